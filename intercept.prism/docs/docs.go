@@ -15,9 +15,147 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/cookies": {
+            "get": {
+                "description": "Returns the unexpired cookies in the jar of a workspace and session, as sent by REST and GraphQL requests with the same ` + "`" + `workspace_id` + "`" + ` and ` + "`" + `session_id` + "`" + `",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "List a session's cookies",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace ID",
+                        "name": "workspace_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "session_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cookies, empty when the jar does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing workspace_id or session_id",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Stores a cookie in a session's jar, replacing the one with the same name, domain and path. Path defaults to /, and an ` + "`" + `expires` + "`" + ` in the past removes the cookie",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Add or edit a cookie",
+                "parameters": [
+                    {
+                        "description": "Cookie to store",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The jar after the update",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid cookie or missing workspace_id or session_id",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "With ` + "`" + `name` + "`" + `, removes that cookie, narrowed to ` + "`" + `domain` + "`" + ` and ` + "`" + `path` + "`" + ` when given. Without it the whole jar of the session is dropped",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Delete cookies or clear a jar",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace ID",
+                        "name": "workspace_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "session_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cookie name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cookie domain",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cookie path",
+                        "name": "path",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Remaining cookies and how many were removed",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing workspace_id or session_id",
+                        "schema": {
+                            "$ref": "#/definitions/model.CookieJarResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/graphql/": {
             "post": {
-                "description": "Proxies a GraphQL request to a target endpoint with tracing enabled",
+                "description": "Proxies a GraphQL request to a target endpoint with tracing enabled.\n` + "`" + `{{name}}` + "`" + ` references and ` + "`" + `{{$helper}}` + "`" + ` calls in the URL, headers, query and variables are resolved from ` + "`" + `environment` + "`" + ` first, as for REST requests.\n` + "`" + `auth` + "`" + ` is applied to every HTTP request of the operation, as for REST requests.\n` + "`" + `assertions` + "`" + ` are checked against the response as for REST requests.\n` + "`" + `extract` + "`" + ` pulls values out of the response into variables and optionally saves them to ` + "`" + `save_to_environment` + "`" + `, as for REST requests.\nA ` + "`" + `session_id` + "`" + `, which requires a ` + "`" + `workspace_id` + "`" + `, sends and stores cookies through the session's jar, shared with REST requests of the same workspace and session.\nAn errors array in the response body is returned in ` + "`" + `errors` + "`" + ` and marks the span and execution as failed, even with HTTP 200.\nResolver timings in ` + "`" + `extensions.tracing` + "`" + ` (Apollo tracing) or ` + "`" + `extensions.ftv1` + "`" + ` (federated trace) become child spans of the request span; set ` + "`" + `include_trace` + "`" + ` to ask Apollo subgraphs for ftv1.\nThe operation is sent as a JSON POST by default. ` + "`" + `method: GET` + "`" + ` encodes it in the query string, ` + "`" + `batch` + "`" + ` sends several operations as a JSON array, ` + "`" + `uploads` + "`" + ` switches to the GraphQL multipart request spec, and ` + "`" + `persisted_query` + "`" + ` sends the sha256 hash first and the query only when the server has not seen it.\nThe query's depth, field, alias and fragment counts and an estimated complexity are returned in ` + "`" + `analysis` + "`" + ` and tagged on the span. With an introspected schema, list fields multiply the cost of their selections by their first/last/limit argument (10 if absent), honouring ` + "`" + `@listSize` + "`" + ` and ` + "`" + `@cost` + "`" + ` where the schema declares them.\nWhen the endpoint's schema has been introspected, the query and variables are validated first and errors are returned without contacting the target unless ` + "`" + `skip_validation` + "`" + ` is set",
                 "consumes": [
                     "application/json"
                 ],
@@ -47,7 +185,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request body, or the query failed validation",
                         "schema": {
                             "$ref": "#/definitions/model.GraphQLResponse"
                         }
@@ -61,9 +199,171 @@ const docTemplate = `{
                 }
             }
         },
+        "/graphql/diff": {
+            "post": {
+                "description": "Compares a base and a target schema and classifies each change as breaking, dangerous or safe, e.g. a removed field, a changed argument type or a removed enum value.\nEach side is an endpoint (its cached introspection snapshot, or a live introspection with ` + "`" + `refresh` + "`" + `), SDL, or an introspection ` + "`" + `__schema` + "`" + ` object.\nAn endpoint is introspected with its headers and ` + "`" + `auth` + "`" + `, which can reference ` + "`" + `environment` + "`" + ` variables, and shares the snapshots of POST /graphql/introspect.\nSet ` + "`" + `fail_on` + "`" + ` to ` + "`" + `breaking` + "`" + ` or ` + "`" + `dangerous` + "`" + ` to get a 409 with the report when such changes are found, for use in CI",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "GraphQL"
+                ],
+                "summary": "Compare two GraphQL schemas",
+                "parameters": [
+                    {
+                        "description": "Schemas to compare",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Change report",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, schema, auth or unresolved variable",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "OAuth2 needs an interactive authorization first",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Changes at or above fail_on were found",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "An endpoint failed or does not allow introspection",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSchemaDiffResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql/introspect": {
+            "post": {
+                "description": "Runs the standard introspection query against the target with the request's headers and ` + "`" + `auth` + "`" + ` and returns the schema as JSON and SDL.\nThe URL, headers and auth can reference ` + "`" + `environment` + "`" + ` variables, as in a GraphQL request.\nSchemas are cached per URL, headers and credentials, and a GraphQL request sent with the same ones is validated against the cached schema; set ` + "`" + `refresh` + "`" + ` to fetch again.\n` + "`" + `changed` + "`" + ` reports whether a fetched schema differs from the previous one",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "GraphQL"
+                ],
+                "summary": "Introspect a GraphQL schema",
+                "parameters": [
+                    {
+                        "description": "Endpoint and headers",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLIntrospectRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Schema as JSON and SDL",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLIntrospectResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, unresolved variable or invalid auth",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLIntrospectResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "OAuth2 needs an interactive authorization first",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLIntrospectResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "The target or the OAuth2 token endpoint failed, or the target does not allow introspection",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLIntrospectResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql/subscribe": {
+            "post": {
+                "description": "Runs a subscription over WebSocket using graphql-transport-ws (default) or the legacy subscriptions-transport-ws protocol and streams the results as Server-Sent Events.\nEvents: ` + "`" + `connected` + "`" + ` (after connection_ack), ` + "`" + `next` + "`" + ` (model.GraphQLSubscriptionEvent for every payload), ` + "`" + `error` + "`" + ` (errors sent by the server) and a final ` + "`" + `end` + "`" + ` (model.GraphQLResponse with the subscription span).\nWith a ` + "`" + `session_id` + "`" + ` the handshake sends the session's cookies and stores those it sets.\nThe subscription ends when the server completes it, after ` + "`" + `max_events` + "`" + ` payloads, after ` + "`" + `timeout_ms` + "`" + ` or when the client disconnects",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "GraphQL"
+                ],
+                "summary": "Execute a GraphQL subscription",
+                "parameters": [
+                    {
+                        "description": "GraphQL subscription with WebSocket protocol and connection params",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "SSE stream of connected, next, error and end events",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLSubscriptionEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, URL or protocol, or the query failed validation",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "WebSocket connection failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "The server refused the WebSocket handshake or negotiated another subprotocol",
+                        "schema": {
+                            "$ref": "#/definitions/model.GraphQLResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/grpc/": {
             "post": {
-                "description": "Proxies a unary gRPC request to a target server using an uploaded .proto file definition",
+                "description": "Proxies a unary gRPC request to a target server using uploaded .proto files, a protoset or server reflection.\nThe call is made over native gRPC, gRPC-Web, gRPC-Web-text or the Connect protocol depending on ` + "`" + `protocol` + "`" + `.\n` + "`" + `{{name}}` + "`" + ` references and ` + "`" + `{{$helper}}` + "`" + ` calls in the server address, metadata and body are resolved from ` + "`" + `environment` + "`" + ` first, as for REST requests\n` + "`" + `auth` + "`" + ` of type basic, bearer or apikey (in a header) is sent as metadata; other types are rejected with 400\n` + "`" + `assertions` + "`" + ` are checked as for REST requests: status compares the gRPC code or its name, headers include trailers and paths apply to the protojson body\n` + "`" + `extract` + "`" + ` works as for REST requests, and a ` + "`" + `field` + "`" + ` source walks the response message by proto or JSON field names, e.g. ` + "`" + `user.tokens[0].value` + "`" + ` or ` + "`" + `labels[\"env\"]` + "`" + `",
                 "consumes": [
                     "application/json"
                 ],
@@ -76,7 +376,7 @@ const docTemplate = `{
                 "summary": "Execute a gRPC request",
                 "parameters": [
                     {
-                        "description": "gRPC request configuration with .proto file content",
+                        "description": "gRPC request configuration with proto sources",
                         "name": "request",
                         "in": "body",
                         "required": true,
@@ -107,9 +407,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/rest/": {
+        "/grpc/health": {
             "post": {
-                "description": "Proxies an HTTP request to a target URL with tracing enabled",
+                "description": "Calls grpc.health.v1.Health/Check (and optionally Watch) for each service on a fresh connection.\nReports per-service serving status, connectivity state transitions and handshake timing, and records the probe as an Execution and span.\nstatus_code is 0 when every service is SERVING, the failing RPC's code when a check errored, and UNAVAILABLE (14) otherwise",
                 "consumes": [
                     "application/json"
                 ],
@@ -117,246 +417,2518 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "REST"
+                    "gRPC"
                 ],
-                "summary": "Execute an HTTP request",
+                "summary": "Probe a gRPC target with the standard health service",
                 "parameters": [
                     {
-                        "description": "Request configuration",
+                        "description": "Health probe configuration",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.RestRequest"
+                            "$ref": "#/definitions/model.GRPCHealthRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successful response with tracing info",
+                        "description": "Probe result with tracing info",
                         "schema": {
-                            "$ref": "#/definitions/model.RestResponse"
+                            "$ref": "#/definitions/model.GRPCHealthResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request body or TLS configuration",
                         "schema": {
-                            "$ref": "#/definitions/model.RestResponse"
+                            "$ref": "#/definitions/model.GRPCHealthResponse"
                         }
                     },
                     "500": {
-                        "description": "Request execution failed",
+                        "description": "Failed to create the connection",
                         "schema": {
-                            "$ref": "#/definitions/model.RestResponse"
+                            "$ref": "#/definitions/model.GRPCHealthResponse"
                         }
                     }
                 }
             }
         },
-        "/v1/traces": {
+        "/grpc/services": {
+            "get": {
+                "description": "Lists the services and methods a gRPC target exposes through server reflection (v1 or v1alpha).\nUse POST /grpc/services for targets that need metadata, auth or environment variables",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "gRPC"
+                ],
+                "summary": "List gRPC services via reflection",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target server address (host:port)",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Connect using TLS with the system root CAs",
+                        "name": "use_tls",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Skip TLS certificate verification",
+                        "name": "insecure_skip_verify",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Override the :authority pseudo-header",
+                        "name": "authority",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Services and methods",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing address or invalid TLS configuration",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    },
+                    "502": {
+                        "description": "Connecting to the target or reflection failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Receives OpenTelemetry traces in protobuf or JSON format",
+                "description": "Same as GET /grpc/services, for targets whose reflection API needs credentials. The reflection calls\ncarry ` + "`" + `metadata` + "`" + ` and the ` + "`" + `auth` + "`" + ` block, and both can reference ` + "`" + `environment` + "`" + ` variables.\nProto sources and the message body are ignored",
                 "consumes": [
-                    "application/x-protobuf",
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Tracing"
+                    "gRPC"
+                ],
+                "summary": "List gRPC services via reflection, with metadata and auth",
+                "parameters": [
+                    {
+                        "description": "Target address, TLS, metadata, auth and environment",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCRequest"
+                        }
+                    }
                 ],
-                "summary": "Receive OTLP traces",
                 "responses": {
                     "200": {
-                        "description": "Traces accepted",
+                        "description": "Services and methods",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/model.GRPCServiceList"
                         }
                     },
                     "400": {
-                        "description": "Invalid trace data",
+                        "description": "Missing address, unresolved variable or invalid TLS or auth configuration",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    },
+                    "401": {
+                        "description": "OAuth2 needs an interactive authorization first",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    },
+                    "502": {
+                        "description": "Connecting to the target, fetching an OAuth2 token or reflection failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCServiceList"
+                        }
+                    }
+                }
+            }
+        },
+        "/grpc/stream": {
+            "post": {
+                "description": "Proxies a server-streaming, client-streaming or bidirectional gRPC call and streams the result as Server-Sent Events.\nRequest messages are taken from ` + "`" + `messages` + "`" + ` (or ` + "`" + `body` + "`" + ` for server-streaming). Events are emitted as they happen:\n` + "`" + `headers` + "`" + ` (response headers), ` + "`" + `message` + "`" + ` (model.GRPCStreamMessage, for every message sent and received) and a final ` + "`" + `end` + "`" + ` (model.GRPCResponse with status, trailers and the stream span)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "gRPC"
+                ],
+                "summary": "Execute a streaming gRPC request",
+                "parameters": [
+                    {
+                        "description": "gRPC request configuration with proto sources and messages",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "SSE stream of headers, message and end events",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCStreamMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, proto file or messages",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Request execution failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grpc/template": {
+            "post": {
+                "description": "Builds a protojson skeleton of a method's input message from uploaded proto sources or server reflection.\nEvery field is set to a placeholder (enums to their first value, repeated fields to one element). Only the first field of each oneof is included; the others are listed in ` + "`" + `fields` + "`" + ` with ` + "`" + `in_body` + "`" + ` false",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "gRPC"
+                ],
+                "summary": "Generate a request template for a gRPC method",
+                "parameters": [
+                    {
+                        "description": "Proto sources (or use_reflection), service and method",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Request template",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCMessageTemplate"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, proto file, service or method",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCMessageTemplate"
+                        }
+                    },
+                    "500": {
+                        "description": "Reflection failed on the target",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCMessageTemplate"
+                        }
+                    }
+                }
+            }
+        },
+        "/grpc/transcode": {
+            "post": {
+                "description": "Maps a gRPC request (service, method, body) onto the REST path, query and body of the method's google.api.http binding,\nor routes an HTTP request (` + "`" + `http` + "`" + `) to the gRPC method whose binding matches it, the way grpc-gateway does.\n` + "`" + `mode` + "`" + ` rest or grpc calls that side, compare calls both and checks that the responses are equivalent; without a mode only the translation is returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "gRPC"
+                ],
+                "summary": "Transcode between a gRPC method and its google.api.http mapping",
+                "parameters": [
+                    {
+                        "description": "gRPC or HTTP request with proto sources and the sides to call",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCTranscodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Translated request and the responses of the called sides",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCTranscodeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, missing binding or no matching route",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCTranscodeResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Reflection or a call failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.GRPCTranscodeResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth2/authorize": {
+            "post": {
+                "description": "Returns the provider's authorization URL with a PKCE S256 challenge. Open it in a browser; the provider redirects to ` + "`" + `redirect_uri` + "`" + `, by default this server's /oauth2/callback, which exchanges the code and caches the token for the workspace.\nRequests using the same configuration then send that token, refreshing it when it expires",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth2"
+                ],
+                "summary": "Start an OAuth2 authorization code flow",
+                "parameters": [
+                    {
+                        "description": "authorization_code configuration",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2AuthorizeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "URL to open",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2AuthorizeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid configuration",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2AuthorizeResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth2/callback": {
+            "get": {
+                "description": "Receives the authorization code from the provider, exchanges it with the PKCE verifier and caches the token. Answers with a page the user can close",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "OAuth2"
+                ],
+                "summary": "OAuth2 redirect target",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "State returned by /oauth2/authorize",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Error reported by the provider",
+                        "name": "error",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Authorization complete",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown state or the provider refused",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "502": {
+                        "description": "The code exchange failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth2/token": {
+            "post": {
+                "description": "Returns the cached token for the workspace and configuration, refreshing it when it has expired, or runs the client_credentials, password or refresh_token grant.\nExecutors do the same for an ` + "`" + `auth` + "`" + ` block of type ` + "`" + `oauth2` + "`" + `, so calling this first is only needed to inspect the token or to warm the cache. Token endpoint calls are returned as spans",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth2"
+                ],
+                "summary": "Fetch an OAuth2 access token",
+                "parameters": [
+                    {
+                        "description": "Token configuration",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Access token",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid configuration",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2TokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "An authorization_code configuration has not been authorized yet",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2TokenResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "The token endpoint failed or refused the grant",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2TokenResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth2/tokens": {
+            "delete": {
+                "description": "Drops every cached access and refresh token of a workspace, so the next request runs its grant again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth2"
+                ],
+                "summary": "Forget cached OAuth2 tokens",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workspace ID",
+                        "name": "workspace_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Tokens dropped",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2ClearResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing workspace_id",
+                        "schema": {
+                            "$ref": "#/definitions/model.OAuth2ClearResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "model.GRPCRequest": {
+        },
+        "/rest/": {
+            "post": {
+                "description": "Proxies an HTTP request to a target URL with tracing enabled.\n` + "`" + `{{name}}` + "`" + ` in the URL, headers and body is replaced with the value from ` + "`" + `environment` + "`" + `, and helpers such as ` + "`" + `{{$uuid}}` + "`" + `, ` + "`" + `{{$timestamp}}` + "`" + `, ` + "`" + `{{$isoTimestamp}}` + "`" + `, ` + "`" + `{{$randomInt 1 10}}` + "`" + `, ` + "`" + `{{$base64 text}}` + "`" + ` and ` + "`" + `{{$hmac sha256 key message}}` + "`" + ` are evaluated. When an ` + "`" + `environment` + "`" + ` is sent, unresolved variables are rejected with 400; without one they are sent as written\n` + "`" + `auth` + "`" + ` adds Basic, Bearer, API key (header or query), Digest, AWS Signature V4 or HMAC credentials to the resolved request. Digest answers the server's 401 challenge with a second request. Secrets never appear in span tags\nWith a ` + "`" + `session_id` + "`" + `, which requires a ` + "`" + `workspace_id` + "`" + `, cookies set by responses are kept in a jar for the workspace and session and sent with later requests that use it, following domain, path, secure and expiry rules. See /cookies\n` + "`" + `assertions` + "`" + ` check the status, headers, JSONPath or XPath values, body regex, JSON Schema, size or latency of the response. Results are returned and stored with the execution, and any failure marks the span as failed\nPaths are a subset, and unsupported syntax is rejected with 400. JSONPath supports ` + "`" + `$` + "`" + `, ` + "`" + `.name` + "`" + `, ` + "`" + `['name']` + "`" + `, ` + "`" + `[n]` + "`" + `, ` + "`" + `[-n]` + "`" + `, ` + "`" + `[start:end]` + "`" + `, ` + "`" + `*` + "`" + `, ` + "`" + `..` + "`" + ` and unions like ` + "`" + `[0,2]` + "`" + `, but not filter expressions ` + "`" + `[?(...)]` + "`" + ` or script expressions. XPath supports ` + "`" + `/` + "`" + `, ` + "`" + `//` + "`" + `, names, ` + "`" + `*` + "`" + `, ` + "`" + `@attr` + "`" + `, ` + "`" + `text()` + "`" + `, ` + "`" + `node()` + "`" + `, ` + "`" + `.` + "`" + `, ` + "`" + `..` + "`" + ` and ` + "`" + `count(path)` + "`" + `, with the predicates ` + "`" + `[n]` + "`" + `, ` + "`" + `[last()]` + "`" + `, ` + "`" + `[@a]` + "`" + `, ` + "`" + `[@a='v']` + "`" + `, ` + "`" + `[name='v']` + "`" + `, ` + "`" + `contains()` + "`" + ` and ` + "`" + `starts-with()` + "`" + `; other axes, functions and operators are not supported. JSON Schema checks type, enum, const, the numeric, string, array and object constraints, allOf, anyOf, oneOf, not and local ` + "`" + `$ref` + "`" + ` (` + "`" + `#/...` + "`" + `); ` + "`" + `format` + "`" + `, remote ` + "`" + `$ref` + "`" + `, ` + "`" + `if` + "`" + `/` + "`" + `then` + "`" + `/` + "`" + `else` + "`" + `, ` + "`" + `dependentSchemas` + "`" + ` and ` + "`" + `unevaluatedProperties` + "`" + ` are ignored\n` + "`" + `extract` + "`" + ` pulls values out of the response by JSONPath or XPath (the subsets above), regex (first capture group) or header name into the ` + "`" + `variables` + "`" + ` of ` + "`" + `extracted` + "`" + `, to be sent in the ` + "`" + `environment` + "`" + ` of the next request. With ` + "`" + `save_to_environment` + "`" + `, they are also written to that environment of ` + "`" + `workspace_id` + "`" + `; values are never put in span tags\nAn ` + "`" + `oauth2` + "`" + ` auth block fetches an access token with its grant and caches it per ` + "`" + `workspace_id` + "`" + `, which it requires, until it expires, refreshing it when possible; token endpoint calls are returned as child spans",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "REST"
+                ],
+                "summary": "Execute an HTTP request",
+                "parameters": [
+                    {
+                        "description": "Request configuration",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.RestRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response with tracing info",
+                        "schema": {
+                            "$ref": "#/definitions/model.RestResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/model.RestResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "An oauth2 authorization_code configuration has not been authorized yet",
+                        "schema": {
+                            "$ref": "#/definitions/model.RestResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Request execution failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.RestResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "The OAuth2 token endpoint failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.RestResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/traces": {
+            "post": {
+                "description": "Receives OpenTelemetry traces in protobuf or JSON format",
+                "consumes": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tracing"
+                ],
+                "summary": "Receive OTLP traces",
+                "responses": {
+                    "200": {
+                        "description": "Traces accepted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid trace data",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "model.Assertion": {
+            "type": "object",
+            "properties": {
+                "expected": {
+                    "description": "Compared as a number when both sides are numeric. Bytes for size, milliseconds for latency",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Label for the result, generated from the other fields when empty",
+                    "type": "string"
+                },
+                "operator": {
+                    "description": "eq, neq, lt, lte, gt, gte, contains, not_contains, matches, not_matches, exists or not_exists",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Header name, JSONPath or XPath expression",
+                    "type": "string"
+                },
+                "schema": {
+                    "description": "JSON Schema the body must satisfy, for the schema type",
+                    "type": "object"
+                },
+                "type": {
+                    "description": "status, header, jsonpath, xpath, regex, schema, size or latency",
+                    "type": "string"
+                }
+            }
+        },
+        "model.AssertionResult": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "string"
+                },
+                "expected": {
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Why it failed, e.g. the schema violations or a body that is not JSON",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "operator": {
+                    "type": "string"
+                },
+                "passed": {
+                    "type": "boolean"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.AuthConfig": {
+            "type": "object",
+            "properties": {
+                "access_key_id": {
+                    "description": "awsv4",
+                    "type": "string"
+                },
+                "algorithm": {
+                    "description": "sha1, sha256 (default) or sha512",
+                    "type": "string"
+                },
+                "encoding": {
+                    "description": "hex (default) or base64",
+                    "type": "string"
+                },
+                "in": {
+                    "description": "\"header\" (default) or \"query\"",
+                    "type": "string"
+                },
+                "key": {
+                    "description": "apikey",
+                    "type": "string"
+                },
+                "oauth2": {
+                    "description": "oauth2: an access token is fetched, cached per workspace (workspace_id is required) and sent like a bearer token",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.OAuth2Config"
+                        }
+                    ]
+                },
+                "password": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "scheme": {
+                    "description": "Authorization scheme, defaults to Bearer",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "hmac: signs \"METHOD\\nPATH?QUERY\\nTIMESTAMP\\nBODY\" with the secret",
+                    "type": "string"
+                },
+                "secret_access_key": {
+                    "type": "string"
+                },
+                "service": {
+                    "description": "Signing name, e.g. execute-api, s3 or es",
+                    "type": "string"
+                },
+                "session_token": {
+                    "type": "string"
+                },
+                "signature_header": {
+                    "description": "Defaults to X-Signature",
+                    "type": "string"
+                },
+                "timestamp_header": {
+                    "description": "Unix seconds, defaults to X-Timestamp",
+                    "type": "string"
+                },
+                "token": {
+                    "description": "bearer",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "basic, bearer, apikey, digest, awsv4, hmac or oauth2",
+                    "type": "string"
+                },
+                "username": {
+                    "description": "basic and digest",
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.CertificateInfo": {
+            "type": "object",
+            "properties": {
+                "dns_names": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "not_after": {
+                    "description": "RFC 3339",
+                    "type": "string"
+                },
+                "not_before": {
+                    "description": "RFC 3339",
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Cookie": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "description": "Without a leading dot",
+                    "type": "string"
+                },
+                "expires": {
+                    "description": "RFC 3339, empty for a session cookie",
+                    "type": "string"
+                },
+                "host_only": {
+                    "description": "Sent to Domain only, not its subdomains",
+                    "type": "boolean"
+                },
+                "http_only": {
+                    "description": "Informational, the data plane has no scripts",
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Defaults to /",
+                    "type": "string"
+                },
+                "same_site": {
+                    "description": "Informational: Lax, Strict or None",
+                    "type": "string"
+                },
+                "secure": {
+                    "description": "Sent over https and wss only",
+                    "type": "boolean"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.CookieJarResponse": {
+            "type": "object",
+            "properties": {
+                "cookies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Cookie"
+                    }
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "removed": {
+                    "description": "Cookies dropped by a delete",
+                    "type": "integer"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "workspace_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.CookieJarUpdate": {
+            "type": "object",
+            "properties": {
+                "cookie": {
+                    "$ref": "#/definitions/model.Cookie"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "workspace_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.ExtractResult": {
+            "type": "object",
+            "properties": {
+                "environment_id": {
+                    "description": "Set when the request named an environment to save into",
+                    "type": "string"
+                },
+                "failures": {
+                    "description": "\"variable: reason\" for extractions that found no value",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "readonly": {
+                    "description": "Variables not saved because their row is read-only",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "save_error": {
+                    "description": "Why nothing was saved",
+                    "type": "string"
+                },
+                "saved": {
+                    "type": "boolean"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "model.Extraction": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "jsonpath, xpath, regex, header or field (gRPC only)",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "JSONPath, XPath, pattern, header name or message field path such as user.tokens[0]",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Masked in the environment when saved, the value is never put in span tags",
+                    "type": "boolean"
+                },
+                "variable": {
+                    "description": "Name of the variable",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCCallOptions": {
+            "type": "object",
+            "properties": {
+                "compression": {
+                    "description": "\"gzip\" or \"identity\" (default)",
+                    "type": "string"
+                },
+                "deadline_ms": {
+                    "description": "Defaults to 30s for unary calls and 5m for streams",
+                    "type": "integer"
+                },
+                "max_recv_message_size": {
+                    "description": "in bytes, 4MB by default for native gRPC",
+                    "type": "integer"
+                },
+                "max_send_message_size": {
+                    "description": "in bytes, unlimited by default",
+                    "type": "integer"
+                },
+                "user_agent": {
+                    "description": "Prepended to the grpc-go user agent for native gRPC",
+                    "type": "string"
+                },
+                "wait_for_ready": {
+                    "description": "Block until the connection is ready instead of failing fast (native gRPC only)",
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.GRPCConnectionState": {
+            "type": "object",
+            "properties": {
+                "elapsed_us": {
+                    "description": "Since the probe started",
+                    "type": "integer"
+                },
+                "state": {
+                    "description": "IDLE, CONNECTING, READY, TRANSIENT_FAILURE or SHUTDOWN",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCErrorDetail": {
+            "type": "object",
+            "properties": {
+                "raw": {
+                    "description": "Base64 encoded bytes, only set when the type is unknown",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Fully-qualified message name",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Detail as JSON, empty when the type is unknown",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCHTTPRule": {
+            "type": "object",
+            "properties": {
+                "binding": {
+                    "type": "integer"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path template",
+                    "type": "string"
+                },
+                "response_body": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCHealthRequest": {
+            "type": "object",
+            "properties": {
+                "authority": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "server_address": {
+                    "type": "string"
+                },
+                "services": {
+                    "description": "Service names to check, empty means the whole server (\"\")",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "timeout_ms": {
+                    "description": "Connect and Check deadline, defaults to 10s",
+                    "type": "integer"
+                },
+                "tls": {
+                    "$ref": "#/definitions/model.GRPCTLSConfig"
+                },
+                "use_tls": {
+                    "type": "boolean"
+                },
+                "watch": {
+                    "description": "Also stream status changes via Health/Watch",
+                    "type": "boolean"
+                },
+                "watch_duration_ms": {
+                    "description": "How long to watch, defaults to 5s, at most 60s",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.GRPCHealthResponse": {
+            "type": "object",
+            "properties": {
+                "connection_states": {
+                    "description": "Connectivity transitions of the probe connection",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCConnectionState"
+                    }
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "execution_id": {
+                    "type": "string"
+                },
+                "handshake_duration": {
+                    "type": "string"
+                },
+                "handshake_us": {
+                    "type": "integer"
+                },
+                "healthy": {
+                    "description": "Every checked service is SERVING",
+                    "type": "boolean"
+                },
+                "request_duration": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "Database record IDs",
+                    "type": "string"
+                },
+                "server_address": {
+                    "type": "string"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCServiceHealth"
+                    }
+                },
+                "span_id": {
+                    "type": "string"
+                },
+                "spans": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.SpanInfo"
+                    }
+                },
+                "status_code": {
+                    "type": "integer"
+                },
+                "tls": {
+                    "$ref": "#/definitions/model.GRPCTLSInfo"
+                },
+                "trace_id": {
+                    "description": "Distributed tracing",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCHealthUpdate": {
+            "type": "object",
+            "properties": {
+                "elapsed_us": {
+                    "description": "Since the probe started",
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCMessageTemplate": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "description": "protojson with every field set to a placeholder",
+                    "type": "string"
+                },
+                "client_streaming": {
+                    "type": "boolean"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "fields": {
+                    "description": "Annotations for the fields in Body, in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCTemplateField"
+                    }
+                },
+                "input_type": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCMethodInfo": {
+            "type": "object",
+            "properties": {
+                "client_streaming": {
+                    "type": "boolean"
+                },
+                "full_name": {
+                    "description": "\"/package.Service/Method\"",
+                    "type": "string"
+                },
+                "input_type": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "output_type": {
+                    "type": "string"
+                },
+                "server_streaming": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.GRPCRequest": {
+            "type": "object",
+            "properties": {
+                "assertions": {
+                    "description": "Checks run against the response of a unary call. Status compares the gRPC code or its\nname, headers include trailers and paths apply to the protojson body",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Assertion"
+                    }
+                },
+                "auth": {
+                    "description": "Credentials applied after templating. gRPC calls send basic, bearer or a header apikey\nas metadata; the REST side of a transcoded call takes any type",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
+                "authority": {
+                    "description": "Overrides the :authority pseudo-header",
+                    "type": "string"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "collection_id": {
+                    "type": "string"
+                },
+                "created_by_id": {
+                    "type": "string"
+                },
+                "environment": {
+                    "description": "Values for {{name}} references in the server address, metadata, body and messages",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "extract": {
+                    "description": "Values pulled out of the response of a unary call into variables, saved to\nSaveToEnvironment, an environment of the workspace, when it is set. field paths walk\nthe response message by proto or JSON field names",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Extraction"
+                    }
+                },
+                "messages": {
+                    "description": "JSON messages sent in order on client and bidi streams",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "method": {
+                    "type": "string"
+                },
+                "options": {
+                    "description": "Per-call settings, defaults match a plain grpc-go client",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCCallOptions"
+                        }
+                    ]
+                },
+                "proto_file": {
+                    "type": "string"
+                },
+                "proto_files": {
+                    "description": "Import path -\u003e .proto content",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "proto_zip": {
+                    "description": "Base64 zip archive of .proto files",
+                    "type": "string"
+                },
+                "protocol": {
+                    "description": "grpc (default), grpc-web, grpc-web-text or connect",
+                    "type": "string"
+                },
+                "protoset": {
+                    "description": "Base64 FileDescriptorSet, takes precedence over sources",
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "save_to_environment": {
+                    "type": "string"
+                },
+                "server_address": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "tls": {
+                    "description": "Only used when UseTLS is set",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCTLSConfig"
+                        }
+                    ]
+                },
+                "use_reflection": {
+                    "description": "Resolve descriptors via server reflection instead of ProtoFile",
+                    "type": "boolean"
+                },
+                "use_tls": {
+                    "type": "boolean"
+                },
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCResponse": {
+            "type": "object",
+            "properties": {
+                "assertions": {
+                    "description": "Results of the request's assertions, in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.AssertionResult"
+                    }
+                },
+                "body": {
+                    "type": "string"
+                },
+                "error_details": {
+                    "description": "google.rpc.Status details attached to a failed RPC",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCErrorDetail"
+                    }
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "execution_id": {
+                    "type": "string"
+                },
+                "extracted": {
+                    "description": "Variables pulled out of the response",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.ExtractResult"
+                        }
+                    ]
+                },
+                "messages_received": {
+                    "type": "integer"
+                },
+                "messages_sent": {
+                    "description": "Message counts, only set for streaming calls",
+                    "type": "integer"
+                },
+                "request_duration": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "Database record IDs",
+                    "type": "string"
+                },
+                "request_size": {
+                    "description": "in bytes",
+                    "type": "integer"
+                },
+                "response_headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "response_size": {
+                    "description": "in bytes",
+                    "type": "integer"
+                },
+                "response_trailers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "span_id": {
+                    "type": "string"
+                },
+                "spans": {
+                    "description": "Local spans captured for this request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.SpanInfo"
+                    }
+                },
+                "status_code": {
+                    "type": "integer"
+                },
+                "status_name": {
+                    "type": "string"
+                },
+                "timings": {
+                    "description": "Setup time spent before the RPC, not included in Duration",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCTimings"
+                        }
+                    ]
+                },
+                "tls": {
+                    "description": "Negotiated TLS details, only set for TLS connections",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCTLSInfo"
+                        }
+                    ]
+                },
+                "trace_id": {
+                    "description": "Distributed tracing",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCServiceHealth": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "SERVING, NOT_SERVING, SERVICE_UNKNOWN or UNKNOWN",
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "gRPC code of the Check call",
+                    "type": "integer"
+                },
+                "updates": {
+                    "description": "Statuses received from Watch",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCHealthUpdate"
+                    }
+                },
+                "watch_error": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCServiceInfo": {
+            "type": "object",
+            "properties": {
+                "methods": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCMethodInfo"
+                    }
+                },
+                "name": {
+                    "description": "Fully-qualified, e.g. \"helloworld.Greeter\"",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCServiceList": {
+            "type": "object",
+            "properties": {
+                "error_msg": {
+                    "type": "string"
+                },
+                "server_address": {
+                    "type": "string"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GRPCServiceInfo"
+                    }
+                }
+            }
+        },
+        "model.GRPCStreamMessage": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "direction": {
+                    "description": "\"sent\" or \"received\"",
+                    "type": "string"
+                },
+                "elapsed_us": {
+                    "description": "Since the stream was opened",
+                    "type": "integer"
+                },
+                "index": {
+                    "description": "Position within its direction, starting at 0",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "Encoded protobuf size in bytes",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.GRPCTLSConfig": {
+            "type": "object",
+            "properties": {
+                "ca_cert": {
+                    "description": "PEM encoded CA bundle",
+                    "type": "string"
+                },
+                "client_cert": {
+                    "description": "PEM encoded, enables mTLS together with ClientKey",
+                    "type": "string"
+                },
+                "client_key": {
+                    "description": "PEM encoded",
+                    "type": "string"
+                },
+                "insecure_skip_verify": {
+                    "type": "boolean"
+                },
+                "server_name": {
+                    "description": "SNI and certificate verification name",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCTLSInfo": {
+            "type": "object",
+            "properties": {
+                "cipher_suite": {
+                    "type": "string"
+                },
+                "mutual_tls": {
+                    "type": "boolean"
+                },
+                "negotiated_protocol": {
+                    "description": "ALPN, \"h2\" for gRPC",
+                    "type": "string"
+                },
+                "peer_certificates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.CertificateInfo"
+                    }
+                },
+                "server_name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCTemplateField": {
+            "type": "object",
+            "properties": {
+                "enum_values": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "in_body": {
+                    "description": "False for oneof alternatives left out of Body",
+                    "type": "boolean"
+                },
+                "label": {
+                    "description": "\"repeated\", \"map\" or \"optional\"",
+                    "type": "string"
+                },
+                "oneof": {
+                    "description": "Name of the oneof the field belongs to",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "JSON path in Body, e.g. \"address.lines[]\"",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Scalar kind, or the full name of the message or enum",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCTimings": {
+            "type": "object",
+            "properties": {
+                "compile_duration": {
+                    "description": "Descriptor compile or reflection time",
+                    "type": "string"
+                },
+                "compile_us": {
+                    "type": "integer"
+                },
+                "connection_reused": {
+                    "type": "boolean"
+                },
+                "descriptor_cache_hit": {
+                    "type": "boolean"
+                },
+                "dial_duration": {
+                    "description": "Time until the connection was READY",
+                    "type": "string"
+                },
+                "dial_us": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.GRPCTranscodeHTTPRequest": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "Path and query string, relative to the gateway URL",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCTranscodeRequest": {
+            "type": "object",
+            "properties": {
+                "assertions": {
+                    "description": "Checks run against the response of a unary call. Status compares the gRPC code or its\nname, headers include trailers and paths apply to the protojson body",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Assertion"
+                    }
+                },
+                "auth": {
+                    "description": "Credentials applied after templating. gRPC calls send basic, bearer or a header apikey\nas metadata; the REST side of a transcoded call takes any type",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
+                "authority": {
+                    "description": "Overrides the :authority pseudo-header",
+                    "type": "string"
+                },
+                "binding": {
+                    "description": "0 for the main rule, n for additional_bindings[n-1]",
+                    "type": "integer"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "collection_id": {
+                    "type": "string"
+                },
+                "created_by_id": {
+                    "type": "string"
+                },
+                "environment": {
+                    "description": "Values for {{name}} references in the server address, metadata, body and messages",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "extract": {
+                    "description": "Values pulled out of the response of a unary call into variables, saved to\nSaveToEnvironment, an environment of the workspace, when it is set. field paths walk\nthe response message by proto or JSON field names",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Extraction"
+                    }
+                },
+                "gateway_url": {
+                    "description": "Base URL of the REST side, e.g. a grpc-gateway",
+                    "type": "string"
+                },
+                "headers": {
+                    "description": "Sent with the REST call",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "http": {
+                    "description": "REST call to route to its gRPC method, replaces service/method/body",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCTranscodeHTTPRequest"
+                        }
+                    ]
+                },
+                "messages": {
+                    "description": "JSON messages sent in order on client and bidi streams",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "method": {
+                    "type": "string"
+                },
+                "mode": {
+                    "description": "\"\" translates only, \"rest\", \"grpc\" or \"compare\" calls those sides",
+                    "type": "string"
+                },
+                "options": {
+                    "description": "Per-call settings, defaults match a plain grpc-go client",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCCallOptions"
+                        }
+                    ]
+                },
+                "proto_file": {
+                    "type": "string"
+                },
+                "proto_files": {
+                    "description": "Import path -\u003e .proto content",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "proto_zip": {
+                    "description": "Base64 zip archive of .proto files",
+                    "type": "string"
+                },
+                "protocol": {
+                    "description": "grpc (default), grpc-web, grpc-web-text or connect",
+                    "type": "string"
+                },
+                "protoset": {
+                    "description": "Base64 FileDescriptorSet, takes precedence over sources",
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "save_to_environment": {
+                    "type": "string"
+                },
+                "server_address": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "tls": {
+                    "description": "Only used when UseTLS is set",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GRPCTLSConfig"
+                        }
+                    ]
+                },
+                "use_reflection": {
+                    "description": "Resolve descriptors via server reflection instead of ProtoFile",
+                    "type": "boolean"
+                },
+                "use_tls": {
+                    "type": "boolean"
+                },
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GRPCTranscodeResponse": {
+            "type": "object",
+            "properties": {
+                "differences": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "equivalent": {
+                    "description": "Only set by the compare mode",
+                    "type": "boolean"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "grpc": {
+                    "$ref": "#/definitions/model.GRPCResponse"
+                },
+                "grpc_body": {
+                    "description": "protojson request message",
+                    "type": "string"
+                },
+                "http_request": {
+                    "$ref": "#/definitions/model.GRPCTranscodeHTTPRequest"
+                },
+                "http_rule": {
+                    "$ref": "#/definitions/model.GRPCHTTPRule"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "mode": {
+                    "type": "string"
+                },
+                "rest": {
+                    "$ref": "#/definitions/model.RestResponse"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "span_id": {
+                    "type": "string"
+                },
+                "spans": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.SpanInfo"
+                    }
+                },
+                "trace_id": {
+                    "description": "Distributed tracing, the calls are child spans of SpanID",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "extensions.code, e.g. UNAUTHENTICATED",
+                    "type": "string"
+                },
+                "extensions": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "locations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLLocation"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "operation": {
+                    "description": "Index of the operation in a batch",
+                    "type": "integer"
+                },
+                "path": {
+                    "description": "Dotted response path, e.g. books.0.author",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLIntrospectRequest": {
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "description": "Credentials applied after templating",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
+                "environment": {
+                    "description": "Values for {{name}} references in the URL, headers and auth",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "refresh": {
+                    "description": "Fetch again even when the schema is cached",
+                    "type": "boolean"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLIntrospectResponse": {
+            "type": "object",
+            "properties": {
+                "cached": {
+                    "description": "Served from the cache without contacting the target",
+                    "type": "boolean"
+                },
+                "changed": {
+                    "description": "The schema differs from the previous fetch",
+                    "type": "boolean"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "fetched_at": {
+                    "description": "RFC 3339",
+                    "type": "string"
+                },
+                "hash": {
+                    "description": "SHA-256 of the SDL",
+                    "type": "string"
+                },
+                "previous_hash": {
+                    "type": "string"
+                },
+                "request_duration": {
+                    "type": "string"
+                },
+                "schema": {
+                    "description": "The __schema object of the introspection result",
+                    "type": "object"
+                },
+                "sdl": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "types": {
+                    "description": "Named types, excluding introspection and built-in scalars",
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLLocation": {
+            "type": "object",
+            "properties": {
+                "column": {
+                    "type": "integer"
+                },
+                "line": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.GraphQLOperation": {
+            "type": "object",
+            "properties": {
+                "operation_name": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "model.GraphQLQueryAnalysis": {
+            "type": "object",
+            "properties": {
+                "aliases": {
+                    "description": "Fields selected under a different name",
+                    "type": "integer"
+                },
+                "complexity": {
+                    "description": "Estimated cost, see SchemaWeighted",
+                    "type": "integer"
+                },
+                "depth": {
+                    "description": "Deepest field nesting, 1 for top-level fields",
+                    "type": "integer"
+                },
+                "fields": {
+                    "description": "Fields selected, counting each fragment use",
+                    "type": "integer"
+                },
+                "fragment_spreads": {
+                    "description": "...Name uses",
+                    "type": "integer"
+                },
+                "fragments": {
+                    "description": "Distinct named fragments used",
+                    "type": "integer"
+                },
+                "inline_fragments": {
+                    "description": "... on Type uses",
+                    "type": "integer"
+                },
+                "schema_weighted": {
+                    "description": "The complexity uses the introspected schema: list fields multiply their selections by the\nfirst/last/limit argument, or @listSize, and @cost weights replace the default cost of 1.\nWithout a schema the complexity is the field count",
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.GraphQLRequest": {
+            "type": "object",
+            "properties": {
+                "assertions": {
+                    "description": "Checks run against the response. Not evaluated for subscriptions",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Assertion"
+                    }
+                },
+                "auth": {
+                    "description": "Credentials applied after templating. Secrets are never stored in span tags",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
+                "batch": {
+                    "description": "Operations sent together as a JSON array, instead of query",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLOperation"
+                    }
+                },
+                "collection_id": {
+                    "type": "string"
+                },
+                "connection_params": {
+                    "description": "Payload of connection_init, e.g. an auth token",
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "created_by_id": {
+                    "type": "string"
+                },
+                "environment": {
+                    "description": "Values for {{name}} references in the URL, headers, query and variables",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "extract": {
+                    "description": "Values pulled out of the response into variables, returned in the response and saved\nto SaveToEnvironment, an environment of the workspace, when it is set. Not run for\nsubscriptions",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Extraction"
+                    }
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "include_trace": {
+                    "description": "Send apollo-federation-include-trace: ftv1 so Apollo subgraphs return resolver timings",
+                    "type": "boolean"
+                },
+                "max_events": {
+                    "description": "Complete the subscription after this many events",
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "Transport variants. A request is a JSON POST of query unless one of these is set",
+                    "type": "string"
+                },
+                "operation_name": {
+                    "type": "string"
+                },
+                "persisted_query": {
+                    "description": "Automatic Persisted Queries: send the sha256 hash first and the query only if the server asks for it",
+                    "type": "boolean"
+                },
+                "protocol": {
+                    "description": "Subscriptions over WebSocket (/graphql/subscribe)",
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "save_to_environment": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "description": "Cookie jar shared by requests with the same workspace and session, none when empty. Requires workspace_id",
+                    "type": "string"
+                },
+                "skip_validation": {
+                    "description": "Send the query as-is, even when an introspected schema is cached for the endpoint.\nUseful for servers with directives or extensions that introspection does not expose",
+                    "type": "boolean"
+                },
+                "timeout_ms": {
+                    "description": "Subscription lifetime, defaults to 5m",
+                    "type": "integer"
+                },
+                "uploads": {
+                    "description": "Files sent with the GraphQL multipart request spec",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLUpload"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens and cookie jars",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLResponse": {
+            "type": "object",
+            "properties": {
+                "analysis": {
+                    "description": "Cost of the query document, measured before sending",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.GraphQLQueryAnalysis"
+                        }
+                    ]
+                },
+                "assertions": {
+                    "description": "Results of the request's assertions, in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.AssertionResult"
+                    }
+                },
+                "attempts": {
+                    "description": "HTTP requests made, 2 after a persisted query miss",
+                    "type": "integer"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "end_reason": {
+                    "description": "complete, max_events, timeout, client_closed, error or connection_closed",
+                    "type": "string"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors returned by the server in the response body, usually with HTTP 200",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLError"
+                    }
+                },
+                "events": {
+                    "description": "next payloads received",
+                    "type": "integer"
+                },
+                "execution_id": {
+                    "type": "string"
+                },
+                "extracted": {
+                    "description": "Variables pulled out of the response",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.ExtractResult"
+                        }
+                    ]
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "partial_data": {
+                    "description": "data was returned alongside errors",
+                    "type": "boolean"
+                },
+                "persisted_query": {
+                    "description": "hit, registered (sent again with the query) or unsupported",
+                    "type": "string"
+                },
+                "protocol": {
+                    "description": "Subscription summary, sent in the final \"end\" event of /graphql/subscribe",
+                    "type": "string"
+                },
+                "request_duration": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "Database record IDs",
+                    "type": "string"
+                },
+                "request_size": {
+                    "description": "in bytes",
+                    "type": "integer"
+                },
+                "response_size": {
+                    "description": "in bytes",
+                    "type": "integer"
+                },
+                "span_id": {
+                    "type": "string"
+                },
+                "spans": {
+                    "description": "Local spans captured for this request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.SpanInfo"
+                    }
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "trace_id": {
+                    "description": "Distributed tracing",
+                    "type": "string"
+                },
+                "transport": {
+                    "description": "Transport details",
+                    "type": "string"
+                },
+                "validated": {
+                    "description": "Client-side validation against the introspected schema",
+                    "type": "boolean"
+                },
+                "validation_errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLValidationError"
+                    }
+                }
+            }
+        },
+        "model.GraphQLSchemaChange": {
             "type": "object",
             "properties": {
-                "body": {
+                "criticality": {
+                    "description": "breaking, dangerous or safe",
                     "type": "string"
                 },
-                "collection_id": {
+                "message": {
                     "type": "string"
                 },
-                "created_by_id": {
+                "path": {
+                    "description": "e.g. Query.books, Query.books.first, Genre.HISTORY or @cached.ttl",
                     "type": "string"
                 },
-                "metadata": {
+                "type": {
+                    "description": "e.g. FIELD_REMOVED, ARG_TYPE_CHANGED, ENUM_VALUE_ADDED",
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLSchemaDiffRequest": {
+            "type": "object",
+            "properties": {
+                "base": {
+                    "$ref": "#/definitions/model.GraphQLSchemaSource"
+                },
+                "environment": {
+                    "description": "Values for {{name}} references in the URLs, headers and auth of both sides",
                     "type": "object",
                     "additionalProperties": {
                         "type": "string"
                     }
                 },
-                "method": {
-                    "type": "string"
-                },
-                "proto_file": {
-                    "type": "string"
-                },
-                "request_id": {
+                "fail_on": {
+                    "description": "\"breaking\" or \"dangerous\": respond 409 when changes at or above this level are found",
                     "type": "string"
                 },
-                "server_address": {
-                    "type": "string"
+                "target": {
+                    "$ref": "#/definitions/model.GraphQLSchemaSource"
                 },
-                "service": {
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens",
                     "type": "string"
-                },
-                "use_tls": {
-                    "type": "boolean"
                 }
             }
         },
-        "model.GRPCResponse": {
+        "model.GraphQLSchemaDiffResponse": {
             "type": "object",
             "properties": {
-                "body": {
+                "base_hash": {
+                    "description": "SHA-256 of the SDL, as printed from introspection or as given",
                     "type": "string"
                 },
+                "breaking": {
+                    "type": "integer"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLSchemaChange"
+                    }
+                },
+                "dangerous": {
+                    "type": "integer"
+                },
                 "error_msg": {
                     "type": "string"
                 },
-                "execution_id": {
-                    "type": "string"
+                "failed": {
+                    "description": "fail_on was reached",
+                    "type": "boolean"
                 },
-                "request_duration": {
-                    "type": "string"
+                "identical": {
+                    "type": "boolean"
                 },
-                "request_id": {
-                    "description": "Database record IDs",
+                "request_duration": {
                     "type": "string"
                 },
-                "request_size": {
-                    "description": "in bytes",
+                "safe": {
                     "type": "integer"
                 },
-                "response_headers": {
+                "target_hash": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLSchemaSource": {
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "description": "Credentials for the endpoint, applied after templating",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
+                "headers": {
                     "type": "object",
                     "additionalProperties": {
                         "type": "string"
                     }
                 },
-                "response_size": {
-                    "description": "in bytes",
-                    "type": "integer"
+                "refresh": {
+                    "description": "Introspect the endpoint even when a snapshot is cached",
+                    "type": "boolean"
                 },
-                "response_trailers": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
+                "schema": {
+                    "description": "An introspection __schema object",
+                    "type": "object"
                 },
-                "span_id": {
+                "sdl": {
                     "type": "string"
                 },
-                "spans": {
-                    "description": "Local spans captured for this request",
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GraphQLSubscriptionEvent": {
+            "type": "object",
+            "properties": {
+                "elapsed_us": {
+                    "description": "Since the subscription was started",
+                    "type": "integer"
+                },
+                "errors": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/model.SpanInfo"
+                        "$ref": "#/definitions/model.GraphQLError"
                     }
                 },
-                "status_code": {
+                "index": {
+                    "description": "Position in the subscription, starting at 0",
                     "type": "integer"
                 },
-                "status_name": {
-                    "type": "string"
+                "interval_us": {
+                    "description": "Since the previous event",
+                    "type": "integer"
                 },
-                "trace_id": {
-                    "description": "Distributed tracing",
+                "payload": {
+                    "description": "The execution result with data, errors and extensions",
                     "type": "string"
+                },
+                "size": {
+                    "description": "Payload size in bytes",
+                    "type": "integer"
                 }
             }
         },
-        "model.GraphQLRequest": {
+        "model.GraphQLUpload": {
             "type": "object",
             "properties": {
-                "collection_id": {
+                "content": {
+                    "description": "base64",
                     "type": "string"
                 },
-                "created_by_id": {
+                "content_type": {
+                    "description": "Defaults to application/octet-stream",
                     "type": "string"
                 },
-                "headers": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
+                "filename": {
+                    "type": "string"
                 },
-                "operation_name": {
+                "path": {
+                    "description": "Object path of the variable, e.g. variables.file, variables.files.0 or 1.variables.file in a batch",
                     "type": "string"
+                }
+            }
+        },
+        "model.GraphQLValidationError": {
+            "type": "object",
+            "properties": {
+                "locations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.GraphQLLocation"
+                    }
                 },
-                "query": {
+                "message": {
                     "type": "string"
                 },
-                "request_id": {
+                "operation": {
+                    "description": "Index of the operation in a batch",
+                    "type": "integer"
+                },
+                "path": {
+                    "description": "e.g. variable.filter.genre for variable errors",
                     "type": "string"
                 },
-                "url": {
+                "rule": {
+                    "description": "Name of the failed validation rule, e.g. FieldsOnCorrectType",
                     "type": "string"
+                }
+            }
+        },
+        "model.OAuth2AuthorizeRequest": {
+            "type": "object",
+            "properties": {
+                "oauth2": {
+                    "$ref": "#/definitions/model.OAuth2Config"
                 },
-                "variables": {
-                    "type": "object",
-                    "additionalProperties": true
+                "workspace_id": {
+                    "type": "string"
                 }
             }
         },
-        "model.GraphQLResponse": {
+        "model.OAuth2AuthorizeResponse": {
             "type": "object",
             "properties": {
-                "body": {
+                "authorization_url": {
                     "type": "string"
                 },
                 "error_msg": {
                     "type": "string"
                 },
-                "execution_id": {
+                "redirect_uri": {
                     "type": "string"
                 },
-                "headers": {
+                "state": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.OAuth2ClearResponse": {
+            "type": "object",
+            "properties": {
+                "cleared": {
+                    "description": "Number of cached tokens dropped",
+                    "type": "integer"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.OAuth2Config": {
+            "type": "object",
+            "properties": {
+                "audience": {
+                    "type": "string"
+                },
+                "authorization_url": {
+                    "description": "authorization_code grant with PKCE, started through POST /oauth2/authorize",
+                    "type": "string"
+                },
+                "client_auth": {
+                    "description": "\"basic\" (default) sends the client credentials in an Authorization header, \"body\" as form fields",
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "client_secret": {
+                    "type": "string"
+                },
+                "extra_params": {
+                    "description": "Additional form fields for the token request",
                     "type": "object",
                     "additionalProperties": {
                         "type": "string"
                     }
                 },
-                "request_duration": {
+                "grant_type": {
+                    "description": "client_credentials, password, refresh_token or authorization_code",
                     "type": "string"
                 },
-                "request_id": {
-                    "description": "Database record IDs",
+                "password": {
                     "type": "string"
                 },
-                "request_size": {
-                    "description": "in bytes",
-                    "type": "integer"
+                "redirect_uri": {
+                    "description": "Defaults to this server's /oauth2/callback",
+                    "type": "string"
                 },
-                "response_size": {
-                    "description": "in bytes",
-                    "type": "integer"
+                "refresh_token": {
+                    "description": "refresh_token grant, also used once to seed the cache",
+                    "type": "string"
                 },
-                "span_id": {
+                "scope": {
+                    "description": "Space separated",
+                    "type": "string"
+                },
+                "token_url": {
+                    "type": "string"
+                },
+                "username": {
+                    "description": "password grant",
+                    "type": "string"
+                }
+            }
+        },
+        "model.OAuth2TokenRequest": {
+            "type": "object",
+            "properties": {
+                "force_refresh": {
+                    "description": "Skip the cache and ask the token endpoint",
+                    "type": "boolean"
+                },
+                "oauth2": {
+                    "$ref": "#/definitions/model.OAuth2Config"
+                },
+                "workspace_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.OAuth2TokenResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "error_msg": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "RFC 3339, empty when the server gave no lifetime",
+                    "type": "string"
+                },
+                "refreshable": {
+                    "description": "A refresh token is cached alongside",
+                    "type": "boolean"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "source": {
+                    "description": "cache, fetched or refreshed",
                     "type": "string"
                 },
                 "spans": {
-                    "description": "Local spans captured for this request",
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/model.SpanInfo"
@@ -365,8 +2937,10 @@ const docTemplate = `{
                 "status": {
                     "type": "integer"
                 },
+                "token_type": {
+                    "type": "string"
+                },
                 "trace_id": {
-                    "description": "Distributed tracing",
                     "type": "string"
                 }
             }
@@ -374,6 +2948,21 @@ const docTemplate = `{
         "model.RestRequest": {
             "type": "object",
             "properties": {
+                "assertions": {
+                    "description": "Checks run against the response",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Assertion"
+                    }
+                },
+                "auth": {
+                    "description": "Credentials applied after templating. Secrets are never stored in span tags",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.AuthConfig"
+                        }
+                    ]
+                },
                 "body": {
                     "type": "string"
                 },
@@ -383,6 +2972,20 @@ const docTemplate = `{
                 "created_by_id": {
                     "type": "string"
                 },
+                "environment": {
+                    "description": "Values for {{name}} references in the URL, headers and body",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "extract": {
+                    "description": "Values pulled out of the response into variables, returned in the response and saved\nto SaveToEnvironment, an environment of the workspace, when it is set",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Extraction"
+                    }
+                },
                 "headers": {
                     "type": "object",
                     "additionalProperties": {
@@ -395,14 +2998,32 @@ const docTemplate = `{
                 "request_id": {
                     "type": "string"
                 },
+                "save_to_environment": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "description": "Cookie jar shared by requests with the same workspace and session, none when empty. Requires workspace_id",
+                    "type": "string"
+                },
                 "url": {
                     "type": "string"
+                },
+                "workspace_id": {
+                    "description": "Scopes cached OAuth2 tokens and cookie jars",
+                    "type": "string"
                 }
             }
         },
         "model.RestResponse": {
             "type": "object",
             "properties": {
+                "assertions": {
+                    "description": "Results of the request's assertions, in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.AssertionResult"
+                    }
+                },
                 "body": {
                     "type": "string"
                 },
@@ -412,6 +3033,14 @@ const docTemplate = `{
                 "execution_id": {
                     "type": "string"
                 },
+                "extracted": {
+                    "description": "Variables pulled out of the response",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.ExtractResult"
+                        }
+                    ]
+                },
                 "headers": {
                     "type": "object",
                     "additionalProperties": {
@@ -452,6 +3081,24 @@ const docTemplate = `{
                 }
             }
         },
+        "model.SpanEvent": {
+            "type": "object",
+            "properties": {
+                "attributes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "description": "Unix microseconds",
+                    "type": "integer"
+                }
+            }
+        },
         "model.SpanInfo": {
             "type": "object",
             "properties": {
@@ -459,6 +3106,12 @@ const docTemplate = `{
                     "description": "Microseconds",
                     "type": "integer"
                 },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.SpanEvent"
+                    }
+                },
                 "operation": {
                     "type": "string"
                 },
@@ -0,0 +1,354 @@
+// Package assertions checks responses against the assertions of a request after it
+// completes, so that runs without the UI verify more than the status code
+package assertions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// Response is what assertions are evaluated against
+type Response struct {
+	StatusCode int
+	StatusName string            // gRPC code name, compared when the expected status is not a number
+	Headers    map[string]string // Looked up case-insensitively
+	Body       []byte
+	Latency    time.Duration
+}
+
+var operators = map[string]bool{
+	"eq": true, "neq": true, "lt": true, "lte": true, "gt": true, "gte": true,
+	"contains": true, "not_contains": true, "matches": true, "not_matches": true,
+	"exists": true, "not_exists": true,
+}
+
+// operator returns the assertion's operator, or the one its type implies
+func operator(a model.Assertion) string {
+	if a.Operator != "" {
+		return strings.ToLower(a.Operator)
+	}
+	switch strings.ToLower(a.Type) {
+	case "header", "jsonpath", "xpath":
+		if a.Expected == "" {
+			return "exists"
+		}
+	case "regex":
+		return "matches"
+	case "size", "latency":
+		return "lte"
+	case "schema":
+		return ""
+	}
+	return "eq"
+}
+
+// Validate rejects assertions that could never be evaluated, before the request is sent
+func Validate(list []model.Assertion) error {
+	for i, a := range list {
+		if err := validate(a); err != nil {
+			return fmt.Errorf("assertion %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validate(a model.Assertion) error {
+	op := operator(a)
+	switch strings.ToLower(a.Type) {
+	case "status", "regex":
+	case "header":
+		if a.Path == "" {
+			return fmt.Errorf("header requires a path with the header name")
+		}
+	case "jsonpath":
+		if _, err := parseJSONPath(a.Path); err != nil {
+			return err
+		}
+	case "xpath":
+		if _, err := parseXPath(a.Path); err != nil {
+			return err
+		}
+	case "size", "latency":
+		if _, err := strconv.ParseFloat(a.Expected, 64); err != nil {
+			return fmt.Errorf("%s expects a number, got '%s'", a.Type, a.Expected)
+		}
+	case "schema":
+		var schema any
+		if err := json.Unmarshal(a.Schema, &schema); err != nil {
+			return fmt.Errorf("schema is not valid JSON: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown type '%s', expected status, header, jsonpath, xpath, regex, schema, size or latency", a.Type)
+	}
+
+	if !operators[op] {
+		return fmt.Errorf("unknown operator '%s'", a.Operator)
+	}
+	switch op {
+	case "exists", "not_exists":
+	case "matches", "not_matches":
+		if _, err := regexp.Compile(a.Expected); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	case "lt", "lte", "gt", "gte":
+		if _, err := strconv.ParseFloat(a.Expected, 64); err != nil {
+			return fmt.Errorf("%s expects a number, got '%s'", op, a.Expected)
+		}
+	}
+	return nil
+}
+
+// Evaluate runs every assertion against the response, in order
+func Evaluate(list []model.Assertion, resp Response) []model.AssertionResult {
+	if len(list) == 0 {
+		return nil
+	}
+	results := make([]model.AssertionResult, len(list))
+	for i, a := range list {
+		results[i] = evaluate(a, resp)
+	}
+	return results
+}
+
+// Failed counts the assertions that did not pass
+func Failed(results []model.AssertionResult) int {
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+func evaluate(a model.Assertion, resp Response) model.AssertionResult {
+	result := model.AssertionResult{
+		Name:     a.Name,
+		Type:     strings.ToLower(a.Type),
+		Path:     a.Path,
+		Operator: operator(a),
+		Expected: a.Expected,
+	}
+	if result.Name == "" {
+		result.Name = describe(result)
+	}
+
+	// values holds what the path selected, none when nothing matched
+	var values []any
+	switch result.Type {
+	case "status":
+		if _, err := strconv.Atoi(a.Expected); err != nil && resp.StatusName != "" {
+			values = []any{resp.StatusName}
+		} else {
+			values = []any{json.Number(strconv.Itoa(resp.StatusCode))}
+		}
+	case "header":
+		for key, value := range resp.Headers {
+			if strings.EqualFold(key, a.Path) {
+				values = []any{value}
+				break
+			}
+		}
+	case "jsonpath":
+		doc, err := DecodeJSON(resp.Body)
+		if err != nil {
+			result.Message = fmt.Sprintf("Body is not JSON: %v", err)
+			return result
+		}
+		values, err = SelectJSON(doc, a.Path)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+	case "xpath":
+		nodes, err := SelectXML(resp.Body, a.Path)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		for _, node := range nodes {
+			values = append(values, node)
+		}
+	case "regex":
+		values = []any{string(resp.Body)}
+	case "size":
+		values = []any{json.Number(strconv.Itoa(len(resp.Body)))}
+	case "latency":
+		values = []any{json.Number(strconv.FormatInt(resp.Latency.Milliseconds(), 10))}
+	case "schema":
+		doc, err := DecodeJSON(resp.Body)
+		if err != nil {
+			result.Actual = "invalid"
+			result.Message = fmt.Sprintf("Body is not JSON: %v", err)
+			return result
+		}
+		violations, err := ValidateSchema(a.Schema, doc)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		result.Passed = len(violations) == 0
+		result.Actual = "valid"
+		if !result.Passed {
+			result.Actual = fmt.Sprintf("%d violations", len(violations))
+			if len(violations) > 10 {
+				violations = append(violations[:10], "...")
+			}
+			result.Message = strings.Join(violations, "; ")
+		}
+		return result
+	}
+
+	result.Passed, result.Message = compare(values, result.Operator, a.Expected)
+	switch len(values) {
+	case 0:
+	case 1:
+		result.Actual = FormatValue(values[0])
+	default:
+		result.Actual = FormatValue(values)
+	}
+	return result
+}
+
+// describe names an assertion after what it checks, e.g. "jsonpath $.id exists"
+func describe(r model.AssertionResult) string {
+	parts := []string{r.Type}
+	for _, part := range []string{r.Path, r.Operator, r.Expected} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// compare applies the operator to the selected values. Several values are compared as a list
+func compare(values []any, op, expected string) (bool, string) {
+	switch op {
+	case "exists":
+		return len(values) > 0, ""
+	case "not_exists":
+		if len(values) > 0 {
+			return false, "A value is present"
+		}
+		return true, ""
+	}
+	if len(values) == 0 {
+		return false, "No value found"
+	}
+
+	var value any = values
+	if len(values) == 1 {
+		value = values[0]
+	}
+	switch op {
+	case "eq":
+		return equal(value, expected), ""
+	case "neq":
+		return !equal(value, expected), ""
+	case "lt", "lte", "gt", "gte":
+		actual, ok := number(value)
+		if !ok {
+			return false, fmt.Sprintf("%s is not a number", FormatValue(value))
+		}
+		limit, _ := strconv.ParseFloat(expected, 64)
+		switch op {
+		case "lt":
+			return actual < limit, ""
+		case "lte":
+			return actual <= limit, ""
+		case "gt":
+			return actual > limit, ""
+		}
+		return actual >= limit, ""
+	case "contains":
+		return contains(value, expected), ""
+	case "not_contains":
+		return !contains(value, expected), ""
+	case "matches", "not_matches":
+		pattern, err := regexp.Compile(expected)
+		if err != nil {
+			return false, err.Error()
+		}
+		return pattern.MatchString(FormatValue(value)) == (op == "matches"), ""
+	}
+	return false, fmt.Sprintf("unknown operator '%s'", op)
+}
+
+// equal compares numerically when both sides are numbers, then as text, then as JSON
+func equal(value any, expected string) bool {
+	if actual, ok := number(value); ok {
+		if want, err := strconv.ParseFloat(expected, 64); err == nil {
+			return actual == want
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s == expected
+	}
+	if FormatValue(value) == expected {
+		return true
+	}
+	want, err := DecodeJSON([]byte(expected))
+	return err == nil && FormatValue(want) == FormatValue(value)
+}
+
+// contains looks for an element of a list, a key of an object or a substring
+func contains(value any, expected string) bool {
+	switch v := value.(type) {
+	case []any:
+		for _, element := range v {
+			if equal(element, expected) {
+				return true
+			}
+		}
+		return false
+	case map[string]any:
+		_, ok := v[expected]
+		return ok
+	}
+	return strings.Contains(FormatValue(value), expected)
+}
+
+// number reads JSON numbers and numeric strings such as header values
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// FormatValue renders a value for comparison and for the result: strings as they are, anything
+// else as JSON
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// DecodeJSON keeps numbers as json.Number so large integers are compared and shown exactly
+func DecodeJSON(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
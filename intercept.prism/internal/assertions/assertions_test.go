@@ -0,0 +1,173 @@
+package assertions
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+var testResponse = Response{
+	StatusCode: 201,
+	Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8", "X-Rate-Remaining": "42"},
+	Body:       []byte(`{"id":9007199254740993,"user":{"name":"Ada","roles":["admin","dev"]},"items":[{"price":5},{"price":12.5}],"active":true,"deleted":null}`),
+	Latency:    180 * time.Millisecond,
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		assertion model.Assertion
+		passed    bool
+		actual    string
+	}{
+		{model.Assertion{Type: "status", Expected: "201"}, true, "201"},
+		{model.Assertion{Type: "status", Operator: "lt", Expected: "300"}, true, "201"},
+		{model.Assertion{Type: "status", Expected: "200"}, false, "201"},
+		{model.Assertion{Type: "header", Path: "content-type", Operator: "contains", Expected: "json"}, true, "application/json; charset=utf-8"},
+		{model.Assertion{Type: "header", Path: "X-Rate-Remaining", Operator: "gte", Expected: "10"}, true, "42"},
+		{model.Assertion{Type: "header", Path: "ETag"}, false, ""},
+		{model.Assertion{Type: "header", Path: "ETag", Operator: "not_exists"}, true, ""},
+		{model.Assertion{Type: "jsonpath", Path: "$.id", Expected: "9007199254740993"}, true, "9007199254740993"},
+		{model.Assertion{Type: "jsonpath", Path: "$.user.name", Expected: "Ada"}, true, "Ada"},
+		{model.Assertion{Type: "jsonpath", Path: "user.roles", Operator: "contains", Expected: "dev"}, true, `["admin","dev"]`},
+		{model.Assertion{Type: "jsonpath", Path: "$.items[*].price", Expected: "[5,12.5]"}, true, `[5,12.5]`},
+		{model.Assertion{Type: "jsonpath", Path: "$.items[-1].price", Operator: "gt", Expected: "10"}, true, "12.5"},
+		{model.Assertion{Type: "jsonpath", Path: "$.active", Expected: "true"}, true, "true"},
+		{model.Assertion{Type: "jsonpath", Path: "$.deleted", Expected: "null"}, true, "null"},
+		{model.Assertion{Type: "jsonpath", Path: "$.missing"}, false, ""},
+		{model.Assertion{Type: "regex", Expected: `"name":"A\w+"`}, true, ""},
+		{model.Assertion{Type: "regex", Operator: "not_matches", Expected: `error`}, true, ""},
+		{model.Assertion{Type: "size", Expected: "100"}, false, ""},
+		{model.Assertion{Type: "latency", Expected: "200"}, true, "180"},
+		{model.Assertion{Type: "latency", Operator: "lt", Expected: "100"}, false, "180"},
+	}
+	for _, tt := range tests {
+		if err := Validate([]model.Assertion{tt.assertion}); err != nil {
+			t.Errorf("%+v: unexpected validation error %v", tt.assertion, err)
+			continue
+		}
+		result := Evaluate([]model.Assertion{tt.assertion}, testResponse)[0]
+		if result.Passed != tt.passed {
+			t.Errorf("%s: expected passed=%v, got %+v", result.Name, tt.passed, result)
+		}
+		if tt.actual != "" && result.Actual != tt.actual {
+			t.Errorf("%s: expected actual %q, got %q", result.Name, tt.actual, result.Actual)
+		}
+	}
+}
+
+func TestEvaluate_GRPCStatusName(t *testing.T) {
+	resp := Response{StatusCode: 5, StatusName: "NOT_FOUND"}
+	results := Evaluate([]model.Assertion{
+		{Type: "status", Expected: "NOT_FOUND"},
+		{Type: "status", Expected: "5"},
+		{Name: "found", Type: "status", Expected: "OK"},
+	}, resp)
+	if !results[0].Passed || !results[1].Passed || results[2].Passed {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if results[2].Name != "found" || results[0].Name != "status eq NOT_FOUND" {
+		t.Errorf("Unexpected names %q %q", results[0].Name, results[2].Name)
+	}
+	if Failed(results) != 1 {
+		t.Errorf("Expected one failure, got %d", Failed(results))
+	}
+}
+
+func TestEvaluate_XPath(t *testing.T) {
+	resp := Response{Body: []byte(`<?xml version="1.0"?>
+<catalog xmlns:bk="urn:books">
+  <bk:book id="b1" lang="en"><title>Go</title><price>30</price></bk:book>
+  <bk:book id="b2" lang="fr"><title>Rust</title><price>45</price></bk:book>
+  <magazine id="m1"><title>Wired</title></magazine>
+</catalog>`)}
+
+	tests := []struct {
+		path     string
+		operator string
+		expected string
+		actual   string
+	}{
+		{"/catalog/book[1]/title", "eq", "Go", "Go"},
+		{"//book[@lang='fr']/title", "eq", "Rust", "Rust"},
+		{"//book[last()]/@id", "eq", "b2", "b2"},
+		{"count(//title)", "eq", "3", "3"},
+		{"//book[@lang='de']", "not_exists", "", ""},
+		{"//book[starts-with(title,'G')]/price", "lt", "40", "30"},
+		{"/catalog/*/@id", "contains", "m1", `["b1","b2","m1"]`},
+		{"//title/text()", "contains", "Wired", `["Go","Rust","Wired"]`},
+	}
+	for _, tt := range tests {
+		a := model.Assertion{Type: "xpath", Path: tt.path, Operator: tt.operator, Expected: tt.expected}
+		if err := Validate([]model.Assertion{a}); err != nil {
+			t.Errorf("%s: unexpected validation error %v", tt.path, err)
+			continue
+		}
+		result := Evaluate([]model.Assertion{a}, resp)[0]
+		if !result.Passed || result.Actual != tt.actual {
+			t.Errorf("%s: expected %q to pass, got %+v", tt.path, tt.actual, result)
+		}
+	}
+}
+
+func TestEvaluate_Schema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["id", "user", "email"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"user": {"$ref": "#/$defs/user"},
+			"items": {"type": "array", "items": {"type": "object", "properties": {"price": {"type": "integer"}}}}
+		},
+		"$defs": {
+			"user": {"type": "object", "properties": {"name": {"type": "string", "minLength": 5}, "roles": {"type": "array", "uniqueItems": true}}, "additionalProperties": false}
+		}
+	}`)
+	result := Evaluate([]model.Assertion{{Type: "schema", Schema: schema}}, testResponse)[0]
+	if result.Passed || result.Actual != "3 violations" {
+		t.Fatalf("Expected 3 violations, got %+v", result)
+	}
+	for _, expected := range []string{`$: missing required property "email"`, "$.items[1].price: expected integer, got number", "$.user.name: length 3 is less than 5"} {
+		if !strings.Contains(result.Message, expected) {
+			t.Errorf("Expected %q in %q", expected, result.Message)
+		}
+	}
+
+	valid := json.RawMessage(`{"type":"object","properties":{"active":{"const":true},"deleted":{"type":["null","string"]}}}`)
+	if result := Evaluate([]model.Assertion{{Type: "schema", Schema: valid}}, testResponse)[0]; !result.Passed || result.Actual != "valid" {
+		t.Errorf("Expected the body to be valid, got %+v", result)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		assertion model.Assertion
+		problem   string
+	}{
+		{model.Assertion{Type: "body"}, "unknown type 'body'"},
+		{model.Assertion{Type: "status", Operator: "approx", Expected: "200"}, "unknown operator 'approx'"},
+		{model.Assertion{Type: "header"}, "header requires a path"},
+		{model.Assertion{Type: "jsonpath", Path: "$.items[?(@.price > 10)]"}, "filter expressions are not supported"},
+		{model.Assertion{Type: "jsonpath", Path: "$.items[0"}, "unclosed ["},
+		{model.Assertion{Type: "xpath", Path: "//book[position() < 3]"}, "unsupported predicate"},
+		{model.Assertion{Type: "regex", Expected: "("}, "invalid pattern"},
+		{model.Assertion{Type: "latency", Expected: "fast"}, "latency expects a number"},
+		{model.Assertion{Type: "status", Operator: "gt", Expected: "ok"}, "gt expects a number"},
+		{model.Assertion{Type: "schema", Schema: json.RawMessage(`{`)}, "schema is not valid JSON"},
+	}
+	for _, tt := range tests {
+		err := Validate([]model.Assertion{{Type: "status", Expected: "200"}, tt.assertion})
+		if err == nil || !strings.Contains(err.Error(), tt.problem) || !strings.HasPrefix(err.Error(), "assertion 2: ") {
+			t.Errorf("%+v: expected %q, got %v", tt.assertion, tt.problem, err)
+		}
+	}
+}
+
+func TestEvaluate_NotJSON(t *testing.T) {
+	result := Evaluate([]model.Assertion{{Type: "jsonpath", Path: "$.id"}}, Response{Body: []byte("<html>")})[0]
+	if result.Passed || !strings.HasPrefix(result.Message, "Body is not JSON") {
+		t.Errorf("Expected a JSON error, got %+v", result)
+	}
+}
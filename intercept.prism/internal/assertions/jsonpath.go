@@ -0,0 +1,275 @@
+package assertions
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonSegment is one step of a JSONPath, e.g. .name, [0], [*] or ..name
+type jsonSegment struct {
+	recursive bool // Applies to the node and all its descendants
+	selectors []jsonSelector
+}
+
+type jsonSelector struct {
+	wildcard   bool
+	name       string
+	index      *int
+	slice      bool
+	start, end *int
+}
+
+// parseJSONPath supports the common subset of JSONPath: $, .name, ['name'], [n], [-n],
+// [start:end], [*], .*, ..name and unions like [0,2]. Filter expressions are not supported
+func parseJSONPath(path string) ([]jsonSegment, error) {
+	p := strings.TrimSpace(path)
+	if p == "" {
+		return nil, fmt.Errorf("jsonpath requires a path")
+	}
+	if p[0] == '$' {
+		p = p[1:]
+	} else if p[0] != '.' && p[0] != '[' {
+		p = "." + p
+	}
+
+	var segments []jsonSegment
+	for p != "" {
+		segment := jsonSegment{}
+		if strings.HasPrefix(p, "..") {
+			// ..name and ..[selectors] apply to every descendant
+			segment.recursive = true
+			p = p[2:]
+			if !strings.HasPrefix(p, "[") {
+				p = "." + p
+			}
+		}
+
+		switch p[0] {
+		case '[':
+			end := closingBracket(p)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in jsonpath '%s'", path)
+			}
+			selectors, err := parseJSONSelectors(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%v in jsonpath '%s'", err, path)
+			}
+			segment.selectors = selectors
+			p = p[end+1:]
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			switch name := p[:end]; name {
+			case "":
+				return nil, fmt.Errorf("empty name in jsonpath '%s'", path)
+			case "*":
+				segment.selectors = []jsonSelector{{wildcard: true}}
+			default:
+				segment.selectors = []jsonSelector{{name: name}}
+			}
+			p = p[end:]
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in jsonpath '%s'", p[0], path)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// closingBracket finds the ] matching the [ at the start of p, skipping quoted names
+func closingBracket(p string) int {
+	var quote byte
+	for i := 1; i < len(p); i++ {
+		switch {
+		case quote != 0:
+			if p[i] == quote {
+				quote = 0
+			}
+		case p[i] == '\'' || p[i] == '"':
+			quote = p[i]
+		case p[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseJSONSelectors(content string) ([]jsonSelector, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "?") {
+		return nil, fmt.Errorf("filter expressions are not supported")
+	}
+
+	var selectors []jsonSelector
+	for _, part := range splitUnion(content) {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "*":
+			selectors = append(selectors, jsonSelector{wildcard: true})
+		case len(part) >= 2 && (part[0] == '\'' || part[0] == '"') && part[len(part)-1] == part[0]:
+			selectors = append(selectors, jsonSelector{name: part[1 : len(part)-1]})
+		case strings.Contains(part, ":"):
+			bounds := strings.SplitN(part, ":", 3)
+			selector := jsonSelector{slice: true}
+			for i, bound := range bounds[:2] {
+				bound = strings.TrimSpace(bound)
+				if bound == "" {
+					continue
+				}
+				n, err := strconv.Atoi(bound)
+				if err != nil {
+					return nil, fmt.Errorf("invalid slice '%s'", part)
+				}
+				if i == 0 {
+					selector.start = &n
+				} else {
+					selector.end = &n
+				}
+			}
+			selectors = append(selectors, selector)
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector '%s'", part)
+			}
+			selectors = append(selectors, jsonSelector{index: &n})
+		}
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("empty []")
+	}
+	return selectors, nil
+}
+
+// splitUnion splits on commas outside quotes
+func splitUnion(content string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(content); i++ {
+		switch {
+		case quote != 0:
+			if content[i] == quote {
+				quote = 0
+			}
+		case content[i] == '\'' || content[i] == '"':
+			quote = content[i]
+		case content[i] == ',':
+			parts = append(parts, content[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, content[start:])
+}
+
+// CheckJSONPath reports whether a path is supported, without a document to select from
+func CheckJSONPath(path string) error {
+	_, err := parseJSONPath(path)
+	return err
+}
+
+// SelectJSON returns the values a JSONPath selects from a decoded document, in document
+// order with object keys sorted. Nothing matching is not an error
+func SelectJSON(doc any, path string) ([]any, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []any{doc}
+	for _, segment := range segments {
+		var next []any
+		for _, node := range nodes {
+			candidates := []any{node}
+			if segment.recursive {
+				candidates = descendants(node, nil)
+			}
+			for _, candidate := range candidates {
+				for _, selector := range segment.selectors {
+					next = append(next, selector.apply(candidate)...)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+func (s jsonSelector) apply(node any) []any {
+	switch v := node.(type) {
+	case map[string]any:
+		if s.wildcard {
+			return objectValues(v)
+		}
+		if s.index == nil && !s.slice {
+			if value, ok := v[s.name]; ok {
+				return []any{value}
+			}
+		}
+	case []any:
+		switch {
+		case s.wildcard:
+			return v
+		case s.index != nil:
+			i := *s.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []any{v[i]}
+			}
+		case s.slice:
+			start, end := 0, len(v)
+			if s.start != nil {
+				start = clampIndex(*s.start, len(v))
+			}
+			if s.end != nil {
+				end = clampIndex(*s.end, len(v))
+			}
+			if start < end {
+				return v[start:end]
+			}
+		}
+	}
+	return nil
+}
+
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	return max(0, min(i, length))
+}
+
+func objectValues(object map[string]any) []any {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		values[i] = object[key]
+	}
+	return values
+}
+
+// descendants lists the node and everything below it, parents first
+func descendants(node any, out []any) []any {
+	out = append(out, node)
+	switch v := node.(type) {
+	case map[string]any:
+		for _, child := range objectValues(v) {
+			out = descendants(child, out)
+		}
+	case []any:
+		for _, child := range v {
+			out = descendants(child, out)
+		}
+	}
+	return out
+}
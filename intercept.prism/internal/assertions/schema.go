@@ -0,0 +1,377 @@
+package assertions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemaValidator checks a document against a JSON Schema. It covers the validation
+// keywords shared by drafts 4 to 2020-12: type, enum, const, the numeric, string, array and
+// object constraints, allOf, anyOf, oneOf, not and local $ref. format, remote $ref,
+// if/then/else, dependentSchemas and unevaluatedProperties are not checked; the /rest/
+// docs list the same limits for users
+type schemaValidator struct {
+	root       any
+	violations []string
+}
+
+// ValidateSchema returns one message per violation, each prefixed with the JSONPath of the
+// offending value
+func ValidateSchema(schema json.RawMessage, doc any) ([]string, error) {
+	root, err := DecodeJSON(schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %v", err)
+	}
+	v := &schemaValidator{root: root}
+	v.validate(root, doc, "$", 0)
+	return v.violations, nil
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+}
+
+// valid runs a subschema on its own, for anyOf, oneOf and not
+func (v *schemaValidator) valid(schema, value any, path string, depth int) bool {
+	sub := &schemaValidator{root: v.root}
+	sub.validate(schema, value, path, depth)
+	return len(sub.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema, value any, path string, depth int) {
+	if depth > 64 {
+		v.fail(path, "schema nesting is too deep, is a $ref recursive?")
+		return
+	}
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]any:
+		v.validateObject(s, value, path, depth)
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, value any, path string, depth int) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.validate(target, value, path, depth+1)
+	}
+
+	if types, ok := s["type"]; ok && !matchesType(types, value) {
+		v.fail(path, "expected %s, got %s", FormatValue(types), jsonType(value))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, option := range enum {
+			if FormatValue(option) == FormatValue(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "%s is not one of %s", FormatValue(value), FormatValue(enum))
+		}
+	}
+	if constant, ok := s["const"]; ok && FormatValue(constant) != FormatValue(value) {
+		v.fail(path, "expected %s, got %s", FormatValue(constant), FormatValue(value))
+	}
+
+	for _, sub := range schemaList(s["allOf"]) {
+		v.validate(sub, value, path, depth+1)
+	}
+	if anyOf := schemaList(s["anyOf"]); anyOf != nil {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "does not match any schema in anyOf")
+		}
+	}
+	if oneOf := schemaList(s["oneOf"]); oneOf != nil {
+		matched := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, value, path, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "matches %d schemas in oneOf, expected exactly 1", matched)
+		}
+	}
+	if not, ok := s["not"]; ok && v.valid(not, value, path, depth+1) {
+		v.fail(path, "must not match the schema in not")
+	}
+
+	switch val := value.(type) {
+	case json.Number:
+		v.validateNumber(s, val, path)
+	case string:
+		v.validateString(s, val, path)
+	case []any:
+		v.validateArray(s, val, path, depth)
+	case map[string]any:
+		v.validateProperties(s, val, path, depth)
+	}
+}
+
+func (v *schemaValidator) validateNumber(s map[string]any, value json.Number, path string) {
+	n, err := value.Float64()
+	if err != nil {
+		return
+	}
+	if limit, ok := schemaNumber(s["minimum"]); ok && n < limit {
+		v.fail(path, "%s is less than the minimum %v", value, limit)
+	}
+	if limit, ok := schemaNumber(s["maximum"]); ok && n > limit {
+		v.fail(path, "%s is greater than the maximum %v", value, limit)
+	}
+	// Draft 4 uses booleans next to minimum and maximum, later drafts numbers
+	if limit, ok := schemaNumber(s["exclusiveMinimum"]); ok && n <= limit {
+		v.fail(path, "%s must be greater than %v", value, limit)
+	} else if exclusive, _ := s["exclusiveMinimum"].(bool); exclusive {
+		if limit, ok := schemaNumber(s["minimum"]); ok && n == limit {
+			v.fail(path, "%s must be greater than %v", value, limit)
+		}
+	}
+	if limit, ok := schemaNumber(s["exclusiveMaximum"]); ok && n >= limit {
+		v.fail(path, "%s must be less than %v", value, limit)
+	} else if exclusive, _ := s["exclusiveMaximum"].(bool); exclusive {
+		if limit, ok := schemaNumber(s["maximum"]); ok && n == limit {
+			v.fail(path, "%s must be less than %v", value, limit)
+		}
+	}
+	if divisor, ok := schemaNumber(s["multipleOf"]); ok && divisor > 0 {
+		if quotient := n / divisor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.fail(path, "%s is not a multiple of %v", value, divisor)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(s map[string]any, value, path string) {
+	length := utf8.RuneCountInString(value)
+	if limit, ok := schemaNumber(s["minLength"]); ok && float64(length) < limit {
+		v.fail(path, "length %d is less than %v", length, limit)
+	}
+	if limit, ok := schemaNumber(s["maxLength"]); ok && float64(length) > limit {
+		v.fail(path, "length %d is greater than %v", length, limit)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "invalid pattern %q: %v", pattern, err)
+		} else if !re.MatchString(value) {
+			v.fail(path, "%q does not match %q", value, pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(s map[string]any, value []any, path string, depth int) {
+	if limit, ok := schemaNumber(s["minItems"]); ok && float64(len(value)) < limit {
+		v.fail(path, "%d items, expected at least %v", len(value), limit)
+	}
+	if limit, ok := schemaNumber(s["maxItems"]); ok && float64(len(value)) > limit {
+		v.fail(path, "%d items, expected at most %v", len(value), limit)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		seen := map[string]bool{}
+		for i, item := range value {
+			key := FormatValue(item)
+			if seen[key] {
+				v.fail(fmt.Sprintf("%s[%d]", path, i), "duplicate item %s", key)
+			}
+			seen[key] = true
+		}
+	}
+
+	// prefixItems (2020-12) or an items array (earlier drafts) describe positions, then
+	// items or additionalItems the rest
+	tuple := schemaList(s["prefixItems"])
+	rest, hasRest := s["items"]
+	if tuple == nil {
+		if list := schemaList(s["items"]); list != nil {
+			tuple = list
+			rest, hasRest = s["additionalItems"]
+		}
+	}
+	for i, item := range value {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(tuple) {
+			v.validate(tuple[i], item, itemPath, depth+1)
+		} else if hasRest {
+			v.validate(rest, item, itemPath, depth+1)
+		}
+	}
+
+	if contains, ok := s["contains"]; ok {
+		found := false
+		for _, item := range value {
+			if v.valid(contains, item, path, depth+1) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "no item matches the schema in contains")
+		}
+	}
+}
+
+func (v *schemaValidator) validateProperties(s map[string]any, value map[string]any, path string, depth int) {
+	if limit, ok := schemaNumber(s["minProperties"]); ok && float64(len(value)) < limit {
+		v.fail(path, "%d properties, expected at least %v", len(value), limit)
+	}
+	if limit, ok := schemaNumber(s["maxProperties"]); ok && float64(len(value)) > limit {
+		v.fail(path, "%d properties, expected at most %v", len(value), limit)
+	}
+	if required, ok := s["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := value[key]; !present {
+					v.fail(path, "missing required property %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]any)
+	patterns, _ := s["patternProperties"].(map[string]any)
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		propertyPath := path + "." + key
+		matched := false
+		if sub, ok := properties[key]; ok {
+			v.validate(sub, value[key], propertyPath, depth+1)
+			matched = true
+		}
+		for pattern, sub := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				v.validate(sub, value[key], propertyPath, depth+1)
+				matched = true
+			}
+		}
+		if additional, ok := s["additionalProperties"]; ok && !matched {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				v.fail(path, "unexpected property %q", key)
+			} else {
+				v.validate(additional, value[key], propertyPath, depth+1)
+			}
+		}
+	}
+}
+
+// resolve follows a local reference such as #/definitions/User or #/$defs/User
+func (v *schemaValidator) resolve(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local $ref is supported, got %q", ref)
+	}
+	pointer, err := url.PathUnescape(strings.TrimPrefix(ref, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q", ref)
+	}
+	target := v.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := target.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("$ref %q not found", ref)
+			}
+			target = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("$ref %q not found", ref)
+			}
+			target = node[i]
+		default:
+			return nil, fmt.Errorf("$ref %q not found", ref)
+		}
+	}
+	return target, nil
+}
+
+func schemaList(value any) []any {
+	list, _ := value.([]any)
+	return list
+}
+
+func schemaNumber(value any) (float64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func matchesType(types, value any) bool {
+	switch t := types.(type) {
+	case string:
+		return isType(t, value)
+	case []any:
+		for _, option := range t {
+			if name, ok := option.(string); ok && isType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, value any) bool {
+	actual := jsonType(value)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+// jsonType names a decoded value's type, with integral numbers as integer
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
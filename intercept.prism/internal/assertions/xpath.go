@@ -0,0 +1,375 @@
+package assertions
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is an element, text or attribute of a parsed document
+type xmlNode struct {
+	kind     xmlKind
+	name     string // Local name, prefixes are ignored
+	value    string // Text and attribute content
+	attrs    []*xmlNode
+	children []*xmlNode
+	parent   *xmlNode
+}
+
+type xmlKind int
+
+const (
+	xmlDocument xmlKind = iota
+	xmlElement
+	xmlText
+	xmlAttr
+)
+
+// stringValue is the text of a node and, for elements, of everything below it
+func (n *xmlNode) stringValue() string {
+	if n.kind == xmlText || n.kind == xmlAttr {
+		return n.value
+	}
+	var b strings.Builder
+	for _, child := range n.children {
+		b.WriteString(child.stringValue())
+	}
+	return b.String()
+}
+
+// parseXML builds a tree leniently, so HTML-ish responses can be queried too
+func parseXML(body []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	root := &xmlNode{kind: xmlDocument}
+	current := root
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlNode{kind: xmlElement, name: t.Name.Local, parent: current}
+			for _, attr := range t.Attr {
+				element.attrs = append(element.attrs, &xmlNode{kind: xmlAttr, name: attr.Name.Local, value: attr.Value, parent: element})
+			}
+			current.children = append(current.children, element)
+			current = element
+		case xml.EndElement:
+			if current.parent != nil {
+				current = current.parent
+			}
+		case xml.CharData:
+			if current != root {
+				current.children = append(current.children, &xmlNode{kind: xmlText, value: string(t), parent: current})
+			}
+		}
+	}
+	for _, child := range root.children {
+		if child.kind == xmlElement {
+			return root, nil
+		}
+	}
+	return nil, fmt.Errorf("no root element")
+}
+
+// xpathExpr is a location path, optionally wrapped in count()
+type xpathExpr struct {
+	count bool
+	steps []xpathStep
+}
+
+type xpathStep struct {
+	descendant bool   // Preceded by //
+	test       string // name, *, @name, @*, text(), node(), . or ..
+	predicates []string
+}
+
+// parseXPath supports location paths with /, //, names, *, @attr, text(), . and .., the
+// predicates [n], [last()], [@attr], [@attr='v'], [name='v'], [contains(x,'v')] and
+// [starts-with(x,'v')], and count(path)
+func parseXPath(path string) (*xpathExpr, error) {
+	p := strings.TrimSpace(path)
+	if p == "" {
+		return nil, fmt.Errorf("xpath requires a path")
+	}
+	expr := &xpathExpr{}
+	if strings.HasPrefix(p, "count(") && strings.HasSuffix(p, ")") {
+		expr.count = true
+		p = strings.TrimSpace(p[len("count(") : len(p)-1])
+	}
+
+	// Relative and absolute paths both start at the document
+	for p != "" {
+		step := xpathStep{}
+		switch {
+		case strings.HasPrefix(p, "//"):
+			step.descendant = true
+			p = p[2:]
+		case strings.HasPrefix(p, "/"):
+			p = p[1:]
+		case len(expr.steps) > 0:
+			return nil, fmt.Errorf("unexpected '%s' in xpath '%s'", p, path)
+		}
+
+		end := strings.IndexAny(p, "/[")
+		if end < 0 {
+			end = len(p)
+		}
+		step.test = strings.TrimSpace(p[:end])
+		if step.test == "" {
+			return nil, fmt.Errorf("empty step in xpath '%s'", path)
+		}
+		if strings.HasSuffix(step.test, ")") && step.test != "text()" && step.test != "node()" {
+			return nil, fmt.Errorf("unsupported function '%s' in xpath '%s'", step.test, path)
+		}
+		p = p[end:]
+
+		for strings.HasPrefix(p, "[") {
+			end := closingBracket(p)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in xpath '%s'", path)
+			}
+			predicate := strings.TrimSpace(p[1:end])
+			if _, err := parsePredicate(predicate); err != nil {
+				return nil, fmt.Errorf("%v in xpath '%s'", err, path)
+			}
+			step.predicates = append(step.predicates, predicate)
+			p = p[end+1:]
+		}
+		expr.steps = append(expr.steps, step)
+	}
+	return expr, nil
+}
+
+// xpathPredicate is a parsed [...] filter
+type xpathPredicate struct {
+	position int    // [n], 0 otherwise
+	last     bool   // [last()]
+	function string // contains or starts-with
+	operand  string // Relative step tested, e.g. @id, name, text() or .
+	operator string // = or !=, empty for an existence test
+	literal  string
+}
+
+func parsePredicate(predicate string) (*xpathPredicate, error) {
+	if n, err := strconv.Atoi(predicate); err == nil {
+		if n < 1 {
+			return nil, fmt.Errorf("positions start at 1")
+		}
+		return &xpathPredicate{position: n}, nil
+	}
+	if predicate == "last()" {
+		return &xpathPredicate{last: true}, nil
+	}
+
+	for _, function := range []string{"contains", "starts-with"} {
+		if strings.HasPrefix(predicate, function+"(") && strings.HasSuffix(predicate, ")") {
+			args := splitUnion(predicate[len(function)+1 : len(predicate)-1])
+			if len(args) != 2 {
+				return nil, fmt.Errorf("%s() takes two arguments", function)
+			}
+			literal, ok := unquote(strings.TrimSpace(args[1]))
+			if !ok {
+				return nil, fmt.Errorf("%s() expects a quoted string", function)
+			}
+			return &xpathPredicate{function: function, operand: strings.TrimSpace(args[0]), literal: literal}, nil
+		}
+	}
+
+	parsed := &xpathPredicate{operand: predicate}
+	for _, operator := range []string{"!=", "="} {
+		if i := strings.Index(predicate, operator); i > 0 {
+			parsed.operand = strings.TrimSpace(predicate[:i])
+			parsed.operator = operator
+			literal := strings.TrimSpace(predicate[i+len(operator):])
+			if unquoted, ok := unquote(literal); ok {
+				literal = unquoted
+			} else if _, err := strconv.ParseFloat(literal, 64); err != nil {
+				return nil, fmt.Errorf("expected a quoted string or number in [%s]", predicate)
+			}
+			parsed.literal = literal
+			break
+		}
+	}
+	if strings.ContainsAny(parsed.operand, "/[()") && parsed.operand != "text()" {
+		return nil, fmt.Errorf("unsupported predicate [%s]", predicate)
+	}
+	return parsed, nil
+}
+
+func unquote(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	return "", false
+}
+
+// CheckXPath reports whether a path is supported, without a document to select from
+func CheckXPath(path string) error {
+	_, err := parseXPath(path)
+	return err
+}
+
+// SelectXML returns the string values of the nodes an XPath selects, or their number for
+// count(). Nothing matching is not an error
+func SelectXML(body []byte, path string) ([]string, error) {
+	expr, err := parseXPath(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXML(body)
+	if err != nil {
+		return nil, fmt.Errorf("Body is not XML: %v", err)
+	}
+
+	nodes := []*xmlNode{root}
+	for _, step := range expr.steps {
+		var next []*xmlNode
+		seen := map[*xmlNode]bool{}
+		for _, context := range nodes {
+			candidates := []*xmlNode{context}
+			if step.descendant {
+				candidates = xmlDescendants(context, nil)
+			}
+			for _, candidate := range candidates {
+				for _, node := range step.apply(candidate) {
+					if !seen[node] {
+						seen[node] = true
+						next = append(next, node)
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+
+	if expr.count {
+		return []string{strconv.Itoa(len(nodes))}, nil
+	}
+	values := make([]string, len(nodes))
+	for i, node := range nodes {
+		values[i] = node.stringValue()
+	}
+	return values, nil
+}
+
+// apply selects the step's nodes relative to one context node and filters them
+func (s xpathStep) apply(context *xmlNode) []*xmlNode {
+	selected := axis(context, s.test)
+	for _, raw := range s.predicates {
+		predicate, _ := parsePredicate(raw)
+		var kept []*xmlNode
+		for i, node := range selected {
+			if predicate.matches(node, i+1, len(selected)) {
+				kept = append(kept, node)
+			}
+		}
+		selected = kept
+	}
+	return selected
+}
+
+// axis evaluates a node test: children by name, attributes, text, self or parent
+func axis(context *xmlNode, test string) []*xmlNode {
+	var selected []*xmlNode
+	switch {
+	case test == ".":
+		return []*xmlNode{context}
+	case test == "..":
+		if context.parent != nil {
+			return []*xmlNode{context.parent}
+		}
+		return nil
+	case strings.HasPrefix(test, "@"):
+		name := localName(test[1:])
+		for _, attr := range context.attrs {
+			if name == "*" || attr.name == name {
+				selected = append(selected, attr)
+			}
+		}
+		return selected
+	}
+
+	name := localName(test)
+	for _, child := range context.children {
+		switch {
+		case test == "node()":
+			selected = append(selected, child)
+		case test == "text()":
+			if child.kind == xmlText {
+				selected = append(selected, child)
+			}
+		case child.kind == xmlElement && (name == "*" || child.name == name):
+			selected = append(selected, child)
+		}
+	}
+	return selected
+}
+
+func (p *xpathPredicate) matches(node *xmlNode, position, size int) bool {
+	switch {
+	case p.position > 0:
+		return position == p.position
+	case p.last:
+		return position == size
+	}
+
+	operands := axis(node, p.operand)
+	for _, operand := range operands {
+		value := operand.stringValue()
+		switch {
+		case p.function == "contains":
+			if strings.Contains(value, p.literal) {
+				return true
+			}
+		case p.function == "starts-with":
+			if strings.HasPrefix(value, p.literal) {
+				return true
+			}
+		case p.operator == "=":
+			if value == p.literal || numericEqual(value, p.literal) {
+				return true
+			}
+		case p.operator == "!=":
+			if value != p.literal && !numericEqual(value, p.literal) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func numericEqual(a, b string) bool {
+	x, errX := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	return errX == nil && errY == nil && x == y
+}
+
+func localName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// xmlDescendants lists the node and every element and text below it, in document order
+func xmlDescendants(node *xmlNode, out []*xmlNode) []*xmlNode {
+	out = append(out, node)
+	for _, child := range node.children {
+		out = xmlDescendants(child, out)
+	}
+	return out
+}
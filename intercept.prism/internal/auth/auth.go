@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// now is replaced in tests to sign with fixed timestamps
+var now = time.Now
+
+// Validate checks that the fields the auth type needs are set. A nil config is valid
+func Validate(cfg *model.AuthConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	var missing []string
+	require := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	switch strings.ToLower(cfg.Type) {
+	case "basic", "digest":
+		require("username", cfg.Username)
+	case "bearer":
+		require("token", cfg.Token)
+	case "apikey":
+		require("key", cfg.Key)
+		if cfg.In != "" && cfg.In != "header" && cfg.In != "query" {
+			return fmt.Errorf("auth: unknown apikey location '%s', expected header or query", cfg.In)
+		}
+	case "awsv4":
+		require("access_key_id", cfg.AccessKeyID)
+		require("secret_access_key", cfg.SecretAccessKey)
+		require("region", cfg.Region)
+		require("service", cfg.Service)
+	case "hmac":
+		require("secret", cfg.Secret)
+		if _, ok := hmacAlgorithms[strings.ToLower(cfg.Algorithm)]; cfg.Algorithm != "" && !ok {
+			return fmt.Errorf("auth: unknown hmac algorithm '%s', expected sha1, sha256 or sha512", cfg.Algorithm)
+		}
+		if cfg.Encoding != "" && cfg.Encoding != "hex" && cfg.Encoding != "base64" {
+			return fmt.Errorf("auth: unknown hmac encoding '%s', expected hex or base64", cfg.Encoding)
+		}
+	case "oauth2":
+		return ValidateOAuth2(cfg.OAuth2)
+	default:
+		return fmt.Errorf("auth: unknown type '%s', expected basic, bearer, apikey, digest, awsv4, hmac or oauth2", cfg.Type)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("auth: %s requires %s", strings.ToLower(cfg.Type), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Apply adds credentials to a request. AWS Signature V4 and HMAC sign the body, read through
+// req.GetBody. Digest credentials need a challenge from the server, see Send
+func Apply(req *http.Request, cfg *model.AuthConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(cfg.Type) {
+	case "basic":
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	case "bearer":
+		scheme := cfg.Scheme
+		if scheme == "" {
+			scheme = "Bearer"
+		}
+		req.Header.Set("Authorization", scheme+" "+cfg.Token)
+	case "apikey":
+		if cfg.In == "query" {
+			query := req.URL.Query()
+			query.Set(cfg.Key, cfg.Value)
+			req.URL.RawQuery = query.Encode()
+		} else {
+			req.Header.Set(cfg.Key, cfg.Value)
+		}
+	case "awsv4":
+		signAWSV4(req, cfg, body, now())
+	case "hmac":
+		signHMAC(req, cfg, body, now())
+	case "oauth2":
+		if cfg.Token == "" {
+			return fmt.Errorf("auth: the oauth2 access token has not been fetched")
+		}
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	return nil
+}
+
+// ApplyMetadata adds credentials to gRPC metadata. Only schemes carried in a single header
+// work over gRPC; the others sign parts of an HTTP request that gRPC does not have
+func ApplyMetadata(md map[string]string, cfg *model.AuthConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "basic", "bearer", "oauth2":
+		req, _ := http.NewRequest(http.MethodPost, "/", nil)
+		if err := Apply(req, cfg); err != nil {
+			return err
+		}
+		md["authorization"] = req.Header.Get("Authorization")
+	case "apikey":
+		if cfg.In == "query" {
+			return fmt.Errorf("auth: gRPC has no query string, send the API key in a header")
+		}
+		md[strings.ToLower(cfg.Key)] = cfg.Value
+	default:
+		return fmt.Errorf("auth: %s is not supported for gRPC", strings.ToLower(cfg.Type))
+	}
+	return nil
+}
+
+// Send makes a request built by newRequest, which should call Apply. For digest auth a 401
+// challenge is answered with a second request, so newRequest may be called twice
+func Send(client *http.Client, cfg *model.AuthConfig, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil || cfg == nil || !strings.EqualFold(cfg.Type, "digest") || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := digestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	body, err := requestBody(retry)
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := digestAuthorization(challenge, cfg, retry.Method, retry.URL.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", authorization)
+	return client.Do(retry)
+}
+
+// requestBody returns a copy of the body without consuming it. http.NewRequest sets GetBody
+// for the in-memory readers every executor uses
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		return nil, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// Tags describes the auth on a span without any secret
+func Tags(tags map[string]string, cfg *model.AuthConfig) {
+	if cfg == nil {
+		return
+	}
+	kind := strings.ToLower(cfg.Type)
+	tags["auth.type"] = kind
+	switch kind {
+	case "basic", "digest":
+		tags["auth.username"] = cfg.Username
+	case "apikey":
+		tags["auth.key"] = cfg.Key
+		tags["auth.in"] = "header"
+		if cfg.In == "query" {
+			tags["auth.in"] = "query"
+		}
+	case "awsv4":
+		tags["auth.aws.region"] = cfg.Region
+		tags["auth.aws.service"] = cfg.Service
+	case "oauth2":
+		if cfg.OAuth2 != nil {
+			tags["auth.oauth2.grant_type"] = cfg.OAuth2.GrantType
+			tags["auth.oauth2.client_id"] = cfg.OAuth2.ClientID
+		}
+	}
+}
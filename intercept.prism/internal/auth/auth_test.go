@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg     model.AuthConfig
+		problem string
+	}{
+		{model.AuthConfig{Type: "basic", Username: "alice"}, ""},
+		{model.AuthConfig{Type: "Bearer", Token: "t"}, ""},
+		{model.AuthConfig{Type: "bearer"}, "auth: bearer requires token"},
+		{model.AuthConfig{Type: "apikey", Key: "k", In: "cookie"}, "unknown apikey location 'cookie'"},
+		{model.AuthConfig{Type: "awsv4", AccessKeyID: "id"}, "auth: awsv4 requires secret_access_key, region, service"},
+		{model.AuthConfig{Type: "hmac", Secret: "s", Algorithm: "md5"}, "unknown hmac algorithm 'md5'"},
+		{model.AuthConfig{Type: "ntlm"}, "unknown type 'ntlm'"},
+		{model.AuthConfig{Type: "oauth2"}, "auth: oauth2 requires an oauth2 block"},
+	}
+	for _, tt := range tests {
+		err := Validate(&tt.cfg)
+		if tt.problem == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.cfg, err)
+		}
+		if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+			t.Errorf("%+v: expected %q, got %v", tt.cfg, tt.problem, err)
+		}
+	}
+}
+
+func TestApply_HeaderSchemes(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://api.example.com/books?page=2", nil)
+	Apply(req, &model.AuthConfig{Type: "basic", Username: "alice", Password: "s3cret"})
+	if user, pass, ok := req.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+		t.Errorf("Expected basic credentials, got %q", req.Header.Get("Authorization"))
+	}
+
+	Apply(req, &model.AuthConfig{Type: "bearer", Token: "abc"})
+	if got := req.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Expected a bearer token, got %q", got)
+	}
+	Apply(req, &model.AuthConfig{Type: "bearer", Token: "abc", Scheme: "Token"})
+	if got := req.Header.Get("Authorization"); got != "Token abc" {
+		t.Errorf("Expected a custom scheme, got %q", got)
+	}
+
+	Apply(req, &model.AuthConfig{Type: "apikey", Key: "X-Api-Key", Value: "k1"})
+	if got := req.Header.Get("X-Api-Key"); got != "k1" {
+		t.Errorf("Expected the key in a header, got %q", got)
+	}
+	Apply(req, &model.AuthConfig{Type: "apikey", Key: "api_key", Value: "k 2", In: "query"})
+	if got := req.URL.Query(); got.Get("api_key") != "k 2" || got.Get("page") != "2" {
+		t.Errorf("Expected the key added to the query, got %s", req.URL.RawQuery)
+	}
+}
+
+// The get-vanilla case of the AWS Signature Version 4 test suite
+func TestApply_AWSV4(t *testing.T) {
+	now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	err := Apply(req, &model.AuthConfig{
+		Type:            "awsv4",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("Unexpected signature:\n got %s\nwant %s", got, expected)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("Unexpected X-Amz-Date %s", got)
+	}
+}
+
+func TestAWSCanonicalRequestParts(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.com/a%20b/c%2Fd?z=1&a=b c&a=a", nil)
+	if got := awsCanonicalURI(req.URL, "execute-api"); got != "/a%2520b/c%252Fd" {
+		t.Errorf("Expected a double encoded path, got %s", got)
+	}
+	if got := awsCanonicalURI(req.URL, "s3"); got != "/a%20b/c%2Fd" {
+		t.Errorf("Expected s3 to sign the path as sent, got %s", got)
+	}
+	if got := awsCanonicalQuery(req.URL); got != "a=a&a=b%20c&z=1" {
+		t.Errorf("Expected a sorted query, got %s", got)
+	}
+}
+
+func TestApply_HMAC(t *testing.T) {
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer func() { now = time.Now }()
+
+	body := []byte(`{"title":"Dune"}`)
+	req, _ := http.NewRequest("POST", "https://api.example.com/books?draft=true", bytes.NewReader(body))
+	Apply(req, &model.AuthConfig{Type: "hmac", Secret: "key", Encoding: "base64", SignatureHeader: "X-Sig"})
+
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("POST\n/books?draft=true\n1700000000\n" + `{"title":"Dune"}`))
+	if got := req.Header.Get("X-Sig"); got != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected signature %s", got)
+	}
+	if got := req.Header.Get("X-Timestamp"); got != "1700000000" {
+		t.Errorf("Unexpected timestamp %s", got)
+	}
+}
+
+// digestServer checks the Authorization header against its challenge the way a server would
+func digestServer(t *testing.T, challenge string, newHash func() hash.Hash) (*httptest.Server, *int) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Digest ") {
+			w.Header().Add("WWW-Authenticate", `Basic realm="other"`)
+			w.Header().Add("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h := func(s string) string {
+			sum := newHash()
+			sum.Write([]byte(s))
+			return hex.EncodeToString(sum.Sum(nil))
+		}
+		c := digestParams(strings.TrimPrefix(challenge, "Digest "))
+		p := digestParams(strings.TrimPrefix(authorization, "Digest "))
+		body, _ := io.ReadAll(r.Body)
+
+		ha1 := h("alice:" + c["realm"] + ":s3cret")
+		if strings.HasSuffix(p["algorithm"], "-sess") {
+			ha1 = h(ha1 + ":" + p["nonce"] + ":" + p["cnonce"])
+		}
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		if p["qop"] == "auth-int" {
+			ha2 = h(r.Method + ":" + r.URL.RequestURI() + ":" + h(string(body)))
+		}
+		expected := h(ha1 + ":" + c["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + p["qop"] + ":" + ha2)
+
+		if p["response"] != expected || p["uri"] != r.URL.RequestURI() || p["opaque"] != c["opaque"] {
+			t.Errorf("Digest response did not verify: %s", authorization)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, &calls
+}
+
+func TestSend_Digest(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		newHash   func() hash.Hash
+	}{
+		{"md5", `Digest realm="books@example.com", qop="auth, auth-int", nonce="dcd98b7102dd2f0e", opaque="5ccc069c"`, md5.New},
+		{"sha256-sess", `Digest realm="books", qop="auth-int", algorithm=SHA-256-sess, nonce="7ypf/xlj9XXwfDPEoM4URrv"`, sha256.New},
+	}
+	cfg := &model.AuthConfig{Type: "digest", Username: "alice", Password: "s3cret"}
+	body := []byte(`{"title":"Dune"}`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := digestServer(t, tt.challenge, tt.newHash)
+			defer server.Close()
+
+			resp, err := Send(http.DefaultClient, cfg, func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL+"/books?x=1", strings.NewReader(string(body)))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || *calls != 2 {
+				t.Errorf("Expected a successful retry, got %d after %d calls", resp.StatusCode, *calls)
+			}
+		})
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	md := map[string]string{}
+	if err := ApplyMetadata(md, &model.AuthConfig{Type: "bearer", Token: "abc"}); err != nil || md["authorization"] != "Bearer abc" {
+		t.Errorf("Expected a bearer header, got %v (%v)", md, err)
+	}
+	if err := ApplyMetadata(md, &model.AuthConfig{Type: "apikey", Key: "X-Api-Key", Value: "k"}); err != nil || md["x-api-key"] != "k" {
+		t.Errorf("Expected a lower-case key, got %v (%v)", md, err)
+	}
+	if err := ApplyMetadata(md, &model.AuthConfig{Type: "hmac", Secret: "s"}); err == nil {
+		t.Error("Expected hmac to be rejected for gRPC")
+	}
+}
+
+func TestTags_NoSecrets(t *testing.T) {
+	configs := []model.AuthConfig{
+		{Type: "basic", Username: "alice", Password: "secret-1"},
+		{Type: "bearer", Token: "secret-1"},
+		{Type: "apikey", Key: "X-Api-Key", Value: "secret-1"},
+		{Type: "awsv4", AccessKeyID: "secret-1", SecretAccessKey: "secret-1", SessionToken: "secret-1", Region: "eu-west-1", Service: "s3"},
+		{Type: "hmac", Secret: "secret-1"},
+	}
+	for _, cfg := range configs {
+		tags := map[string]string{}
+		Tags(tags, &cfg)
+		if tags["auth.type"] != cfg.Type {
+			t.Errorf("Expected auth.type %s, got %v", cfg.Type, tags)
+		}
+		for name, value := range tags {
+			if strings.Contains(value, "secret-1") {
+				t.Errorf("%s: tag %s leaks a secret", cfg.Type, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-256": sha256.New,
+}
+
+// digestChallenge finds the first Digest challenge with an algorithm we can answer
+func digestChallenge(headers []string) (map[string]string, bool) {
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := digestParams(rest)
+		if _, ok := digestAlgorithms[digestBaseAlgorithm(params["algorithm"])]; ok && params["nonce"] != "" {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// digestParams parses the comma separated key=value list of a challenge, where values may be
+// quoted strings containing commas
+func digestParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return params
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+}
+
+// digestBaseAlgorithm maps the challenge's algorithm to its hash, MD5 when absent
+func digestBaseAlgorithm(algorithm string) string {
+	algorithm = strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS")
+	if algorithm == "" {
+		return "MD5"
+	}
+	return algorithm
+}
+
+// digestAuthorization answers a challenge following RFC 7616. auth is preferred over
+// auth-int when the server offers both, since it does not depend on the body
+func digestAuthorization(challenge map[string]string, cfg *model.AuthConfig, method, uri string, body []byte) (string, error) {
+	algorithm := challenge["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	newHash := digestAlgorithms[digestBaseAlgorithm(algorithm)]
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	qop := ""
+	for _, offered := range strings.Split(challenge["qop"], ",") {
+		offered = strings.TrimSpace(offered)
+		if offered == "auth" || (offered == "auth-int" && qop == "") {
+			qop = offered
+		}
+	}
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", fmt.Errorf("auth: generating a digest cnonce: %w", err)
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nonce := challenge["nonce"]
+	nc := "00000001"
+
+	ha1 := h(cfg.Username + ":" + challenge["realm"] + ":" + cfg.Password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf(`username="%s"`, cfg.Username),
+		fmt.Sprintf(`realm="%s"`, challenge["realm"]),
+		fmt.Sprintf(`nonce="%s"`, nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		"algorithm=" + algorithm,
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf(`opaque="%s"`, opaque))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hmacStringToSign is what the signature covers. The timestamp is sent alongside it so the
+// receiver can rebuild the string and reject replays
+func hmacStringToSign(req *http.Request, timestamp string, body []byte) string {
+	return req.Method + "\n" + req.URL.RequestURI() + "\n" + timestamp + "\n" + string(body)
+}
+
+func signHMAC(req *http.Request, cfg *model.AuthConfig, body []byte, t time.Time) {
+	algorithm := strings.ToLower(cfg.Algorithm)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	signatureHeader := cfg.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = "X-Signature"
+	}
+	timestampHeader := cfg.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(hmacAlgorithms[algorithm], []byte(cfg.Secret))
+	mac.Write([]byte(hmacStringToSign(req, timestamp, body)))
+
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if cfg.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, signature)
+}
@@ -0,0 +1,422 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// expirySkew refreshes tokens slightly early so they do not expire in flight
+const expirySkew = 30 * time.Second
+
+// pendingAuthorizationTTL bounds how long an authorization code flow may stay unfinished
+const pendingAuthorizationTTL = 10 * time.Minute
+
+// ErrAuthorizationRequired is returned for authorization_code configurations that have no
+// usable token yet, until the flow is completed in a browser
+var ErrAuthorizationRequired = errors.New("oauth2: no token for this authorization_code configuration, start the flow with POST /oauth2/authorize")
+
+// Token is an OAuth 2.0 access token as cached
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Scope        string
+	Expiry       time.Time // Zero when the server did not say
+}
+
+func (t *Token) valid(at time.Time) bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || at.Add(expirySkew).Before(t.Expiry))
+}
+
+// TokenFetch describes one call to a token endpoint, for its span
+type TokenFetch struct {
+	GrantType  string
+	TokenURL   string
+	Start      time.Time
+	Duration   time.Duration
+	StatusCode int   // 0 when no response was received
+	Err        error // Set when no token came back
+}
+
+// TokenCache keeps access tokens per workspace and configuration, and the PKCE state of
+// authorization code flows waiting for their callback
+type TokenCache struct {
+	mu      sync.Mutex
+	tokens  map[string]*Token
+	pending map[string]*pendingAuthorization
+}
+
+type pendingAuthorization struct {
+	workspaceID string
+	cfg         model.OAuth2Config
+	verifier    string
+	created     time.Time
+}
+
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens:  make(map[string]*Token),
+		pending: make(map[string]*pendingAuthorization),
+	}
+}
+
+// Global token cache
+var OAuth2Tokens = NewTokenCache()
+
+// oauth2Key identifies whose token it is. The secrets are hashed in too, so a request with
+// the right username and a wrong password never gets someone else's token. The workspace
+// prefix lets Clear drop a workspace
+func oauth2Key(workspaceID string, cfg *model.OAuth2Config) string {
+	h := sha256.New()
+	for _, part := range []string{
+		cfg.GrantType, cfg.TokenURL, cfg.ClientID, cfg.Scope, cfg.Audience, cfg.Username,
+		cfg.Password, cfg.ClientSecret, cfg.RefreshToken,
+	} {
+		fmt.Fprintf(h, "%d:%s\n", len(part), part)
+	}
+	return workspaceID + "/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// requireWorkspace keeps tokens from landing in one cache shared by every caller
+func requireWorkspace(workspaceID string) error {
+	if workspaceID == "" {
+		return fmt.Errorf("auth: oauth2 requires a workspace_id to scope its cached tokens")
+	}
+	return nil
+}
+
+// ValidateOAuth2 checks that a configuration has what its grant needs
+func ValidateOAuth2(cfg *model.OAuth2Config) error {
+	if cfg == nil {
+		return fmt.Errorf("auth: oauth2 requires an oauth2 block")
+	}
+	var missing []string
+	require := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	require("token_url", cfg.TokenURL)
+	require("client_id", cfg.ClientID)
+
+	switch cfg.GrantType {
+	case "client_credentials":
+	case "password":
+		require("username", cfg.Username)
+	case "refresh_token":
+		require("refresh_token", cfg.RefreshToken)
+	case "authorization_code":
+		require("authorization_url", cfg.AuthorizationURL)
+	default:
+		return fmt.Errorf("auth: unknown oauth2 grant_type '%s', expected client_credentials, password, refresh_token or authorization_code", cfg.GrantType)
+	}
+	if cfg.ClientAuth != "" && cfg.ClientAuth != "basic" && cfg.ClientAuth != "body" {
+		return fmt.Errorf("auth: unknown oauth2 client_auth '%s', expected basic or body", cfg.ClientAuth)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("auth: oauth2 %s requires %s", cfg.GrantType, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Token returns a usable access token for the configuration. A cached token is returned
+// as is, an expired one is refreshed when a refresh token is cached, and otherwise the
+// grant is run. fetches lists the calls made to the token endpoint, none on a cache hit;
+// source is cache, fetched or refreshed
+func (c *TokenCache) Token(client *http.Client, workspaceID string, cfg *model.OAuth2Config, force bool) (*Token, []*TokenFetch, string, error) {
+	if err := ValidateOAuth2(cfg); err != nil {
+		return nil, nil, "", err
+	}
+	if err := requireWorkspace(workspaceID); err != nil {
+		return nil, nil, "", err
+	}
+	key := oauth2Key(workspaceID, cfg)
+
+	c.mu.Lock()
+	cached := c.tokens[key]
+	c.mu.Unlock()
+	if cached != nil && !force && cached.valid(now()) {
+		return cached, nil, "cache", nil
+	}
+
+	var fetches []*TokenFetch
+	if cached != nil && cached.RefreshToken != "" {
+		params := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {cached.RefreshToken}}
+		token, fetch := requestToken(client, cfg, params)
+		fetches = append(fetches, fetch)
+		if fetch.Err == nil {
+			// Servers may keep the refresh token the same and leave it out of the response
+			if token.RefreshToken == "" {
+				token.RefreshToken = cached.RefreshToken
+			}
+			c.store(key, token)
+			return token, fetches, "refreshed", nil
+		}
+		// A revoked refresh token falls back to the grant, when it can run unattended
+		if cfg.GrantType == "authorization_code" || cfg.GrantType == "refresh_token" {
+			return nil, fetches, "refreshed", fetch.Err
+		}
+	}
+
+	params := url.Values{"grant_type": {cfg.GrantType}}
+	switch cfg.GrantType {
+	case "password":
+		params.Set("username", cfg.Username)
+		params.Set("password", cfg.Password)
+	case "refresh_token":
+		params.Set("refresh_token", cfg.RefreshToken)
+	case "authorization_code":
+		return nil, fetches, "", ErrAuthorizationRequired
+	}
+	token, fetch := requestToken(client, cfg, params)
+	fetches = append(fetches, fetch)
+	if fetch.Err != nil {
+		return nil, fetches, "fetched", fetch.Err
+	}
+	if token.RefreshToken == "" && cfg.GrantType == "refresh_token" {
+		token.RefreshToken = cfg.RefreshToken
+	}
+	c.store(key, token)
+	return token, fetches, "fetched", nil
+}
+
+func (c *TokenCache) store(key string, token *Token) {
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+}
+
+// Authorize starts an authorization code flow with PKCE and returns the URL to open
+func (c *TokenCache) Authorize(workspaceID string, cfg model.OAuth2Config) (authURL, state string, err error) {
+	if err := ValidateOAuth2(&cfg); err != nil {
+		return "", "", err
+	}
+	if err := requireWorkspace(workspaceID); err != nil {
+		return "", "", err
+	}
+	if cfg.GrantType != "authorization_code" {
+		return "", "", fmt.Errorf("auth: only the authorization_code grant is started in a browser")
+	}
+	u, err := url.Parse(cfg.AuthorizationURL)
+	if err != nil {
+		return "", "", fmt.Errorf("auth: invalid authorization_url: %v", err)
+	}
+
+	verifier, err := randomURLSafe(32)
+	if err != nil {
+		return "", "", err
+	}
+	state, err = randomURLSafe(16)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", cfg.RedirectURI)
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	if cfg.Scope != "" {
+		query.Set("scope", cfg.Scope)
+	}
+	if cfg.Audience != "" {
+		query.Set("audience", cfg.Audience)
+	}
+	u.RawQuery = query.Encode()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s, p := range c.pending {
+		if time.Since(p.created) > pendingAuthorizationTTL {
+			delete(c.pending, s)
+		}
+	}
+	c.pending[state] = &pendingAuthorization{workspaceID: workspaceID, cfg: cfg, verifier: verifier, created: time.Now()}
+	return u.String(), state, nil
+}
+
+// Callback finishes the flow started by Authorize, exchanging the code for a token
+func (c *TokenCache) Callback(client *http.Client, state, code string) (*Token, *TokenFetch, error) {
+	c.mu.Lock()
+	pending, ok := c.pending[state]
+	delete(c.pending, state)
+	c.mu.Unlock()
+	if !ok || time.Since(pending.created) > pendingAuthorizationTTL {
+		return nil, nil, fmt.Errorf("oauth2: unknown or expired state")
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", code)
+	params.Set("redirect_uri", pending.cfg.RedirectURI)
+	params.Set("code_verifier", pending.verifier)
+	token, fetch := requestToken(client, &pending.cfg, params)
+	if fetch.Err != nil {
+		return nil, fetch, fetch.Err
+	}
+
+	c.store(oauth2Key(pending.workspaceID, &pending.cfg), token)
+	return token, fetch, nil
+}
+
+// Cancel forgets a flow the provider refused, so its state cannot be used again
+func (c *TokenCache) Cancel(state string) {
+	c.mu.Lock()
+	delete(c.pending, state)
+	c.mu.Unlock()
+}
+
+// Clear drops every cached token of a workspace and reports how many there were
+func (c *TokenCache) Clear(workspaceID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cleared := 0
+	for key := range c.tokens {
+		if strings.HasPrefix(key, workspaceID+"/") {
+			delete(c.tokens, key)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// requestToken posts a token request following RFC 6749 section 4
+func requestToken(client *http.Client, cfg *model.OAuth2Config, params url.Values) (*Token, *TokenFetch) {
+	fetch := &TokenFetch{GrantType: params.Get("grant_type"), TokenURL: cfg.TokenURL, Start: time.Now()}
+	defer func() { fetch.Duration = time.Since(fetch.Start) }()
+
+	if cfg.Scope != "" && params.Get("grant_type") != "authorization_code" {
+		params.Set("scope", cfg.Scope)
+	}
+	if cfg.Audience != "" {
+		params.Set("audience", cfg.Audience)
+	}
+	names := make([]string, 0, len(cfg.ExtraParams))
+	for name := range cfg.ExtraParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params.Set(name, cfg.ExtraParams[name])
+	}
+	if cfg.ClientAuth == "body" {
+		params.Set("client_id", cfg.ClientID)
+		if cfg.ClientSecret != "" {
+			params.Set("client_secret", cfg.ClientSecret)
+		}
+	} else if cfg.ClientSecret == "" {
+		// Public clients identify themselves in the body, having no secret to authenticate with
+		params.Set("client_id", cfg.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		fetch.Err = fmt.Errorf("oauth2: %v", err)
+		return nil, fetch
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientAuth != "body" && cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fetch.Err = fmt.Errorf("oauth2: token request failed: %v", err)
+		return nil, fetch
+	}
+	defer resp.Body.Close()
+	fetch.StatusCode = resp.StatusCode
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fetch.Err = fmt.Errorf("oauth2: failed to read token response")
+		return nil, fetch
+	}
+
+	fields, err := tokenResponseFields(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		fetch.Err = fmt.Errorf("oauth2: token endpoint returned %d with an unreadable body", resp.StatusCode)
+		return nil, fetch
+	}
+	if resp.StatusCode != http.StatusOK || fields["error"] != "" || fields["access_token"] == "" {
+		message := fields["error"]
+		if message == "" {
+			message = "no access_token in the response"
+		}
+		if fields["error_description"] != "" {
+			message += ": " + fields["error_description"]
+		}
+		fetch.Err = fmt.Errorf("oauth2: token endpoint returned %d: %s", resp.StatusCode, message)
+		return nil, fetch
+	}
+
+	token := &Token{
+		AccessToken:  fields["access_token"],
+		TokenType:    fields["token_type"],
+		RefreshToken: fields["refresh_token"],
+		Scope:        fields["scope"],
+	}
+	if seconds, err := strconv.ParseInt(fields["expires_in"], 10, 64); err == nil && seconds > 0 {
+		token.Expiry = now().Add(time.Duration(seconds) * time.Second)
+	}
+	return token, fetch
+}
+
+// tokenResponseFields reads a JSON token response, or the form encoded one some providers
+// such as GitHub still send by default
+func tokenResponseFields(contentType string, body []byte) (map[string]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "text/plain" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(values))
+		for name := range values {
+			fields[name] = values.Get(name)
+		}
+		return fields, nil
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			fields[name] = v
+		case float64:
+			fields[name] = strconv.FormatInt(int64(v), 10)
+		}
+	}
+	return fields, nil
+}
+
+func randomURLSafe(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("auth: generating random state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// tokenServer is a token endpoint that issues numbered tokens and records each request
+type tokenServer struct {
+	mu        sync.Mutex
+	requests  []url.Values
+	basicAuth []string
+	expiresIn int
+	refresh   bool   // Issue refresh tokens
+	failGrant string // Answer this grant type with invalid_grant
+	challenge string // PKCE challenge expected with authorization_code
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.PostForm)
+	user, pass, _ := r.BasicAuth()
+	s.basicAuth = append(s.basicAuth, user+":"+pass)
+
+	w.Header().Set("Content-Type", "application/json")
+	grant := r.PostForm.Get("grant_type")
+	if grant == s.failGrant {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"token revoked"}`))
+		return
+	}
+	if grant == "authorization_code" {
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge || r.PostForm.Get("code") != "the-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+	}
+
+	body := map[string]any{
+		"access_token": fmt.Sprintf("token-%d", len(s.requests)),
+		"token_type":   "Bearer",
+		"expires_in":   s.expiresIn,
+	}
+	if s.refresh {
+		body["refresh_token"] = fmt.Sprintf("refresh-%d", len(s.requests))
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *tokenServer) grants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var grants []string
+	for _, r := range s.requests {
+		grants = append(grants, r.Get("grant_type"))
+	}
+	return grants
+}
+
+func TestTokenCache_ClientCredentials(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache := NewTokenCache()
+	cfg := &model.OAuth2Config{GrantType: "client_credentials", TokenURL: ts.URL, ClientID: "app", ClientSecret: "s3cret", Scope: "read write"}
+
+	token, fetches, source, err := cache.Token(http.DefaultClient, "ws-1", cfg, false)
+	if err != nil || token.AccessToken != "token-1" || source != "fetched" || len(fetches) != 1 {
+		t.Fatalf("Expected a fetched token, got %+v %s %v", token, source, err)
+	}
+	if server.basicAuth[0] != "app:s3cret" || server.requests[0].Get("scope") != "read write" {
+		t.Errorf("Expected basic client auth and the scope, got %s %v", server.basicAuth[0], server.requests[0])
+	}
+	if fetches[0].StatusCode != http.StatusOK || fetches[0].GrantType != "client_credentials" {
+		t.Errorf("Unexpected fetch %+v", fetches[0])
+	}
+
+	token, fetches, source, _ = cache.Token(http.DefaultClient, "ws-1", cfg, false)
+	if token.AccessToken != "token-1" || source != "cache" || fetches != nil {
+		t.Errorf("Expected the cached token, got %s from %s", token.AccessToken, source)
+	}
+
+	// Workspaces do not share tokens
+	token, _, _, _ = cache.Token(http.DefaultClient, "ws-2", cfg, false)
+	if token.AccessToken != "token-2" {
+		t.Errorf("Expected a separate token for another workspace, got %s", token.AccessToken)
+	}
+	if cleared := cache.Clear("ws-1"); cleared != 1 {
+		t.Errorf("Expected one token cleared, got %d", cleared)
+	}
+	token, _, _, _ = cache.Token(http.DefaultClient, "ws-1", cfg, false)
+	if token.AccessToken != "token-3" {
+		t.Errorf("Expected a new token after clearing, got %s", token.AccessToken)
+	}
+}
+
+func TestTokenCache_RefreshOnExpiry(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600, refresh: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache := NewTokenCache()
+	cfg := &model.OAuth2Config{GrantType: "password", TokenURL: ts.URL, ClientID: "app", ClientAuth: "body", Username: "alice", Password: "pw"}
+	cache.Token(http.DefaultClient, "ws", cfg, false)
+	if got := server.requests[0]; got.Get("username") != "alice" || got.Get("client_id") != "app" {
+		t.Errorf("Expected the password grant with the client in the body, got %v", got)
+	}
+
+	// An hour later the token has expired and the refresh token is used
+	now = func() time.Time { return time.Now().Add(time.Hour) }
+	defer func() { now = time.Now }()
+	token, _, source, err := cache.Token(http.DefaultClient, "ws", cfg, false)
+	if err != nil || source != "refreshed" || token.AccessToken != "token-2" {
+		t.Fatalf("Expected a refreshed token, got %+v %s %v", token, source, err)
+	}
+	if server.requests[1].Get("refresh_token") != "refresh-1" {
+		t.Errorf("Expected the cached refresh token to be sent, got %v", server.requests[1])
+	}
+
+	// A revoked refresh token falls back to the password grant
+	server.failGrant = "refresh_token"
+	now = func() time.Time { return time.Now().Add(3 * time.Hour) }
+	token, fetches, _, err := cache.Token(http.DefaultClient, "ws", cfg, false)
+	if err != nil || token.AccessToken != "token-4" || len(fetches) != 2 || fetches[0].Err == nil {
+		t.Errorf("Expected a failed refresh then a new grant, got %+v %v", token, err)
+	}
+	if strings.Join(server.grants(), ",") != "password,refresh_token,refresh_token,password" {
+		t.Errorf("Unexpected grants %v", server.grants())
+	}
+}
+
+func TestTokenCache_KeyedBySecrets(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache := NewTokenCache()
+	cfg := model.OAuth2Config{GrantType: "password", TokenURL: ts.URL, ClientID: "app", Username: "alice", Password: "pw"}
+	cache.Token(http.DefaultClient, "ws", &cfg, false)
+
+	// The right username with another password must not reuse alice's token
+	wrong := cfg
+	wrong.Password = "guess"
+	token, _, source, err := cache.Token(http.DefaultClient, "ws", &wrong, false)
+	if err != nil || source != "fetched" || token.AccessToken != "token-2" {
+		t.Errorf("Expected a separate grant for another password, got %+v %s %v", token, source, err)
+	}
+
+	if _, _, _, err := cache.Token(http.DefaultClient, "", &cfg, false); err == nil || !strings.Contains(err.Error(), "requires a workspace_id") {
+		t.Errorf("Expected an error without a workspace, got %v", err)
+	}
+	if _, _, err := cache.Authorize("", cfg); err == nil {
+		t.Error("Expected Authorize to require a workspace")
+	}
+	if len(server.requests) != 2 {
+		t.Errorf("Expected two token requests, got %d", len(server.requests))
+	}
+}
+
+func TestTokenCache_AuthorizationCodePKCE(t *testing.T) {
+	server := &tokenServer{expiresIn: 60}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache := NewTokenCache()
+	cfg := model.OAuth2Config{
+		GrantType:        "authorization_code",
+		TokenURL:         ts.URL,
+		ClientID:         "app",
+		AuthorizationURL: "https://idp.example.com/authorize?prompt=consent",
+		RedirectURI:      "http://localhost:7000/oauth2/callback",
+		Scope:            "openid",
+	}
+	if _, _, _, err := cache.Token(http.DefaultClient, "ws", &cfg, false); err != ErrAuthorizationRequired {
+		t.Fatalf("Expected ErrAuthorizationRequired before the flow, got %v", err)
+	}
+
+	authURL, state, err := cache.Authorize("ws", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("state") != state || query.Get("prompt") != "consent" || query.Get("redirect_uri") != cfg.RedirectURI {
+		t.Errorf("Unexpected authorization URL %s", authURL)
+	}
+	server.challenge = query.Get("code_challenge")
+
+	if _, _, err := cache.Callback(http.DefaultClient, "wrong-state", "the-code"); err == nil {
+		t.Error("Expected an unknown state to be rejected")
+	}
+	token, fetch, err := cache.Callback(http.DefaultClient, state, "the-code")
+	if err != nil || token.AccessToken != "token-1" || fetch.GrantType != "authorization_code" {
+		t.Fatalf("Expected the code to be exchanged, got %+v %v", token, err)
+	}
+	if _, _, err := cache.Callback(http.DefaultClient, state, "the-code"); err == nil {
+		t.Error("Expected the state to be usable once")
+	}
+
+	// Executions use the configuration without its redirect_uri
+	cfg.RedirectURI = ""
+	token, _, source, err := cache.Token(http.DefaultClient, "ws", &cfg, false)
+	if err != nil || source != "cache" || token.AccessToken != "token-1" {
+		t.Errorf("Expected the authorized token from the cache, got %+v %s %v", token, source, err)
+	}
+}
+
+func TestRequestToken_Responses(t *testing.T) {
+	tests := []struct {
+		contentType string
+		status      int
+		body        string
+		token       string
+		problem     string
+	}{
+		{"application/x-www-form-urlencoded", 200, "access_token=gho_abc&token_type=bearer&scope=repo", "gho_abc", ""},
+		{"application/json", 401, `{"error":"invalid_client","error_description":"bad secret"}`, "", "returned 401: invalid_client: bad secret"},
+		{"application/json", 200, `{"token_type":"Bearer"}`, "", "no access_token in the response"},
+		{"text/html", 502, `<html>`, "", "unreadable body"},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		token, fetch := requestToken(http.DefaultClient, &model.OAuth2Config{TokenURL: ts.URL, ClientID: "app"}, url.Values{"grant_type": {"client_credentials"}})
+		ts.Close()
+
+		if tt.problem == "" && (fetch.Err != nil || token.AccessToken != tt.token) {
+			t.Errorf("%s: expected token %s, got %+v %v", tt.body, tt.token, token, fetch.Err)
+		}
+		if tt.problem != "" && (fetch.Err == nil || !strings.Contains(fetch.Err.Error(), tt.problem)) {
+			t.Errorf("%s: expected %q, got %v", tt.body, tt.problem, fetch.Err)
+		}
+	}
+}
+
+func TestValidateOAuth2(t *testing.T) {
+	tests := []struct {
+		cfg     model.OAuth2Config
+		problem string
+	}{
+		{model.OAuth2Config{GrantType: "client_credentials", TokenURL: "u", ClientID: "c"}, ""},
+		{model.OAuth2Config{GrantType: "password", TokenURL: "u"}, "auth: oauth2 password requires client_id, username"},
+		{model.OAuth2Config{GrantType: "implicit", TokenURL: "u", ClientID: "c"}, "unknown oauth2 grant_type 'implicit'"},
+		{model.OAuth2Config{GrantType: "client_credentials", TokenURL: "u", ClientID: "c", ClientAuth: "jwt"}, "unknown oauth2 client_auth 'jwt'"},
+	}
+	for _, tt := range tests {
+		err := ValidateOAuth2(&tt.cfg)
+		if tt.problem == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.cfg, err)
+		}
+		if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+			t.Errorf("%+v: expected %q, got %v", tt.cfg, tt.problem, err)
+		}
+	}
+}
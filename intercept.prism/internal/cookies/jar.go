@@ -0,0 +1,323 @@
+package cookies
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"golang.org/x/net/publicsuffix"
+)
+
+// now is replaced in tests to move past cookie expiry
+var now = time.Now
+
+// Jar is an http.CookieJar following the storage and retrieval rules of RFC 6265 section 5.
+// Unlike net/http/cookiejar its contents can be listed and edited. Domain attributes naming a
+// public suffix, such as "com" or "co.uk", are refused
+type Jar struct {
+	mu      sync.Mutex
+	entries map[string]*entry // name;domain;path
+	seq     uint64            // Creation order, for retrieval order and eviction
+}
+
+type entry struct {
+	name, value, domain, path  string
+	hostOnly, secure, httpOnly bool
+	sameSite                   string
+	expires                    time.Time // Zero for a session cookie
+	seq                        uint64
+}
+
+// maxCookies bounds a jar the way browsers bound theirs, dropping the oldest first
+const maxCookies = 1000
+
+func NewJar() *Jar {
+	return &Jar{entries: make(map[string]*entry)}
+}
+
+func entryKey(name, domain, path string) string {
+	return name + ";" + domain + ";" + path
+}
+
+func (e *entry) expired(at time.Time) bool {
+	return !e.expires.IsZero() && !at.Before(e.expires)
+}
+
+// SetCookies stores the Set-Cookie headers of a response from u
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u.Host)
+	secureScheme := u.Scheme == "https" || u.Scheme == "wss"
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		e := &entry{
+			name:     c.Name,
+			value:    c.Value,
+			path:     c.Path,
+			secure:   c.Secure,
+			httpOnly: c.HttpOnly,
+			sameSite: sameSiteName(c.SameSite),
+		}
+
+		// Domain: host-only unless a Domain attribute names the host or a parent of it
+		domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		switch {
+		case domain == "":
+			e.domain, e.hostOnly = host, true
+		case domain == host && publicSuffix(domain):
+			// A host that is itself a public suffix keeps the cookie to itself
+			e.domain, e.hostOnly = host, true
+		case domain == host:
+			e.domain = host
+		case net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain) && !publicSuffix(domain):
+			e.domain = domain
+		default:
+			continue
+		}
+
+		// Path: the directory of the request path unless an absolute Path is given
+		if !strings.HasPrefix(e.path, "/") {
+			e.path = defaultPath(u.EscapedPath())
+		}
+
+		// Only secure origins may set Secure cookies (RFC 6265bis)
+		if e.secure && !secureScheme {
+			continue
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			e.expires = time.Unix(1, 0)
+		case c.MaxAge > 0:
+			e.expires = now().Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.expires = c.Expires
+		}
+		j.store(e)
+	}
+}
+
+// store adds or replaces an entry, removing it instead when it has already expired.
+// A replacement keeps the creation order of the cookie it replaces
+func (j *Jar) store(e *entry) {
+	key := entryKey(e.name, e.domain, e.path)
+	if e.expired(now()) {
+		delete(j.entries, key)
+		return
+	}
+	if old, ok := j.entries[key]; ok {
+		e.seq = old.seq
+	} else {
+		j.seq++
+		e.seq = j.seq
+	}
+	j.entries[key] = e
+
+	if len(j.entries) > maxCookies {
+		var oldest string
+		for k, candidate := range j.entries {
+			if oldest == "" || candidate.seq < j.entries[oldest].seq {
+				oldest = k
+			}
+		}
+		delete(j.entries, oldest)
+	}
+}
+
+// Cookies returns the cookies to send to u, longest path first and then oldest first
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u.Host)
+	secureScheme := u.Scheme == "https" || u.Scheme == "wss"
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	at := now()
+	var matched []*entry
+	for key, e := range j.entries {
+		if e.expired(at) {
+			delete(j.entries, key)
+			continue
+		}
+		if e.secure && !secureScheme {
+			continue
+		}
+		if e.hostOnly && host != e.domain || !e.hostOnly && !domainMatch(host, e.domain) {
+			continue
+		}
+		if !pathMatch(path, e.path) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].path) != len(matched[b].path) {
+			return len(matched[a].path) > len(matched[b].path)
+		}
+		return matched[a].seq < matched[b].seq
+	})
+	cookies := make([]*http.Cookie, len(matched))
+	for i, e := range matched {
+		cookies[i] = &http.Cookie{Name: e.name, Value: e.value}
+	}
+	return cookies
+}
+
+// List returns every unexpired cookie, ordered by domain, path and name
+func (j *Jar) List() []model.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	at := now()
+	list := []model.Cookie{}
+	for key, e := range j.entries {
+		if e.expired(at) {
+			delete(j.entries, key)
+			continue
+		}
+		c := model.Cookie{
+			Name:     e.name,
+			Value:    e.value,
+			Domain:   e.domain,
+			Path:     e.path,
+			HostOnly: e.hostOnly,
+			Secure:   e.secure,
+			HttpOnly: e.httpOnly,
+			SameSite: e.sameSite,
+		}
+		if !e.expires.IsZero() {
+			c.Expires = e.expires.UTC().Format(time.RFC3339)
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].Domain != list[b].Domain {
+			return list[a].Domain < list[b].Domain
+		}
+		if list[a].Path != list[b].Path {
+			return list[a].Path < list[b].Path
+		}
+		return list[a].Name < list[b].Name
+	})
+	return list
+}
+
+// Set adds or replaces a cookie by hand. An expiry in the past removes it
+func (j *Jar) Set(c model.Cookie) error {
+	if c.Name == "" || c.Domain == "" {
+		return fmt.Errorf("A cookie needs a name and a domain")
+	}
+	e := &entry{
+		name:     c.Name,
+		value:    c.Value,
+		domain:   canonicalHost(strings.TrimPrefix(c.Domain, ".")),
+		path:     c.Path,
+		hostOnly: c.HostOnly,
+		secure:   c.Secure,
+		httpOnly: c.HttpOnly,
+		sameSite: c.SameSite,
+	}
+	if !strings.HasPrefix(e.path, "/") {
+		e.path = "/"
+	}
+	if c.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, c.Expires)
+		if err != nil {
+			return fmt.Errorf("Invalid expires '%s', expected RFC 3339", c.Expires)
+		}
+		e.expires = expires
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.store(e)
+	return nil
+}
+
+// Delete removes the cookies with the given name, narrowed to a domain and path when they
+// are set, and reports how many were removed
+func (j *Jar) Delete(name, domain, path string) int {
+	domain = canonicalHost(strings.TrimPrefix(domain, "."))
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	removed := 0
+	for key, e := range j.entries {
+		if e.name == name && (domain == "" || e.domain == domain) && (path == "" || e.path == path) {
+			delete(j.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len counts the cookies currently held, expired ones included
+func (j *Jar) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// canonicalHost lower-cases the host and strips the port and a trailing dot
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// publicSuffix reports whether anyone can register names directly under domain
+func publicSuffix(domain string) bool {
+	_, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	return err != nil
+}
+
+// domainMatch implements RFC 6265 section 5.1.3
+func domainMatch(host, domain string) bool {
+	return host == domain || net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch implements RFC 6265 section 5.1.4
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+// defaultPath implements RFC 6265 section 5.1.4: the request path up to its last slash
+func defaultPath(requestPath string) string {
+	if !strings.HasPrefix(requestPath, "/") {
+		return "/"
+	}
+	i := strings.LastIndex(requestPath, "/")
+	if i == 0 {
+		return "/"
+	}
+	return requestPath[:i]
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
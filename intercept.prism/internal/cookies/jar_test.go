@@ -0,0 +1,140 @@
+package cookies
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func names(cookies []*http.Cookie) string {
+	var list []string
+	for _, c := range cookies {
+		list = append(list, c.Name)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestJar_DomainAndPath(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustParse(t, "http://api.example.com:8080/v1/login"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "shared", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "v1", Value: "3", Path: "/v1"},
+		{Name: "tld", Value: "4", Domain: "com"},
+		{Name: "foreign", Value: "5", Domain: "other.com"},
+	})
+	jar.SetCookies(mustParse(t, "https://shop.example.co.uk/"), []*http.Cookie{
+		{Name: "suffix", Value: "6", Domain: ".co.uk"},
+		{Name: "site", Value: "7", Domain: "example.co.uk"},
+	})
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://api.example.com/v1/users", "host,v1,shared"},
+		{"http://api.example.com/v1", "host,v1,shared"},
+		{"http://api.example.com/v10", "shared"},
+		{"http://www.example.com/v1/users", "shared"},
+		{"http://example.com/", "shared"},
+		{"http://other.com/", ""},
+		{"https://other.co.uk/", ""},
+		{"https://www.example.co.uk/", "site"},
+	}
+	for _, tt := range tests {
+		if got := names(jar.Cookies(mustParse(t, tt.url))); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.url, tt.expected, got)
+		}
+	}
+}
+
+func TestJar_SecureAndExpiry(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustParse(t, "http://example.com/"), []*http.Cookie{{Name: "insecure-origin", Value: "x", Secure: true}})
+	jar.SetCookies(mustParse(t, "https://example.com/"), []*http.Cookie{
+		{Name: "secure", Value: "1", Secure: true},
+		{Name: "short", Value: "2", MaxAge: 60},
+		{Name: "dated", Value: "3", Expires: time.Now().Add(2 * time.Hour)},
+	})
+
+	if got := names(jar.Cookies(mustParse(t, "http://example.com/"))); got != "short,dated" {
+		t.Errorf("Expected Secure cookies to stay off http, got %q", got)
+	}
+	if got := names(jar.Cookies(mustParse(t, "wss://example.com/"))); got != "secure,short,dated" {
+		t.Errorf("Expected Secure cookies over wss, got %q", got)
+	}
+
+	now = func() time.Time { return time.Now().Add(time.Hour) }
+	defer func() { now = time.Now }()
+	if got := names(jar.Cookies(mustParse(t, "https://example.com/"))); got != "secure,dated" {
+		t.Errorf("Expected the Max-Age cookie to expire, got %q", got)
+	}
+
+	// The server deletes a cookie with a past expiry
+	jar.SetCookies(mustParse(t, "https://example.com/"), []*http.Cookie{{Name: "dated", MaxAge: -1}})
+	if got := names(jar.Cookies(mustParse(t, "https://example.com/"))); got != "secure" {
+		t.Errorf("Expected the deleted cookie to be gone, got %q", got)
+	}
+}
+
+func TestJar_ListSetDelete(t *testing.T) {
+	jar := NewJar()
+	jar.SetCookies(mustParse(t, "https://example.com/app/page"), []*http.Cookie{{Name: "sid", Value: "abc", HttpOnly: true, SameSite: http.SameSiteLaxMode}})
+
+	list := jar.List()
+	expected := model.Cookie{Name: "sid", Value: "abc", Domain: "example.com", Path: "/app", HostOnly: true, HttpOnly: true, SameSite: "Lax"}
+	if len(list) != 1 || list[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, list)
+	}
+
+	// Editing replaces the cookie with the same name, domain and path
+	expected.Value = "edited"
+	if err := jar.Set(expected); err != nil {
+		t.Fatal(err)
+	}
+	if got := jar.Cookies(mustParse(t, "https://example.com/app/")); len(got) != 1 || got[0].Value != "edited" {
+		t.Errorf("Expected the edited value, got %v", got)
+	}
+
+	if err := jar.Set(model.Cookie{Name: "x", Domain: "example.com", Expires: "tomorrow"}); err == nil {
+		t.Error("Expected an invalid expiry to be rejected")
+	}
+	if err := jar.Set(model.Cookie{Name: "x"}); err == nil {
+		t.Error("Expected a cookie without a domain to be rejected")
+	}
+
+	if removed := jar.Delete("sid", "example.com", ""); removed != 1 || len(jar.List()) != 0 {
+		t.Errorf("Expected the cookie to be deleted, removed %d", removed)
+	}
+}
+
+func TestStore_Sessions(t *testing.T) {
+	store := NewStore()
+	store.Jar("ws", "a").Set(model.Cookie{Name: "sid", Domain: "example.com"})
+
+	if _, ok := store.Lookup("ws", "b"); ok {
+		t.Error("Expected sessions not to share a jar")
+	}
+	if _, ok := store.Lookup("other", "a"); ok {
+		t.Error("Expected workspaces not to share a jar")
+	}
+	if removed := store.Drop("ws", "a"); removed != 1 {
+		t.Errorf("Expected one cookie dropped, got %d", removed)
+	}
+	if _, ok := store.Lookup("ws", "a"); ok {
+		t.Error("Expected the jar to be gone")
+	}
+}
@@ -0,0 +1,79 @@
+package cookies
+
+import (
+	"sync"
+	"time"
+)
+
+// idleTimeout drops jars nobody has used for a while, like an abandoned browser session
+const idleTimeout = 24 * time.Hour
+
+// Store holds the cookie jars of every workspace and session
+type Store struct {
+	mu   sync.Mutex
+	jars map[string]*storedJar
+}
+
+type storedJar struct {
+	jar      *Jar
+	lastUsed time.Time
+}
+
+func NewStore() *Store {
+	return &Store{jars: make(map[string]*storedJar)}
+}
+
+// Global jar store
+var Jars = NewStore()
+
+func storeKey(workspaceID, sessionID string) string {
+	return workspaceID + "\x00" + sessionID
+}
+
+// Jar returns the session's jar, creating an empty one on first use
+func (s *Store) Jar(workspaceID, sessionID string) *Jar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictIdle()
+
+	key := storeKey(workspaceID, sessionID)
+	stored, ok := s.jars[key]
+	if !ok {
+		stored = &storedJar{jar: NewJar()}
+		s.jars[key] = stored
+	}
+	stored.lastUsed = time.Now()
+	return stored.jar
+}
+
+// Lookup returns the session's jar without creating one
+func (s *Store) Lookup(workspaceID, sessionID string) (*Jar, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jars[storeKey(workspaceID, sessionID)]
+	if !ok {
+		return nil, false
+	}
+	return stored.jar, true
+}
+
+// Drop forgets a session's jar and reports how many cookies it held
+func (s *Store) Drop(workspaceID, sessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := storeKey(workspaceID, sessionID)
+	stored, ok := s.jars[key]
+	if !ok {
+		return 0
+	}
+	delete(s.jars, key)
+	return stored.jar.Len()
+}
+
+func (s *Store) evictIdle() {
+	for key, stored := range s.jars {
+		if time.Since(stored.lastUsed) > idleTimeout {
+			delete(s.jars, key)
+		}
+	}
+}
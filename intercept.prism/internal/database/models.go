@@ -55,6 +55,14 @@ func (ns NullHttpMethod) Value() (driver.Value, error) {
 	return string(ns.HttpMethod), nil
 }
 
+type Environment struct {
+	ID          string
+	Name        string
+	Variables   []byte
+	WorkspaceId string
+	CreatedAt   pgtype.Timestamp
+}
+
 type Execution struct {
 	ID         string
 	RequestId  string
@@ -62,6 +70,8 @@ type Execution struct {
 	StatusCode pgtype.Int4
 	LatencyMs  pgtype.Int4
 	ExecutedAt pgtype.Timestamp
+	ErrorCount pgtype.Int4
+	Assertions []byte
 }
 
 type Request struct {
@@ -88,4 +98,5 @@ type Span struct {
 	Status       pgtype.Text
 	Tags         []byte
 	CreatedAt    pgtype.Timestamp
+	Events       []byte
 }
@@ -1,16 +1,27 @@
 -- name: InsertSpan :exec
-INSERT INTO "Span" ("id", "traceId", "spanId", "parentSpanId", "operation", "serviceName", "startTime", "duration", "status", "tags")
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+INSERT INTO "Span" ("id", "traceId", "spanId", "parentSpanId", "operation", "serviceName", "startTime", "duration", "status", "tags", "events")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 ON CONFLICT ("traceId", "spanId") DO NOTHING;
 
 -- name: InsertExecution :one
-INSERT INTO "Execution" ("id", "requestId", "traceId", "statusCode", "latencyMs")
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO "Execution" ("id", "requestId", "traceId", "statusCode", "latencyMs", "errorCount", "assertions")
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING "id";
 
 -- name: GetSpansByTraceID :many
 SELECT "id", "traceId", "spanId", "parentSpanId", "operation", "serviceName",
-       "startTime", "duration", "status", "tags"
+       "startTime", "duration", "status", "tags", "events"
 FROM "Span"
 WHERE "traceId" = $1
 ORDER BY "startTime";
+
+-- name: GetEnvironmentVariables :one
+SELECT "variables"
+FROM "Environment"
+WHERE "id" = $1 AND "workspaceId" = $2
+FOR UPDATE;
+
+-- name: UpdateEnvironmentVariables :exec
+UPDATE "Environment"
+SET "variables" = $1
+WHERE "id" = $2;
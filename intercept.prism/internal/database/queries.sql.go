@@ -11,9 +11,28 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const getEnvironmentVariables = `-- name: GetEnvironmentVariables :one
+SELECT "variables"
+FROM "Environment"
+WHERE "id" = $1 AND "workspaceId" = $2
+FOR UPDATE
+`
+
+type GetEnvironmentVariablesParams struct {
+	ID          string
+	WorkspaceId string
+}
+
+func (q *Queries) GetEnvironmentVariables(ctx context.Context, arg GetEnvironmentVariablesParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getEnvironmentVariables, arg.ID, arg.WorkspaceId)
+	var variables []byte
+	err := row.Scan(&variables)
+	return variables, err
+}
+
 const getSpansByTraceID = `-- name: GetSpansByTraceID :many
 SELECT "id", "traceId", "spanId", "parentSpanId", "operation", "serviceName",
-       "startTime", "duration", "status", "tags"
+       "startTime", "duration", "status", "tags", "events"
 FROM "Span"
 WHERE "traceId" = $1
 ORDER BY "startTime"
@@ -30,6 +49,7 @@ type GetSpansByTraceIDRow struct {
 	Duration     int64
 	Status       pgtype.Text
 	Tags         []byte
+	Events       []byte
 }
 
 func (q *Queries) GetSpansByTraceID(ctx context.Context, traceid string) ([]GetSpansByTraceIDRow, error) {
@@ -52,6 +72,7 @@ func (q *Queries) GetSpansByTraceID(ctx context.Context, traceid string) ([]GetS
 			&i.Duration,
 			&i.Status,
 			&i.Tags,
+			&i.Events,
 		); err != nil {
 			return nil, err
 		}
@@ -64,8 +85,8 @@ func (q *Queries) GetSpansByTraceID(ctx context.Context, traceid string) ([]GetS
 }
 
 const insertExecution = `-- name: InsertExecution :one
-INSERT INTO "Execution" ("id", "requestId", "traceId", "statusCode", "latencyMs")
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO "Execution" ("id", "requestId", "traceId", "statusCode", "latencyMs", "errorCount", "assertions")
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING "id"
 `
 
@@ -75,6 +96,8 @@ type InsertExecutionParams struct {
 	TraceId    string
 	StatusCode pgtype.Int4
 	LatencyMs  pgtype.Int4
+	ErrorCount pgtype.Int4
+	Assertions []byte
 }
 
 func (q *Queries) InsertExecution(ctx context.Context, arg InsertExecutionParams) (string, error) {
@@ -84,6 +107,8 @@ func (q *Queries) InsertExecution(ctx context.Context, arg InsertExecutionParams
 		arg.TraceId,
 		arg.StatusCode,
 		arg.LatencyMs,
+		arg.ErrorCount,
+		arg.Assertions,
 	)
 	var id string
 	err := row.Scan(&id)
@@ -91,8 +116,8 @@ func (q *Queries) InsertExecution(ctx context.Context, arg InsertExecutionParams
 }
 
 const insertSpan = `-- name: InsertSpan :exec
-INSERT INTO "Span" ("id", "traceId", "spanId", "parentSpanId", "operation", "serviceName", "startTime", "duration", "status", "tags")
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+INSERT INTO "Span" ("id", "traceId", "spanId", "parentSpanId", "operation", "serviceName", "startTime", "duration", "status", "tags", "events")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 ON CONFLICT ("traceId", "spanId") DO NOTHING
 `
 
@@ -107,6 +132,7 @@ type InsertSpanParams struct {
 	Duration     int64
 	Status       pgtype.Text
 	Tags         []byte
+	Events       []byte
 }
 
 func (q *Queries) InsertSpan(ctx context.Context, arg InsertSpanParams) error {
@@ -121,6 +147,23 @@ func (q *Queries) InsertSpan(ctx context.Context, arg InsertSpanParams) error {
 		arg.Duration,
 		arg.Status,
 		arg.Tags,
+		arg.Events,
 	)
 	return err
 }
+
+const updateEnvironmentVariables = `-- name: UpdateEnvironmentVariables :exec
+UPDATE "Environment"
+SET "variables" = $1
+WHERE "id" = $2
+`
+
+type UpdateEnvironmentVariablesParams struct {
+	Variables []byte
+	ID        string
+}
+
+func (q *Queries) UpdateEnvironmentVariables(ctx context.Context, arg UpdateEnvironmentVariablesParams) error {
+	_, err := q.db.Exec(ctx, updateEnvironmentVariables, arg.Variables, arg.ID)
+	return err
+}
@@ -22,6 +22,8 @@ CREATE TABLE "Execution" (
     "statusCode" INTEGER,
     "latencyMs" INTEGER,
     "executedAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "errorCount" INTEGER,
+    "assertions" JSONB,
     FOREIGN KEY ("requestId") REFERENCES "Request"("id")
 );
 
@@ -37,5 +39,14 @@ CREATE TABLE "Span" (
     "status" TEXT,
     "tags" JSONB,
     "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "events" JSONB,
     UNIQUE("traceId", "spanId")
 );
+
+CREATE TABLE "Environment" (
+    "id" TEXT PRIMARY KEY,
+    "name" TEXT NOT NULL,
+    "variables" JSONB NOT NULL,
+    "workspaceId" TEXT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
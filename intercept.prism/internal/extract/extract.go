@@ -0,0 +1,163 @@
+// Package extract pulls values out of responses into variables, so a request can feed
+// a token or an ID to the next one in a chain
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Response is what extractions read from
+type Response struct {
+	Headers map[string]string    // Looked up case-insensitively
+	Body    []byte               // Queried by jsonpath, xpath and regex
+	Message protoreflect.Message // Decoded gRPC response for field paths, nil for HTTP
+}
+
+// Validate rejects extractions that could never produce a value, before the request is
+// sent. fields allows gRPC field paths
+func Validate(list []model.Extraction, fields bool) error {
+	for i, e := range list {
+		if err := validate(e, fields); err != nil {
+			return fmt.Errorf("extract %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validate(e model.Extraction, fields bool) error {
+	name := e.Variable
+	switch {
+	case name == "":
+		return fmt.Errorf("variable requires a name")
+	case strings.HasPrefix(name, "$"):
+		return fmt.Errorf("variable '%s' cannot start with $, which marks helpers", name)
+	case strings.ContainsAny(name, "{} \t\r\n"):
+		return fmt.Errorf("variable '%s' cannot contain braces or whitespace", name)
+	}
+
+	var err error
+	switch strings.ToLower(e.From) {
+	case "jsonpath":
+		err = assertions.CheckJSONPath(e.Path)
+	case "xpath":
+		err = assertions.CheckXPath(e.Path)
+	case "regex":
+		_, err = regexp.Compile(e.Path)
+		if err != nil {
+			err = fmt.Errorf("invalid pattern: %v", err)
+		}
+	case "header":
+		if e.Path == "" {
+			err = fmt.Errorf("header requires a path with the header name")
+		}
+	case "field":
+		if !fields {
+			return fmt.Errorf("field paths only apply to gRPC responses")
+		}
+		_, err = parseFieldPath(e.Path)
+	default:
+		err = fmt.Errorf("unknown source '%s', expected jsonpath, xpath, regex, header or field", e.From)
+	}
+	return err
+}
+
+// Run evaluates the extractions in order. A later extraction of the same variable
+// overrides an earlier one only when it finds a value. It returns nil for no extractions
+func Run(list []model.Extraction, resp Response) *model.ExtractResult {
+	if len(list) == 0 {
+		return nil
+	}
+	result := &model.ExtractResult{Variables: map[string]string{}}
+	for _, e := range list {
+		value, err := extract(e, resp)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", e.Variable, err))
+			continue
+		}
+		result.Variables[e.Variable] = value
+	}
+	return result
+}
+
+// Secrets lists the variables marked secret, which are masked when saved
+func Secrets(list []model.Extraction) map[string]bool {
+	secrets := map[string]bool{}
+	for _, e := range list {
+		if e.Secret {
+			secrets[e.Variable] = true
+		}
+	}
+	return secrets
+}
+
+// Names returns the extracted variable names in order, for span tags that must not carry
+// the values
+func Names(result *model.ExtractResult) []string {
+	names := make([]string, 0, len(result.Variables))
+	for name := range result.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func extract(e model.Extraction, resp Response) (string, error) {
+	switch strings.ToLower(e.From) {
+	case "jsonpath":
+		doc, err := assertions.DecodeJSON(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("Body is not JSON: %v", err)
+		}
+		values, err := assertions.SelectJSON(doc, e.Path)
+		if err != nil {
+			return "", err
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("no value at %s", e.Path)
+		}
+		return assertions.FormatValue(values[0]), nil
+	case "xpath":
+		values, err := assertions.SelectXML(resp.Body, e.Path)
+		if err != nil {
+			return "", err
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("no node at %s", e.Path)
+		}
+		return values[0], nil
+	case "regex":
+		pattern, err := regexp.Compile(e.Path)
+		if err != nil {
+			return "", err
+		}
+		// The first capture group when the pattern has one, the whole match otherwise
+		match := pattern.FindSubmatch(resp.Body)
+		if match == nil {
+			return "", fmt.Errorf("no match for %s", e.Path)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	case "header":
+		for key, value := range resp.Headers {
+			if strings.EqualFold(key, e.Path) {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("no header %s", e.Path)
+	case "field":
+		if resp.Message == nil {
+			return "", fmt.Errorf("no response message")
+		}
+		return fieldValue(resp.Message, e.Path)
+	}
+	return "", fmt.Errorf("unknown source '%s'", e.From)
+}
@@ -0,0 +1,158 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRun(t *testing.T) {
+	resp := Response{
+		Headers: map[string]string{"X-Request-Id": "req-7"},
+		Body:    []byte(`{"token":"eyJhbGciOi","user":{"id":9007199254740993,"roles":["admin","dev"]},"expires_in":3600,"next":"/page?sid=abc"}`),
+	}
+	result := Run([]model.Extraction{
+		{Variable: "token", From: "jsonpath", Path: "$.token", Secret: true},
+		{Variable: "userId", From: "jsonpath", Path: "user.id"},
+		{Variable: "roles", From: "jsonpath", Path: "$.user.roles"},
+		{Variable: "firstRole", From: "jsonpath", Path: "$.user.roles[*]"},
+		{Variable: "requestId", From: "header", Path: "x-request-id"},
+		{Variable: "sid", From: "regex", Path: `sid=(\w+)`},
+		{Variable: "expires", From: "regex", Path: `"expires_in":\d+`},
+		{Variable: "email", From: "jsonpath", Path: "$.user.email"},
+		{Variable: "trace", From: "header", Path: "traceparent"},
+	}, resp)
+
+	expected := map[string]string{
+		"token":     "eyJhbGciOi",
+		"userId":    "9007199254740993",
+		"roles":     `["admin","dev"]`,
+		"firstRole": "admin",
+		"requestId": "req-7",
+		"sid":       "abc",
+		"expires":   `"expires_in":3600`,
+	}
+	for name, value := range expected {
+		if result.Variables[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, result.Variables[name])
+		}
+	}
+	if len(result.Variables) != len(expected) {
+		t.Errorf("Unexpected variables %v", result.Variables)
+	}
+	if len(result.Failures) != 2 || !strings.HasPrefix(result.Failures[0], "email: no value at $.user.email") || !strings.HasPrefix(result.Failures[1], "trace: no header") {
+		t.Errorf("Unexpected failures %q", result.Failures)
+	}
+	if names := strings.Join(Names(result), ","); names != "expires,firstRole,requestId,roles,sid,token,userId" {
+		t.Errorf("Unexpected names %s", names)
+	}
+	if secrets := Secrets([]model.Extraction{{Variable: "token", Secret: true}, {Variable: "userId"}}); !secrets["token"] || secrets["userId"] {
+		t.Errorf("Unexpected secrets %v", secrets)
+	}
+	if Run(nil, resp) != nil {
+		t.Error("Expected no result without extractions")
+	}
+}
+
+func TestRun_XPath(t *testing.T) {
+	resp := Response{Body: []byte(`<session><token expires="60">abc123</token><user id="u1"/></session>`)}
+	result := Run([]model.Extraction{
+		{Variable: "token", From: "xpath", Path: "/session/token"},
+		{Variable: "userId", From: "xpath", Path: "//user/@id"},
+		{Variable: "missing", From: "xpath", Path: "//refresh"},
+	}, resp)
+	if result.Variables["token"] != "abc123" || result.Variables["userId"] != "u1" {
+		t.Errorf("Unexpected variables %v", result.Variables)
+	}
+	if len(result.Failures) != 1 || !strings.HasPrefix(result.Failures[0], "missing: no node") {
+		t.Errorf("Unexpected failures %q", result.Failures)
+	}
+}
+
+func TestRun_Field(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name: proto.String("user.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("user_id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+				{Name: proto.String("tags"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+			},
+		}},
+	}
+	labels, _ := structpb.NewStruct(map[string]any{"session": map[string]any{"token": "t-1"}, "ttl": 30})
+
+	tests := []struct {
+		message proto.Message
+		path    string
+		value   string
+		problem string
+	}{
+		{file, "name", "user.proto", ""},
+		{file, "message_type[0].name", "User", ""},
+		{file, "messageType[0].field[-1].label", "LABEL_REPEATED", ""},
+		{file, "message_type[0].field[0].number", "1", ""},
+		{file, "message_type[0].field[0].type", "TYPE_STRING", ""},
+		{file, "message_type[0].field[1].type", "TYPE_DOUBLE", ""},
+		{file, "message_type[0].field[0].options", "", "options is not set"},
+		{file, "message_type[1].name", "", "message_type has no item 1"},
+		{file, "message_type.name", "", "message_type is not a message"},
+		{file, "message_type", "", "is a list or map"},
+		{file, "syntax_version", "", "has no field syntax_version"},
+		{labels, `fields["session"].struct_value.fields[token].string_value`, "t-1", ""},
+		{labels, "fields[ttl].number_value", "30", ""},
+		{labels, "fields[ttl]", `30`, ""},
+		{labels, "fields[other]", "", "fields has no key other"},
+	}
+	for _, tt := range tests {
+		result := Run([]model.Extraction{{Variable: "v", From: "field", Path: tt.path}}, Response{Message: tt.message.ProtoReflect()})
+		if tt.problem != "" {
+			if len(result.Failures) != 1 || !strings.Contains(result.Failures[0], tt.problem) {
+				t.Errorf("%s: expected %q, got %v %q", tt.path, tt.problem, result.Variables, result.Failures)
+			}
+			continue
+		}
+		if value, ok := result.Variables["v"]; !ok || value != tt.value {
+			t.Errorf("%s: expected %q, got %q %q", tt.path, tt.value, value, result.Failures)
+		}
+	}
+
+	result := Run([]model.Extraction{{Variable: "v", From: "field", Path: "name"}}, Response{})
+	if len(result.Failures) != 1 || result.Failures[0] != "v: no response message" {
+		t.Errorf("Expected a failure without a message, got %q", result.Failures)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		extraction model.Extraction
+		problem    string
+	}{
+		{model.Extraction{From: "header", Path: "X-Token"}, "variable requires a name"},
+		{model.Extraction{Variable: "$token", From: "header", Path: "X-Token"}, "cannot start with $"},
+		{model.Extraction{Variable: "my token", From: "header", Path: "X-Token"}, "cannot contain braces or whitespace"},
+		{model.Extraction{Variable: "token", From: "body"}, "unknown source 'body'"},
+		{model.Extraction{Variable: "token", From: "header"}, "header requires a path"},
+		{model.Extraction{Variable: "token", From: "jsonpath", Path: "$.items[?(@.id)]"}, "filter expressions are not supported"},
+		{model.Extraction{Variable: "token", From: "xpath", Path: "//a[position() < 2]"}, "unsupported predicate"},
+		{model.Extraction{Variable: "token", From: "regex", Path: "("}, "invalid pattern"},
+		{model.Extraction{Variable: "token", From: "field", Path: "user.token"}, "field paths only apply to gRPC responses"},
+	}
+	for _, tt := range tests {
+		err := Validate([]model.Extraction{{Variable: "ok", From: "header", Path: "X-Ok"}, tt.extraction}, false)
+		if err == nil || !strings.Contains(err.Error(), tt.problem) || !strings.HasPrefix(err.Error(), "extract 2: ") {
+			t.Errorf("%+v: expected %q, got %v", tt.extraction, tt.problem, err)
+		}
+	}
+
+	for _, path := range []string{"user.tokens[0]", `labels["env"]`, "user..id", "tokens[0"} {
+		err := Validate([]model.Extraction{{Variable: "v", From: "field", Path: path}}, true)
+		if valid := !strings.Contains(path, "..") && !strings.HasSuffix(path, "[0"); (err == nil) != valid {
+			t.Errorf("%s: unexpected validation result %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package extract
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldStep is a field name followed by list indexes or map keys, e.g. tokens[0]
+type fieldStep struct {
+	name string
+	keys []string
+}
+
+// parseFieldPath reads paths such as user.tokens[0].value or labels["env"], with proto or
+// JSON field names
+func parseFieldPath(path string) ([]fieldStep, error) {
+	p := strings.TrimSpace(path)
+	if p == "" {
+		return nil, fmt.Errorf("field requires a path")
+	}
+
+	var steps []fieldStep
+	for p != "" {
+		end := strings.IndexAny(p, ".[")
+		if end < 0 {
+			end = len(p)
+		}
+		step := fieldStep{name: p[:end]}
+		if step.name == "" {
+			return nil, fmt.Errorf("empty field name in path '%s'", path)
+		}
+		p = p[end:]
+
+		for strings.HasPrefix(p, "[") {
+			closing := strings.IndexByte(p, ']')
+			if closing < 0 {
+				return nil, fmt.Errorf("unclosed [ in path '%s'", path)
+			}
+			key := strings.TrimSpace(p[1:closing])
+			if len(key) >= 2 && (key[0] == '\'' || key[0] == '"') && key[len(key)-1] == key[0] {
+				key = key[1 : len(key)-1]
+			}
+			step.keys = append(step.keys, key)
+			p = p[closing+1:]
+		}
+		if strings.HasPrefix(p, ".") {
+			p = p[1:]
+			if p == "" {
+				return nil, fmt.Errorf("path '%s' ends with .", path)
+			}
+		} else if p != "" {
+			return nil, fmt.Errorf("unexpected '%s' in path '%s'", p, path)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// fieldValue walks a response message and renders the value it reaches. Unset scalar
+// fields read as their default, as they do in protojson with defaults emitted
+func fieldValue(msg protoreflect.Message, path string) (string, error) {
+	steps, err := parseFieldPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var value protoreflect.Value
+	var fd protoreflect.FieldDescriptor
+	for i, step := range steps {
+		if i > 0 {
+			if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind || fd.IsList() || fd.IsMap() {
+				return "", fmt.Errorf("%s is not a message", steps[i-1].name)
+			}
+			msg = value.Message()
+		}
+
+		fields := msg.Descriptor().Fields()
+		fd = fields.ByName(protoreflect.Name(step.name))
+		if fd == nil {
+			fd = fields.ByJSONName(step.name)
+		}
+		if fd == nil {
+			return "", fmt.Errorf("%s has no field %s", msg.Descriptor().FullName(), step.name)
+		}
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && !msg.Has(fd) {
+			return "", fmt.Errorf("%s is not set", step.name)
+		}
+		value = msg.Get(fd)
+
+		for _, key := range step.keys {
+			switch {
+			case fd.IsList():
+				list := value.List()
+				n, err := strconv.Atoi(key)
+				if err != nil {
+					return "", fmt.Errorf("%s is a list, expected an index, got '%s'", step.name, key)
+				}
+				if n < 0 {
+					n += list.Len()
+				}
+				if n < 0 || n >= list.Len() {
+					return "", fmt.Errorf("%s has no item %s", step.name, key)
+				}
+				value = list.Get(n)
+			case fd.IsMap():
+				mapKey, err := parseMapKey(fd.MapKey(), key)
+				if err != nil {
+					return "", fmt.Errorf("%s: %v", step.name, err)
+				}
+				if !value.Map().Has(mapKey) {
+					return "", fmt.Errorf("%s has no key %s", step.name, key)
+				}
+				value = value.Map().Get(mapKey)
+				fd = fd.MapValue()
+			default:
+				return "", fmt.Errorf("%s is not a list or map", step.name)
+			}
+			// An item or map value is walked as a plain field of its kind
+			fd = singular{fd}
+		}
+	}
+	return formatField(fd, value)
+}
+
+// singular describes one item of a list or a map value, so the walk treats it as a
+// plain field of the same kind
+type singular struct{ protoreflect.FieldDescriptor }
+
+func (singular) IsList() bool { return false }
+func (singular) IsMap() bool  { return false }
+
+func parseMapKey(fd protoreflect.FieldDescriptor, key string) (protoreflect.MapKey, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(key).MapKey(), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(key)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("expected a bool key, got '%s'", key)
+		}
+		return protoreflect.ValueOfBool(b).MapKey(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(key, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("expected an integer key, got '%s'", key)
+		}
+		return protoreflect.ValueOfInt32(int32(n)).MapKey(), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("expected an integer key, got '%s'", key)
+		}
+		return protoreflect.ValueOfInt64(n).MapKey(), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("expected an unsigned key, got '%s'", key)
+		}
+		return protoreflect.ValueOfUint32(uint32(n)).MapKey(), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, fmt.Errorf("expected an unsigned key, got '%s'", key)
+		}
+		return protoreflect.ValueOfUint64(n).MapKey(), nil
+	}
+	return protoreflect.MapKey{}, fmt.Errorf("unsupported key kind %s", fd.Kind())
+}
+
+// formatField renders scalars as text, enums by name, bytes as base64 and messages as
+// protojson. Lists and maps have to be indexed
+func formatField(fd protoreflect.FieldDescriptor, value protoreflect.Value) (string, error) {
+	if fd.IsList() || fd.IsMap() {
+		return "", fmt.Errorf("%s is a list or map, select an item with [ ]", fd.Name())
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return value.String(), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes()), nil
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(value.Enum()); ev != nil {
+			return string(ev.Name()), nil
+		}
+		return strconv.Itoa(int(value.Enum())), nil
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 32), nil
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		encoded, err := protojson.Marshal(value.Message().Interface())
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+	// Booleans and integers
+	return value.String(), nil
+}
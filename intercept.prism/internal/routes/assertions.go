@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// addAssertionTags summarises assertion results on the span and reports whether any
+// failed, which fails the span as well
+func addAssertionTags(tags map[string]string, results []model.AssertionResult) bool {
+	if len(results) == 0 {
+		return false
+	}
+	failed := assertions.Failed(results)
+	tags["assertions.total"] = fmt.Sprintf("%d", len(results))
+	tags["assertions.failed"] = fmt.Sprintf("%d", failed)
+	if failed == 0 {
+		return false
+	}
+	var names []string
+	for _, r := range results {
+		if !r.Passed {
+			names = append(names, r.Name)
+		}
+	}
+	tags["assertions.failures"] = strings.Join(names, "; ")
+	return true
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yendelevium/intercept.prism/internal/cookies"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func cookieRoutes(superRouter *gin.RouterGroup) {
+	cookieRouter := superRouter.Group("/cookies")
+	{
+		cookieRouter.GET("", listCookies)
+		cookieRouter.PUT("", setCookie)
+		cookieRouter.DELETE("", deleteCookies)
+	}
+}
+
+// requireJar checks that a cookie jar is addressed by both workspace and session, so callers
+// in different workspaces never share a jar under a common session name
+func requireJar(workspaceID, sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session_id is required")
+	}
+	if workspaceID == "" {
+		return fmt.Errorf("workspace_id is required")
+	}
+	return nil
+}
+
+// validateSession checks the jar of an executor request, which is optional
+func validateSession(workspaceID, sessionID string) error {
+	if sessionID != "" && workspaceID == "" {
+		return fmt.Errorf("session_id requires a workspace_id to scope its cookie jar")
+	}
+	return nil
+}
+
+// sessionJar returns the cookie jar for a request, or nil when it has no session_id
+func sessionJar(workspaceID, sessionID string) http.CookieJar {
+	if sessionID == "" {
+		return nil
+	}
+	return cookies.Jars.Jar(workspaceID, sessionID)
+}
+
+// addCookieTags records which jar a request used and how many cookies went each way.
+// Values are left out, they are as sensitive as credentials
+func addCookieTags(tags map[string]string, sessionID string, sent, set int) {
+	if sessionID == "" {
+		return
+	}
+	tags["http.cookie_jar"] = sessionID
+	tags["http.cookies.sent"] = fmt.Sprintf("%d", sent)
+	tags["http.cookies.set"] = fmt.Sprintf("%d", set)
+}
+
+// listCookies godoc
+// @Summary      List a session's cookies
+// @Description  Returns the unexpired cookies in the jar of a workspace and session, as sent by REST and GraphQL requests with the same `workspace_id` and `session_id`
+// @Tags         Cookies
+// @Produce      json
+// @Param        workspace_id query string true "Workspace ID"
+// @Param        session_id query string true "Session ID"
+// @Success      200 {object} model.CookieJarResponse "Cookies, empty when the jar does not exist"
+// @Failure      400 {object} model.CookieJarResponse "Missing workspace_id or session_id"
+// @Router       /cookies [get]
+func listCookies(c *gin.Context) {
+	workspaceID, sessionID := c.Query("workspace_id"), c.Query("session_id")
+	if err := requireJar(workspaceID, sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, model.CookieJarResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+
+	response := model.CookieJarResponse{
+		StatusCode:  http.StatusOK,
+		WorkspaceID: workspaceID,
+		SessionID:   sessionID,
+		Cookies:     []model.Cookie{},
+	}
+	if jar, ok := cookies.Jars.Lookup(workspaceID, sessionID); ok {
+		response.Cookies = jar.List()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setCookie godoc
+// @Summary      Add or edit a cookie
+// @Description  Stores a cookie in a session's jar, replacing the one with the same name, domain and path. Path defaults to /, and an `expires` in the past removes the cookie
+// @Tags         Cookies
+// @Accept       json
+// @Produce      json
+// @Param        request body model.CookieJarUpdate true "Cookie to store"
+// @Success      200 {object} model.CookieJarResponse "The jar after the update"
+// @Failure      400 {object} model.CookieJarResponse "Invalid cookie or missing workspace_id or session_id"
+// @Router       /cookies [put]
+func setCookie(c *gin.Context) {
+	reqBody := model.CookieJarUpdate{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.CookieJarResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+	if err := requireJar(reqBody.WorkspaceID, reqBody.SessionID); err != nil {
+		c.JSON(http.StatusBadRequest, model.CookieJarResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+
+	jar := cookies.Jars.Jar(reqBody.WorkspaceID, reqBody.SessionID)
+	if err := jar.Set(reqBody.Cookie); err != nil {
+		c.JSON(http.StatusBadRequest, model.CookieJarResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.CookieJarResponse{
+		StatusCode:  http.StatusOK,
+		WorkspaceID: reqBody.WorkspaceID,
+		SessionID:   reqBody.SessionID,
+		Cookies:     jar.List(),
+	})
+}
+
+// deleteCookies godoc
+// @Summary      Delete cookies or clear a jar
+// @Description  With `name`, removes that cookie, narrowed to `domain` and `path` when given. Without it the whole jar of the session is dropped
+// @Tags         Cookies
+// @Produce      json
+// @Param        workspace_id query string true "Workspace ID"
+// @Param        session_id query string true "Session ID"
+// @Param        name query string false "Cookie name"
+// @Param        domain query string false "Cookie domain"
+// @Param        path query string false "Cookie path"
+// @Success      200 {object} model.CookieJarResponse "Remaining cookies and how many were removed"
+// @Failure      400 {object} model.CookieJarResponse "Missing workspace_id or session_id"
+// @Router       /cookies [delete]
+func deleteCookies(c *gin.Context) {
+	workspaceID, sessionID := c.Query("workspace_id"), c.Query("session_id")
+	if err := requireJar(workspaceID, sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, model.CookieJarResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+
+	response := model.CookieJarResponse{
+		StatusCode:  http.StatusOK,
+		WorkspaceID: workspaceID,
+		SessionID:   sessionID,
+		Cookies:     []model.Cookie{},
+	}
+	name := c.Query("name")
+	if name == "" {
+		response.Removed = cookies.Jars.Drop(workspaceID, sessionID)
+	} else if jar, ok := cookies.Jars.Lookup(workspaceID, sessionID); ok {
+		response.Removed = jar.Delete(name, c.Query("domain"), c.Query("path"))
+		response.Cookies = jar.List()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func setupCookieRouter() *gin.Engine {
+	r := gin.New()
+	restRoutes(r.Group("/"))
+	cookieRoutes(r.Group("/"))
+	return r
+}
+
+func TestRestRoute_CookieJar(t *testing.T) {
+	router := setupCookieRouter()
+
+	var received string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Cookie")
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	send := func(path, sessionID string) model.RestResponse {
+		jsonBody, _ := json.Marshal(model.RestRequest{
+			Method:      "GET",
+			URL:         mockServer.URL + path,
+			WorkspaceID: "ws-cookies",
+			SessionID:   sessionID,
+		})
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := send("/login", "s1")
+	if resp.Spans[0].Tags["http.cookie_jar"] != "s1" || resp.Spans[0].Tags["http.cookies.set"] != "1" {
+		t.Errorf("Expected cookie jar tags, got %v", resp.Spans[0].Tags)
+	}
+	resp = send("/profile", "s1")
+	if received != "sid=abc" || resp.Spans[0].Tags["http.cookies.sent"] != "1" {
+		t.Errorf("Expected the session cookie to be sent, got %q %v", received, resp.Spans[0].Tags)
+	}
+
+	// Other sessions and requests without one have no cookies
+	send("/profile", "s2")
+	if received != "" {
+		t.Errorf("Expected no cookies for another session, got %q", received)
+	}
+	resp = send("/profile", "")
+	if received != "" || resp.Spans[0].Tags["http.cookie_jar"] != "" {
+		t.Errorf("Expected no jar without a session, got %q", received)
+	}
+
+	// Edit the cookie through the API
+	host, _ := url.Parse(mockServer.URL)
+	jsonBody, _ := json.Marshal(model.CookieJarUpdate{
+		WorkspaceID: "ws-cookies",
+		SessionID:   "s1",
+		Cookie:      model.Cookie{Name: "sid", Value: "edited", Domain: host.Hostname(), Path: "/", HostOnly: true},
+	})
+	req, _ := http.NewRequest("PUT", "/cookies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the cookie to be stored, got %d %s", w.Code, w.Body.String())
+	}
+	send("/profile", "s1")
+	if received != "sid=edited" {
+		t.Errorf("Expected the edited cookie, got %q", received)
+	}
+
+	req, _ = http.NewRequest("GET", "/cookies?workspace_id=ws-cookies&session_id=s1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var listed model.CookieJarResponse
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed.Cookies) != 1 || listed.Cookies[0].Value != "edited" {
+		t.Errorf("Expected the jar to list the cookie, got %+v", listed)
+	}
+
+	// Clearing the jar stops the cookie being sent
+	req, _ = http.NewRequest("DELETE", "/cookies?workspace_id=ws-cookies&session_id=s1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var cleared model.CookieJarResponse
+	json.Unmarshal(w.Body.Bytes(), &cleared)
+	if cleared.Removed != 1 {
+		t.Errorf("Expected one cookie removed, got %+v", cleared)
+	}
+	send("/profile", "s1")
+	if received != "" {
+		t.Errorf("Expected no cookies after clearing, got %q", received)
+	}
+}
+
+func TestCookieJar_RequiresWorkspace(t *testing.T) {
+	router := setupCookieRouter()
+
+	code, resp := postJSON[model.RestResponse](t, router, "/rest/", model.RestRequest{
+		Method:    "GET",
+		URL:       "http://localhost/profile",
+		SessionID: "default",
+	})
+	if code != http.StatusBadRequest || resp.Error != "session_id requires a workspace_id to scope its cookie jar" {
+		t.Errorf("Expected 400 for a session without a workspace, got %d: %s", code, resp.Error)
+	}
+
+	for _, method := range []string{"GET", "DELETE"} {
+		req, _ := http.NewRequest(method, "/cookies?session_id=default", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 without workspace_id, got %d", method, w.Code)
+		}
+	}
+	jsonBody, _ := json.Marshal(model.CookieJarUpdate{SessionID: "default", Cookie: model.Cookie{Name: "sid", Value: "x", Domain: "localhost"}})
+	req, _ := http.NewRequest("PUT", "/cookies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT: expected 400 without workspace_id, got %d", w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/internal/extract"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/templating"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// expandExtractions resolves the paths, so a pattern can include an environment value
+func expandExtractions(r *templating.Resolver, list []model.Extraction) {
+	for i := range list {
+		list[i].Path = r.Expand(list[i].Path)
+	}
+}
+
+// validateExtract checks the extract block before the request is sent. Saving needs the
+// workspace the environment belongs to
+func validateExtract(list []model.Extraction, fields bool, environmentID, workspaceID string) error {
+	if err := extract.Validate(list, fields); err != nil {
+		return err
+	}
+	if environmentID != "" && workspaceID == "" {
+		return fmt.Errorf("save_to_environment requires a workspace_id")
+	}
+	return nil
+}
+
+// addExtractTags names the extracted variables on the span. Values stay out of the tags,
+// they are often credentials
+func addExtractTags(tags map[string]string, result *model.ExtractResult) {
+	if result == nil {
+		return
+	}
+	tags["extract.variables"] = strings.Join(extract.Names(result), ", ")
+	if len(result.Failures) > 0 {
+		tags["extract.failures"] = fmt.Sprintf("%d", len(result.Failures))
+	}
+}
+
+// saveExtracted writes the extracted variables to the request's environment. Problems are
+// reported in the result instead of failing a request that already completed
+func saveExtracted(result *model.ExtractResult, list []model.Extraction, environmentID, workspaceID string) {
+	if result == nil || environmentID == "" {
+		return
+	}
+	result.EnvironmentID = environmentID
+	if len(result.Variables) == 0 {
+		result.SaveError = "No variables were extracted"
+		return
+	}
+
+	readonly, err := store.SaveEnvironmentVariables(environmentID, workspaceID, result.Variables, extract.Secrets(list))
+	switch {
+	case errors.Is(err, store.ErrEnvironmentNotFound):
+		result.SaveError = fmt.Sprintf("Environment %s not found in workspace %s", environmentID, workspaceID)
+	case err != nil:
+		log.Printf("Failed to save extracted variables to environment %s: %v", environmentID, err)
+		result.SaveError = err.Error()
+	default:
+		result.Saved = true
+		result.Readonly = readonly
+	}
+}
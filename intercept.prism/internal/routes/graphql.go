@@ -1,9 +1,7 @@
 package routes
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -11,6 +9,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/extract"
 	"github.com/yendelevium/intercept.prism/internal/store"
 	"github.com/yendelevium/intercept.prism/internal/tracing"
 	"github.com/yendelevium/intercept.prism/model"
@@ -20,25 +21,39 @@ func graphqlRoutes(superRouter *gin.RouterGroup) {
 	graphqlRouter := superRouter.Group("/graphql")
 	{
 		graphqlRouter.POST("/", executeGraphQLRequest)
+		graphqlRouter.POST("/introspect", introspectGraphQLSchema)
+		graphqlRouter.POST("/diff", diffGraphQLSchemas)
+		graphqlRouter.POST("/subscribe", executeGraphQLSubscription)
 	}
 }
 
 // graphqlRequestBody is the standard GraphQL POST body sent to the target server
 type graphqlRequestBody struct {
-	Query         string         `json:"query"`
+	Query         string         `json:"query,omitempty"` // Left out when only a persisted query hash is sent
 	Variables     map[string]any `json:"variables,omitempty"`
 	OperationName string         `json:"operationName,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
 }
 
 // executeGraphQLRequest godoc
 // @Summary      Execute a GraphQL request
-// @Description  Proxies a GraphQL request to a target endpoint with tracing enabled
+// @Description  Proxies a GraphQL request to a target endpoint with tracing enabled.
+// @Description  `{{name}}` references and `{{$helper}}` calls in the URL, headers, query and variables are resolved from `environment` first, as for REST requests.
+// @Description  `auth` is applied to every HTTP request of the operation, as for REST requests.
+// @Description  `assertions` are checked against the response as for REST requests.
+// @Description  `extract` pulls values out of the response into variables and optionally saves them to `save_to_environment`, as for REST requests.
+// @Description  A `session_id`, which requires a `workspace_id`, sends and stores cookies through the session's jar, shared with REST requests of the same workspace and session.
+// @Description  An errors array in the response body is returned in `errors` and marks the span and execution as failed, even with HTTP 200.
+// @Description  Resolver timings in `extensions.tracing` (Apollo tracing) or `extensions.ftv1` (federated trace) become child spans of the request span; set `include_trace` to ask Apollo subgraphs for ftv1.
+// @Description  The operation is sent as a JSON POST by default. `method: GET` encodes it in the query string, `batch` sends several operations as a JSON array, `uploads` switches to the GraphQL multipart request spec, and `persisted_query` sends the sha256 hash first and the query only when the server has not seen it.
+// @Description  The query's depth, field, alias and fragment counts and an estimated complexity are returned in `analysis` and tagged on the span. With an introspected schema, list fields multiply the cost of their selections by their first/last/limit argument (10 if absent), honouring `@listSize` and `@cost` where the schema declares them.
+// @Description  When the endpoint's schema has been introspected, the query and variables are validated first and errors are returned without contacting the target unless `skip_validation` is set
 // @Tags         GraphQL
 // @Accept       json
 // @Produce      json
 // @Param        request body model.GraphQLRequest true "GraphQL request configuration"
 // @Success      200 {object} model.GraphQLResponse "Successful response with tracing info"
-// @Failure      400 {object} model.GraphQLResponse "Invalid request body"
+// @Failure      400 {object} model.GraphQLResponse "Invalid request body, or the query failed validation"
 // @Failure      500 {object} model.GraphQLResponse "Request execution failed"
 // @Router       /graphql/ [post]
 func executeGraphQLRequest(c *gin.Context) {
@@ -54,59 +69,73 @@ func executeGraphQLRequest(c *gin.Context) {
 	}
 	log.Println("GraphQL Request Received")
 
+	// Resolve {{variables}} from the request's environment
+	if err := expandGraphQLRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
 	// Get the request ID from the body
 	requestID := reqBody.RequestID
 
+	// Check the query against the endpoint's introspected schema, if there is one
+	validated, ok := checkGraphQLRequest(c, reqBody)
+	if !ok {
+		return
+	}
+
+	// Measure the query's depth and estimated cost before it is sent
+	analysis := analyzeGraphQLRequest(reqBody)
+
 	// Generate IDs upfront
 	executionID := uuid.New().String()
 	spanID := tracing.GenerateSpanID()
 	traceID := tracing.GenerateTraceID()
 
-	// Build standard GraphQL POST body
-	gqlBody := graphqlRequestBody{
-		Query:         reqBody.Query,
-		Variables:     reqBody.Variables,
-		OperationName: reqBody.OperationName,
-	}
-	gqlBodyBytes, err := json.Marshal(gqlBody)
+	// Work out how the operation is sent: POST, GET, batch or multipart
+	transport, err := newGraphQLTransport(reqBody)
 	if err != nil {
-		response := model.GraphQLResponse{
-			StatusCode: http.StatusInternalServerError,
-			Error:      "Failed to marshal GraphQL request body",
-		}
-		c.JSON(http.StatusInternalServerError, response)
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
 		return
 	}
 
-	// Construct the HTTP request
-	remoteReq, err := http.NewRequest("POST", reqBody.URL, strings.NewReader(string(gqlBodyBytes)))
+	// Fetch or reuse the OAuth2 access token, with token endpoint calls under the request's span
+	tokenSpans, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, spanID)
 	if err != nil {
-		response := model.GraphQLResponse{
-			StatusCode: http.StatusInternalServerError,
+		c.JSON(code, model.GraphQLResponse{
+			StatusCode: code,
 			Error:      err.Error(),
-		}
-		c.JSON(http.StatusInternalServerError, response)
+			TraceID:    traceID,
+			SpanID:     spanID,
+			Spans:      tokenSpans,
+		})
 		return
 	}
 
-	// Set Content-Type for GraphQL
-	remoteReq.Header.Set("Content-Type", "application/json")
-
-	// Add custom headers (may override Content-Type if user intends to)
-	for key, value := range reqBody.Headers {
-		remoteReq.Header.Set(key, value)
-	}
-
-	// Inject W3C Trace Context headers for distributed tracing
+	// Inject W3C Trace Context headers for distributed tracing on every attempt
 	traceparent := fmt.Sprintf("00-%s-%s-01", traceID, spanID)
-	remoteReq.Header.Set("traceparent", traceparent)
+	prepare := func(remoteReq *http.Request) {
+		remoteReq.Header.Set("traceparent", traceparent)
+		if reqBody.IncludeTrace {
+			// Apollo subgraphs only attach a federated trace when asked to
+			remoteReq.Header.Set("apollo-federation-include-trace", "ftv1")
+		}
+	}
 
-	// Make the request
+	// Make the request, twice after a persisted query miss
 	reqClient := http.Client{
 		Timeout: 30 * time.Second,
+		Jar:     sessionJar(reqBody.WorkspaceID, reqBody.SessionID),
 	}
 	requestStart := time.Now()
-	remoteResponse, err := reqClient.Do(remoteReq)
+	exchange, err := transport.send(&reqClient, prepare)
+	responseEnd := time.Now()
 	if err != nil {
 		response := model.GraphQLResponse{
 			StatusCode: http.StatusInternalServerError,
@@ -117,20 +146,8 @@ func executeGraphQLRequest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
-	defer remoteResponse.Body.Close()
-
-	// Read response body
-	responseBodyBytes, err := io.ReadAll(remoteResponse.Body)
-	responseEnd := time.Now()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.GraphQLResponse{
-			StatusCode: http.StatusInternalServerError,
-			Error:      "Failed to read response body",
-			TraceID:    traceID,
-			SpanID:     spanID,
-		})
-		return
-	}
+	remoteResponse := exchange.response
+	responseBodyBytes := exchange.body
 
 	totalDuration := responseEnd.Sub(requestStart)
 
@@ -140,9 +157,12 @@ func executeGraphQLRequest(c *gin.Context) {
 		respHeaders[k] = strings.Join(v, ", ")
 	}
 
+	// GraphQL servers report resolver failures in an errors array, usually with HTTP 200
+	graphqlErrors, partialData := parseGraphQLErrors(responseBodyBytes)
+
 	// Determine status
 	status := "OK"
-	if remoteResponse.StatusCode >= 400 {
+	if remoteResponse.StatusCode >= 400 || len(graphqlErrors) > 0 {
 		status = "ERROR"
 	}
 
@@ -151,6 +171,42 @@ func executeGraphQLRequest(c *gin.Context) {
 		"graphql.operation": reqBody.OperationName,
 		"graphql.url":       reqBody.URL,
 		"http.status_code":  fmt.Sprintf("%d", remoteResponse.StatusCode),
+		"graphql.transport": transport.name(),
+	}
+	if exchange.persistedQuery != "" {
+		tags["graphql.persisted_query"] = exchange.persistedQuery
+	}
+	auth.Tags(tags, reqBody.Auth)
+	addCookieTags(tags, reqBody.SessionID, len(remoteResponse.Request.Cookies()), len(remoteResponse.Cookies()))
+	if len(graphqlErrors) > 0 {
+		addGraphQLErrorTags(tags, graphqlErrors, partialData)
+	}
+	if analysis != nil {
+		addGraphQLAnalysisTags(tags, analysis)
+	}
+
+	// Check the response before the span is recorded, a failed assertion fails the span
+	assertionResults := assertions.Evaluate(reqBody.Assertions, assertions.Response{
+		StatusCode: remoteResponse.StatusCode,
+		Headers:    respHeaders,
+		Body:       responseBodyBytes,
+		Latency:    totalDuration,
+	})
+	if addAssertionTags(tags, assertionResults) {
+		status = "ERROR"
+	}
+	extracted := extract.Run(reqBody.Extract, extract.Response{Headers: respHeaders, Body: responseBodyBytes})
+	addExtractTags(tags, extracted)
+	saveExtracted(extracted, reqBody.Extract, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+
+	// Resolver timings reported by the server in extensions.tracing or extensions.ftv1
+	serverTrace, err := parseGraphQLTrace(responseBodyBytes)
+	if err != nil {
+		log.Printf("Ignoring GraphQL trace from %s: %v", reqBody.URL, err)
+		tags["graphql.trace.error"] = err.Error()
+	}
+	if serverTrace != nil {
+		tags["graphql.trace.format"] = serverTrace.format
 	}
 
 	// Queue records for async DB write
@@ -160,6 +216,8 @@ func executeGraphQLRequest(c *gin.Context) {
 		TraceID:    traceID,
 		StatusCode: remoteResponse.StatusCode,
 		LatencyMs:  int(totalDuration.Milliseconds()),
+		ErrorCount: len(graphqlErrors),
+		Assertions: assertionResults,
 	})
 
 	spanRecord := store.SpanRecord{
@@ -172,6 +230,7 @@ func executeGraphQLRequest(c *gin.Context) {
 		Duration:    totalDuration.Microseconds(),
 		Status:      status,
 		Tags:        tags,
+		Events:      exchange.attempts,
 	}
 
 	store.AddSpan(spanRecord);
@@ -189,22 +248,56 @@ func executeGraphQLRequest(c *gin.Context) {
 		Duration:    totalDuration.Microseconds(),
 		Status:      status,
 		Tags:        tags,
+		Events:      exchange.attempts,
 	}
 
+	// Resolver-level child spans for the Gantt chart
+	spans := []model.SpanInfo{rootSpan}
+	if serverTrace != nil {
+		for _, span := range graphqlTraceSpans(serverTrace, rootSpan, graphqlServiceName(reqBody.URL), graphqlErrors) {
+			record := store.SpanRecord{
+				ID:           uuid.New().String(),
+				TraceID:      span.TraceID,
+				SpanID:       span.SpanID,
+				ParentSpanID: span.ParentSpanID,
+				Operation:    span.Operation,
+				ServiceName:  span.ServiceName,
+				StartTime:    span.StartTime,
+				Duration:     span.Duration,
+				Status:       span.Status,
+				Tags:         span.Tags,
+			}
+			store.AddSpan(record)
+			tracing.Hub.Publish(record)
+			spans = append(spans, span)
+		}
+	}
+
+	spans = append(spans, tokenSpans...)
+
 	// Construct and Send Final Response
 	finalResponse := model.GraphQLResponse{
-		Duration:     fmt.Sprintf("%vms", totalDuration.Milliseconds()),
-		StatusCode:   remoteResponse.StatusCode,
-		Body:         string(responseBodyBytes),
-		Headers:      respHeaders,
-		Error:        "",
-		ResponseSize: int64(len(responseBodyBytes)),
-		RequestSize:  int64(len(gqlBodyBytes)),
-		RequestID:    requestID,
-		ExecutionID:  executionID,
-		TraceID:      traceID,
-		SpanID:       spanID,
-		Spans:        []model.SpanInfo{rootSpan},
+		Duration:       fmt.Sprintf("%vms", totalDuration.Milliseconds()),
+		StatusCode:     remoteResponse.StatusCode,
+		Body:           string(responseBodyBytes),
+		Headers:        respHeaders,
+		Error:          "",
+		ResponseSize:   int64(len(responseBodyBytes)),
+		RequestSize:    int64(exchange.requestSize),
+		Errors:         graphqlErrors,
+		PartialData:    partialData,
+		Transport:      transport.name(),
+		PersistedQuery: exchange.persistedQuery,
+		Attempts:       len(exchange.attempts),
+		Validated:      validated,
+		Analysis:       analysis,
+		Assertions:     assertionResults,
+		Extracted:      extracted,
+		RequestID:      requestID,
+		ExecutionID:    executionID,
+		TraceID:        traceID,
+		SpanID:         spanID,
+		Spans:          spans,
 	}
 	c.JSON(http.StatusOK, finalResponse)
 }
@@ -0,0 +1,253 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// defaultGraphQLListSize is the assumed length of a list field without a slicing argument
+const defaultGraphQLListSize = 10
+
+// maxGraphQLComplexity caps the estimate, so huge slicing arguments and nested lists
+// saturate instead of overflowing
+const maxGraphQLComplexity = math.MaxInt32
+
+// graphqlSlicingArguments bound the length of a list field unless @listSize names others
+var graphqlSlicingArguments = []string{"first", "last", "limit"}
+
+// graphqlQueryAnalyzer walks an operation, expanding fragments where they are used
+type graphqlQueryAnalyzer struct {
+	doc       *ast.QueryDocument
+	schema    *ast.Schema // nil when the endpoint has not been introspected
+	variables map[string]any
+	result    model.GraphQLQueryAnalysis
+	used      map[string]bool // Fragments spread at least once
+	visiting  map[string]bool // Fragments being expanded, to stop at cycles
+}
+
+// analyzeGraphQLRequest measures the operation, or every operation of a batch, using the
+// endpoint's introspected schema when there is one. Queries that do not parse are not analysed
+func analyzeGraphQLRequest(reqBody model.GraphQLRequest) *model.GraphQLQueryAnalysis {
+	schema := cachedGraphQLSchema(reqBody.URL, reqBody.Headers, reqBody.Auth)
+	if len(reqBody.Batch) == 0 {
+		return analyzeGraphQLQuery(schema, reqBody.Query, reqBody.OperationName, reqBody.Variables)
+	}
+
+	var combined *model.GraphQLQueryAnalysis
+	for _, op := range reqBody.Batch {
+		analysis := analyzeGraphQLQuery(schema, op.Query, op.OperationName, op.Variables)
+		if analysis == nil {
+			continue
+		}
+		if combined == nil {
+			combined = analysis
+			continue
+		}
+		combined.Depth = max(combined.Depth, analysis.Depth)
+		combined.Fields += analysis.Fields
+		combined.Aliases += analysis.Aliases
+		combined.Fragments += analysis.Fragments
+		combined.FragmentSpreads += analysis.FragmentSpreads
+		combined.InlineFragments += analysis.InlineFragments
+		combined.Complexity = addGraphQLCost(combined.Complexity, analysis.Complexity)
+	}
+	return combined
+}
+
+func analyzeGraphQLQuery(schema *ast.Schema, query, operationName string, variables map[string]any) *model.GraphQLQueryAnalysis {
+	doc, err := parser.ParseQuery(&ast.Source{Name: "query.graphql", Input: query})
+	if err != nil {
+		return nil
+	}
+	op := selectGraphQLOperation(doc, operationName)
+	if op == nil {
+		return nil
+	}
+
+	a := &graphqlQueryAnalyzer{
+		doc:       doc,
+		schema:    schema,
+		variables: variables,
+		used:      map[string]bool{},
+		visiting:  map[string]bool{},
+	}
+	var root *ast.Definition
+	if schema != nil {
+		switch op.Operation {
+		case ast.Query:
+			root = schema.Query
+		case ast.Mutation:
+			root = schema.Mutation
+		case ast.Subscription:
+			root = schema.Subscription
+		}
+	}
+	a.result.Complexity = a.selectionSet(op.SelectionSet, root, 1)
+	a.result.Fragments = len(a.used)
+	a.result.SchemaWeighted = schema != nil
+	return &a.result
+}
+
+// selectionSet returns the cost of a selection set on parent, which is nil when the type is
+// unknown. Fragments on different types are added together, so for unions and interfaces the
+// estimate is an upper bound
+func (a *graphqlQueryAnalyzer) selectionSet(set ast.SelectionSet, parent *ast.Definition, depth int) int {
+	total := 0
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			total = addGraphQLCost(total, a.field(s, parent, depth))
+		case *ast.InlineFragment:
+			a.result.InlineFragments++
+			total = addGraphQLCost(total, a.selectionSet(s.SelectionSet, a.typeCondition(s.TypeCondition, parent), depth))
+		case *ast.FragmentSpread:
+			a.result.FragmentSpreads++
+			fragment := a.doc.Fragments.ForName(s.Name)
+			if fragment == nil || a.visiting[s.Name] {
+				continue
+			}
+			a.used[s.Name] = true
+			a.visiting[s.Name] = true
+			total = addGraphQLCost(total, a.selectionSet(fragment.SelectionSet, a.typeCondition(fragment.TypeCondition, parent), depth))
+			delete(a.visiting, s.Name)
+		}
+	}
+	return total
+}
+
+// field returns the field's own cost plus its selections, repeated for each expected list item
+func (a *graphqlQueryAnalyzer) field(f *ast.Field, parent *ast.Definition, depth int) int {
+	a.result.Fields++
+	a.result.Depth = max(a.result.Depth, depth)
+	if f.Alias != "" && f.Alias != f.Name {
+		a.result.Aliases++
+	}
+
+	var def *ast.FieldDefinition
+	if parent != nil {
+		def = parent.Fields.ForName(f.Name)
+	}
+	cost := 1
+	if def != nil {
+		if weight, ok := directiveInt(def.Directives.ForName("cost"), "weight"); ok {
+			cost = weight
+		}
+	}
+	if len(f.SelectionSet) == 0 {
+		return cost
+	}
+
+	var fieldType *ast.Definition
+	if def != nil {
+		fieldType = a.schema.Types[def.Type.Name()]
+	}
+	return addGraphQLCost(cost, mulGraphQLCost(a.listSize(f, def), a.selectionSet(f.SelectionSet, fieldType, depth+1)))
+}
+
+// addGraphQLCost and mulGraphQLCost saturate at maxGraphQLComplexity. Costs are never negative
+func addGraphQLCost(a, b int) int {
+	if a > maxGraphQLComplexity-b {
+		return maxGraphQLComplexity
+	}
+	return a + b
+}
+
+func mulGraphQLCost(a, b int) int {
+	if b != 0 && a > maxGraphQLComplexity/b {
+		return maxGraphQLComplexity
+	}
+	return a * b
+}
+
+// listSize estimates how many items a list field returns: the value of its slicing argument,
+// else @listSize(assumedSize), else defaultGraphQLListSize. Other fields return one item
+func (a *graphqlQueryAnalyzer) listSize(f *ast.Field, def *ast.FieldDefinition) int {
+	if def == nil || def.Type.Elem == nil {
+		return 1
+	}
+	slicingArguments := graphqlSlicingArguments
+	size := defaultGraphQLListSize
+	if hint := def.Directives.ForName("listSize"); hint != nil {
+		if assumed, ok := directiveInt(hint, "assumedSize"); ok {
+			size = assumed
+		}
+		if arg := hint.Arguments.ForName("slicingArguments"); arg != nil && arg.Value.Kind == ast.ListValue {
+			slicingArguments = nil
+			for _, child := range arg.Value.Children {
+				slicingArguments = append(slicingArguments, child.Value.Raw)
+			}
+		}
+	}
+
+	for _, name := range slicingArguments {
+		if arg := f.Arguments.ForName(name); arg != nil {
+			if n, ok := graphqlIntValue(arg.Value, a.variables); ok {
+				return n
+			}
+		}
+	}
+	return size
+}
+
+// typeCondition resolves the type a fragment applies to, keeping parent when it has none
+func (a *graphqlQueryAnalyzer) typeCondition(name string, parent *ast.Definition) *ast.Definition {
+	if a.schema == nil || name == "" {
+		return parent
+	}
+	return a.schema.Types[name]
+}
+
+// directiveInt reads an integer directive argument. @cost declares its weight as a string
+func directiveInt(directive *ast.Directive, name string) (int, bool) {
+	if directive == nil {
+		return 0, false
+	}
+	arg := directive.Arguments.ForName(name)
+	if arg == nil {
+		return 0, false
+	}
+	return graphqlIntValue(arg.Value, nil)
+}
+
+// graphqlIntValue resolves a literal or variable to a non-negative integer, at most
+// maxGraphQLComplexity
+func graphqlIntValue(value *ast.Value, variables map[string]any) (int, bool) {
+	v, err := value.Value(variables)
+	if err != nil {
+		return 0, false
+	}
+	var n float64
+	switch v := v.(type) {
+	case int64:
+		n = float64(v)
+	case int:
+		n = float64(v)
+	case float64:
+		n = v
+	case string:
+		if n, err = strconv.ParseFloat(v, 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if n < 0 {
+		return 0, false
+	}
+	return int(min(n, maxGraphQLComplexity)), true
+}
+
+// addGraphQLAnalysisTags records the query's shape on the span so cost can be tracked over time
+func addGraphQLAnalysisTags(tags map[string]string, analysis *model.GraphQLQueryAnalysis) {
+	tags["graphql.query.depth"] = fmt.Sprintf("%d", analysis.Depth)
+	tags["graphql.query.fields"] = fmt.Sprintf("%d", analysis.Fields)
+	tags["graphql.query.aliases"] = fmt.Sprintf("%d", analysis.Aliases)
+	tags["graphql.query.fragments"] = fmt.Sprintf("%d", analysis.Fragments)
+	tags["graphql.query.complexity"] = fmt.Sprintf("%d", analysis.Complexity)
+	tags["graphql.query.schema_weighted"] = strconv.FormatBool(analysis.SchemaWeighted)
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+const testAnalysisQuery = `query Q {
+  featured: book(id: "1") { ...BookFields author { name } }
+  books(first: 5) { ...BookFields }
+}
+fragment BookFields on Book { id title }`
+
+func TestAnalyzeGraphQLQuery_WithoutSchema(t *testing.T) {
+	analysis := analyzeGraphQLQuery(nil, testAnalysisQuery, "", nil)
+	expected := model.GraphQLQueryAnalysis{
+		Depth:           3,
+		Fields:          8,
+		Aliases:         1,
+		Fragments:       1,
+		FragmentSpreads: 2,
+		Complexity:      8,
+	}
+	if analysis == nil || *analysis != expected {
+		t.Errorf("Expected %+v, got %+v", expected, analysis)
+	}
+}
+
+func TestAnalyzeGraphQLQuery_WithSchema(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: testLibrarySDL})
+
+	// featured: 1 + id + title + author(1 + name) = 5; books: 1 + 5 * (id + title) = 11
+	analysis := analyzeGraphQLQuery(schema, testAnalysisQuery, "", nil)
+	if analysis == nil || analysis.Complexity != 16 || !analysis.SchemaWeighted {
+		t.Errorf("Expected a schema weighted complexity of 16, got %+v", analysis)
+	}
+
+	// Without a slicing argument a list is assumed to hold 10 items, and both union members count
+	analysis = analyzeGraphQLQuery(schema, `{ search(text: "x") { ... on Book { title } ... on Author { name } } }`, "", nil)
+	if analysis == nil || analysis.Complexity != 21 || analysis.InlineFragments != 2 {
+		t.Errorf("Expected a complexity of 21 with 2 inline fragments, got %+v", analysis)
+	}
+}
+
+func TestAnalyzeGraphQLQuery_CostDirectives(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+directive @cost(weight: String!) on FIELD_DEFINITION
+directive @listSize(assumedSize: Int, slicingArguments: [String!]) on FIELD_DEFINITION
+
+type Query {
+  items(size: Int, first: Int): [Item!]! @listSize(slicingArguments: ["size"])
+  tags: [Item!]! @listSize(assumedSize: 3)
+  expensive: Int @cost(weight: "7")
+}
+
+type Item {
+  id: ID!
+}
+`})
+
+	// items: 1 + 4 * id = 5, ignoring first; tags: 1 + 3 * id = 4; expensive: 7
+	query := `query ($n: Int) { items(size: $n, first: 100) { id } tags { id } expensive }`
+	analysis := analyzeGraphQLQuery(schema, query, "", map[string]any{"n": float64(4)})
+	if analysis == nil || analysis.Complexity != 16 {
+		t.Errorf("Expected a complexity of 16, got %+v", analysis)
+	}
+}
+
+func TestAnalyzeGraphQLQuery_Saturates(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: testLibrarySDL})
+
+	// Nested lists of 2^31 items each would overflow an int64 at the third level
+	query := `{ books(first: 2147483647) { author { books(first: 2147483647) { author { books(first: 1e300) { id } } } } } }`
+	analysis := analyzeGraphQLQuery(schema, query, "", nil)
+	if analysis == nil || analysis.Complexity != maxGraphQLComplexity {
+		t.Errorf("Expected the complexity to saturate at %d, got %+v", maxGraphQLComplexity, analysis)
+	}
+}
+
+func TestAnalyzeGraphQLQuery_Unanalysable(t *testing.T) {
+	if analysis := analyzeGraphQLQuery(nil, `{ books {`, "", nil); analysis != nil {
+		t.Errorf("Expected no analysis of an unparsable query, got %+v", analysis)
+	}
+	if analysis := analyzeGraphQLQuery(nil, `query A { a } query B { b }`, "", nil); analysis != nil {
+		t.Errorf("Expected no analysis without an operation name, got %+v", analysis)
+	}
+
+	// Cyclic fragments are invalid, but can still be sent with skip_validation
+	analysis := analyzeGraphQLQuery(nil, `{ ...A } fragment A on Query { a ...B } fragment B on Query { b ...A }`, "", nil)
+	if analysis == nil || analysis.Fields != 2 || analysis.Fragments != 2 {
+		t.Errorf("Expected cycles to be expanded once, got %+v", analysis)
+	}
+}
+
+func TestGraphQLExecute_Analysis(t *testing.T) {
+	_, url := introspectedLibraryServer(t)
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL: url,
+		Batch: []model.GraphQLOperation{
+			{Query: testAnalysisQuery},
+			{Query: `{ books { id } }`},
+		},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%s)", code, resp.Error)
+	}
+	// The second operation adds 1 + 10 * id = 11 and 2 fields
+	expected := model.GraphQLQueryAnalysis{
+		Depth:           3,
+		Fields:          10,
+		Aliases:         1,
+		Fragments:       1,
+		FragmentSpreads: 2,
+		Complexity:      27,
+		SchemaWeighted:  true,
+	}
+	if resp.Analysis == nil || *resp.Analysis != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, resp.Analysis)
+	}
+
+	expectedTags := map[string]string{
+		"graphql.query.depth":           "3",
+		"graphql.query.fields":          "10",
+		"graphql.query.aliases":         "1",
+		"graphql.query.fragments":       "1",
+		"graphql.query.complexity":      "27",
+		"graphql.query.schema_weighted": "true",
+	}
+	for key, value := range expectedTags {
+		if resp.Spans[0].Tags[key] != value {
+			t.Errorf("Expected tag %s=%q, got %q", key, value, resp.Spans[0].Tags[key])
+		}
+	}
+}
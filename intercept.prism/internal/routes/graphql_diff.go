@@ -0,0 +1,499 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// Criticality of a schema change for existing clients
+const (
+	graphqlChangeBreaking  = "breaking"  // Valid queries may stop working
+	graphqlChangeDangerous = "dangerous" // Queries keep working but clients may see values they do not handle
+	graphqlChangeSafe      = "safe"
+)
+
+var graphqlChangeRank = map[string]int{graphqlChangeBreaking: 0, graphqlChangeDangerous: 1, graphqlChangeSafe: 2}
+
+// diffGraphQLSchemas godoc
+// @Summary      Compare two GraphQL schemas
+// @Description  Compares a base and a target schema and classifies each change as breaking, dangerous or safe, e.g. a removed field, a changed argument type or a removed enum value.
+// @Description  Each side is an endpoint (its cached introspection snapshot, or a live introspection with `refresh`), SDL, or an introspection `__schema` object.
+// @Description  An endpoint is introspected with its headers and `auth`, which can reference `environment` variables, and shares the snapshots of POST /graphql/introspect.
+// @Description  Set `fail_on` to `breaking` or `dangerous` to get a 409 with the report when such changes are found, for use in CI
+// @Tags         GraphQL
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GraphQLSchemaDiffRequest true "Schemas to compare"
+// @Success      200 {object} model.GraphQLSchemaDiffResponse "Change report"
+// @Failure      400 {object} model.GraphQLSchemaDiffResponse "Invalid request body, schema, auth or unresolved variable"
+// @Failure      401 {object} model.GraphQLSchemaDiffResponse "OAuth2 needs an interactive authorization first"
+// @Failure      409 {object} model.GraphQLSchemaDiffResponse "Changes at or above fail_on were found"
+// @Failure      502 {object} model.GraphQLSchemaDiffResponse "An endpoint failed or does not allow introspection"
+// @Router       /graphql/diff [post]
+func diffGraphQLSchemas(c *gin.Context) {
+	reqBody := model.GraphQLSchemaDiffRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLSchemaDiffResponse{Error: err.Error()})
+		return
+	}
+	if err := expandGraphQLSchemaDiffRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLSchemaDiffResponse{Error: err.Error()})
+		return
+	}
+	failRank, ok := graphqlChangeRank[reqBody.FailOn]
+	if reqBody.FailOn != "" && (!ok || reqBody.FailOn == graphqlChangeSafe) {
+		c.JSON(http.StatusBadRequest, model.GraphQLSchemaDiffResponse{Error: fmt.Sprintf("Unknown fail_on '%s', expected breaking or dangerous", reqBody.FailOn)})
+		return
+	}
+
+	requestStart := time.Now()
+	base, baseHash, statusCode, err := loadGraphQLSchemaSource(reqBody.Base, reqBody.WorkspaceID)
+	if err != nil {
+		c.JSON(statusCode, model.GraphQLSchemaDiffResponse{Error: "base: " + err.Error()})
+		return
+	}
+	target, targetHash, statusCode, err := loadGraphQLSchemaSource(reqBody.Target, reqBody.WorkspaceID)
+	if err != nil {
+		c.JSON(statusCode, model.GraphQLSchemaDiffResponse{Error: "target: " + err.Error()})
+		return
+	}
+
+	changes := compareGraphQLSchemas(base, target)
+	response := model.GraphQLSchemaDiffResponse{
+		BaseHash:   baseHash,
+		TargetHash: targetHash,
+		Identical:  len(changes) == 0,
+		Changes:    changes,
+		Duration:   fmt.Sprintf("%vms", time.Since(requestStart).Milliseconds()),
+	}
+	for _, change := range changes {
+		switch change.Criticality {
+		case graphqlChangeBreaking:
+			response.Breaking++
+		case graphqlChangeDangerous:
+			response.Dangerous++
+		case graphqlChangeSafe:
+			response.Safe++
+		}
+		if reqBody.FailOn != "" && graphqlChangeRank[change.Criticality] <= failRank {
+			response.Failed = true
+		}
+	}
+
+	if response.Failed {
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// loadGraphQLSchemaSource parses one side of a comparison, introspecting endpoints that have
+// no cached snapshot with their auth. The status code to reply with is returned alongside any error
+func loadGraphQLSchemaSource(source model.GraphQLSchemaSource, workspaceID string) (*ast.Schema, string, int, error) {
+	set := 0
+	for _, given := range []bool{source.URL != "", source.SDL != "", len(source.Schema) > 0} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("set exactly one of url, sdl or schema")
+	}
+
+	if source.SDL != "" {
+		schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: source.SDL})
+		if err != nil {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("Invalid SDL: %v", err)
+		}
+		hash := sha256.Sum256([]byte(source.SDL))
+		return schema, hex.EncodeToString(hash[:]), http.StatusOK, nil
+	}
+
+	var entry *graphqlSchemaEntry
+	statusCode := http.StatusBadRequest
+	if len(source.Schema) > 0 {
+		var err error
+		if entry, err = newGraphQLSchemaEntry(source.Schema); err != nil {
+			return nil, "", http.StatusBadRequest, err
+		}
+	} else {
+		key := graphqlSchemaKey(source.URL, source.Headers, source.Auth)
+		cached, ok := graphqlSchemas.Get(key)
+		if ok && !source.Refresh {
+			entry = cached
+		} else {
+			if _, code, err := fetchOAuth2Token(source.Auth, workspaceID, tracing.GenerateTraceID(), ""); err != nil {
+				return nil, "", code, err
+			}
+			var err error
+			if entry, _, err = fetchGraphQLSchema(source.URL, source.Headers, source.Auth); err != nil {
+				return nil, "", http.StatusBadGateway, err
+			}
+			graphqlSchemas.Put(key, entry)
+		}
+		statusCode = http.StatusBadGateway
+	}
+
+	schema := entry.astSchema()
+	if schema == nil {
+		return nil, "", statusCode, fmt.Errorf("The introspected schema could not be loaded")
+	}
+	return schema, entry.hash, http.StatusOK, nil
+}
+
+// graphqlSchemaDiff collects the changes between two schemas
+type graphqlSchemaDiff struct {
+	changes []model.GraphQLSchemaChange
+}
+
+func (d *graphqlSchemaDiff) add(changeType, criticality, path, format string, args ...any) {
+	d.changes = append(d.changes, model.GraphQLSchemaChange{
+		Type:        changeType,
+		Criticality: criticality,
+		Path:        path,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+// compareGraphQLSchemas lists what changed from base to target, breaking changes first
+func compareGraphQLSchemas(base, target *ast.Schema) []model.GraphQLSchemaChange {
+	d := &graphqlSchemaDiff{}
+	d.rootType("query", base.Query, target.Query)
+	d.rootType("mutation", base.Mutation, target.Mutation)
+	d.rootType("subscription", base.Subscription, target.Subscription)
+
+	for name, old := range base.Types {
+		if isBuiltinGraphQLType(old) {
+			continue
+		}
+		updated, ok := target.Types[name]
+		switch {
+		case !ok:
+			d.add("TYPE_REMOVED", graphqlChangeBreaking, name, "Type %s was removed", name)
+		case old.Kind != updated.Kind:
+			d.add("TYPE_KIND_CHANGED", graphqlChangeBreaking, name, "%s changed from %s to %s", name, kindName(old.Kind), kindName(updated.Kind))
+		default:
+			d.definition(old, updated)
+		}
+	}
+	for name, added := range target.Types {
+		if _, ok := base.Types[name]; !ok && !isBuiltinGraphQLType(added) {
+			d.add("TYPE_ADDED", graphqlChangeSafe, name, "%s %s was added", kindName(added.Kind), name)
+		}
+	}
+
+	for name, old := range base.Directives {
+		if isBuiltinGraphQLDirective(old) {
+			continue
+		}
+		if updated, ok := target.Directives[name]; ok {
+			d.directive(old, updated)
+		} else {
+			d.add("DIRECTIVE_REMOVED", graphqlChangeBreaking, "@"+name, "Directive @%s was removed", name)
+		}
+	}
+	for name, added := range target.Directives {
+		if _, ok := base.Directives[name]; !ok && !isBuiltinGraphQLDirective(added) {
+			d.add("DIRECTIVE_ADDED", graphqlChangeSafe, "@"+name, "Directive @%s was added", name)
+		}
+	}
+
+	// Map iteration order varies, so ties are broken down to the message for a stable report
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		a, b := d.changes[i], d.changes[j]
+		if graphqlChangeRank[a.Criticality] != graphqlChangeRank[b.Criticality] {
+			return graphqlChangeRank[a.Criticality] < graphqlChangeRank[b.Criticality]
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Message < b.Message
+	})
+	return d.changes
+}
+
+func (d *graphqlSchemaDiff) rootType(operation string, old, updated *ast.Definition) {
+	oldName, newName := "", ""
+	if old != nil {
+		oldName = old.Name
+	}
+	if updated != nil {
+		newName = updated.Name
+	}
+	switch {
+	case oldName == newName:
+	case oldName == "":
+		d.add("ROOT_TYPE_ADDED", graphqlChangeSafe, "schema."+operation, "The schema now supports %s operations with %s", operation, newName)
+	case newName == "":
+		d.add("ROOT_TYPE_REMOVED", graphqlChangeBreaking, "schema."+operation, "The schema no longer supports %s operations", operation)
+	default:
+		d.add("ROOT_TYPE_CHANGED", graphqlChangeBreaking, "schema."+operation, "The %s root type changed from %s to %s", operation, oldName, newName)
+	}
+}
+
+func (d *graphqlSchemaDiff) definition(old, updated *ast.Definition) {
+	switch old.Kind {
+	case ast.Object, ast.Interface:
+		d.fields(old, updated)
+		d.interfaces(old, updated)
+	case ast.InputObject:
+		d.inputValues("INPUT_FIELD", "Input field", old.Name, inputFieldValues(old.Fields), inputFieldValues(updated.Fields))
+	case ast.Enum:
+		d.enumValues(old, updated)
+	case ast.Union:
+		d.unionMembers(old, updated)
+	}
+}
+
+func (d *graphqlSchemaDiff) fields(old, updated *ast.Definition) {
+	for _, field := range old.Fields {
+		if strings.HasPrefix(field.Name, "__") {
+			continue
+		}
+		path := old.Name + "." + field.Name
+		newField := updated.Fields.ForName(field.Name)
+		if newField == nil {
+			d.add("FIELD_REMOVED", graphqlChangeBreaking, path, "Field %s was removed", path)
+			continue
+		}
+		if oldType, newType := field.Type.String(), newField.Type.String(); oldType != newType {
+			criticality := graphqlChangeBreaking
+			if safeOutputTypeChange(field.Type, newField.Type) {
+				criticality = graphqlChangeSafe
+			}
+			d.add("FIELD_TYPE_CHANGED", criticality, path, "Field %s changed type from %s to %s", path, oldType, newType)
+		}
+		if field.Directives.ForName("deprecated") == nil && newField.Directives.ForName("deprecated") != nil {
+			d.add("FIELD_DEPRECATED", graphqlChangeSafe, path, "Field %s was deprecated", path)
+		}
+		d.inputValues("ARG", "Argument", path, argumentValues(field.Arguments), argumentValues(newField.Arguments))
+	}
+	for _, field := range updated.Fields {
+		if old.Fields.ForName(field.Name) == nil && !strings.HasPrefix(field.Name, "__") {
+			path := updated.Name + "." + field.Name
+			d.add("FIELD_ADDED", graphqlChangeSafe, path, "Field %s was added", path)
+		}
+	}
+}
+
+func (d *graphqlSchemaDiff) interfaces(old, updated *ast.Definition) {
+	removed, added := diffNames(old.Interfaces, updated.Interfaces)
+	for _, name := range removed {
+		d.add("INTERFACE_REMOVED", graphqlChangeBreaking, old.Name, "%s no longer implements %s", old.Name, name)
+	}
+	// Fragments on the interface now match objects of this type too
+	for _, name := range added {
+		d.add("INTERFACE_ADDED", graphqlChangeDangerous, old.Name, "%s now implements %s", old.Name, name)
+	}
+}
+
+func (d *graphqlSchemaDiff) enumValues(old, updated *ast.Definition) {
+	for _, value := range old.EnumValues {
+		path := old.Name + "." + value.Name
+		newValue := updated.EnumValues.ForName(value.Name)
+		switch {
+		case newValue == nil:
+			d.add("ENUM_VALUE_REMOVED", graphqlChangeBreaking, path, "Enum value %s was removed", path)
+		case value.Directives.ForName("deprecated") == nil && newValue.Directives.ForName("deprecated") != nil:
+			d.add("ENUM_VALUE_DEPRECATED", graphqlChangeSafe, path, "Enum value %s was deprecated", path)
+		}
+	}
+	// Clients that switch over the enum may not handle the new value
+	for _, value := range updated.EnumValues {
+		if old.EnumValues.ForName(value.Name) == nil {
+			path := updated.Name + "." + value.Name
+			d.add("ENUM_VALUE_ADDED", graphqlChangeDangerous, path, "Enum value %s was added", path)
+		}
+	}
+}
+
+func (d *graphqlSchemaDiff) unionMembers(old, updated *ast.Definition) {
+	removed, added := diffNames(old.Types, updated.Types)
+	for _, name := range removed {
+		d.add("UNION_MEMBER_REMOVED", graphqlChangeBreaking, old.Name, "%s was removed from union %s", name, old.Name)
+	}
+	for _, name := range added {
+		d.add("UNION_MEMBER_ADDED", graphqlChangeDangerous, old.Name, "%s was added to union %s", name, old.Name)
+	}
+}
+
+func (d *graphqlSchemaDiff) directive(old, updated *ast.DirectiveDefinition) {
+	path := "@" + old.Name
+	oldLocations := make([]string, 0, len(old.Locations))
+	for _, location := range old.Locations {
+		oldLocations = append(oldLocations, string(location))
+	}
+	newLocations := make([]string, 0, len(updated.Locations))
+	for _, location := range updated.Locations {
+		newLocations = append(newLocations, string(location))
+	}
+	removed, added := diffNames(oldLocations, newLocations)
+	for _, location := range removed {
+		d.add("DIRECTIVE_LOCATION_REMOVED", graphqlChangeBreaking, path, "Directive %s can no longer be used on %s", path, location)
+	}
+	for _, location := range added {
+		d.add("DIRECTIVE_LOCATION_ADDED", graphqlChangeSafe, path, "Directive %s can now be used on %s", path, location)
+	}
+	d.inputValues("ARG", "Argument", path, argumentValues(old.Arguments), argumentValues(updated.Arguments))
+}
+
+// graphqlInputValue is an argument or input object field
+type graphqlInputValue struct {
+	name         string
+	valueType    *ast.Type
+	defaultValue *ast.Value
+}
+
+func argumentValues(args ast.ArgumentDefinitionList) []graphqlInputValue {
+	values := make([]graphqlInputValue, 0, len(args))
+	for _, arg := range args {
+		values = append(values, graphqlInputValue{arg.Name, arg.Type, arg.DefaultValue})
+	}
+	return values
+}
+
+func inputFieldValues(fields ast.FieldList) []graphqlInputValue {
+	values := make([]graphqlInputValue, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, graphqlInputValue{field.Name, field.Type, field.DefaultValue})
+	}
+	return values
+}
+
+// inputValues compares arguments or input fields. kind prefixes the change type and label
+// starts the message
+func (d *graphqlSchemaDiff) inputValues(kind, label, parent string, old, updated []graphqlInputValue) {
+	newByName := make(map[string]graphqlInputValue, len(updated))
+	for _, value := range updated {
+		newByName[value.name] = value
+	}
+	oldNames := make(map[string]bool, len(old))
+
+	for _, value := range old {
+		oldNames[value.name] = true
+		path := parent + "." + value.name
+		newValue, ok := newByName[value.name]
+		if !ok {
+			d.add(kind+"_REMOVED", graphqlChangeBreaking, path, "%s %s was removed", label, path)
+			continue
+		}
+		if oldType, newType := value.valueType.String(), newValue.valueType.String(); oldType != newType {
+			criticality := graphqlChangeBreaking
+			if safeInputTypeChange(value.valueType, newValue.valueType) {
+				criticality = graphqlChangeSafe
+			}
+			d.add(kind+"_TYPE_CHANGED", criticality, path, "%s %s changed type from %s to %s", label, path, oldType, newType)
+		}
+		// Clients relying on the default get different results
+		if oldDefault, newDefault := defaultValueString(value.defaultValue), defaultValueString(newValue.defaultValue); oldDefault != newDefault {
+			d.add(kind+"_DEFAULT_CHANGED", graphqlChangeDangerous, path, "%s %s default changed from %s to %s", label, path, oldDefault, newDefault)
+		}
+	}
+
+	for _, value := range updated {
+		if oldNames[value.name] {
+			continue
+		}
+		path := parent + "." + value.name
+		if value.valueType.NonNull && value.defaultValue == nil {
+			d.add(kind+"_ADDED", graphqlChangeBreaking, path, "Required %s %s was added", strings.ToLower(label), path)
+		} else {
+			d.add(kind+"_ADDED", graphqlChangeDangerous, path, "Optional %s %s was added", strings.ToLower(label), path)
+		}
+	}
+}
+
+// safeOutputTypeChange reports whether clients reading a field still get values they expect:
+// the new type may only be stricter, e.g. String to String!
+func safeOutputTypeChange(old, updated *ast.Type) bool {
+	switch {
+	case old.NonNull:
+		return updated.NonNull && safeOutputTypeChange(nullableType(old), nullableType(updated))
+	case updated.NonNull:
+		return safeOutputTypeChange(old, nullableType(updated))
+	case old.Elem != nil:
+		return updated.Elem != nil && safeOutputTypeChange(old.Elem, updated.Elem)
+	}
+	return updated.Elem == nil && old.NamedType == updated.NamedType
+}
+
+// safeInputTypeChange reports whether values clients already send are still accepted: the
+// new type may only be looser, e.g. String! to String
+func safeInputTypeChange(old, updated *ast.Type) bool {
+	switch {
+	case old.NonNull:
+		return safeInputTypeChange(nullableType(old), nullableType(updated))
+	case updated.NonNull:
+		return false
+	case old.Elem != nil:
+		return updated.Elem != nil && safeInputTypeChange(old.Elem, updated.Elem)
+	}
+	return updated.Elem == nil && old.NamedType == updated.NamedType
+}
+
+func nullableType(t *ast.Type) *ast.Type {
+	nullable := *t
+	nullable.NonNull = false
+	return &nullable
+}
+
+func defaultValueString(value *ast.Value) string {
+	if value == nil {
+		return "none"
+	}
+	return value.String()
+}
+
+// diffNames returns the names only in old and the names only in updated
+func diffNames(old, updated []string) (removed, added []string) {
+	inOld := make(map[string]bool, len(old))
+	for _, name := range old {
+		inOld[name] = true
+	}
+	inNew := make(map[string]bool, len(updated))
+	for _, name := range updated {
+		inNew[name] = true
+		if !inOld[name] {
+			added = append(added, name)
+		}
+	}
+	for _, name := range old {
+		if !inNew[name] {
+			removed = append(removed, name)
+		}
+	}
+	return removed, added
+}
+
+func isBuiltinGraphQLType(def *ast.Definition) bool {
+	return def.BuiltIn || strings.HasPrefix(def.Name, "__")
+}
+
+func isBuiltinGraphQLDirective(def *ast.DirectiveDefinition) bool {
+	return builtinDirectives[def.Name] || (def.Position != nil && def.Position.Src != nil && def.Position.Src.BuiltIn)
+}
+
+// kindName spells a definition kind the way SDL does, e.g. input for INPUT_OBJECT
+func kindName(kind ast.DefinitionKind) string {
+	switch kind {
+	case ast.Object:
+		return "type"
+	case ast.InputObject:
+		return "input"
+	}
+	return strings.ToLower(string(kind))
+}
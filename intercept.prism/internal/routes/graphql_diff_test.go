@@ -0,0 +1,323 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func TestCompareGraphQLSchemas(t *testing.T) {
+	base := gqlparser.MustLoadSchema(&ast.Source{Input: `
+directive @cached(ttl: Int = 60) on FIELD_DEFINITION | OBJECT
+
+type Query {
+  book(id: ID!): Book
+  books(first: Int = 10, genre: Genre): [Book]
+  authors: [String]
+  legacy: String
+}
+
+type Book {
+  id: ID!
+  title: String
+  genre: Genre
+}
+
+type Magazine {
+  id: ID!
+}
+
+union SearchResult = Book | Magazine
+
+enum Genre {
+  FICTION
+  HISTORY
+  POETRY
+}
+
+input BookFilter {
+  genre: Genre
+  search: String!
+}
+`})
+	target := gqlparser.MustLoadSchema(&ast.Source{Input: `
+directive @cached(ttl: Int = 30, scope: String) on FIELD_DEFINITION
+
+interface Node {
+  id: ID!
+}
+
+type Query {
+  book(id: ID!, locale: String!): Book
+  books(first: Int = 10, genre: [Genre]): [Book!]!
+  authors: [String]
+  legacy: String @deprecated(reason: "Gone soon")
+  magazines: Int
+}
+
+type Book implements Node {
+  id: ID!
+  title: String!
+  genre: String
+}
+
+union SearchResult = Book
+
+enum Genre {
+  FICTION
+  HISTORY
+  SCIENCE
+}
+
+input BookFilter {
+  genre: Genre
+  search: String
+  year: Int!
+}
+
+type Magazine {
+  id: ID!
+}
+`})
+
+	expected := []model.GraphQLSchemaChange{
+		{Type: "DIRECTIVE_LOCATION_REMOVED", Criticality: "breaking", Path: "@cached"},
+		{Type: "INPUT_FIELD_ADDED", Criticality: "breaking", Path: "BookFilter.year"},
+		{Type: "FIELD_TYPE_CHANGED", Criticality: "breaking", Path: "Book.genre"},
+		{Type: "ENUM_VALUE_REMOVED", Criticality: "breaking", Path: "Genre.POETRY"},
+		{Type: "ARG_ADDED", Criticality: "breaking", Path: "Query.book.locale"},
+		{Type: "ARG_TYPE_CHANGED", Criticality: "breaking", Path: "Query.books.genre"},
+		{Type: "UNION_MEMBER_REMOVED", Criticality: "breaking", Path: "SearchResult"},
+		{Type: "ARG_DEFAULT_CHANGED", Criticality: "dangerous", Path: "@cached.ttl"},
+		{Type: "ARG_ADDED", Criticality: "dangerous", Path: "@cached.scope"},
+		{Type: "INTERFACE_ADDED", Criticality: "dangerous", Path: "Book"},
+		{Type: "ENUM_VALUE_ADDED", Criticality: "dangerous", Path: "Genre.SCIENCE"},
+		{Type: "FIELD_TYPE_CHANGED", Criticality: "safe", Path: "Book.title"},
+		{Type: "INPUT_FIELD_TYPE_CHANGED", Criticality: "safe", Path: "BookFilter.search"},
+		{Type: "TYPE_ADDED", Criticality: "safe", Path: "Node"},
+		{Type: "FIELD_TYPE_CHANGED", Criticality: "safe", Path: "Query.books"},
+		{Type: "FIELD_DEPRECATED", Criticality: "safe", Path: "Query.legacy"},
+		{Type: "FIELD_ADDED", Criticality: "safe", Path: "Query.magazines"},
+	}
+
+	changes := compareGraphQLSchemas(base, target)
+	got := make(map[string]string, len(changes))
+	for _, change := range changes {
+		got[change.Type+" "+change.Path] = change.Criticality
+		if change.Message == "" {
+			t.Errorf("Expected a message for %+v", change)
+		}
+	}
+	for _, want := range expected {
+		if criticality, ok := got[want.Type+" "+want.Path]; !ok || criticality != want.Criticality {
+			t.Errorf("Expected %s %s to be %s, got %q", want.Type, want.Path, want.Criticality, criticality)
+		}
+	}
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+
+	// Breaking changes come first
+	for i := 1; i < len(changes); i++ {
+		if graphqlChangeRank[changes[i-1].Criticality] > graphqlChangeRank[changes[i].Criticality] {
+			t.Fatalf("Changes are not ordered by criticality: %+v", changes)
+		}
+	}
+}
+
+func TestCompareGraphQLSchemas_StableOrder(t *testing.T) {
+	// Both removals share a type and path, so only the message orders them
+	base := gqlparser.MustLoadSchema(&ast.Source{Input: `
+type Query { search: [Result] }
+type A { id: ID }
+type B { id: ID }
+type C { id: ID }
+union Result = A | B | C
+`})
+	target := gqlparser.MustLoadSchema(&ast.Source{Input: `
+type Query { search: [Result] }
+type A { id: ID }
+type B { id: ID }
+type C { id: ID }
+union Result = A
+`})
+	for i := 0; i < 20; i++ {
+		changes := compareGraphQLSchemas(base, target)
+		if len(changes) != 2 || changes[0].Message != "B was removed from union Result" || changes[1].Message != "C was removed from union Result" {
+			t.Fatalf("Expected B then C to be removed, got %+v", changes)
+		}
+	}
+}
+
+func TestSafeTypeChanges(t *testing.T) {
+	tests := []struct {
+		old, updated string
+		output       bool
+		input        bool
+	}{
+		{"String", "String!", true, false},
+		{"String!", "String", false, true},
+		{"[String]", "[String!]!", true, false},
+		{"[String!]", "[String]", false, true},
+		{"String", "[String]", false, false},
+		{"String", "ID", false, false},
+	}
+	for _, tt := range tests {
+		old, updated := parseTestType(t, tt.old), parseTestType(t, tt.updated)
+		if got := safeOutputTypeChange(old, updated); got != tt.output {
+			t.Errorf("Output %s to %s: expected safe=%v, got %v", tt.old, tt.updated, tt.output, got)
+		}
+		if got := safeInputTypeChange(old, updated); got != tt.input {
+			t.Errorf("Input %s to %s: expected safe=%v, got %v", tt.old, tt.updated, tt.input, got)
+		}
+	}
+}
+
+// parseTestType reads a type reference such as [String!] through a one-field schema
+func parseTestType(t *testing.T, typeRef string) *ast.Type {
+	t.Helper()
+	schema, err := gqlparser.LoadSchema(&ast.Source{Input: "type Query { f: " + typeRef + " }"})
+	if err != nil {
+		t.Fatalf("Invalid type %s: %v", typeRef, err)
+	}
+	return schema.Query.Fields.ForName("f").Type
+}
+
+func TestGraphQLDiff_SnapshotAgainstLive(t *testing.T) {
+	server, url := introspectedLibraryServer(t)
+
+	// The snapshot against itself
+	code, resp := postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:   model.GraphQLSchemaSource{URL: url},
+		Target: model.GraphQLSchemaSource{SDL: testLibrarySDL},
+	})
+	if code != http.StatusOK || !resp.Identical || len(resp.Changes) != 0 {
+		t.Fatalf("Expected identical schemas, got %d %+v", code, resp)
+	}
+	if server.hitCount() != 1 {
+		t.Errorf("Expected the cached snapshot to be used, target was hit %d times", server.hitCount())
+	}
+
+	// Query.node and Query.search removed on the live endpoint
+	changed := testLibrarySchema()
+	changed.Types[0].Fields = changed.Types[0].Fields[:2]
+	server.setSchema(changed)
+
+	code, resp = postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:   model.GraphQLSchemaSource{URL: url},
+		Target: model.GraphQLSchemaSource{URL: url, Refresh: true},
+		FailOn: "breaking",
+	})
+	if code != http.StatusConflict || !resp.Failed {
+		t.Fatalf("Expected 409 for a breaking change, got %d %+v", code, resp)
+	}
+	if resp.Breaking != 2 || len(resp.Changes) != 2 || resp.Changes[0].Path != "Query.node" || resp.Changes[1].Path != "Query.search" || resp.Changes[0].Type != "FIELD_REMOVED" {
+		t.Errorf("Expected Query.node and Query.search to be removed, got %+v", resp.Changes)
+	}
+	if resp.BaseHash == resp.TargetHash || resp.BaseHash == "" {
+		t.Errorf("Expected different hashes, got %s and %s", resp.BaseHash, resp.TargetHash)
+	}
+
+	// The live schema replaced the snapshot
+	code, resp = postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:   model.GraphQLSchemaSource{URL: url},
+		Target: model.GraphQLSchemaSource{URL: url},
+		FailOn: "breaking",
+	})
+	if code != http.StatusOK || !resp.Identical {
+		t.Errorf("Expected the refreshed snapshot to be identical, got %d %+v", code, resp)
+	}
+}
+
+func TestGraphQLDiff_AuthAndEnvironment(t *testing.T) {
+	server := &introspectionServer{schema: testLibrarySchema()}
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "k-42" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer target.Close()
+
+	apiKey := func() *model.AuthConfig { return &model.AuthConfig{Type: "apikey", Key: "X-Api-Key", Value: "{{key}}"} }
+	environment := map[string]string{"endpoint": target.URL, "key": "k-42"}
+	code, resp := postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:        model.GraphQLSchemaSource{URL: "{{endpoint}}", Auth: apiKey()},
+		Target:      model.GraphQLSchemaSource{SDL: testLibrarySDL},
+		Environment: environment,
+	})
+	if code != http.StatusOK || !resp.Identical {
+		t.Fatalf("Expected identical schemas, got %d %+v", code, resp)
+	}
+
+	// The snapshot is shared with introspection under the same credentials
+	_, introspected := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: "{{endpoint}}", Auth: apiKey(), Environment: environment})
+	if !introspected.Cached || server.hitCount() != 1 {
+		t.Errorf("Expected the diff's snapshot to be reused, got cached=%v hits=%d", introspected.Cached, server.hitCount())
+	}
+
+	code, resp = postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:        model.GraphQLSchemaSource{SDL: testLibrarySDL},
+		Target:      model.GraphQLSchemaSource{URL: "{{endpoint}}", Auth: &model.AuthConfig{Type: "apikey"}},
+		Environment: environment,
+	})
+	if code != http.StatusBadRequest || !strings.HasPrefix(resp.Error, "target: auth:") {
+		t.Errorf("Expected 400 for incomplete auth, got %d: %s", code, resp.Error)
+	}
+}
+
+func TestGraphQLDiff_IntrospectionJSON(t *testing.T) {
+	raw, _ := json.Marshal(testLibrarySchema())
+	code, resp := postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", model.GraphQLSchemaDiffRequest{
+		Base:   model.GraphQLSchemaSource{Schema: raw},
+		Target: model.GraphQLSchemaSource{SDL: strings.Replace(testLibrarySDL, "  HISTORY @deprecated\n", "", 1)},
+		FailOn: "dangerous",
+	})
+	if code != http.StatusConflict || resp.Breaking != 1 || resp.Changes[0].Path != "Genre.HISTORY" {
+		t.Errorf("Expected the enum value removal to fail, got %d %+v", code, resp)
+	}
+}
+
+func TestGraphQLDiff_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   model.GraphQLSchemaDiffRequest
+		error string
+	}{
+		{
+			name:  "no base",
+			req:   model.GraphQLSchemaDiffRequest{Target: model.GraphQLSchemaSource{SDL: testLibrarySDL}},
+			error: "base: set exactly one of url, sdl or schema",
+		},
+		{
+			name:  "two sources",
+			req:   model.GraphQLSchemaDiffRequest{Base: model.GraphQLSchemaSource{SDL: testLibrarySDL}, Target: model.GraphQLSchemaSource{URL: "http://x", SDL: testLibrarySDL}},
+			error: "target: set exactly one of url, sdl or schema",
+		},
+		{
+			name:  "invalid SDL",
+			req:   model.GraphQLSchemaDiffRequest{Base: model.GraphQLSchemaSource{SDL: "type Query { a: Missing }"}, Target: model.GraphQLSchemaSource{SDL: testLibrarySDL}},
+			error: "base: Invalid SDL",
+		},
+		{
+			name:  "unknown fail_on",
+			req:   model.GraphQLSchemaDiffRequest{Base: model.GraphQLSchemaSource{SDL: testLibrarySDL}, Target: model.GraphQLSchemaSource{SDL: testLibrarySDL}, FailOn: "safe"},
+			error: "Unknown fail_on",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postJSON[model.GraphQLSchemaDiffResponse](t, setupGraphQLRouter(), "/graphql/diff", tt.req)
+			if code != http.StatusBadRequest || !strings.HasPrefix(resp.Error, tt.error) {
+				t.Errorf("Expected 400 with %q, got %d %q", tt.error, code, resp.Error)
+			}
+		})
+	}
+}
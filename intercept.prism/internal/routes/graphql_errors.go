@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// maxGraphQLErrorTags bounds the span tags added for one response, since a failing resolver
+// inside a list reports one error per item
+const maxGraphQLErrorTags = 20
+
+// graphqlResult is the part of a GraphQL response body that describes failures
+type graphqlResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                  `json:"message"`
+		Path       []any                   `json:"path"`
+		Locations  []model.GraphQLLocation `json:"locations"`
+		Extensions map[string]any          `json:"extensions"`
+	} `json:"errors"`
+}
+
+// parseGraphQLErrors reads the errors array of a response body and reports whether data was
+// returned alongside it. Bodies that are not GraphQL JSON have no errors. For a batched
+// response the errors of every result are returned, tagged with the operation index
+func parseGraphQLErrors(body []byte) ([]model.GraphQLError, bool) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseBatchedGraphQLErrors(trimmed)
+	}
+
+	var result graphqlResult
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Errors) == 0 {
+		return nil, false
+	}
+
+	errs := make([]model.GraphQLError, 0, len(result.Errors))
+	for _, e := range result.Errors {
+		graphqlErr := model.GraphQLError{
+			Message:    e.Message,
+			Path:       graphqlErrorPath(e.Path),
+			Locations:  e.Locations,
+			Extensions: e.Extensions,
+		}
+		if code, ok := e.Extensions["code"].(string); ok {
+			graphqlErr.Code = code
+		}
+		errs = append(errs, graphqlErr)
+	}
+	partialData := len(result.Data) > 0 && !bytes.Equal(result.Data, []byte("null"))
+	return errs, partialData
+}
+
+func parseBatchedGraphQLErrors(body []byte) ([]model.GraphQLError, bool) {
+	var results []json.RawMessage
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, false
+	}
+	var errs []model.GraphQLError
+	partialData := false
+	for i, result := range results {
+		resultErrs, partial := parseGraphQLErrors(result)
+		for _, e := range resultErrs {
+			e.Operation = &i
+			errs = append(errs, e)
+		}
+		partialData = partialData || partial
+	}
+	return errs, partialData
+}
+
+// graphqlErrorPath joins a response path such as ["books", 0, "author"] into books.0.author
+func graphqlErrorPath(path []any) string {
+	segments := make([]string, 0, len(path))
+	for _, segment := range path {
+		switch s := segment.(type) {
+		case string:
+			segments = append(segments, s)
+		case float64:
+			segments = append(segments, strconv.FormatFloat(s, 'f', -1, 64))
+		default:
+			segments = append(segments, fmt.Sprint(s))
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// addGraphQLErrorTags tags the span with the error count and one graphql.error.<path> tag per
+// failing path. Errors without a path, such as server-side validation errors, share graphql.error.
+// In a batch the path is prefixed with the operation, e.g. graphql.error.op1.books
+func addGraphQLErrorTags(tags map[string]string, errs []model.GraphQLError, partialData bool) {
+	tags["graphql.error_count"] = strconv.Itoa(len(errs))
+	tags["graphql.partial_data"] = strconv.FormatBool(partialData)
+
+	for i, e := range errs {
+		if i == maxGraphQLErrorTags {
+			break
+		}
+		key := "graphql.error"
+		if e.Operation != nil {
+			key += fmt.Sprintf(".op%d", *e.Operation)
+		}
+		if e.Path != "" {
+			key += "." + e.Path
+		}
+		value := e.Message
+		if e.Code != "" {
+			value = e.Code + ": " + value
+		}
+		if previous, ok := tags[key]; ok {
+			value = previous + "; " + value
+		}
+		tags[key] = value
+	}
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func TestGraphQLErrors_PartialData(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+  "data": {"books": [{"title": "Dune", "author": null}, {"title": "Emma", "author": null}]},
+  "errors": [
+    {"message": "Author service unavailable", "path": ["books", 0, "author"], "locations": [{"line": 1, "column": 18}], "extensions": {"code": "SERVICE_UNAVAILABLE", "retryAfter": 5}},
+    {"message": "Not authorised", "path": ["books", 1, "author"], "extensions": {"code": "FORBIDDEN"}}
+  ]
+}`))
+	}))
+	defer mockServer.Close()
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books { title author { name } } }`})
+	if code != http.StatusOK || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the HTTP status to be passed through, got %d/%d", code, resp.StatusCode)
+	}
+	if !resp.PartialData {
+		t.Error("Expected partial_data to be set")
+	}
+	if len(resp.Errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %+v", resp.Errors)
+	}
+
+	first := resp.Errors[0]
+	if first.Message != "Author service unavailable" || first.Path != "books.0.author" || first.Code != "SERVICE_UNAVAILABLE" {
+		t.Errorf("Unexpected first error: %+v", first)
+	}
+	if len(first.Locations) != 1 || first.Locations[0].Line != 1 || first.Locations[0].Column != 18 {
+		t.Errorf("Unexpected locations: %+v", first.Locations)
+	}
+	if first.Extensions["retryAfter"] != float64(5) {
+		t.Errorf("Expected extensions to be kept, got %+v", first.Extensions)
+	}
+
+	if len(resp.Spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(resp.Spans))
+	}
+	span := resp.Spans[0]
+	if span.Status != "ERROR" {
+		t.Errorf("Expected span status ERROR, got %s", span.Status)
+	}
+	expectedTags := map[string]string{
+		"graphql.error_count":          "2",
+		"graphql.partial_data":         "true",
+		"graphql.error.books.0.author": "SERVICE_UNAVAILABLE: Author service unavailable",
+		"graphql.error.books.1.author": "FORBIDDEN: Not authorised",
+	}
+	for key, value := range expectedTags {
+		if span.Tags[key] != value {
+			t.Errorf("Expected tag %s=%q, got %q", key, value, span.Tags[key])
+		}
+	}
+}
+
+func TestGraphQLErrors_RequestErrors(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors": [{"message": "Cannot query field \"isbn\" on type \"Book\"."}, {"message": "Unknown argument \"sort\"."}]}`))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books(sort: ASC) { isbn } }`})
+	if resp.PartialData {
+		t.Error("Expected no partial data without a data field")
+	}
+	if len(resp.Errors) != 2 || resp.Errors[0].Path != "" {
+		t.Fatalf("Unexpected errors: %+v", resp.Errors)
+	}
+	span := resp.Spans[0]
+	if span.Status != "ERROR" {
+		t.Errorf("Expected span status ERROR, got %s", span.Status)
+	}
+	if got := span.Tags["graphql.error"]; got != `Cannot query field "isbn" on type "Book".; Unknown argument "sort".` {
+		t.Errorf("Expected errors without a path to share a tag, got %q", got)
+	}
+}
+
+func TestGraphQLErrors_SuccessfulResponse(t *testing.T) {
+	for name, body := range map[string]string{
+		"data only":    `{"data": {"books": []}}`,
+		"empty errors": `{"data": {"books": []}, "errors": []}`,
+		"not json":     `<html>ok</html>`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			}))
+			defer mockServer.Close()
+
+			_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books { title } }`})
+			if len(resp.Errors) != 0 || resp.PartialData {
+				t.Errorf("Expected no errors, got %+v", resp.Errors)
+			}
+			if span := resp.Spans[0]; span.Status != "OK" || span.Tags["graphql.error_count"] != "" {
+				t.Errorf("Expected an OK span without error tags, got %s %+v", span.Status, span.Tags)
+			}
+		})
+	}
+}
+
+func TestGraphQLErrorTags_Bounded(t *testing.T) {
+	errs := make([]model.GraphQLError, 0, 50)
+	for i := 0; i < 50; i++ {
+		errs = append(errs, model.GraphQLError{Message: "boom", Path: graphqlErrorPath([]any{"books", float64(i), "author"})})
+	}
+	tags := map[string]string{}
+	addGraphQLErrorTags(tags, errs, true)
+
+	if tags["graphql.error_count"] != "50" {
+		t.Errorf("Expected the full error count, got %s", tags["graphql.error_count"])
+	}
+	// error_count, partial_data and one tag per path up to the limit
+	if len(tags) != maxGraphQLErrorTags+2 {
+		t.Errorf("Expected %d tags, got %d", maxGraphQLErrorTags+2, len(tags))
+	}
+}
@@ -0,0 +1,309 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// graphqlSchemaCache keeps the last introspected schema per endpoint, keyed by a hash of the
+// URL, headers and credentials since they can change what a schema exposes
+type graphqlSchemaCache struct {
+	mu         sync.Mutex
+	entries    map[string]*graphqlSchemaEntry
+	maxEntries int
+}
+
+type graphqlSchemaEntry struct {
+	raw       json.RawMessage // The __schema object as returned by the target
+	schema    *introspectionSchema
+	sdl       string
+	hash      string
+	fetchedAt time.Time
+	lastUsed  time.Time
+
+	// Parsed form of sdl for query validation, built on first use
+	astOnce sync.Once
+	ast     *ast.Schema
+}
+
+func newGraphQLSchemaCache(maxEntries int) *graphqlSchemaCache {
+	return &graphqlSchemaCache{
+		entries:    make(map[string]*graphqlSchemaEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// Global schema cache
+var graphqlSchemas = newGraphQLSchemaCache(128)
+
+// graphqlSchemaKey hashes the endpoint URL and the headers a request is sent with, auth
+// included, into a stable cache key
+func graphqlSchemaKey(url string, headers map[string]string, cfg *model.AuthConfig) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "url:%d:%s\n", len(url), url)
+
+	// Header names are case-insensitive, and auth replaces a header of the same name
+	sent := make(map[string]string, len(headers))
+	for name, value := range headers {
+		sent[strings.ToLower(name)] = value
+	}
+	credentials, identity := graphqlCredentials(cfg)
+	for name, value := range credentials {
+		sent[name] = value
+	}
+
+	names := make([]string, 0, len(sent))
+	for name := range sent {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "header:%d:%s:%d:%s\n", len(name), name, len(sent[name]), sent[name])
+	}
+	if identity != "" {
+		fmt.Fprintf(h, "auth:%d:%s\n", len(identity), identity)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// graphqlCredentials returns the header the auth block adds when it is the same on every
+// request. Signatures and fetched OAuth2 tokens change between requests, so those schemes
+// are identified by their configuration instead
+func graphqlCredentials(cfg *model.AuthConfig) (map[string]string, string) {
+	if cfg == nil {
+		return nil, ""
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "basic", "bearer", "apikey":
+		credentials := map[string]string{}
+		if err := auth.ApplyMetadata(credentials, cfg); err == nil {
+			return credentials, ""
+		}
+	}
+	identity := *cfg
+	if identity.OAuth2 != nil {
+		identity.Token = ""
+	}
+	encoded, _ := json.Marshal(identity)
+	return nil, string(encoded)
+}
+
+// Get returns the cached schema for a key
+func (g *graphqlSchemaCache) Get(key string) (*graphqlSchemaEntry, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.entries[key]
+	if ok {
+		entry.lastUsed = time.Now()
+	}
+	return entry, ok
+}
+
+// Put stores a schema and returns the entry it replaced, if any
+func (g *graphqlSchemaCache) Put(key string, entry *graphqlSchemaEntry) *graphqlSchemaEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous := g.entries[key]
+	if previous == nil && len(g.entries) >= g.maxEntries {
+		g.evictOldest()
+	}
+	entry.lastUsed = time.Now()
+	g.entries[key] = entry
+	return previous
+}
+
+// evictOldest drops the least recently used entry. Caller must hold g.mu
+func (g *graphqlSchemaCache) evictOldest() {
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range g.entries {
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, entry.lastUsed
+		}
+	}
+	delete(g.entries, oldestKey)
+}
+
+// introspectGraphQLSchema godoc
+// @Summary      Introspect a GraphQL schema
+// @Description  Runs the standard introspection query against the target with the request's headers and `auth` and returns the schema as JSON and SDL.
+// @Description  The URL, headers and auth can reference `environment` variables, as in a GraphQL request.
+// @Description  Schemas are cached per URL, headers and credentials, and a GraphQL request sent with the same ones is validated against the cached schema; set `refresh` to fetch again.
+// @Description  `changed` reports whether a fetched schema differs from the previous one
+// @Tags         GraphQL
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GraphQLIntrospectRequest true "Endpoint and headers"
+// @Success      200 {object} model.GraphQLIntrospectResponse "Schema as JSON and SDL"
+// @Failure      400 {object} model.GraphQLIntrospectResponse "Invalid request body, unresolved variable or invalid auth"
+// @Failure      401 {object} model.GraphQLIntrospectResponse "OAuth2 needs an interactive authorization first"
+// @Failure      502 {object} model.GraphQLIntrospectResponse "The target or the OAuth2 token endpoint failed, or the target does not allow introspection"
+// @Router       /graphql/introspect [post]
+func introspectGraphQLSchema(c *gin.Context) {
+	reqBody := model.GraphQLIntrospectRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLIntrospectResponse{Error: err.Error()})
+		return
+	}
+	if err := expandGraphQLIntrospectRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLIntrospectResponse{URL: reqBody.URL, Error: err.Error()})
+		return
+	}
+	if reqBody.URL == "" {
+		c.JSON(http.StatusBadRequest, model.GraphQLIntrospectResponse{Error: "url is required"})
+		return
+	}
+
+	key := graphqlSchemaKey(reqBody.URL, reqBody.Headers, reqBody.Auth)
+	if !reqBody.Refresh {
+		if entry, ok := graphqlSchemas.Get(key); ok {
+			response := schemaResponse(reqBody.URL, entry)
+			response.Cached = true
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	// Introspection has no span of its own, so a token fetch is traced on its own
+	if _, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, tracing.GenerateTraceID(), ""); err != nil {
+		c.JSON(code, model.GraphQLIntrospectResponse{URL: reqBody.URL, Error: err.Error()})
+		return
+	}
+
+	requestStart := time.Now()
+	entry, statusCode, err := fetchGraphQLSchema(reqBody.URL, reqBody.Headers, reqBody.Auth)
+	duration := fmt.Sprintf("%vms", time.Since(requestStart).Milliseconds())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, model.GraphQLIntrospectResponse{
+			URL:        reqBody.URL,
+			StatusCode: statusCode,
+			Duration:   duration,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	response := schemaResponse(reqBody.URL, entry)
+	response.StatusCode = statusCode
+	response.Duration = duration
+	if previous := graphqlSchemas.Put(key, entry); previous != nil && previous.hash != entry.hash {
+		response.Changed = true
+		response.PreviousHash = previous.hash
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// schemaResponse describes a cached or freshly fetched schema
+func schemaResponse(url string, entry *graphqlSchemaEntry) model.GraphQLIntrospectResponse {
+	return model.GraphQLIntrospectResponse{
+		URL:        url,
+		StatusCode: http.StatusOK,
+		Schema:     entry.raw,
+		SDL:        entry.sdl,
+		Hash:       entry.hash,
+		Types:      len(entry.schema.printedTypes()),
+		FetchedAt:  entry.fetchedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// fetchGraphQLSchema runs the introspection query with the request's auth, whose OAuth2
+// token must already be fetched, and prints the result as SDL. The HTTP status of the
+// target is returned alongside any error
+func fetchGraphQLSchema(url string, headers map[string]string, cfg *model.AuthConfig) (*graphqlSchemaEntry, int, error) {
+	body, err := json.Marshal(graphqlRequestBody{Query: introspectionQuery, OperationName: "IntrospectionQuery"})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reqClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	remoteResponse, err := auth.Send(reqClient, cfg, func() (*http.Request, error) {
+		remoteReq, err := newGraphQLHTTPRequest(url, headers, body)
+		if err != nil {
+			return nil, err
+		}
+		return remoteReq, auth.Apply(remoteReq, cfg)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer remoteResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(remoteResponse.Body)
+	if err != nil {
+		return nil, remoteResponse.StatusCode, fmt.Errorf("Failed to read response body")
+	}
+
+	var result struct {
+		Data struct {
+			Schema json.RawMessage `json:"__schema"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(responseBody, &result); err != nil {
+		return nil, remoteResponse.StatusCode, fmt.Errorf("Introspection response is not GraphQL JSON (HTTP %d)", remoteResponse.StatusCode)
+	}
+	if len(result.Data.Schema) == 0 || bytes.Equal(result.Data.Schema, []byte("null")) {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		if len(messages) == 0 {
+			messages = append(messages, fmt.Sprintf("no __schema in response (HTTP %d)", remoteResponse.StatusCode))
+		}
+		return nil, remoteResponse.StatusCode, fmt.Errorf("Introspection failed: %s", strings.Join(messages, "; "))
+	}
+
+	entry, err := newGraphQLSchemaEntry(result.Data.Schema)
+	return entry, remoteResponse.StatusCode, err
+}
+
+// newGraphQLSchemaEntry prints an introspected __schema object as SDL
+func newGraphQLSchemaEntry(raw json.RawMessage) (*graphqlSchemaEntry, error) {
+	schema := &introspectionSchema{}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, fmt.Errorf("Invalid introspection result: %v", err)
+	}
+	sdl := printSDL(schema)
+	hash := sha256.Sum256([]byte(sdl))
+
+	return &graphqlSchemaEntry{
+		raw:       raw,
+		schema:    schema,
+		sdl:       sdl,
+		hash:      hex.EncodeToString(hash[:]),
+		fetchedAt: time.Now(),
+	}, nil
+}
+
+// newGraphQLHTTPRequest builds the POST to a GraphQL endpoint. Custom headers are set after
+// the JSON Content-Type so they may override it
+func newGraphQLHTTPRequest(url string, headers map[string]string, body []byte) (*http.Request, error) {
+	remoteReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	remoteReq.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		remoteReq.Header.Set(key, value)
+	}
+	return remoteReq, nil
+}
@@ -0,0 +1,349 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// Builders for hand-written introspection results
+func gqlNamed(kind, name string) introspectionTypeRef {
+	return introspectionTypeRef{Kind: kind, Name: &name}
+}
+
+func gqlNonNull(t introspectionTypeRef) introspectionTypeRef {
+	return introspectionTypeRef{Kind: "NON_NULL", OfType: &t}
+}
+
+func gqlList(t introspectionTypeRef) introspectionTypeRef {
+	return introspectionTypeRef{Kind: "LIST", OfType: &t}
+}
+
+func gqlString(s string) *string {
+	return &s
+}
+
+func gqlArg(name string, t introspectionTypeRef, defaultValue *string) introspectionInputValue {
+	return introspectionInputValue{Name: name, Type: t, DefaultValue: defaultValue}
+}
+
+func gqlField(name string, t introspectionTypeRef, args ...introspectionInputValue) introspectionField {
+	return introspectionField{Name: name, Type: t, Args: args}
+}
+
+// testLibrarySchema is the introspection result of testLibrarySDL
+func testLibrarySchema() *introspectionSchema {
+	var (
+		id       = gqlNamed("SCALAR", "ID")
+		str      = gqlNamed("SCALAR", "String")
+		integer  = gqlNamed("SCALAR", "Int")
+		book     = gqlNamed("OBJECT", "Book")
+		author   = gqlNamed("OBJECT", "Author")
+		genre    = gqlNamed("ENUM", "Genre")
+		node     = gqlNamed("INTERFACE", "Node")
+		search   = gqlNamed("UNION", "SearchResult")
+		filter   = gqlNamed("INPUT_OBJECT", "BookFilter")
+		dateTime = gqlNamed("SCALAR", "DateTime")
+	)
+
+	subtitle := gqlField("subtitle", str)
+	subtitle.IsDeprecated = true
+	subtitle.DeprecationReason = gqlString("Use title")
+	nodeID := gqlArg("id", gqlNonNull(id), nil)
+	nodeID.Description = gqlString("Global ID")
+
+	return &introspectionSchema{
+		QueryType:    &introspectionName{Name: "Query"},
+		MutationType: &introspectionName{Name: "Mutation"},
+		Types: []introspectionType{
+			{Kind: "OBJECT", Name: "Query", Fields: []introspectionField{
+				gqlField("book", book, gqlArg("id", gqlNonNull(id), nil)),
+				gqlField("books", gqlNonNull(gqlList(gqlNonNull(book))), gqlArg("filter", filter, nil), gqlArg("first", integer, gqlString("10"))),
+				gqlField("node", node, nodeID),
+				gqlField("search", gqlNonNull(gqlList(gqlNonNull(search))), gqlArg("text", gqlNonNull(str), nil)),
+			}},
+			{Kind: "OBJECT", Name: "Mutation", Fields: []introspectionField{
+				gqlField("addBook", gqlNonNull(book), gqlArg("title", gqlNonNull(str), nil), gqlArg("genre", genre, nil)),
+			}},
+			{Kind: "OBJECT", Name: "Book", Description: gqlString("A book in the library"), Interfaces: []introspectionTypeRef{node}, Fields: []introspectionField{
+				gqlField("id", gqlNonNull(id)),
+				gqlField("title", gqlNonNull(str)),
+				subtitle,
+				gqlField("author", author),
+				gqlField("genre", genre),
+				gqlField("published", dateTime),
+			}},
+			{Kind: "OBJECT", Name: "Author", Interfaces: []introspectionTypeRef{node}, Fields: []introspectionField{
+				gqlField("id", gqlNonNull(id)),
+				gqlField("name", gqlNonNull(str)),
+				gqlField("books", gqlNonNull(gqlList(gqlNonNull(book))), gqlArg("first", integer, gqlString("10"))),
+			}},
+			{Kind: "INTERFACE", Name: "Node", Fields: []introspectionField{gqlField("id", gqlNonNull(id))}, PossibleTypes: []introspectionTypeRef{author, book}},
+			{Kind: "UNION", Name: "SearchResult", PossibleTypes: []introspectionTypeRef{author, book}},
+			{Kind: "ENUM", Name: "Genre", EnumValues: []introspectionEnumValue{
+				{Name: "FICTION"},
+				{Name: "HISTORY", IsDeprecated: true, DeprecationReason: gqlString(defaultDeprecationReason)},
+			}},
+			{Kind: "INPUT_OBJECT", Name: "BookFilter", InputFields: []introspectionInputValue{
+				gqlArg("genre", genre, gqlString("FICTION")),
+				gqlArg("search", str, nil),
+			}},
+			{Kind: "SCALAR", Name: "DateTime"},
+			{Kind: "SCALAR", Name: "ID"},
+			{Kind: "SCALAR", Name: "String"},
+			{Kind: "SCALAR", Name: "Int"},
+			{Kind: "SCALAR", Name: "Boolean"},
+			{Kind: "OBJECT", Name: "__Schema"},
+		},
+		Directives: []introspectionDirective{
+			{Name: "skip", Locations: []string{"FIELD"}, Args: []introspectionInputValue{gqlArg("if", gqlNonNull(gqlNamed("SCALAR", "Boolean")), nil)}},
+			{Name: "cached", Locations: []string{"FIELD_DEFINITION", "OBJECT"}, Args: []introspectionInputValue{gqlArg("ttl", integer, gqlString("60"))}},
+			{Name: "deprecated", Locations: []string{"FIELD_DEFINITION", "ENUM_VALUE"}},
+		},
+	}
+}
+
+// testLibrarySDL is the expected SDL of testLibrarySchema
+const testLibrarySDL = `directive @cached(ttl: Int = 60) on FIELD_DEFINITION | OBJECT
+
+type Author implements Node {
+  id: ID!
+  name: String!
+  books(first: Int = 10): [Book!]!
+}
+
+"""A book in the library"""
+type Book implements Node {
+  id: ID!
+  title: String!
+  subtitle: String @deprecated(reason: "Use title")
+  author: Author
+  genre: Genre
+  published: DateTime
+}
+
+input BookFilter {
+  genre: Genre = FICTION
+  search: String
+}
+
+scalar DateTime
+
+enum Genre {
+  FICTION
+  HISTORY @deprecated
+}
+
+type Mutation {
+  addBook(title: String!, genre: Genre): Book!
+}
+
+interface Node {
+  id: ID!
+}
+
+type Query {
+  book(id: ID!): Book
+  books(filter: BookFilter, first: Int = 10): [Book!]!
+  node(
+    """Global ID"""
+    id: ID!
+  ): Node
+  search(text: String!): [SearchResult!]!
+}
+
+union SearchResult = Author | Book
+`
+
+// introspectionServer answers introspection queries with a schema that tests can swap
+type introspectionServer struct {
+	mu          sync.Mutex
+	schema      *introspectionSchema
+	hits        int
+	lastHeaders http.Header
+}
+
+func (s *introspectionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body graphqlRequestBody
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	s.hits++
+	s.lastHeaders = r.Header.Clone()
+	schema := s.schema
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(body.Query, "__schema") || schema == nil {
+		w.Write([]byte(`{"errors": [{"message": "GraphQL introspection is not allowed"}]}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"__schema": schema}})
+}
+
+func (s *introspectionServer) setSchema(schema *introspectionSchema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = schema
+}
+
+func (s *introspectionServer) hitCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits
+}
+
+func TestPrintSDL(t *testing.T) {
+	if got := printSDL(testLibrarySchema()); got != testLibrarySDL {
+		t.Errorf("Unexpected SDL:\n%s\nexpected:\n%s", got, testLibrarySDL)
+	}
+}
+
+func TestPrintSDL_CustomRootTypes(t *testing.T) {
+	schema := &introspectionSchema{
+		QueryType: &introspectionName{Name: "Root"},
+		Types: []introspectionType{
+			{Kind: "OBJECT", Name: "Root", Fields: []introspectionField{gqlField("ping", gqlNamed("SCALAR", "String"))}},
+		},
+	}
+	expected := "schema {\n  query: Root\n}\n\ntype Root {\n  ping: String\n}\n"
+	if got := printSDL(schema); got != expected {
+		t.Errorf("Unexpected SDL:\n%s", got)
+	}
+}
+
+func TestGraphQLIntrospect_CachesAndDetectsChanges(t *testing.T) {
+	server := &introspectionServer{schema: testLibrarySchema()}
+	target := httptest.NewServer(server)
+	defer target.Close()
+
+	headers := map[string]string{"Authorization": "Bearer one"}
+	code, first := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: headers})
+	if code != http.StatusOK || first.Error != "" {
+		t.Fatalf("Expected 200, got %d: %s", code, first.Error)
+	}
+	if first.SDL != testLibrarySDL || first.Types != 9 || first.Hash == "" || first.Cached || first.Changed {
+		t.Errorf("Unexpected first fetch: %+v", first)
+	}
+	if !strings.Contains(string(first.Schema), `"queryType"`) {
+		t.Errorf("Expected the __schema JSON, got %s", first.Schema)
+	}
+	if server.lastHeaders.Get("Authorization") != "Bearer one" || server.lastHeaders.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected request headers to be forwarded, got %v", server.lastHeaders)
+	}
+
+	// Served from the cache
+	_, cached := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: headers})
+	if !cached.Cached || cached.Hash != first.Hash || server.hitCount() != 1 {
+		t.Errorf("Expected a cached schema without a second fetch, got cached=%v hits=%d", cached.Cached, server.hitCount())
+	}
+
+	// Other headers are another cache entry
+	postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: map[string]string{"Authorization": "Bearer two"}})
+	if server.hitCount() != 2 {
+		t.Errorf("Expected a fetch for different headers, got %d hits", server.hitCount())
+	}
+
+	// Refreshing an unchanged schema
+	_, unchanged := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: headers, Refresh: true})
+	if unchanged.Cached || unchanged.Changed || unchanged.Hash != first.Hash {
+		t.Errorf("Expected an unchanged refetch, got %+v", unchanged)
+	}
+
+	// Types in another order print the same SDL
+	reordered := testLibrarySchema()
+	reordered.Types[0], reordered.Types[1] = reordered.Types[1], reordered.Types[0]
+	server.setSchema(reordered)
+	_, same := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: headers, Refresh: true})
+	if same.Changed {
+		t.Error("Expected type order not to count as a change")
+	}
+
+	changed := testLibrarySchema()
+	changed.Types[0].Fields = changed.Types[0].Fields[:2]
+	server.setSchema(changed)
+	_, refreshed := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Headers: headers, Refresh: true})
+	if !refreshed.Changed || refreshed.PreviousHash != first.Hash || refreshed.Hash == first.Hash {
+		t.Errorf("Expected a changed schema, got %+v", refreshed)
+	}
+}
+
+func TestGraphQLIntrospect_AuthAndEnvironment(t *testing.T) {
+	server := &introspectionServer{schema: testLibrarySchema()}
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors": [{"message": "unauthorized"}]}`))
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer target.Close()
+
+	bearer := func() *model.AuthConfig { return &model.AuthConfig{Type: "bearer", Token: "{{token}}"} }
+	environment := map[string]string{"endpoint": target.URL, "token": "s3cret"}
+	code, resp := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: "{{endpoint}}", Auth: bearer(), Environment: environment})
+	if code != http.StatusOK || resp.URL != target.URL {
+		t.Fatalf("Expected 200 for %s, got %d: %s", target.URL, code, resp.Error)
+	}
+
+	// A request with the same auth is validated against the cached schema
+	code, executed := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:         "{{endpoint}}",
+		Query:       `{ book(id: "1") { isbn } }`,
+		Auth:        bearer(),
+		Environment: environment,
+	})
+	if code != http.StatusBadRequest || !executed.Validated || len(executed.ValidationErrors) == 0 {
+		t.Errorf("Expected the query to fail validation, got %d %+v", code, executed)
+	}
+
+	code, resp = postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL, Auth: bearer(), Environment: map[string]string{"endpoint": target.URL}})
+	if code != http.StatusBadRequest || !strings.Contains(resp.Error, "token") {
+		t.Errorf("Expected 400 for an unresolved variable, got %d: %s", code, resp.Error)
+	}
+}
+
+func TestGraphQLSchemaKey_Credentials(t *testing.T) {
+	url := "http://graphql.test/"
+	header := graphqlSchemaKey(url, map[string]string{"authorization": "Bearer one"}, nil)
+	if key := graphqlSchemaKey(url, nil, &model.AuthConfig{Type: "bearer", Token: "one"}); key != header {
+		t.Error("Expected a bearer token to key like the header it sends")
+	}
+	if key := graphqlSchemaKey(url, nil, &model.AuthConfig{Type: "bearer", Token: "two"}); key == header {
+		t.Error("Expected another token to be another key")
+	}
+
+	// A fetched OAuth2 token does not change the key, the client does
+	oauth2 := func(clientID, token string) *model.AuthConfig {
+		return &model.AuthConfig{Type: "oauth2", Token: token, OAuth2: &model.OAuth2Config{GrantType: "client_credentials", TokenURL: "http://auth.test/token", ClientID: clientID}}
+	}
+	if graphqlSchemaKey(url, nil, oauth2("app", "")) != graphqlSchemaKey(url, nil, oauth2("app", "fetched")) {
+		t.Error("Expected the OAuth2 key to ignore the fetched token")
+	}
+	if graphqlSchemaKey(url, nil, oauth2("app", "")) == graphqlSchemaKey(url, nil, oauth2("other", "")) {
+		t.Error("Expected another OAuth2 client to be another key")
+	}
+}
+
+func TestGraphQLIntrospect_Disabled(t *testing.T) {
+	target := httptest.NewServer(&introspectionServer{})
+	defer target.Close()
+
+	code, resp := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: target.URL})
+	if code != http.StatusBadGateway || !strings.Contains(resp.Error, "introspection is not allowed") {
+		t.Errorf("Expected 502 with the server's error, got %d: %s", code, resp.Error)
+	}
+}
+
+func TestGraphQLIntrospect_MissingURL(t *testing.T) {
+	code, resp := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{})
+	if code != http.StatusBadRequest || resp.Error != "url is required" {
+		t.Errorf("Expected 400, got %d: %s", code, resp.Error)
+	}
+}
@@ -0,0 +1,369 @@
+package routes
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// introspectionQuery is the standard introspection query. Newer fields such as isRepeatable and
+// specifiedByURL are left out so older servers accept it
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType {
+                kind
+                name
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// introspectionSchema is the __schema object of an introspection result
+type introspectionSchema struct {
+	QueryType        *introspectionName       `json:"queryType"`
+	MutationType     *introspectionName       `json:"mutationType"`
+	SubscriptionType *introspectionName       `json:"subscriptionType"`
+	Types            []introspectionType      `json:"types"`
+	Directives       []introspectionDirective `json:"directives"`
+}
+
+type introspectionName struct {
+	Name string `json:"name"`
+}
+
+type introspectionType struct {
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Description   *string                   `json:"description"`
+	Fields        []introspectionField      `json:"fields"`
+	InputFields   []introspectionInputValue `json:"inputFields"`
+	Interfaces    []introspectionTypeRef    `json:"interfaces"`
+	EnumValues    []introspectionEnumValue  `json:"enumValues"`
+	PossibleTypes []introspectionTypeRef    `json:"possibleTypes"`
+}
+
+type introspectionField struct {
+	Name              string                    `json:"name"`
+	Description       *string                   `json:"description"`
+	Args              []introspectionInputValue `json:"args"`
+	Type              introspectionTypeRef      `json:"type"`
+	IsDeprecated      bool                      `json:"isDeprecated"`
+	DeprecationReason *string                   `json:"deprecationReason"`
+}
+
+type introspectionInputValue struct {
+	Name         string               `json:"name"`
+	Description  *string              `json:"description"`
+	Type         introspectionTypeRef `json:"type"`
+	DefaultValue *string              `json:"defaultValue"`
+}
+
+type introspectionEnumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type introspectionDirective struct {
+	Name        string                    `json:"name"`
+	Description *string                   `json:"description"`
+	Locations   []string                  `json:"locations"`
+	Args        []introspectionInputValue `json:"args"`
+}
+
+// introspectionTypeRef is a possibly wrapped reference to a named type
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   *string               `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+// String renders the reference in SDL form, e.g. [Book!]!
+func (t introspectionTypeRef) String() string {
+	switch {
+	case t.Kind == "NON_NULL" && t.OfType != nil:
+		return t.OfType.String() + "!"
+	case t.Kind == "LIST" && t.OfType != nil:
+		return "[" + t.OfType.String() + "]"
+	case t.Name != nil:
+		return *t.Name
+	}
+	return ""
+}
+
+// builtinScalars and builtinDirectives are part of every schema and are not printed
+var builtinScalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+var builtinDirectives = map[string]bool{"include": true, "skip": true, "deprecated": true, "specifiedBy": true, "oneOf": true}
+
+// defaultDeprecationReason is omitted from @deprecated, matching graphql-js
+const defaultDeprecationReason = "No longer supported"
+
+// printedTypes returns the user-defined types sorted by name
+func (s *introspectionSchema) printedTypes() []introspectionType {
+	var types []introspectionType
+	for _, t := range s.Types {
+		if strings.HasPrefix(t.Name, "__") || (t.Kind == "SCALAR" && builtinScalars[t.Name]) {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// printSDL renders the schema in the SDL form of graphql-js printSchema, with types sorted by
+// name so servers that return them in a different order produce the same document
+func printSDL(s *introspectionSchema) string {
+	var blocks []string
+
+	if schemaBlock := printSchemaDefinition(s); schemaBlock != "" {
+		blocks = append(blocks, schemaBlock)
+	}
+
+	directives := append([]introspectionDirective(nil), s.Directives...)
+	sort.Slice(directives, func(i, j int) bool { return directives[i].Name < directives[j].Name })
+	for _, d := range directives {
+		if builtinDirectives[d.Name] {
+			continue
+		}
+		blocks = append(blocks, printDescription(d.Description, "", true)+
+			"directive @"+d.Name+printArgs(d.Args, "")+" on "+strings.Join(d.Locations, " | "))
+	}
+
+	for _, t := range s.printedTypes() {
+		blocks = append(blocks, printType(t))
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// printSchemaDefinition prints the schema block only when the root types are not named conventionally
+func printSchemaDefinition(s *introspectionSchema) string {
+	roots := []struct {
+		operation string
+		root      *introspectionName
+		name      string
+	}{
+		{"query", s.QueryType, "Query"},
+		{"mutation", s.MutationType, "Mutation"},
+		{"subscription", s.SubscriptionType, "Subscription"},
+	}
+
+	conventional := true
+	var lines []string
+	for _, r := range roots {
+		if r.root == nil {
+			continue
+		}
+		if r.root.Name != r.name {
+			conventional = false
+		}
+		lines = append(lines, "  "+r.operation+": "+r.root.Name)
+	}
+	if conventional {
+		return ""
+	}
+	return "schema {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+func printType(t introspectionType) string {
+	description := printDescription(t.Description, "", true)
+	switch t.Kind {
+	case "SCALAR":
+		return description + "scalar " + t.Name
+	case "OBJECT":
+		return description + "type " + t.Name + printImplements(t.Interfaces) + printFields(t.Fields)
+	case "INTERFACE":
+		return description + "interface " + t.Name + printImplements(t.Interfaces) + printFields(t.Fields)
+	case "UNION":
+		members := make([]string, 0, len(t.PossibleTypes))
+		for _, member := range t.PossibleTypes {
+			members = append(members, member.String())
+		}
+		if len(members) == 0 {
+			return description + "union " + t.Name
+		}
+		return description + "union " + t.Name + " = " + strings.Join(members, " | ")
+	case "ENUM":
+		lines := make([]string, 0, len(t.EnumValues))
+		for i, v := range t.EnumValues {
+			lines = append(lines, printDescription(v.Description, "  ", i == 0)+"  "+v.Name+printDeprecated(v.IsDeprecated, v.DeprecationReason))
+		}
+		return description + "enum " + t.Name + printBlock(lines)
+	case "INPUT_OBJECT":
+		lines := make([]string, 0, len(t.InputFields))
+		for i, f := range t.InputFields {
+			lines = append(lines, printDescription(f.Description, "  ", i == 0)+"  "+printInputValue(f))
+		}
+		return description + "input " + t.Name + printBlock(lines)
+	}
+	return description + "scalar " + t.Name
+}
+
+func printImplements(interfaces []introspectionTypeRef) string {
+	if len(interfaces) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(interfaces))
+	for _, i := range interfaces {
+		names = append(names, i.String())
+	}
+	return " implements " + strings.Join(names, " & ")
+}
+
+func printFields(fields []introspectionField) string {
+	lines := make([]string, 0, len(fields))
+	for i, f := range fields {
+		lines = append(lines, printDescription(f.Description, "  ", i == 0)+
+			"  "+f.Name+printArgs(f.Args, "  ")+": "+f.Type.String()+printDeprecated(f.IsDeprecated, f.DeprecationReason))
+	}
+	return printBlock(lines)
+}
+
+func printBlock(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return " {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+// printArgs prints arguments inline, or one per line when any of them has a description
+func printArgs(args []introspectionInputValue, indent string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	multiline := false
+	for _, arg := range args {
+		if arg.Description != nil && *arg.Description != "" {
+			multiline = true
+		}
+	}
+
+	parts := make([]string, 0, len(args))
+	for i, arg := range args {
+		if multiline {
+			parts = append(parts, printDescription(arg.Description, indent+"  ", i == 0)+indent+"  "+printInputValue(arg))
+		} else {
+			parts = append(parts, printInputValue(arg))
+		}
+	}
+	if multiline {
+		return "(\n" + strings.Join(parts, "\n") + "\n" + indent + ")"
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func printInputValue(v introspectionInputValue) string {
+	s := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		s += " = " + *v.DefaultValue
+	}
+	return s
+}
+
+func printDeprecated(deprecated bool, reason *string) string {
+	if !deprecated {
+		return ""
+	}
+	if reason == nil || *reason == defaultDeprecationReason {
+		return " @deprecated"
+	}
+	quoted, _ := json.Marshal(*reason)
+	return " @deprecated(reason: " + string(quoted) + ")"
+}
+
+// printDescription prints a block string description followed by a newline. Descriptions of
+// fields and values after the first one are preceded by a blank line, like graphql-js does
+func printDescription(description *string, indent string, first bool) string {
+	if description == nil || *description == "" {
+		return ""
+	}
+	prefix := ""
+	if !first {
+		prefix = "\n"
+	}
+
+	text := strings.ReplaceAll(*description, `"""`, `\"""`)
+	if !strings.Contains(text, "\n") && !strings.HasSuffix(text, `"`) && !strings.HasSuffix(text, `\`) {
+		return prefix + indent + `"""` + text + `"""` + "\n"
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return prefix + indent + `"""` + "\n" + strings.Join(lines, "\n") + "\n" + indent + `"""` + "\n"
+}
@@ -0,0 +1,637 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// Default upper bound for a subscription. Closing the SSE connection ends it earlier
+const graphqlSubscriptionTimeout = 5 * time.Minute
+
+// graphqlWSHandshakeTimeout bounds the WebSocket upgrade and the wait for connection_ack
+const graphqlWSHandshakeTimeout = 10 * time.Second
+
+// maxSubscriptionSpanEvents bounds the message events on a subscription span, since a
+// subscription can run for minutes. Messages past it are only counted, in a tag
+const maxSubscriptionSpanEvents = 500
+
+// graphqlSubscriptionID is the id of the single operation started on each connection
+const graphqlSubscriptionID = "1"
+
+// graphqlWSProtocol describes the message types that differ between the two WebSocket protocols
+type graphqlWSProtocol struct {
+	subprotocol string // Sec-WebSocket-Protocol value
+	subscribe   string // Starts the operation
+	next        string // Carries an execution result
+	stop        string // Sent by the client to end the operation
+	terminate   string // Sent by the client before closing, if the protocol has one
+}
+
+var graphqlWSProtocols = map[string]graphqlWSProtocol{
+	"graphql-transport-ws": {
+		subprotocol: "graphql-transport-ws",
+		subscribe:   "subscribe",
+		next:        "next",
+		stop:        "complete",
+	},
+	// Apollo's legacy protocol negotiates the confusingly named graphql-ws subprotocol
+	"subscriptions-transport-ws": {
+		subprotocol: "graphql-ws",
+		subscribe:   "start",
+		next:        "data",
+		stop:        "stop",
+		terminate:   "connection_terminate",
+	},
+}
+
+// graphqlWSMessage is the envelope shared by both protocols
+type graphqlWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// executeGraphQLSubscription godoc
+// @Summary      Execute a GraphQL subscription
+// @Description  Runs a subscription over WebSocket using graphql-transport-ws (default) or the legacy subscriptions-transport-ws protocol and streams the results as Server-Sent Events.
+// @Description  Events: `connected` (after connection_ack), `next` (model.GraphQLSubscriptionEvent for every payload), `error` (errors sent by the server) and a final `end` (model.GraphQLResponse with the subscription span).
+// @Description  With a `session_id` the handshake sends the session's cookies and stores those it sets.
+// @Description  The subscription ends when the server completes it, after `max_events` payloads, after `timeout_ms` or when the client disconnects
+// @Tags         GraphQL
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        request body model.GraphQLRequest true "GraphQL subscription with WebSocket protocol and connection params"
+// @Success      200 {object} model.GraphQLSubscriptionEvent "SSE stream of connected, next, error and end events"
+// @Failure      400 {object} model.GraphQLResponse "Invalid request body, URL or protocol, or the query failed validation"
+// @Failure      500 {object} model.GraphQLResponse "WebSocket connection failed"
+// @Failure      502 {object} model.GraphQLResponse "The server refused the WebSocket handshake or negotiated another subprotocol"
+// @Router       /graphql/subscribe [post]
+func executeGraphQLSubscription(c *gin.Context) {
+	// Bind the incoming request
+	reqBody := model.GraphQLRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+	log.Println("GraphQL Subscription Request Received")
+
+	// Resolve {{variables}} from the request's environment
+	if err := expandGraphQLRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if reqBody.Protocol == "" {
+		reqBody.Protocol = "graphql-transport-ws"
+	}
+	protocol, ok := graphqlWSProtocols[reqBody.Protocol]
+	if !ok {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Sprintf("Unsupported protocol '%s', expected graphql-transport-ws or subscriptions-transport-ws", reqBody.Protocol),
+		})
+		return
+	}
+	wsURL, err := graphqlWebSocketURL(reqBody.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	// Digest needs a challenge round trip, which a WebSocket handshake cannot make
+	if reqBody.Auth != nil && strings.EqualFold(reqBody.Auth.Type, "digest") {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      "Digest auth is not supported for subscriptions",
+		})
+		return
+	}
+
+	validated, ok := checkGraphQLRequest(c, reqBody)
+	if !ok {
+		return
+	}
+
+	// Generate IDs upfront
+	requestID := reqBody.RequestID
+	executionID := uuid.New().String()
+	spanID := tracing.GenerateSpanID()
+	traceID := tracing.GenerateTraceID()
+
+	// The subscription lives as long as the SSE client stays connected
+	timeout := graphqlSubscriptionTimeout
+	if reqBody.TimeoutMs > 0 {
+		timeout = time.Duration(reqBody.TimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	// Fetch or reuse the OAuth2 access token, with token endpoint calls under the subscription's span
+	tokenSpans, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, spanID)
+	if err != nil {
+		c.JSON(code, model.GraphQLResponse{
+			StatusCode: code,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+			Spans:      tokenSpans,
+		})
+		return
+	}
+
+	// Handshake headers and credentials, with W3C traceparent for distributed tracing
+	handshakeReq, err := http.NewRequest(http.MethodGet, wsURL, nil)
+	if err == nil {
+		for key, value := range reqBody.Headers {
+			handshakeReq.Header.Set(key, value)
+		}
+		err = auth.Apply(handshakeReq, reqBody.Auth)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+	header := handshakeReq.Header
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", traceID, spanID))
+	wsURL = handshakeReq.URL.String()
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: graphqlWSHandshakeTimeout,
+		Subprotocols:     []string{protocol.subprotocol},
+		Jar:              sessionJar(reqBody.WorkspaceID, reqBody.SessionID),
+	}
+	cookiesSent := 0
+	if dialer.Jar != nil {
+		cookiesSent = len(dialer.Jar.Cookies(handshakeReq.URL))
+	}
+	connectStart := time.Now()
+	conn, handshake, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		response := model.GraphQLResponse{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		}
+		// A refused handshake is the server's answer, reported like a subprotocol mismatch
+		code := http.StatusInternalServerError
+		if handshake != nil {
+			code = http.StatusBadGateway
+			response.StatusCode = handshake.StatusCode
+			response.Error = fmt.Sprintf("WebSocket handshake failed with HTTP %d", handshake.StatusCode)
+		}
+		c.JSON(code, response)
+		return
+	}
+	defer conn.Close()
+
+	// Servers that don't echo a subprotocol are given the benefit of the doubt
+	if negotiated := conn.Subprotocol(); negotiated != "" && negotiated != protocol.subprotocol {
+		c.JSON(http.StatusBadGateway, model.GraphQLResponse{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Sprintf("Server negotiated subprotocol '%s', expected '%s'", negotiated, protocol.subprotocol),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		})
+		return
+	}
+
+	// From here on everything, including errors, is reported as SSE events
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	sub := &graphqlSubscription{
+		w:        c.Writer,
+		conn:     conn,
+		protocol: protocol,
+	}
+	sub.run(ctx, reqBody, connectStart)
+	subscriptionEnd := time.Now()
+	totalDuration := subscriptionEnd.Sub(connectStart)
+
+	subscriptionStatus := "OK"
+	if sub.err != "" {
+		subscriptionStatus = "ERROR"
+	}
+	tags := map[string]string{
+		"graphql.operation":           reqBody.OperationName,
+		"graphql.url":                 reqBody.URL,
+		"graphql.protocol":            reqBody.Protocol,
+		"graphql.subscription.events": fmt.Sprintf("%d", sub.events),
+		"graphql.subscription.end":    sub.endReason,
+		"http.status_code":            fmt.Sprintf("%d", handshake.StatusCode),
+	}
+	auth.Tags(tags, reqBody.Auth)
+	addCookieTags(tags, reqBody.SessionID, cookiesSent, len(handshake.Cookies()))
+	if len(sub.errors) > 0 {
+		addGraphQLErrorTags(tags, sub.errors, sub.events > 0)
+	}
+	if sub.err != "" {
+		tags["error.message"] = sub.err
+	}
+	if sub.droppedEvents > 0 {
+		tags["graphql.subscription.dropped_events"] = fmt.Sprintf("%d", sub.droppedEvents)
+	}
+
+	// Every GraphQL error counts, and a failed connection counts once
+	errorCount := len(sub.errors) + sub.payloadErrors
+	if errorCount == 0 && sub.err != "" {
+		errorCount = 1
+	}
+
+	// Queue records for async DB write
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: handshake.StatusCode,
+		LatencyMs:  int(totalDuration.Milliseconds()),
+		ErrorCount: errorCount,
+	})
+
+	spanRecord := store.SpanRecord{
+		ID:          uuid.New().String(),
+		TraceID:     traceID,
+		SpanID:      spanID,
+		Operation:   fmt.Sprintf("GraphQL subscription %s", reqBody.URL),
+		ServiceName: "intercept.prism",
+		StartTime:   connectStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      subscriptionStatus,
+		Tags:        tags,
+		Events:      sub.spanEvents,
+	}
+
+	store.AddSpan(spanRecord)
+	tracing.Hub.Publish(spanRecord)
+
+	log.Println("Queued Execution, and Span for async DB write (GraphQL subscription)")
+
+	rootSpan := model.SpanInfo{
+		SpanID:      spanID,
+		TraceID:     traceID,
+		Operation:   spanRecord.Operation,
+		ServiceName: "intercept.prism",
+		StartTime:   connectStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      subscriptionStatus,
+		Tags:        tags,
+		Events:      sub.spanEvents,
+	}
+
+	respHeaders := make(map[string]string)
+	for k, v := range handshake.Header {
+		respHeaders[k] = strings.Join(v, ", ")
+	}
+
+	sub.send("end", model.GraphQLResponse{
+		Duration:     fmt.Sprintf("%vms", totalDuration.Milliseconds()),
+		StatusCode:   handshake.StatusCode,
+		Headers:      respHeaders,
+		Error:        sub.err,
+		ResponseSize: int64(sub.receivedBytes),
+		RequestSize:  int64(sub.sentBytes),
+		Errors:       sub.errors,
+		Protocol:     reqBody.Protocol,
+		Events:       sub.events,
+		EndReason:    sub.endReason,
+		Validated:    validated,
+		RequestID:    requestID,
+		ExecutionID:  executionID,
+		TraceID:      traceID,
+		SpanID:       spanID,
+		Spans:        append([]model.SpanInfo{rootSpan}, tokenSpans...),
+	})
+}
+
+// graphqlWebSocketURL maps an http(s) endpoint to its ws(s) equivalent
+func graphqlWebSocketURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("Invalid URL: %v", err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("Unsupported URL scheme '%s', expected ws, wss, http or https", u.Scheme)
+	}
+	return u.String(), nil
+}
+
+// graphqlSubscription runs one operation on a WebSocket connection. All writes to the
+// connection and the SSE response happen on the goroutine that calls run
+type graphqlSubscription struct {
+	w        gin.ResponseWriter
+	conn     *websocket.Conn
+	protocol graphqlWSProtocol
+
+	subscribed    time.Time // When the subscribe message was sent
+	lastEvent     time.Time
+	events        int
+	payloadErrors int // GraphQL errors inside next payloads
+	sent          int
+	received      int
+	sentBytes     int
+	receivedBytes int
+	spanEvents    []model.SpanEvent
+	droppedEvents int // Messages past maxSubscriptionSpanEvents
+
+	errors    []model.GraphQLError // Sent by the server in an error message
+	err       string               // Connection or protocol failure
+	endReason string
+}
+
+// graphqlWSRead is one message read from the connection, or the error that ended reading
+type graphqlWSRead struct {
+	msg  graphqlWSMessage
+	size int
+	err  error
+}
+
+// run performs the connection_init handshake, subscribes and relays results until the
+// subscription ends, then stops the operation and closes the connection
+func (s *graphqlSubscription) run(ctx context.Context, reqBody model.GraphQLRequest, connectStart time.Time) {
+	done := make(chan struct{})
+	defer close(done)
+	reads := make(chan graphqlWSRead)
+	go func() {
+		for {
+			read := graphqlWSRead{}
+			_, data, err := s.conn.ReadMessage()
+			if err == nil {
+				read.size = len(data)
+				if jsonErr := json.Unmarshal(data, &read.msg); jsonErr != nil {
+					err = fmt.Errorf("Invalid message from server: %v", jsonErr)
+				}
+			}
+			read.err = err
+			select {
+			case reads <- read:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var initPayload any
+	if reqBody.ConnectionParams != nil {
+		initPayload = reqBody.ConnectionParams
+	}
+	if err := s.write("connection_init", "", initPayload); err != nil {
+		s.fail(err.Error())
+		return
+	}
+	ackTimer := time.NewTimer(graphqlWSHandshakeTimeout)
+	defer ackTimer.Stop()
+	ackTimeout := ackTimer.C
+
+	active := false
+	for s.endReason == "" {
+		select {
+		case <-ctx.Done():
+			s.endReason = "client_closed"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.endReason = "timeout"
+			}
+		case <-ackTimeout:
+			s.fail(fmt.Sprintf("No connection_ack within %v", graphqlWSHandshakeTimeout))
+		case read := <-reads:
+			if read.err != nil {
+				s.closed(read.err)
+				break
+			}
+			s.record("received", read.msg.Type, read.size)
+			active = s.handle(read.msg, reqBody, connectStart, active)
+			if active && ackTimeout != nil {
+				ackTimeout = nil
+			}
+		}
+	}
+
+	// Stop an operation the server still considers running, then close politely
+	if active && (s.endReason == "max_events" || s.endReason == "timeout" || s.endReason == "client_closed") {
+		s.write(s.protocol.stop, graphqlSubscriptionID, nil)
+	}
+	if s.protocol.terminate != "" && s.endReason != "connection_closed" {
+		s.write(s.protocol.terminate, "", nil)
+	}
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// handle reacts to one server message and reports whether the operation is running
+func (s *graphqlSubscription) handle(msg graphqlWSMessage, reqBody model.GraphQLRequest, connectStart time.Time, active bool) bool {
+	switch msg.Type {
+	case "connection_ack":
+		if active {
+			return true
+		}
+		s.send("connected", gin.H{
+			"protocol":     reqBody.Protocol,
+			"subprotocol":  s.protocol.subprotocol,
+			"handshake_us": time.Since(connectStart).Microseconds(),
+			"payload":      msg.Payload,
+		})
+		err := s.write(s.protocol.subscribe, graphqlSubscriptionID, graphqlRequestBody{
+			Query:         reqBody.Query,
+			Variables:     reqBody.Variables,
+			OperationName: reqBody.OperationName,
+		})
+		if err != nil {
+			s.fail(err.Error())
+			return false
+		}
+		s.subscribed = time.Now()
+		s.lastEvent = s.subscribed
+		return true
+
+	case "ping":
+		// graphql-transport-ws expects a pong echoing the payload
+		var payload any
+		if len(msg.Payload) > 0 {
+			payload = msg.Payload
+		}
+		s.write("pong", "", payload)
+
+	case s.protocol.next:
+		if msg.ID != graphqlSubscriptionID {
+			break
+		}
+		s.next(msg.Payload)
+		if reqBody.MaxEvents > 0 && s.events >= reqBody.MaxEvents {
+			s.endReason = "max_events"
+		}
+
+	case "error":
+		s.errors = graphqlWSErrors(msg.Payload)
+		s.send("error", gin.H{"errors": s.errors})
+		s.endReason = "error"
+		s.err = "Subscription failed"
+		if len(s.errors) > 0 {
+			s.err = s.errors[0].Message
+		}
+		return false
+
+	case "connection_error":
+		// subscriptions-transport-ws rejects connection_init with a single error object
+		errs := graphqlWSErrors(msg.Payload)
+		message := "Connection rejected by server"
+		if len(errs) > 0 && errs[0].Message != "" {
+			message = errs[0].Message
+		}
+		s.fail(message)
+		return false
+
+	case "complete":
+		if msg.ID == graphqlSubscriptionID {
+			s.endReason = "complete"
+			return false
+		}
+	}
+	return active
+}
+
+// closed ends the subscription when the connection goes away. Only a normal closure is clean
+func (s *graphqlSubscription) closed(err error) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		if closeErr.Code == websocket.CloseNormalClosure {
+			s.endReason = "connection_closed"
+			return
+		}
+		// graphql-transport-ws reports failures such as 4403 Forbidden as close codes
+		s.fail(fmt.Sprintf("Connection closed with code %d: %s", closeErr.Code, closeErr.Text))
+		s.endReason = "connection_closed"
+		return
+	}
+	s.fail(err.Error())
+}
+
+func (s *graphqlSubscription) fail(message string) {
+	s.err = message
+	s.endReason = "error"
+	s.send("error", gin.H{"error": message})
+}
+
+// next emits a "next" event with timing relative to the subscribe message and the previous event
+func (s *graphqlSubscription) next(payload json.RawMessage) {
+	now := time.Now()
+	errs, _ := parseGraphQLErrors(payload)
+	s.payloadErrors += len(errs)
+
+	s.send("next", model.GraphQLSubscriptionEvent{
+		Index:    s.events,
+		Payload:  string(payload),
+		Errors:   errs,
+		Size:     len(payload),
+		Elapsed:  now.Sub(s.subscribed).Microseconds(),
+		Interval: now.Sub(s.lastEvent).Microseconds(),
+	})
+	s.events++
+	s.lastEvent = now
+}
+
+// write sends a protocol message and records it as a span event
+func (s *graphqlSubscription) write(messageType, id string, payload any) error {
+	msg := map[string]any{"type": messageType}
+	if id != "" {
+		msg["id"] = id
+	}
+	if payload != nil {
+		msg["payload"] = payload
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(graphqlWSHandshakeTimeout))
+	if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	s.record("sent", messageType, len(data))
+	return nil
+}
+
+// record adds a span event for a protocol message in either direction
+func (s *graphqlSubscription) record(direction, messageType string, size int) {
+	index := s.received
+	if direction == "sent" {
+		index = s.sent
+		s.sent++
+		s.sentBytes += size
+	} else {
+		s.received++
+		s.receivedBytes += size
+	}
+	if len(s.spanEvents) >= maxSubscriptionSpanEvents {
+		s.droppedEvents++
+		return
+	}
+	s.spanEvents = append(s.spanEvents, model.SpanEvent{
+		Name:      "message",
+		Timestamp: time.Now().UnixMicro(),
+		Attributes: map[string]string{
+			"message.type":              direction,
+			"message.id":                fmt.Sprintf("%d", index),
+			"message.uncompressed_size": fmt.Sprintf("%d", size),
+			"graphql.message_type":      messageType,
+		},
+	})
+}
+
+// send writes a single SSE event and flushes it to the client
+func (s *graphqlSubscription) send(event string, payload any) {
+	data, _ := json.Marshal(payload)
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	s.w.Flush()
+}
+
+// graphqlWSErrors reads the payload of an error message: a list of GraphQL errors in
+// graphql-transport-ws, a single error object in subscriptions-transport-ws
+func graphqlWSErrors(payload json.RawMessage) []model.GraphQLError {
+	trimmed := strings.TrimSpace(string(payload))
+	if trimmed == "" || trimmed == "null" {
+		return nil
+	}
+	if !strings.HasPrefix(trimmed, "[") {
+		trimmed = "[" + trimmed + "]"
+	}
+	errs, _ := parseGraphQLErrors([]byte(`{"errors":` + trimmed + `}`))
+	return errs
+}
@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// subscriptionServer speaks graphql-transport-ws and subscriptions-transport-ws. Each started
+// operation is answered by script, which writes server messages for the operation id
+type subscriptionServer struct {
+	script func(conn *websocket.Conn, protocol, id string)
+
+	mu       sync.Mutex
+	headers  http.Header
+	init     map[string]any
+	start    graphqlRequestBody
+	received []string // Message types sent by the client, in order
+}
+
+func (s *subscriptionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws", "graphql-ws"}}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.headers = r.Header.Clone()
+	s.mu.Unlock()
+
+	for {
+		var msg struct {
+			ID      string          `json:"id"`
+			Type    string          `json:"type"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.received = append(s.received, msg.Type)
+		s.mu.Unlock()
+
+		switch msg.Type {
+		case "connection_init":
+			s.mu.Lock()
+			json.Unmarshal(msg.Payload, &s.init)
+			s.mu.Unlock()
+			conn.WriteJSON(map[string]any{"type": "connection_ack"})
+		case "subscribe", "start":
+			s.mu.Lock()
+			json.Unmarshal(msg.Payload, &s.start)
+			s.mu.Unlock()
+			go s.script(conn, conn.Subprotocol(), msg.ID)
+		}
+	}
+}
+
+// receivedTypes returns the client message types seen so far
+func (s *subscriptionServer) receivedTypes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// startSubscriptionServer serves script over WebSocket and returns its http:// URL
+func startSubscriptionServer(t *testing.T, script func(conn *websocket.Conn, protocol, id string)) (*subscriptionServer, string) {
+	t.Helper()
+	server := &subscriptionServer{script: script}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer.URL + "/graphql"
+}
+
+// nextMessageType is the result message type of a negotiated subprotocol
+func nextMessageType(protocol string) string {
+	if protocol == "graphql-ws" {
+		return "data"
+	}
+	return "next"
+}
+
+// doGraphQLSubscribe posts to /graphql/subscribe and returns the status code and raw body
+func doGraphQLSubscribe(t *testing.T, reqBody model.GraphQLRequest) (int, string) {
+	t.Helper()
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest("POST", "/graphql/subscribe", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	setupGraphQLRouter().ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// subscriptionResult splits the SSE output into next events and the final response
+func subscriptionResult(t *testing.T, body string) ([]model.GraphQLSubscriptionEvent, model.GraphQLResponse) {
+	t.Helper()
+
+	var events []model.GraphQLSubscriptionEvent
+	var end *model.GraphQLResponse
+	for _, ev := range parseSSE(body) {
+		switch ev.Event {
+		case "next":
+			var event model.GraphQLSubscriptionEvent
+			if err := json.Unmarshal([]byte(ev.Data), &event); err != nil {
+				t.Fatalf("Failed to parse next event: %v", err)
+			}
+			events = append(events, event)
+		case "end":
+			end = &model.GraphQLResponse{}
+			if err := json.Unmarshal([]byte(ev.Data), end); err != nil {
+				t.Fatalf("Failed to parse end event: %v", err)
+			}
+		}
+	}
+	if end == nil {
+		t.Fatalf("Expected an end event, got: %s", body)
+	}
+	return events, *end
+}
+
+// countdown sends three results and completes the operation
+func countdown(conn *websocket.Conn, protocol, id string) {
+	for i := 3; i > 0; i-- {
+		conn.WriteJSON(map[string]any{"id": id, "type": nextMessageType(protocol), "payload": map[string]any{"data": map[string]any{"countdown": i}}})
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.WriteJSON(map[string]any{"id": id, "type": "complete"})
+}
+
+func TestGraphQLSubscribe_TransportWS(t *testing.T) {
+	server, url := startSubscriptionServer(t, countdown)
+
+	code, body := doGraphQLSubscribe(t, model.GraphQLRequest{
+		URL:              url,
+		Query:            `subscription Countdown($from: Int!) { countdown(from: $from) }`,
+		Variables:        map[string]interface{}{"from": 3},
+		OperationName:    "Countdown",
+		Headers:          map[string]string{"Authorization": "Bearer token"},
+		ConnectionParams: map[string]any{"authToken": "secret"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", code, body)
+	}
+	if !strings.Contains(body, "event: connected\n") {
+		t.Errorf("Expected a connected event, got: %s", body)
+	}
+
+	events, end := subscriptionResult(t, body)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 next events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Index != i {
+			t.Errorf("Expected index %d, got %d", i, event.Index)
+		}
+		if event.Size != len(event.Payload) || event.Elapsed <= 0 {
+			t.Errorf("Expected size and timing on event %d, got %+v", i, event)
+		}
+	}
+	if events[0].Payload != `{"data":{"countdown":3}}` {
+		t.Errorf("Unexpected first payload: %s", events[0].Payload)
+	}
+	if events[2].Elapsed < events[1].Elapsed || events[2].Interval <= 0 {
+		t.Errorf("Expected increasing timings, got %+v", events)
+	}
+
+	if end.EndReason != "complete" || end.Events != 3 || end.Error != "" {
+		t.Errorf("Unexpected end: reason=%s events=%d error=%s", end.EndReason, end.Events, end.Error)
+	}
+	if end.StatusCode != http.StatusSwitchingProtocols || end.Protocol != "graphql-transport-ws" {
+		t.Errorf("Unexpected status %d or protocol %s", end.StatusCode, end.Protocol)
+	}
+
+	// The server saw the operation, connection params and handshake headers
+	if server.start.OperationName != "Countdown" || server.start.Variables["from"] != float64(3) {
+		t.Errorf("Unexpected subscribe payload: %+v", server.start)
+	}
+	if server.init["authToken"] != "secret" {
+		t.Errorf("Expected connection params in connection_init, got %+v", server.init)
+	}
+	if server.headers.Get("Authorization") != "Bearer token" || server.headers.Get("traceparent") == "" {
+		t.Errorf("Expected custom and traceparent headers, got %v", server.headers)
+	}
+
+	if len(end.Spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(end.Spans))
+	}
+	span := end.Spans[0]
+	if span.Status != "OK" || span.Tags["graphql.subscription.events"] != "3" || span.Tags["graphql.subscription.end"] != "complete" {
+		t.Errorf("Unexpected span: %s %+v", span.Status, span.Tags)
+	}
+	// connection_init, subscribe sent; connection_ack, 3 next and complete received
+	var messageTypes []string
+	for _, event := range span.Events {
+		messageTypes = append(messageTypes, event.Attributes["message.type"]+":"+event.Attributes["graphql.message_type"])
+	}
+	expected := "sent:connection_init received:connection_ack sent:subscribe received:next received:next received:next received:complete"
+	if got := strings.Join(messageTypes, " "); got != expected {
+		t.Errorf("Unexpected span events:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestGraphQLSubscribe_LegacyProtocolMaxEvents(t *testing.T) {
+	server, url := startSubscriptionServer(t, func(conn *websocket.Conn, protocol, id string) {
+		conn.WriteJSON(map[string]any{"type": "ka"})
+		for i := 0; i < 10; i++ {
+			if err := conn.WriteJSON(map[string]any{"id": id, "type": nextMessageType(protocol), "payload": map[string]any{"data": map[string]any{"tick": i}}}); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	code, body := doGraphQLSubscribe(t, model.GraphQLRequest{
+		URL:       url,
+		Query:     `subscription { tick }`,
+		Protocol:  "subscriptions-transport-ws",
+		MaxEvents: 2,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", code, body)
+	}
+	events, end := subscriptionResult(t, body)
+	if len(events) != 2 || end.EndReason != "max_events" {
+		t.Fatalf("Expected 2 events ending with max_events, got %d (%s)", len(events), end.EndReason)
+	}
+	if events[1].Payload != `{"data":{"tick":1}}` {
+		t.Errorf("Unexpected payload: %s", events[1].Payload)
+	}
+
+	// The client stops the operation and terminates the connection
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && len(server.receivedTypes()) < 4 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := strings.Join(server.receivedTypes(), " "); got != "connection_init start stop connection_terminate" {
+		t.Errorf("Unexpected client messages: %s", got)
+	}
+}
+
+func TestGraphQLSubscribe_ErrorMessage(t *testing.T) {
+	_, url := startSubscriptionServer(t, func(conn *websocket.Conn, protocol, id string) {
+		conn.WriteJSON(map[string]any{"id": id, "type": "error", "payload": []map[string]any{
+			{"message": "Not authorised to subscribe", "extensions": map[string]any{"code": "FORBIDDEN"}},
+		}})
+	})
+
+	_, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: url, Query: `subscription { secrets }`})
+	if !strings.Contains(body, "event: error\n") {
+		t.Errorf("Expected an error event, got: %s", body)
+	}
+	_, end := subscriptionResult(t, body)
+	if end.EndReason != "error" || end.Error != "Not authorised to subscribe" {
+		t.Errorf("Unexpected end: %s %s", end.EndReason, end.Error)
+	}
+	if len(end.Errors) != 1 || end.Errors[0].Code != "FORBIDDEN" {
+		t.Errorf("Expected the server errors, got %+v", end.Errors)
+	}
+	span := end.Spans[0]
+	if span.Status != "ERROR" || span.Tags["graphql.error"] != "FORBIDDEN: Not authorised to subscribe" {
+		t.Errorf("Unexpected span: %s %+v", span.Status, span.Tags)
+	}
+}
+
+func TestGraphQLSubscribe_PingAndTimeout(t *testing.T) {
+	server, url := startSubscriptionServer(t, func(conn *websocket.Conn, protocol, id string) {
+		conn.WriteJSON(map[string]any{"type": "ping"})
+		conn.WriteJSON(map[string]any{"id": id, "type": "next", "payload": map[string]any{"data": map[string]any{"tick": 0}}})
+	})
+
+	_, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: url, Query: `subscription { tick }`, TimeoutMs: 200})
+	events, end := subscriptionResult(t, body)
+	if len(events) != 1 || end.EndReason != "timeout" || end.Error != "" {
+		t.Fatalf("Expected one event ending with a timeout, got %d (%s %s)", len(events), end.EndReason, end.Error)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && len(server.receivedTypes()) < 4 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := strings.Join(server.receivedTypes(), " "); got != "connection_init subscribe pong complete" {
+		t.Errorf("Unexpected client messages: %s", got)
+	}
+}
+
+func TestGraphQLSubscribe_CloseCode(t *testing.T) {
+	_, url := startSubscriptionServer(t, func(conn *websocket.Conn, protocol, id string) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4403, "Forbidden"))
+	})
+
+	_, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: url, Query: `subscription { tick }`})
+	_, end := subscriptionResult(t, body)
+	if end.EndReason != "connection_closed" || end.Error != "Connection closed with code 4403: Forbidden" {
+		t.Errorf("Unexpected end: %s %s", end.EndReason, end.Error)
+	}
+	if end.Spans[0].Status != "ERROR" {
+		t.Errorf("Expected an ERROR span, got %s", end.Spans[0].Status)
+	}
+}
+
+func TestGraphQLSubscribe_SpanEventLimit(t *testing.T) {
+	_, url := startSubscriptionServer(t, func(conn *websocket.Conn, protocol, id string) {
+		for i := 0; i < maxSubscriptionSpanEvents; i++ {
+			conn.WriteJSON(map[string]any{"id": id, "type": nextMessageType(protocol), "payload": map[string]any{"data": map[string]any{"tick": i}}})
+		}
+		conn.WriteJSON(map[string]any{"id": id, "type": "complete"})
+	})
+
+	_, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: url, Query: `subscription { tick }`})
+	events, end := subscriptionResult(t, body)
+	if len(events) != maxSubscriptionSpanEvents || end.EndReason != "complete" {
+		t.Fatalf("Expected %d events ending with complete, got %d (%s)", maxSubscriptionSpanEvents, len(events), end.EndReason)
+	}
+	span := end.Spans[0]
+	if len(span.Events) != maxSubscriptionSpanEvents || span.Tags["graphql.subscription.dropped_events"] == "" {
+		t.Errorf("Expected %d span events and a dropped count, got %d %v", maxSubscriptionSpanEvents, len(span.Events), span.Tags)
+	}
+}
+
+func TestGraphQLSubscribe_SubprotocolMismatch(t *testing.T) {
+	// Answers every handshake with the legacy subprotocol
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, http.Header{"Sec-Websocket-Protocol": {"graphql-ws"}})
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer target.Close()
+
+	code, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: target.URL, Query: `subscription { tick }`})
+	var resp model.GraphQLResponse
+	json.Unmarshal([]byte(body), &resp)
+	if code != http.StatusBadGateway || resp.StatusCode != http.StatusBadGateway || !strings.Contains(resp.Error, "negotiated subprotocol 'graphql-ws'") {
+		t.Errorf("Expected 502 for another subprotocol, got %d: %s", code, body)
+	}
+}
+
+func TestGraphQLSubscribe_HandshakeRefused(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer target.Close()
+
+	code, body := doGraphQLSubscribe(t, model.GraphQLRequest{URL: target.URL, Query: `subscription { tick }`})
+	var resp model.GraphQLResponse
+	json.Unmarshal([]byte(body), &resp)
+	if code != http.StatusBadGateway || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 502 carrying the upstream 403, got %d: %s", code, body)
+	}
+}
+
+func TestGraphQLSubscribe_RejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		reqBody model.GraphQLRequest
+		code    int
+	}{
+		{"unknown protocol", model.GraphQLRequest{URL: "ws://localhost/graphql", Query: `subscription { tick }`, Protocol: "sse"}, http.StatusBadRequest},
+		{"unsupported scheme", model.GraphQLRequest{URL: "ftp://localhost/graphql", Query: `subscription { tick }`}, http.StatusBadRequest},
+		{"connection refused", model.GraphQLRequest{URL: "ws://127.0.0.1:1/graphql", Query: `subscription { tick }`}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := doGraphQLSubscribe(t, tt.reqBody)
+			if code != tt.code {
+				t.Fatalf("Expected %d, got %d: %s", tt.code, code, body)
+			}
+			var resp model.GraphQLResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil || resp.Error == "" {
+				t.Errorf("Expected a JSON error, got: %s", body)
+			}
+		})
+	}
+}
+
+func TestGraphQLWebSocketURL(t *testing.T) {
+	for input, expected := range map[string]string{
+		"http://localhost:4000/graphql": "ws://localhost:4000/graphql",
+		"https://api.example.com/gql":   "wss://api.example.com/gql",
+		"wss://api.example.com/gql":     "wss://api.example.com/gql",
+	} {
+		if got, err := graphqlWebSocketURL(input); err != nil || got != expected {
+			t.Errorf("graphqlWebSocketURL(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+}
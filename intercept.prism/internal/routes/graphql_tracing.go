@@ -0,0 +1,431 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxResolverSpans bounds the child spans created from one trace, since every list item
+// has its own resolvers
+const maxResolverSpans = 500
+
+// graphqlTrace is a server-side execution trace in either supported format, with offsets
+// relative to the start of the trace
+type graphqlTrace struct {
+	format    string // "apollo-tracing" or "ftv1"
+	duration  time.Duration
+	phases    []graphqlTracePhase
+	resolvers []graphqlResolverTiming
+}
+
+type graphqlTracePhase struct {
+	name     string
+	start    time.Duration
+	duration time.Duration
+}
+
+type graphqlResolverTiming struct {
+	path       []any
+	parentType string
+	fieldName  string
+	returnType string
+	start      time.Duration
+	duration   time.Duration
+	errors     []string
+}
+
+// apolloTracing is the extensions.tracing object of the Apollo tracing format. Offsets and
+// durations are in nanoseconds
+type apolloTracing struct {
+	Version    int               `json:"version"`
+	Duration   int64             `json:"duration"`
+	Parsing    *apolloTracePhase `json:"parsing"`
+	Validation *apolloTracePhase `json:"validation"`
+	Execution  *struct {
+		Resolvers []struct {
+			Path        []any  `json:"path"`
+			ParentType  string `json:"parentType"`
+			FieldName   string `json:"fieldName"`
+			ReturnType  string `json:"returnType"`
+			StartOffset int64  `json:"startOffset"`
+			Duration    int64  `json:"duration"`
+		} `json:"resolvers"`
+	} `json:"execution"`
+}
+
+type apolloTracePhase struct {
+	StartOffset int64 `json:"startOffset"`
+	Duration    int64 `json:"duration"`
+}
+
+// parseGraphQLTrace reads extensions.tracing or extensions.ftv1 from a response body.
+// It returns nil when the body carries neither
+func parseGraphQLTrace(body []byte) (*graphqlTrace, error) {
+	var result struct {
+		Extensions struct {
+			Tracing *apolloTracing `json:"tracing"`
+			FTV1    string         `json:"ftv1"`
+		} `json:"extensions"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case result.Extensions.Tracing != nil:
+		return apolloTrace(result.Extensions.Tracing), nil
+	case result.Extensions.FTV1 != "":
+		data, err := base64.StdEncoding.DecodeString(result.Extensions.FTV1)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ftv1 encoding: %v", err)
+		}
+		return decodeFTV1(data)
+	}
+	return nil, nil
+}
+
+func apolloTrace(t *apolloTracing) *graphqlTrace {
+	trace := &graphqlTrace{format: "apollo-tracing", duration: time.Duration(t.Duration)}
+	if t.Parsing != nil {
+		trace.phases = append(trace.phases, graphqlTracePhase{"parse", time.Duration(t.Parsing.StartOffset), time.Duration(t.Parsing.Duration)})
+	}
+	if t.Validation != nil {
+		trace.phases = append(trace.phases, graphqlTracePhase{"validate", time.Duration(t.Validation.StartOffset), time.Duration(t.Validation.Duration)})
+	}
+	if t.Execution != nil {
+		for _, r := range t.Execution.Resolvers {
+			trace.resolvers = append(trace.resolvers, graphqlResolverTiming{
+				path:       r.Path,
+				parentType: r.ParentType,
+				fieldName:  r.FieldName,
+				returnType: r.ReturnType,
+				start:      time.Duration(r.StartOffset),
+				duration:   time.Duration(r.Duration),
+			})
+		}
+	}
+	return trace
+}
+
+// Field numbers of the Trace message in Apollo's reports.proto that the spans need
+const (
+	ftv1TraceEndTime    protowire.Number = 3
+	ftv1TraceStartTime  protowire.Number = 4
+	ftv1TraceDurationNs protowire.Number = 11
+	ftv1TraceRoot       protowire.Number = 14
+
+	ftv1NodeResponseName      protowire.Number = 1
+	ftv1NodeIndex             protowire.Number = 2
+	ftv1NodeType              protowire.Number = 3
+	ftv1NodeStartTime         protowire.Number = 8
+	ftv1NodeEndTime           protowire.Number = 9
+	ftv1NodeError             protowire.Number = 11
+	ftv1NodeChild             protowire.Number = 12
+	ftv1NodeParentType        protowire.Number = 13
+	ftv1NodeOriginalFieldName protowire.Number = 14
+
+	ftv1ErrorMessage protowire.Number = 1
+)
+
+// decodeFTV1 reads a federated trace, the protobuf Trace message sent base64-encoded in
+// extensions.ftv1 by Apollo subgraphs
+func decodeFTV1(data []byte) (*graphqlTrace, error) {
+	trace := &graphqlTrace{format: "ftv1"}
+	var start, end time.Time
+	var root []byte
+
+	err := rangeProtoFields(data, func(num protowire.Number, varint uint64, bytes []byte) error {
+		var err error
+		switch num {
+		case ftv1TraceStartTime:
+			start, err = decodeProtoTimestamp(bytes)
+		case ftv1TraceEndTime:
+			end, err = decodeProtoTimestamp(bytes)
+		case ftv1TraceDurationNs:
+			trace.duration = time.Duration(varint)
+		case ftv1TraceRoot:
+			root = bytes
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ftv1 trace: %v", err)
+	}
+	if trace.duration == 0 && !start.IsZero() && end.After(start) {
+		trace.duration = end.Sub(start)
+	}
+	if root != nil {
+		if err := trace.addFTV1Node(root, nil); err != nil {
+			return nil, fmt.Errorf("Invalid ftv1 trace: %v", err)
+		}
+	}
+	return trace, nil
+}
+
+// addFTV1Node records a field node and its children. Nodes are either fields, identified by
+// response name, or list items, identified by index; only fields are resolvers
+func (t *graphqlTrace) addFTV1Node(data []byte, path []any) error {
+	var resolver graphqlResolverTiming
+	var responseName string
+	var index *uint64
+	var startNs, endNs uint64
+	var children [][]byte
+
+	err := rangeProtoFields(data, func(num protowire.Number, varint uint64, bytes []byte) error {
+		switch num {
+		case ftv1NodeResponseName:
+			responseName = string(bytes)
+		case ftv1NodeIndex:
+			i := varint
+			index = &i
+		case ftv1NodeType:
+			resolver.returnType = string(bytes)
+		case ftv1NodeParentType:
+			resolver.parentType = string(bytes)
+		case ftv1NodeOriginalFieldName:
+			resolver.fieldName = string(bytes)
+		case ftv1NodeStartTime:
+			startNs = varint
+		case ftv1NodeEndTime:
+			endNs = varint
+		case ftv1NodeError:
+			return rangeProtoFields(bytes, func(num protowire.Number, _ uint64, message []byte) error {
+				if num == ftv1ErrorMessage {
+					resolver.errors = append(resolver.errors, string(message))
+				}
+				return nil
+			})
+		case ftv1NodeChild:
+			children = append(children, bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	nodePath := path
+	switch {
+	case responseName != "":
+		nodePath = append(append([]any(nil), path...), responseName)
+		if resolver.fieldName == "" {
+			resolver.fieldName = responseName
+		}
+		resolver.path = nodePath
+		resolver.start = time.Duration(startNs)
+		if endNs > startNs {
+			resolver.duration = time.Duration(endNs - startNs)
+		}
+		t.resolvers = append(t.resolvers, resolver)
+	case index != nil:
+		nodePath = append(append([]any(nil), path...), float64(*index))
+	}
+
+	for _, child := range children {
+		if err := t.addFTV1Node(child, nodePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeProtoFields calls fn for every varint and length-delimited field of a message and
+// skips the rest
+func rangeProtoFields(data []byte, fn func(num protowire.Number, varint uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+			data = data[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, 0, v); err != nil {
+				return err
+			}
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+// decodeProtoTimestamp reads a google.protobuf.Timestamp
+func decodeProtoTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos uint64
+	err := rangeProtoFields(data, func(num protowire.Number, varint uint64, _ []byte) error {
+		switch num {
+		case 1:
+			seconds = varint
+		case 2:
+			nanos = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if seconds == 0 && nanos == 0 {
+		return time.Time{}, errors.New("empty timestamp")
+	}
+	return time.Unix(int64(seconds), int64(nanos)), nil
+}
+
+// graphqlTraceSpans turns a server trace into child spans of the proxy span: one span for the
+// server-side execution, with phase and resolver spans beneath it. Resolver spans are nested
+// under the resolver of their parent field.
+//
+// The server's clock is not trusted, so the trace is centred within the proxy span on the
+// assumption that the request and response spent equal time on the network
+func graphqlTraceSpans(trace *graphqlTrace, parent model.SpanInfo, serviceName string, errs []model.GraphQLError) []model.SpanInfo {
+	traceDuration := trace.duration
+	for _, r := range trace.resolvers {
+		if end := r.start + r.duration; end > traceDuration {
+			traceDuration = end
+		}
+	}
+	anchor := parent.StartTime
+	if slack := parent.Duration - traceDuration.Microseconds(); slack > 0 {
+		anchor += slack / 2
+	}
+
+	// Errors in the response body belong to the resolver with the same path
+	errorsByPath := make(map[string][]string)
+	for _, e := range errs {
+		if e.Path != "" {
+			errorsByPath[e.Path] = append(errorsByPath[e.Path], e.Message)
+		}
+	}
+
+	server := model.SpanInfo{
+		SpanID:       tracing.GenerateSpanID(),
+		ParentSpanID: parent.SpanID,
+		TraceID:      parent.TraceID,
+		Operation:    "GraphQL execute",
+		ServiceName:  serviceName,
+		StartTime:    anchor,
+		Duration:     traceDuration.Microseconds(),
+		Status:       "OK",
+		Tags: map[string]string{
+			"graphql.trace.format":    trace.format,
+			"graphql.trace.resolvers": fmt.Sprintf("%d", len(trace.resolvers)),
+		},
+	}
+	if len(errs) > 0 {
+		server.Status = "ERROR"
+	}
+	spans := []model.SpanInfo{server}
+
+	for _, phase := range trace.phases {
+		spans = append(spans, model.SpanInfo{
+			SpanID:       tracing.GenerateSpanID(),
+			ParentSpanID: server.SpanID,
+			TraceID:      parent.TraceID,
+			Operation:    "GraphQL " + phase.name,
+			ServiceName:  serviceName,
+			StartTime:    anchor + phase.start.Microseconds(),
+			Duration:     phase.duration.Microseconds(),
+			Status:       "OK",
+		})
+	}
+
+	// Parents start no later than their children, so sorting by start lets every resolver
+	// find its parent's span already created
+	resolvers := append([]graphqlResolverTiming(nil), trace.resolvers...)
+	sort.SliceStable(resolvers, func(i, j int) bool {
+		if resolvers[i].start != resolvers[j].start {
+			return resolvers[i].start < resolvers[j].start
+		}
+		return len(resolvers[i].path) < len(resolvers[j].path)
+	})
+	if len(resolvers) > maxResolverSpans {
+		server.Tags["graphql.trace.dropped_spans"] = fmt.Sprintf("%d", len(resolvers)-maxResolverSpans)
+		resolvers = resolvers[:maxResolverSpans]
+	}
+
+	spanByPath := make(map[string]string, len(resolvers))
+	for _, r := range resolvers {
+		path := graphqlErrorPath(r.path)
+		parentSpanID, ok := spanByPath[graphqlErrorPath(parentFieldPath(r.path))]
+		if !ok {
+			parentSpanID = server.SpanID
+		}
+
+		span := model.SpanInfo{
+			SpanID:       tracing.GenerateSpanID(),
+			ParentSpanID: parentSpanID,
+			TraceID:      parent.TraceID,
+			Operation:    fmt.Sprintf("resolve %s.%s", r.parentType, r.fieldName),
+			ServiceName:  serviceName,
+			StartTime:    anchor + r.start.Microseconds(),
+			Duration:     r.duration.Microseconds(),
+			Status:       "OK",
+			Tags: map[string]string{
+				"graphql.field.path":        path,
+				"graphql.field.parent_type": r.parentType,
+				"graphql.field.name":        r.fieldName,
+				"graphql.field.return_type": r.returnType,
+			},
+		}
+		if messages := append(append([]string(nil), r.errors...), errorsByPath[path]...); len(messages) > 0 {
+			span.Status = "ERROR"
+			span.Tags["error.message"] = strings.Join(messages, "; ")
+		}
+		spanByPath[path] = span.SpanID
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// parentFieldPath is the path of the field that resolved the parent object, e.g.
+// books.0.author has the parent field books
+func parentFieldPath(path []any) []any {
+	if len(path) == 0 {
+		return nil
+	}
+	parent := path[:len(path)-1]
+	for len(parent) > 0 {
+		if _, isIndex := parent[len(parent)-1].(float64); !isIndex {
+			break
+		}
+		parent = parent[:len(parent)-1]
+	}
+	return parent
+}
+
+// graphqlServiceName names the target in resolver spans after its host
+func graphqlServiceName(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "graphql"
+}
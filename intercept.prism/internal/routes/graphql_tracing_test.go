@@ -0,0 +1,276 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// spansByOperation indexes spans by operation, failing on duplicates
+func spansByOperation(t *testing.T, spans []model.SpanInfo) map[string]model.SpanInfo {
+	t.Helper()
+	byOperation := make(map[string]model.SpanInfo, len(spans))
+	for _, span := range spans {
+		key := span.Operation
+		if path := span.Tags["graphql.field.path"]; path != "" {
+			key += " " + path
+		}
+		if _, ok := byOperation[key]; ok {
+			t.Fatalf("Duplicate span %s", key)
+		}
+		byOperation[key] = span
+	}
+	return byOperation
+}
+
+func TestGraphQLTracing_ApolloTracing(t *testing.T) {
+	ms := int64(time.Millisecond)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"books": []any{
+				map[string]any{"title": "Dune", "author": map[string]any{"name": "Frank Herbert"}},
+				map[string]any{"title": "Emma", "author": nil},
+			}},
+			"errors": []any{map[string]any{"message": "Author not found", "path": []any{"books", 1, "author"}}},
+			"extensions": map[string]any{"tracing": map[string]any{
+				"version":    1,
+				"startTime":  "2026-10-19T10:00:00.000Z",
+				"endTime":    "2026-10-19T10:00:00.005Z",
+				"duration":   5 * ms,
+				"parsing":    map[string]any{"startOffset": ms / 10, "duration": ms / 2},
+				"validation": map[string]any{"startOffset": ms, "duration": ms / 2},
+				"execution": map[string]any{"resolvers": []any{
+					map[string]any{"path": []any{"books"}, "parentType": "Query", "fieldName": "books", "returnType": "[Book!]!", "startOffset": 2 * ms, "duration": ms},
+					map[string]any{"path": []any{"books", 0, "author"}, "parentType": "Book", "fieldName": "author", "returnType": "Author", "startOffset": 3 * ms, "duration": ms},
+					map[string]any{"path": []any{"books", 1, "author"}, "parentType": "Book", "fieldName": "author", "returnType": "Author", "startOffset": 3 * ms, "duration": ms},
+					map[string]any{"path": []any{"books", 0, "author", "name"}, "parentType": "Author", "fieldName": "name", "returnType": "String!", "startOffset": 4 * ms, "duration": ms / 10},
+				}},
+			}},
+		})
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books { title author { name } } }`})
+
+	// Request span, execute span, two phases and four resolvers
+	if len(resp.Spans) != 8 {
+		t.Fatalf("Expected 8 spans, got %d: %+v", len(resp.Spans), resp.Spans)
+	}
+	root := resp.Spans[0]
+	if root.Tags["graphql.trace.format"] != "apollo-tracing" {
+		t.Errorf("Expected the trace format on the request span, got %+v", root.Tags)
+	}
+
+	spans := spansByOperation(t, resp.Spans)
+	execute := spans["GraphQL execute"]
+	books := spans["resolve Query.books books"]
+	author := spans["resolve Book.author books.0.author"]
+	missingAuthor := spans["resolve Book.author books.1.author"]
+	name := spans["resolve Author.name books.0.author.name"]
+
+	if execute.ParentSpanID != root.SpanID || execute.Duration != 5000 {
+		t.Errorf("Unexpected execute span: %+v", execute)
+	}
+	if execute.StartTime < root.StartTime {
+		t.Errorf("Expected the execute span to start within the request span")
+	}
+	for _, phase := range []string{"GraphQL parse", "GraphQL validate"} {
+		if spans[phase].ParentSpanID != execute.SpanID {
+			t.Errorf("Expected %s under the execute span", phase)
+		}
+	}
+
+	// Resolvers nest under the resolver of their parent field
+	if books.ParentSpanID != execute.SpanID || author.ParentSpanID != books.SpanID ||
+		missingAuthor.ParentSpanID != books.SpanID || name.ParentSpanID != author.SpanID {
+		t.Errorf("Unexpected resolver nesting: books<-%s author<-%s name<-%s", books.ParentSpanID, author.ParentSpanID, name.ParentSpanID)
+	}
+	if name.StartTime-execute.StartTime != 4000 || name.Duration != 100 {
+		t.Errorf("Expected resolver timing relative to the trace, got offset %d duration %d", name.StartTime-execute.StartTime, name.Duration)
+	}
+	if author.Tags["graphql.field.return_type"] != "Author" || author.ServiceName != mockServer.Listener.Addr().String() {
+		t.Errorf("Unexpected resolver span: %+v", author)
+	}
+
+	// The error path marks its resolver as failed
+	if missingAuthor.Status != "ERROR" || missingAuthor.Tags["error.message"] != "Author not found" || author.Status != "OK" {
+		t.Errorf("Expected only books.1.author to fail, got %s/%s", author.Status, missingAuthor.Status)
+	}
+	for _, span := range resp.Spans {
+		if span.TraceID != resp.TraceID {
+			t.Errorf("Expected all spans in trace %s, got %s", resp.TraceID, span.TraceID)
+		}
+	}
+}
+
+// ftv1Node encodes a Trace.Node with a response name or list index and its children
+func ftv1Node(responseName string, index int, parentType, returnType string, start, end uint64, errorMessage string, children ...[]byte) []byte {
+	var b []byte
+	if responseName != "" {
+		b = protowire.AppendTag(b, ftv1NodeResponseName, protowire.BytesType)
+		b = protowire.AppendString(b, responseName)
+		b = protowire.AppendTag(b, ftv1NodeParentType, protowire.BytesType)
+		b = protowire.AppendString(b, parentType)
+		b = protowire.AppendTag(b, ftv1NodeType, protowire.BytesType)
+		b = protowire.AppendString(b, returnType)
+		b = protowire.AppendTag(b, ftv1NodeStartTime, protowire.VarintType)
+		b = protowire.AppendVarint(b, start)
+		b = protowire.AppendTag(b, ftv1NodeEndTime, protowire.VarintType)
+		b = protowire.AppendVarint(b, end)
+	} else if index >= 0 {
+		b = protowire.AppendTag(b, ftv1NodeIndex, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(index))
+	}
+	if errorMessage != "" {
+		var e []byte
+		e = protowire.AppendTag(e, ftv1ErrorMessage, protowire.BytesType)
+		e = protowire.AppendString(e, errorMessage)
+		b = protowire.AppendTag(b, ftv1NodeError, protowire.BytesType)
+		b = protowire.AppendBytes(b, e)
+	}
+	for _, child := range children {
+		b = protowire.AppendTag(b, ftv1NodeChild, protowire.BytesType)
+		b = protowire.AppendBytes(b, child)
+	}
+	return b
+}
+
+func TestGraphQLTracing_FederatedTrace(t *testing.T) {
+	timestamp := func(t time.Time) []byte {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(t.Unix()))
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(t.Nanosecond()))
+	}
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	root := ftv1Node("", -1, "", "", 0, 0, "",
+		ftv1Node("reviews", 0, "Query", "[Review]", 1000000, 1500000, "",
+			ftv1Node("", 0, "", "", 0, 0, "",
+				ftv1Node("body", 0, "Review", "String", 1600000, 1700000, ""),
+			),
+			ftv1Node("", 1, "", "", 0, 0, "",
+				ftv1Node("body", 0, "Review", "String", 1600000, 1800000, "Review was removed"),
+			),
+		),
+	)
+	var trace []byte
+	trace = protowire.AppendTag(trace, ftv1TraceStartTime, protowire.BytesType)
+	trace = protowire.AppendBytes(trace, timestamp(start))
+	trace = protowire.AppendTag(trace, ftv1TraceEndTime, protowire.BytesType)
+	trace = protowire.AppendBytes(trace, timestamp(start.Add(2*time.Millisecond)))
+	trace = protowire.AppendTag(trace, ftv1TraceRoot, protowire.BytesType)
+	trace = protowire.AppendBytes(trace, root)
+
+	var includeTrace string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		includeTrace = r.Header.Get("apollo-federation-include-trace")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": {"reviews": [{"body": "Great"}, {"body": null}]}, "extensions": {"ftv1": %q}}`, base64.StdEncoding.EncodeToString(trace))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ reviews { body } }`, IncludeTrace: true})
+	if includeTrace != "ftv1" {
+		t.Errorf("Expected apollo-federation-include-trace: ftv1, got %q", includeTrace)
+	}
+
+	// Request span, execute span and three resolvers
+	if len(resp.Spans) != 5 {
+		t.Fatalf("Expected 5 spans, got %d: %+v", len(resp.Spans), resp.Spans)
+	}
+	spans := spansByOperation(t, resp.Spans)
+	execute := spans["GraphQL execute"]
+	reviews := spans["resolve Query.reviews reviews"]
+	first := spans["resolve Review.body reviews.0.body"]
+	second := spans["resolve Review.body reviews.1.body"]
+
+	if execute.Duration != 2000 || execute.Tags["graphql.trace.format"] != "ftv1" {
+		t.Errorf("Expected the duration from the trace timestamps, got %+v", execute)
+	}
+	if reviews.ParentSpanID != execute.SpanID || first.ParentSpanID != reviews.SpanID || second.ParentSpanID != reviews.SpanID {
+		t.Error("Expected list item fields under their list field")
+	}
+	if reviews.StartTime-execute.StartTime != 1000 || reviews.Duration != 500 || second.Duration != 200 {
+		t.Errorf("Unexpected timings: reviews +%d/%d, second %d", reviews.StartTime-execute.StartTime, reviews.Duration, second.Duration)
+	}
+	if second.Status != "ERROR" || second.Tags["error.message"] != "Review was removed" || first.Status != "OK" {
+		t.Errorf("Expected node errors on the failing resolver, got %s/%s", first.Status, second.Status)
+	}
+}
+
+func TestGraphQLTracing_InvalidAndMissingTraces(t *testing.T) {
+	for name, test := range map[string]struct {
+		body       string
+		spans      int
+		traceError bool
+	}{
+		"no extensions": {`{"data": {"books": []}}`, 1, false},
+		"bad base64":    {`{"data": {}, "extensions": {"ftv1": "%%%"}}`, 1, true},
+		"bad protobuf":  {`{"data": {}, "extensions": {"ftv1": "/////w=="}}`, 1, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(test.body))
+			}))
+			defer mockServer.Close()
+
+			code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books { title } }`})
+			if code != http.StatusOK || len(resp.Spans) != test.spans {
+				t.Fatalf("Expected %d span(s), got %d (HTTP %d)", test.spans, len(resp.Spans), code)
+			}
+			if _, ok := resp.Spans[0].Tags["graphql.trace.error"]; ok != test.traceError {
+				t.Errorf("Expected graphql.trace.error present=%v, got %+v", test.traceError, resp.Spans[0].Tags)
+			}
+		})
+	}
+}
+
+func TestGraphQLTraceSpans_Bounded(t *testing.T) {
+	trace := &graphqlTrace{format: "apollo-tracing", duration: time.Millisecond}
+	for i := 0; i < maxResolverSpans+100; i++ {
+		trace.resolvers = append(trace.resolvers, graphqlResolverTiming{
+			path:       []any{"books", float64(i), "title"},
+			parentType: "Book",
+			fieldName:  "title",
+		})
+	}
+	parent := model.SpanInfo{SpanID: "root", TraceID: "trace", StartTime: 1000, Duration: 2000}
+	spans := graphqlTraceSpans(trace, parent, "graphql", nil)
+
+	if len(spans) != maxResolverSpans+1 {
+		t.Errorf("Expected %d spans, got %d", maxResolverSpans+1, len(spans))
+	}
+	if spans[0].Tags["graphql.trace.dropped_spans"] != "100" {
+		t.Errorf("Expected dropped spans to be counted, got %+v", spans[0].Tags)
+	}
+	// A 1ms trace inside a 2ms request starts half the slack in
+	if spans[0].StartTime != 1500 {
+		t.Errorf("Expected the trace centred in the request span, got start %d", spans[0].StartTime)
+	}
+}
+
+func TestParentFieldPath(t *testing.T) {
+	for _, tt := range []struct {
+		path     []any
+		expected string
+	}{
+		{[]any{"books"}, ""},
+		{[]any{"books", float64(0), "author"}, "books"},
+		{[]any{"matrix", float64(0), float64(1), "value"}, "matrix"},
+		{[]any{"book", "author", "name"}, "book.author"},
+	} {
+		if got := graphqlErrorPath(parentFieldPath(tt.path)); got != tt.expected {
+			t.Errorf("parentFieldPath(%v) = %q, expected %q", tt.path, got, tt.expected)
+		}
+	}
+}
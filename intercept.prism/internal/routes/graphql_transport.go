@@ -0,0 +1,363 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// graphqlTransport sends an operation, or a batch of them, the way the request asks for
+type graphqlTransport struct {
+	url        string
+	headers    map[string]string
+	method     string
+	operations []graphqlRequestBody
+	batch      bool
+	persisted  bool
+	uploads    []graphqlUpload
+	auth       *model.AuthConfig
+}
+
+type graphqlUpload struct {
+	path        string
+	filename    string
+	contentType string
+	content     []byte
+}
+
+// graphqlExchange is the outcome of sending a request, possibly over several attempts
+type graphqlExchange struct {
+	response       *http.Response // Body already read into body
+	body           []byte
+	requestSize    int
+	persistedQuery string
+	attempts       []model.SpanEvent
+}
+
+// newGraphQLTransport checks that the requested transport options can be combined
+func newGraphQLTransport(reqBody model.GraphQLRequest) (*graphqlTransport, error) {
+	t := &graphqlTransport{
+		url:       reqBody.URL,
+		headers:   reqBody.Headers,
+		method:    strings.ToUpper(reqBody.Method),
+		persisted: reqBody.PersistedQuery,
+		auth:      reqBody.Auth,
+	}
+	if t.method == "" {
+		t.method = http.MethodPost
+	}
+	if t.method != http.MethodPost && t.method != http.MethodGet {
+		return nil, fmt.Errorf("Unsupported method '%s', expected GET or POST", reqBody.Method)
+	}
+
+	if len(reqBody.Batch) > 0 {
+		if reqBody.Query != "" {
+			return nil, fmt.Errorf("Set either query or batch, not both")
+		}
+		t.batch = true
+		for _, op := range reqBody.Batch {
+			t.operations = append(t.operations, graphqlRequestBody{Query: op.Query, Variables: op.Variables, OperationName: op.OperationName})
+		}
+	} else {
+		t.operations = []graphqlRequestBody{{Query: reqBody.Query, Variables: reqBody.Variables, OperationName: reqBody.OperationName}}
+	}
+
+	for i, u := range reqBody.Uploads {
+		content, err := base64.StdEncoding.DecodeString(u.Content)
+		if err != nil {
+			return nil, fmt.Errorf("Upload %d content is not valid base64: %v", i, err)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("Upload %d has no path", i)
+		}
+		contentType := u.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		t.uploads = append(t.uploads, graphqlUpload{path: u.Path, filename: u.Filename, contentType: contentType, content: content})
+	}
+
+	switch {
+	case t.method == http.MethodGet && t.batch:
+		return nil, fmt.Errorf("Batched operations cannot be sent with GET")
+	case t.method == http.MethodGet && len(t.uploads) > 0:
+		return nil, fmt.Errorf("Uploads cannot be sent with GET")
+	case t.persisted && (t.batch || len(t.uploads) > 0):
+		return nil, fmt.Errorf("persisted_query cannot be combined with batch or uploads")
+	}
+	return t, nil
+}
+
+// name describes the transport for tags and responses
+func (t *graphqlTransport) name() string {
+	switch {
+	case len(t.uploads) > 0:
+		return "multipart"
+	case t.batch:
+		return "batch"
+	case t.method == http.MethodGet:
+		return "get"
+	}
+	return "post"
+}
+
+// send performs the request. With persisted queries the hash is sent alone first, and the
+// query follows in a second request when the server does not know the hash or does not
+// support persisted queries. prepare adds per-attempt headers such as traceparent
+func (t *graphqlTransport) send(client *http.Client, prepare func(*http.Request)) (*graphqlExchange, error) {
+	exchange := &graphqlExchange{}
+	if !t.persisted {
+		return exchange, t.attempt(client, prepare, exchange, true, false)
+	}
+
+	if err := t.attempt(client, prepare, exchange, false, true); err != nil {
+		return exchange, err
+	}
+	switch persistedQueryError(exchange.body) {
+	case "PERSISTED_QUERY_NOT_FOUND":
+		exchange.persistedQuery = "registered"
+		return exchange, t.attempt(client, prepare, exchange, true, true)
+	case "PERSISTED_QUERY_NOT_SUPPORTED":
+		exchange.persistedQuery = "unsupported"
+		return exchange, t.attempt(client, prepare, exchange, true, false)
+	}
+	exchange.persistedQuery = "hit"
+	return exchange, nil
+}
+
+// attempt sends one HTTP request and records it as a span event. Credentials are added
+// before prepare, so signatures cover the request as built and traceparent stays last
+func (t *graphqlTransport) attempt(client *http.Client, prepare func(*http.Request), exchange *graphqlExchange, withQuery, withHash bool) error {
+	var req *http.Request
+	var size int
+	newRequest := func() (*http.Request, error) {
+		var err error
+		req, size, err = t.request(withQuery, withHash)
+		if err != nil {
+			return nil, err
+		}
+		if err := auth.Apply(req, t.auth); err != nil {
+			return nil, err
+		}
+		prepare(req)
+		return req, nil
+	}
+
+	start := time.Now()
+	resp, err := auth.Send(client, t.auth, newRequest)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read response body")
+	}
+
+	exchange.response = resp
+	exchange.body = body
+	exchange.requestSize += size
+	exchange.attempts = append(exchange.attempts, model.SpanEvent{
+		Name:      "http.request",
+		Timestamp: start.UnixMicro(),
+		Attributes: map[string]string{
+			"http.method":        req.Method,
+			"http.status_code":   fmt.Sprintf("%d", resp.StatusCode),
+			"http.request_size":  fmt.Sprintf("%d", size),
+			"http.response_size": fmt.Sprintf("%d", len(body)),
+			"http.duration_us":   fmt.Sprintf("%d", time.Since(start).Microseconds()),
+			"graphql.query_sent": strconv.FormatBool(withQuery),
+			"graphql.hash_sent":  strconv.FormatBool(withHash),
+		},
+	})
+	return nil
+}
+
+// request builds the HTTP request and reports the size of what it sends
+func (t *graphqlTransport) request(withQuery, withHash bool) (*http.Request, int, error) {
+	operations := make([]graphqlRequestBody, len(t.operations))
+	for i, op := range t.operations {
+		if withHash {
+			hash := sha256.Sum256([]byte(op.Query))
+			op.Extensions = map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(hash[:])}}
+		}
+		if !withQuery {
+			op.Query = ""
+		}
+		operations[i] = op
+	}
+	var payload any = operations[0]
+	if t.batch {
+		payload = operations
+	}
+
+	switch {
+	case t.method == http.MethodGet:
+		return t.getRequest(operations[0])
+	case len(t.uploads) > 0:
+		return t.multipartRequest(payload)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to marshal GraphQL request body")
+	}
+	req, err := newGraphQLHTTPRequest(t.url, t.headers, body)
+	return req, len(body), err
+}
+
+// getRequest encodes the operation in the query string, keeping any parameters already in the URL
+func (t *graphqlTransport) getRequest(op graphqlRequestBody) (*http.Request, int, error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil, 0, err
+	}
+	params := u.Query()
+	if op.Query != "" {
+		params.Set("query", op.Query)
+	}
+	if op.OperationName != "" {
+		params.Set("operationName", op.OperationName)
+	}
+	for name, value := range map[string]any{"variables": op.Variables, "extensions": op.Extensions} {
+		if value == nil || (name == "variables" && len(op.Variables) == 0) || (name == "extensions" && len(op.Extensions) == 0) {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to encode %s: %v", name, err)
+		}
+		params.Set(name, string(encoded))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A GET without a preflight header is a "simple" request that CSRF protection rejects
+	req.Header.Set("Apollo-Require-Preflight", "true")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return req, len(u.RawQuery), nil
+}
+
+// multipartRequest follows the GraphQL multipart request spec: an operations field with
+// null placeholders for the files, a map field from file fields to their paths, then the files
+func (t *graphqlTransport) multipartRequest(payload any) (*http.Request, int, error) {
+	// Round-trip through JSON so paths can be walked without knowing the shape
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to marshal GraphQL request body")
+	}
+	var operations any
+	json.Unmarshal(encoded, &operations)
+
+	fileMap := make(map[string][]string, len(t.uploads))
+	for i, u := range t.uploads {
+		if err := setNullAtPath(operations, strings.Split(u.path, ".")); err != nil {
+			return nil, 0, fmt.Errorf("Upload %d path '%s': %v", i, u.path, err)
+		}
+		fileMap[strconv.Itoa(i)] = []string{u.path}
+	}
+	operationsJSON, _ := json.Marshal(operations)
+	mapJSON, _ := json.Marshal(fileMap)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("operations", string(operationsJSON))
+	writer.WriteField("map", string(mapJSON))
+	for i, u := range t.uploads {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%d"; filename="%s"`, i, strings.ReplaceAll(u.filename, `"`, `\"`)))
+		header.Set("Content-Type", u.contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, 0, err
+		}
+		part.Write(u.content)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Apollo-Require-Preflight", "true")
+	for key, value := range t.headers {
+		// The multipart boundary must survive a JSON Content-Type copied from a regular request
+		if strings.EqualFold(key, "Content-Type") {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+	return req, body.Len(), nil
+}
+
+// setNullAtPath sets the value at a dotted path to null. Objects gain the final key if it is
+// missing; list indexes must exist
+func setNullAtPath(value any, path []string) error {
+	for i, segment := range path {
+		last := i == len(path)-1
+		switch v := value.(type) {
+		case map[string]any:
+			if last {
+				v[segment] = nil
+				return nil
+			}
+			next, ok := v[segment]
+			if !ok || next == nil {
+				if path[i+1] == "" {
+					return fmt.Errorf("empty path segment")
+				}
+				// Intermediate objects such as variables may be absent when there are no other variables
+				next = map[string]any{}
+				v[segment] = next
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return fmt.Errorf("no list index %s", segment)
+			}
+			if last {
+				v[index] = nil
+				return nil
+			}
+			value = v[index]
+		default:
+			return fmt.Errorf("'%s' is not an object or list", strings.Join(path[:i], "."))
+		}
+	}
+	return nil
+}
+
+// persistedQueryError returns the persisted query error code of a response, if any. Servers
+// report it by extensions.code or, in older versions, only by message
+func persistedQueryError(body []byte) string {
+	errs, _ := parseGraphQLErrors(body)
+	for _, e := range errs {
+		switch {
+		case e.Code == "PERSISTED_QUERY_NOT_FOUND" || e.Message == "PersistedQueryNotFound":
+			return "PERSISTED_QUERY_NOT_FOUND"
+		case e.Code == "PERSISTED_QUERY_NOT_SUPPORTED" || e.Message == "PersistedQueryNotSupported":
+			return "PERSISTED_QUERY_NOT_SUPPORTED"
+		}
+	}
+	return ""
+}
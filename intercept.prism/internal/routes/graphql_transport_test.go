@@ -0,0 +1,305 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// persistedQueryServer implements Automatic Persisted Queries over POST and GET
+type persistedQueryServer struct {
+	mu        sync.Mutex
+	supported bool
+	queries   map[string]string
+	requests  []graphqlRequestBody
+}
+
+func (s *persistedQueryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body graphqlRequestBody
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		body.Query = q.Get("query")
+		body.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			json.Unmarshal([]byte(v), &body.Variables)
+		}
+		if e := q.Get("extensions"); e != "" {
+			json.Unmarshal([]byte(e), &body.Extensions)
+		}
+	} else {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, body)
+
+	w.Header().Set("Content-Type", "application/json")
+	persisted, _ := body.Extensions["persistedQuery"].(map[string]any)
+	switch {
+	case persisted != nil && !s.supported:
+		w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotSupported"}]}`))
+		return
+	case persisted != nil:
+		hash, _ := persisted["sha256Hash"].(string)
+		if body.Query != "" {
+			s.queries[hash] = body.Query
+		} else if _, ok := s.queries[hash]; !ok {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+	}
+	w.Write([]byte(`{"data":{"books":[]}}`))
+}
+
+func TestGraphQLTransport_PersistedQuery(t *testing.T) {
+	query := `{ books { id } }`
+	hash := sha256.Sum256([]byte(query))
+	server := &persistedQueryServer{supported: true, queries: map[string]string{}}
+	mockServer := httptest.NewServer(server)
+	defer mockServer.Close()
+
+	// The first request misses and registers the query
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: query, PersistedQuery: true})
+	if code != http.StatusOK || resp.Error != "" {
+		t.Fatalf("Expected success, got %d %s", code, resp.Error)
+	}
+	if resp.PersistedQuery != "registered" || resp.Attempts != 2 {
+		t.Errorf("Expected a registered query after 2 attempts, got %s after %d", resp.PersistedQuery, resp.Attempts)
+	}
+	if len(resp.Errors) != 0 {
+		t.Errorf("Expected the miss not to be reported as an error, got %+v", resp.Errors)
+	}
+	if len(server.requests) != 2 || server.requests[0].Query != "" || server.requests[1].Query != query {
+		t.Fatalf("Expected the hash alone, then the query, got %+v", server.requests)
+	}
+	persisted := server.requests[0].Extensions["persistedQuery"].(map[string]any)
+	if persisted["sha256Hash"] != hex.EncodeToString(hash[:]) || persisted["version"] != float64(1) {
+		t.Errorf("Unexpected persistedQuery extension: %+v", persisted)
+	}
+	span := resp.Spans[0]
+	if span.Status != "OK" || span.Tags["graphql.persisted_query"] != "registered" || len(span.Events) != 2 {
+		t.Errorf("Unexpected span: status %s, tags %+v, %d events", span.Status, span.Tags, len(span.Events))
+	}
+
+	// The second request over GET hits the stored query
+	_, resp = postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: query, PersistedQuery: true, Method: "get"})
+	if resp.PersistedQuery != "hit" || resp.Attempts != 1 || resp.Transport != "get" {
+		t.Errorf("Expected a hit in 1 attempt over GET, got %s after %d over %s", resp.PersistedQuery, resp.Attempts, resp.Transport)
+	}
+	if last := server.requests[len(server.requests)-1]; last.Query != "" {
+		t.Errorf("Expected the hit to send no query, got %q", last.Query)
+	}
+}
+
+func TestGraphQLTransport_PersistedQueryUnsupported(t *testing.T) {
+	server := &persistedQueryServer{queries: map[string]string{}}
+	mockServer := httptest.NewServer(server)
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: mockServer.URL, Query: `{ books { id } }`, PersistedQuery: true})
+	if resp.PersistedQuery != "unsupported" || resp.Attempts != 2 || len(resp.Errors) != 0 {
+		t.Errorf("Expected a fallback to the plain query, got %s after %d with %+v", resp.PersistedQuery, resp.Attempts, resp.Errors)
+	}
+	if fallback := server.requests[1]; fallback.Query == "" || fallback.Extensions != nil {
+		t.Errorf("Expected the fallback to send the query without extensions, got %+v", fallback)
+	}
+}
+
+func TestGraphQLTransport_Get(t *testing.T) {
+	var received *http.Request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"book":null}}`))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:           mockServer.URL + "/graphql?tenant=acme",
+		Query:         `query Book($id: ID!) { book(id: $id) { title } }`,
+		Variables:     map[string]interface{}{"id": "42"},
+		OperationName: "Book",
+		Method:        "GET",
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+	})
+	if resp.Transport != "get" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a GET request, got %s %d %s", resp.Transport, resp.StatusCode, resp.Error)
+	}
+	if received.Method != http.MethodGet {
+		t.Fatalf("Expected GET, got %s", received.Method)
+	}
+	params := received.URL.Query()
+	expected := map[string]string{
+		"tenant":        "acme",
+		"query":         `query Book($id: ID!) { book(id: $id) { title } }`,
+		"variables":     `{"id":"42"}`,
+		"operationName": "Book",
+	}
+	for key, value := range expected {
+		if params.Get(key) != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, params.Get(key))
+		}
+	}
+	if params.Has("extensions") {
+		t.Errorf("Expected no extensions parameter, got %q", params.Get("extensions"))
+	}
+	if received.Header.Get("Apollo-Require-Preflight") != "true" || received.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("Unexpected headers: %+v", received.Header)
+	}
+}
+
+func TestGraphQLTransport_Batch(t *testing.T) {
+	var received []graphqlRequestBody
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+  {"data": {"books": []}},
+  {"data": {"book": null}, "errors": [{"message": "Not found", "path": ["book"], "extensions": {"code": "NOT_FOUND"}}]}
+]`))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL: mockServer.URL,
+		Batch: []model.GraphQLOperation{
+			{Query: `{ books { id } }`},
+			{Query: `query Book($id: ID!) { book(id: $id) { id } }`, Variables: map[string]interface{}{"id": "9"}, OperationName: "Book"},
+		},
+	})
+	if resp.Transport != "batch" {
+		t.Fatalf("Expected a batch, got %s (%s)", resp.Transport, resp.Error)
+	}
+	if len(received) != 2 || received[1].OperationName != "Book" || received[1].Variables["id"] != "9" {
+		t.Fatalf("Expected both operations in one array, got %+v", received)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Operation == nil || *resp.Errors[0].Operation != 1 {
+		t.Fatalf("Expected one error from operation 1, got %+v", resp.Errors)
+	}
+	span := resp.Spans[0]
+	if span.Status != "ERROR" || span.Tags["graphql.error.op1.book"] != "NOT_FOUND: Not found" {
+		t.Errorf("Unexpected span: %s %+v", span.Status, span.Tags)
+	}
+}
+
+func TestGraphQLTransport_Multipart(t *testing.T) {
+	var operations, fileMap, file, contentType, preflight string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		operations = r.FormValue("operations")
+		fileMap = r.FormValue("map")
+		f, header, _ := r.FormFile("0")
+		content, _ := io.ReadAll(f)
+		file = header.Filename + ":" + string(content)
+		contentType = header.Header.Get("Content-Type")
+		preflight = r.Header.Get("Apollo-Require-Preflight")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"uploadCover":true}}`))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:       mockServer.URL,
+		Query:     `mutation ($id: ID!, $file: Upload!) { uploadCover(id: $id, file: $file) }`,
+		Variables: map[string]interface{}{"id": "1"},
+		Headers:   map[string]string{"Content-Type": "application/json"},
+		Uploads: []model.GraphQLUpload{
+			{Path: "variables.file", Filename: "cover.png", ContentType: "image/png", Content: "aGVsbG8="},
+		},
+	})
+	if resp.StatusCode != http.StatusOK || resp.Transport != "multipart" {
+		t.Fatalf("Expected a multipart request, got %d %s %s", resp.StatusCode, resp.Transport, resp.Error)
+	}
+	if operations != `{"query":"mutation ($id: ID!, $file: Upload!) { uploadCover(id: $id, file: $file) }","variables":{"file":null,"id":"1"}}` {
+		t.Errorf("Unexpected operations: %s", operations)
+	}
+	if fileMap != `{"0":["variables.file"]}` {
+		t.Errorf("Unexpected map: %s", fileMap)
+	}
+	if file != "cover.png:hello" || contentType != "image/png" || preflight != "true" {
+		t.Errorf("Unexpected file %q (%s), preflight %q", file, contentType, preflight)
+	}
+}
+
+func TestGraphQLTransport_RejectsInvalidCombinations(t *testing.T) {
+	batch := []model.GraphQLOperation{{Query: `{ a }`}}
+	upload := []model.GraphQLUpload{{Path: "variables.file", Content: "aGk="}}
+
+	tests := []struct {
+		name string
+		req  model.GraphQLRequest
+	}{
+		{"unknown method", model.GraphQLRequest{Query: `{ a }`, Method: "PUT"}},
+		{"query and batch", model.GraphQLRequest{Query: `{ a }`, Batch: batch}},
+		{"batch over GET", model.GraphQLRequest{Batch: batch, Method: "GET"}},
+		{"uploads over GET", model.GraphQLRequest{Query: `{ a }`, Uploads: upload, Method: "GET"}},
+		{"persisted batch", model.GraphQLRequest{Batch: batch, PersistedQuery: true}},
+		{"invalid upload content", model.GraphQLRequest{Query: `{ a }`, Uploads: []model.GraphQLUpload{{Path: "variables.file", Content: "%%%"}}}},
+		{"upload without path", model.GraphQLRequest{Query: `{ a }`, Uploads: []model.GraphQLUpload{{Content: "aGk="}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.URL = "http://127.0.0.1:0"
+			code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", tt.req)
+			if code != http.StatusBadRequest || resp.Error == "" {
+				t.Errorf("Expected 400 with an error, got %d %q", code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestSetNullAtPath(t *testing.T) {
+	var operations any
+	json.Unmarshal([]byte(`[{"variables":{"files":[1,2]}},{}]`), &operations)
+
+	if err := setNullAtPath(operations, []string{"0", "variables", "files", "1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := setNullAtPath(operations, []string{"1", "variables", "file"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	encoded, _ := json.Marshal(operations)
+	if string(encoded) != `[{"variables":{"files":[1,null]}},{"variables":{"file":null}}]` {
+		t.Errorf("Unexpected result: %s", encoded)
+	}
+	if err := setNullAtPath(operations, []string{"0", "variables", "files", "5"}); err == nil {
+		t.Error("Expected an out of range index to fail")
+	}
+}
+
+func TestGraphQLTransport_Auth(t *testing.T) {
+	var received *http.Request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"book":null}}`))
+	}))
+	defer mockServer.Close()
+
+	_, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:   mockServer.URL,
+		Query: `{ book(id: "1") { title } }`,
+		Auth:  &model.AuthConfig{Type: "hmac", Secret: "key"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", resp.StatusCode, resp.Error)
+	}
+	if received.Header.Get("X-Signature") == "" || received.Header.Get("X-Timestamp") == "" {
+		t.Errorf("Expected a signed request, got %+v", received.Header)
+	}
+	if resp.Spans[0].Tags["auth.type"] != "hmac" {
+		t.Errorf("Expected an auth.type tag, got %v", resp.Spans[0].Tags)
+	}
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// astSchema parses the entry's SDL once. A schema that cannot be loaded is logged and
+// returned as nil so requests are sent without validation
+func (e *graphqlSchemaEntry) astSchema() *ast.Schema {
+	e.astOnce.Do(func() {
+		schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: e.sdl})
+		if err != nil {
+			log.Printf("Failed to load introspected schema %s for validation: %v", e.hash, err)
+			return
+		}
+		e.ast = schema
+	})
+	return e.ast
+}
+
+// cachedGraphQLSchema returns the introspected schema of an endpoint, or nil if there is none
+func cachedGraphQLSchema(url string, headers map[string]string, cfg *model.AuthConfig) *ast.Schema {
+	entry, ok := graphqlSchemas.Get(graphqlSchemaKey(url, headers, cfg))
+	if !ok {
+		return nil
+	}
+	return entry.astSchema()
+}
+
+// validateGraphQLRequest checks the query and variables against the cached schema of the
+// endpoint. It reports whether a schema was available and any errors found. Each operation of
+// a batch is checked, with errors tagged by operation index
+func validateGraphQLRequest(reqBody model.GraphQLRequest) (bool, []model.GraphQLValidationError) {
+	schema := cachedGraphQLSchema(reqBody.URL, reqBody.Headers, reqBody.Auth)
+	if schema == nil {
+		return false, nil
+	}
+
+	// Uploaded files are sent as null variables that the server replaces with the file, so
+	// coercing them here would reject non-null Upload arguments
+	checkVariables := len(reqBody.Uploads) == 0
+
+	if len(reqBody.Batch) == 0 {
+		return true, validateGraphQLOperation(schema, reqBody.Query, reqBody.OperationName, reqBody.Variables, checkVariables)
+	}
+	var errs []model.GraphQLValidationError
+	for i, op := range reqBody.Batch {
+		for _, e := range validateGraphQLOperation(schema, op.Query, op.OperationName, op.Variables, checkVariables) {
+			e.Operation = &i
+			errs = append(errs, e)
+		}
+	}
+	return true, errs
+}
+
+func validateGraphQLOperation(schema *ast.Schema, query, operationName string, variables map[string]any, checkVariables bool) []model.GraphQLValidationError {
+	doc, err := parser.ParseQuery(&ast.Source{Name: "query.graphql", Input: query})
+	if err != nil {
+		return graphqlValidationErrors(gqlerror.List{gqlerror.WrapIfUnwrapped(err)})
+	}
+	if errs := validator.ValidateWithRules(schema, doc, nil); len(errs) > 0 {
+		return graphqlValidationErrors(errs)
+	}
+
+	op := selectGraphQLOperation(doc, operationName)
+	if op == nil {
+		message := fmt.Sprintf("Unknown operation named %q.", operationName)
+		if operationName == "" {
+			message = "Must provide operation name if query contains multiple operations."
+		}
+		return []model.GraphQLValidationError{{Message: message}}
+	}
+	if !checkVariables {
+		return nil
+	}
+	if _, err := validator.VariableValues(schema, op, variables); err != nil {
+		return graphqlValidationErrors(gqlerror.List{gqlerror.WrapIfUnwrapped(err)})
+	}
+	return nil
+}
+
+// checkGraphQLRequest validates a request unless it opts out, replying with 400 and returning
+// false when the query is invalid. validated reports whether a schema was available
+func checkGraphQLRequest(c *gin.Context, reqBody model.GraphQLRequest) (validated bool, ok bool) {
+	if reqBody.SkipValidation {
+		return false, true
+	}
+	validated, validationErrors := validateGraphQLRequest(reqBody)
+	if len(validationErrors) > 0 {
+		c.JSON(http.StatusBadRequest, model.GraphQLResponse{
+			StatusCode:       http.StatusBadRequest,
+			Error:            "Query failed validation against the introspected schema",
+			Validated:        true,
+			ValidationErrors: validationErrors,
+			RequestID:        reqBody.RequestID,
+		})
+		return true, false
+	}
+	return validated, true
+}
+
+// selectGraphQLOperation picks the operation a server would run: the named one, or the only one
+func selectGraphQLOperation(doc *ast.QueryDocument, name string) *ast.OperationDefinition {
+	if name != "" {
+		return doc.Operations.ForName(name)
+	}
+	if len(doc.Operations) == 1 {
+		return doc.Operations[0]
+	}
+	return nil
+}
+
+func graphqlValidationErrors(errs gqlerror.List) []model.GraphQLValidationError {
+	result := make([]model.GraphQLValidationError, 0, len(errs))
+	for _, e := range errs {
+		validationErr := model.GraphQLValidationError{
+			Message: e.Message,
+			Rule:    e.Rule,
+			Path:    e.Path.String(),
+		}
+		for _, loc := range e.Locations {
+			validationErr.Locations = append(validationErr.Locations, model.GraphQLLocation{Line: loc.Line, Column: loc.Column})
+		}
+		result = append(result, validationErr)
+	}
+	return result
+}
@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// introspectedLibraryServer starts a target whose schema has already been introspected
+func introspectedLibraryServer(t *testing.T) (*introspectionServer, string) {
+	t.Helper()
+	server := &introspectionServer{schema: testLibrarySchema()}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	if code, resp := postJSON[model.GraphQLIntrospectResponse](t, setupGraphQLRouter(), "/graphql/introspect", model.GraphQLIntrospectRequest{URL: httpServer.URL}); code != http.StatusOK {
+		t.Fatalf("Introspection failed: %d %s", code, resp.Error)
+	}
+	return server, httpServer.URL
+}
+
+func TestGraphQLValidate_RejectsInvalidQueries(t *testing.T) {
+	server, url := introspectedLibraryServer(t)
+
+	tests := []struct {
+		name          string
+		query         string
+		variables     map[string]interface{}
+		operationName string
+		rule          string
+		path          string
+		line, column  int
+	}{
+		{
+			name:   "unknown field",
+			query:  "{\n  book(id: \"1\") {\n    isbn\n  }\n}",
+			rule:   "FieldsOnCorrectType",
+			line:   3,
+			column: 5,
+		},
+		{
+			name:   "wrong argument type",
+			query:  `{ books(first: "ten") { id } }`,
+			rule:   "ValuesOfCorrectType",
+			line:   1,
+			column: 17,
+		},
+		{
+			name:   "missing required argument",
+			query:  `{ search { ... on Book { id } } }`,
+			rule:   "ProvidedRequiredArguments",
+			line:   1,
+			column: 3,
+		},
+		{
+			name:   "unknown fragment",
+			query:  `{ book(id: "1") { ...BookFields } }`,
+			rule:   "KnownFragmentNames",
+			line:   1,
+			column: 22,
+		},
+		{
+			name:   "fragment on wrong type",
+			query:  "query { book(id: \"1\") { ...AuthorFields } }\nfragment AuthorFields on Author { name }",
+			rule:   "PossibleFragmentSpreads",
+			line:   1,
+			column: 28,
+		},
+		{
+			name:   "syntax error",
+			query:  `{ book(id: "1") { id }`,
+			line:   1,
+			column: 23,
+		},
+		{
+			name:  "missing required variable",
+			query: `query GetBook($id: ID!) { book(id: $id) { title } }`,
+			path:  "variable.id",
+		},
+		{
+			name:      "wrong variable type",
+			query:     `query Books($filter: BookFilter) { books(filter: $filter) { title } }`,
+			variables: map[string]interface{}{"filter": map[string]interface{}{"genre": "POETRY"}},
+			path:      "variable.filter.genre",
+		},
+		{
+			name:          "unknown operation",
+			query:         `query A { books { id } } query B { books { title } }`,
+			operationName: "C",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+				URL:           url,
+				Query:         tt.query,
+				Variables:     tt.variables,
+				OperationName: tt.operationName,
+			})
+			if code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d (%+v)", code, resp)
+			}
+			if !resp.Validated || len(resp.ValidationErrors) == 0 {
+				t.Fatalf("Expected validation errors, got %+v", resp)
+			}
+
+			validationErr := resp.ValidationErrors[0]
+			if validationErr.Message == "" {
+				t.Error("Expected an error message")
+			}
+			if validationErr.Rule != tt.rule {
+				t.Errorf("Expected rule %q, got %q (%s)", tt.rule, validationErr.Rule, validationErr.Message)
+			}
+			if validationErr.Path != tt.path {
+				t.Errorf("Expected path %q, got %q", tt.path, validationErr.Path)
+			}
+			if tt.line != 0 {
+				if len(validationErr.Locations) == 0 {
+					t.Fatalf("Expected a location, got none (%s)", validationErr.Message)
+				}
+				if loc := validationErr.Locations[0]; loc.Line != tt.line || loc.Column != tt.column {
+					t.Errorf("Expected %d:%d, got %d:%d (%s)", tt.line, tt.column, loc.Line, loc.Column, validationErr.Message)
+				}
+			}
+		})
+	}
+
+	// Only the introspection query reached the target
+	if hits := server.hitCount(); hits != 1 {
+		t.Errorf("Expected invalid queries not to be sent, target was hit %d times", hits)
+	}
+}
+
+func TestGraphQLValidate_SendsValidQueries(t *testing.T) {
+	server, url := introspectedLibraryServer(t)
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL: url,
+		Query: `query Books($filter: BookFilter, $first: Int) {
+  books(filter: $filter, first: $first) { ...BookFields }
+  search(text: "dune") { __typename ... on Author { name } }
+}
+fragment BookFields on Book { id title author { name } }`,
+		Variables:     map[string]interface{}{"filter": map[string]interface{}{"genre": "FICTION"}, "first": 5},
+		OperationName: "Books",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%+v)", code, resp)
+	}
+	if !resp.Validated || len(resp.ValidationErrors) != 0 {
+		t.Errorf("Expected the query to pass validation, got %+v", resp.ValidationErrors)
+	}
+	if hits := server.hitCount(); hits != 2 {
+		t.Errorf("Expected the query to be sent, target was hit %d times", hits)
+	}
+}
+
+func TestGraphQLValidate_SkipValidation(t *testing.T) {
+	server, url := introspectedLibraryServer(t)
+
+	// A client directive that the server strips before execution
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:            url,
+		Query:          `{ books { id title @client } }`,
+		SkipValidation: true,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%+v)", code, resp)
+	}
+	if resp.Validated {
+		t.Error("Expected validation to be skipped")
+	}
+	if hits := server.hitCount(); hits != 2 {
+		t.Errorf("Expected the query to be sent, target was hit %d times", hits)
+	}
+}
+
+func TestGraphQLValidate_Batch(t *testing.T) {
+	server, url := introspectedLibraryServer(t)
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL: url,
+		Batch: []model.GraphQLOperation{
+			{Query: `{ books { id } }`},
+			{Query: `{ books { isbn } }`},
+		},
+	})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", code)
+	}
+	if len(resp.ValidationErrors) != 1 || resp.ValidationErrors[0].Operation == nil || *resp.ValidationErrors[0].Operation != 1 {
+		t.Fatalf("Expected one error for operation 1, got %+v", resp.ValidationErrors)
+	}
+	if hits := server.hitCount(); hits != 1 {
+		t.Errorf("Expected the batch not to be sent, target was hit %d times", hits)
+	}
+}
+
+func TestGraphQLValidate_WithoutSchema(t *testing.T) {
+	server := &introspectionServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{URL: httpServer.URL, Query: `{ anything }`})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%+v)", code, resp)
+	}
+	if resp.Validated {
+		t.Error("Expected no validation without an introspected schema")
+	}
+	if hits := server.hitCount(); hits != 1 {
+		t.Errorf("Expected the query to be sent, target was hit %d times", hits)
+	}
+}
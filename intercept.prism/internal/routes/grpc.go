@@ -2,23 +2,27 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/bufbuild/protocompile"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/extract"
 	"github.com/yendelevium/intercept.prism/internal/store"
 	"github.com/yendelevium/intercept.prism/internal/tracing"
 	"github.com/yendelevium/intercept.prism/model"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
@@ -27,16 +31,27 @@ func grpcRoutes(superRouter *gin.RouterGroup) {
 	grpcRouter := superRouter.Group("/grpc")
 	{
 		grpcRouter.POST("/", executeGRPCRequest)
+		grpcRouter.POST("/stream", executeGRPCStream)
+		grpcRouter.GET("/services", listGRPCServices)
+		grpcRouter.POST("/services", describeGRPCServices)
+		grpcRouter.POST("/template", generateGRPCTemplate)
+		grpcRouter.POST("/health", checkGRPCHealth)
+		grpcRouter.POST("/transcode", transcodeGRPCRequest)
 	}
 }
 
 // executeGRPCRequest godoc
 // @Summary      Execute a gRPC request
-// @Description  Proxies a unary gRPC request to a target server using an uploaded .proto file definition
+// @Description  Proxies a unary gRPC request to a target server using uploaded .proto files, a protoset or server reflection.
+// @Description  The call is made over native gRPC, gRPC-Web, gRPC-Web-text or the Connect protocol depending on `protocol`.
+// @Description  `{{name}}` references and `{{$helper}}` calls in the server address, metadata and body are resolved from `environment` first, as for REST requests
+// @Description  `auth` of type basic, bearer or apikey (in a header) is sent as metadata; other types are rejected with 400
+// @Description  `assertions` are checked as for REST requests: status compares the gRPC code or its name, headers include trailers and paths apply to the protojson body
+// @Description  `extract` works as for REST requests, and a `field` source walks the response message by proto or JSON field names, e.g. `user.tokens[0].value` or `labels["env"]`
 // @Tags         gRPC
 // @Accept       json
 // @Produce      json
-// @Param        request body model.GRPCRequest true "gRPC request configuration with .proto file content"
+// @Param        request body model.GRPCRequest true "gRPC request configuration with proto sources"
 // @Success      200 {object} model.GRPCResponse "Successful response with tracing info"
 // @Failure      400 {object} model.GRPCResponse "Invalid request body or proto file"
 // @Failure      500 {object} model.GRPCResponse "Request execution failed"
@@ -53,11 +68,11 @@ func executeGRPCRequest(c *gin.Context) {
 	}
 	log.Println("gRPC Request Received")
 
-	// Validate required fields
-	if reqBody.ProtoFile == "" {
+	// Resolve {{variables}} from the request's environment
+	if err := expandGRPCRequest(&reqBody); err != nil {
 		c.JSON(http.StatusBadRequest, model.GRPCResponse{
 			StatusCode: http.StatusBadRequest,
-			Error:      "proto_file content is required",
+			Error:      err.Error(),
 		})
 		return
 	}
@@ -68,82 +83,37 @@ func executeGRPCRequest(c *gin.Context) {
 	spanID := tracing.GenerateSpanID()
 	traceID := tracing.GenerateTraceID()
 
-	// Parse the .proto file content using protocompile
-	compiler := protocompile.Compiler{
-		Resolver: &protocompile.SourceResolver{
-			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
-				"uploaded.proto": reqBody.ProtoFile,
-			}),
-		},
-	}
-
-	compiled, err := compiler.Compile(context.Background(), "uploaded.proto")
+	// Fetch or reuse the OAuth2 access token, with token endpoint calls under the call's span
+	tokenSpans, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, spanID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, model.GRPCResponse{
-			StatusCode: http.StatusBadRequest,
-			Error:      fmt.Sprintf("Failed to parse .proto file: %v", err),
-			TraceID:    traceID,
-			SpanID:     spanID,
-		})
-		return
-	}
-
-	if len(compiled) == 0 {
-		c.JSON(http.StatusBadRequest, model.GRPCResponse{
-			StatusCode: http.StatusBadRequest,
-			Error:      "No file descriptors found in .proto file",
+		c.JSON(code, model.GRPCResponse{
+			StatusCode: code,
+			Error:      err.Error(),
 			TraceID:    traceID,
 			SpanID:     spanID,
+			Spans:      tokenSpans,
 		})
 		return
 	}
 
-	// Find the service descriptor
-	fileDesc := compiled[0]
-	var serviceDesc protoreflect.ServiceDescriptor
-	services := fileDesc.Services()
-	serviceName := reqBody.Service
-
-	// Try exact match first
-	for i := 0; i < services.Len(); i++ {
-		svc := services.Get(i)
-		if string(svc.FullName()) == serviceName || string(svc.Name()) == serviceName {
-			serviceDesc = svc
-			break
-		}
-	}
-
-	// Try with package prefix if not found
-	if serviceDesc == nil {
-		pkg := string(fileDesc.Package())
-		if pkg != "" {
-			qualifiedName := pkg + "." + serviceName
-			for i := 0; i < services.Len(); i++ {
-				svc := services.Get(i)
-				if string(svc.FullName()) == qualifiedName {
-					serviceDesc = svc
-					break
-				}
-			}
-		}
-	}
-
-	if serviceDesc == nil {
-		c.JSON(http.StatusBadRequest, model.GRPCResponse{
-			StatusCode: http.StatusBadRequest,
-			Error:      fmt.Sprintf("Service '%s' not found in .proto file", reqBody.Service),
+	// Resolve the method on a pooled connection
+	target, code, err := resolveGRPCTarget(reqBody)
+	if err != nil {
+		c.JSON(code, model.GRPCResponse{
+			StatusCode: code,
+			Error:      err.Error(),
 			TraceID:    traceID,
 			SpanID:     spanID,
 		})
 		return
 	}
+	defer target.release()
 
-	// Find the method descriptor
-	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(reqBody.Method))
-	if methodDesc == nil {
+	methodDesc := target.methodDesc
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
 		c.JSON(http.StatusBadRequest, model.GRPCResponse{
 			StatusCode: http.StatusBadRequest,
-			Error:      fmt.Sprintf("Method '%s' not found in service '%s'", reqBody.Method, reqBody.Service),
+			Error:      fmt.Sprintf("Method '%s' is a streaming method, use /grpc/stream instead", reqBody.Method),
 			TraceID:    traceID,
 			SpanID:     spanID,
 		})
@@ -164,194 +134,335 @@ func executeGRPCRequest(c *gin.Context) {
 		}
 	}
 
-	// Dial the target gRPC server
-	dialOpts := []grpc.DialOption{}
-	if !reqBody.UseTLS {
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	}
-
-	conn, err := grpc.NewClient(reqBody.ServerAddress, dialOpts...)
+	// Invoke the RPC and queue its span
+	call, err := invokeUnary(target, reqBody, reqMsg, traceID, spanID, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.GRPCResponse{
 			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Sprintf("Failed to connect to gRPC server: %v", err),
+			Error:      err.Error(),
 			TraceID:    traceID,
 			SpanID:     spanID,
 		})
 		return
 	}
-	defer conn.Close()
 
-	// Build outgoing metadata
-	md := metadata.New(nil)
-	for key, value := range reqBody.Metadata {
-		md.Set(key, value)
-	}
+	// Queue records for async DB write
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: call.response.StatusCode,
+		LatencyMs:  int(call.duration.Milliseconds()),
+		Assertions: call.response.Assertions,
+	})
+	log.Println("Queued Execution, and Span for async DB write (gRPC)")
+
+	// Save extracted variables so the next request of a chain can use them
+	saveExtracted(call.response.Extracted, reqBody.Extract, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+
+	call.response.RequestID = requestID
+	call.response.ExecutionID = executionID
+	call.response.Spans = append(call.response.Spans, tokenSpans...)
+	c.JSON(http.StatusOK, call.response)
+}
+
+// unaryCall is the outcome of invokeUnary
+type unaryCall struct {
+	response model.GRPCResponse
+	respMsg  *dynamicpb.Message // Decoded response, nil when the RPC failed
+	duration time.Duration
+}
+
+// invokeUnary calls a unary method on the target's wire protocol and queues its span.
+// RPC failures are reported in the response; the error is only set when the response
+// could not be encoded. parentSpanID is empty for root spans
+func invokeUnary(target *grpcTarget, reqBody model.GRPCRequest, reqMsg proto.Message, traceID, spanID, parentSpanID string) (*unaryCall, error) {
 	// Inject W3C traceparent
+	md := target.md.Copy()
 	traceparent := fmt.Sprintf("00-%s-%s-01", traceID, spanID)
 	md.Set("traceparent", traceparent)
 
+	timeout := target.options.timeout(30 * time.Second)
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Invoke the RPC using conn.Invoke with dynamicpb messages
-	respMsg := dynamicpb.NewMessage(methodDesc.Output())
-	fullMethod := fmt.Sprintf("/%s/%s", serviceDesc.FullName(), methodDesc.Name())
+	// Connect before starting the clock so a fresh dial doesn't count as RPC latency.
+	// gRPC-Web and Connect dial as part of the HTTP request instead
+	if target.protocol == grpcProtocolNative {
+		target.connect(ctx)
+	}
+
+	// Invoke the RPC with dynamicpb messages on the selected wire protocol
+	respMsg := dynamicpb.NewMessage(target.methodDesc.Output())
 	var respHeaders, respTrailers metadata.MD
+	var respPeer peer.Peer
+	var tlsInfo *model.GRPCTLSInfo
+	var err error
 
 	requestStart := time.Now()
-	err = conn.Invoke(ctx, fullMethod, reqMsg, respMsg,
-		grpc.Header(&respHeaders),
-		grpc.Trailer(&respTrailers),
-	)
-	responseEnd := time.Now()
-	totalDuration := responseEnd.Sub(requestStart)
-
-	// Flatten metadata
-	flatHeaders := flattenMetadata(respHeaders)
-	flatTrailers := flattenMetadata(respTrailers)
-
-	// Handle RPC error
-	if err != nil {
-		st, _ := status.FromError(err)
-
-		grpcStatus := "ERROR"
-		tags := map[string]string{
-			"grpc.service":     reqBody.Service,
-			"grpc.method":      reqBody.Method,
-			"grpc.status_code": fmt.Sprintf("%d", int(st.Code())),
-			"grpc.status_name": st.Code().String(),
-		}
-
-		// Queue records for async DB write
-		store.AddExecution(store.ExecutionRecord{
-			ID:         executionID,
-			RequestID:  requestID,
-			TraceID:    traceID,
-			StatusCode: int(st.Code()),
-			LatencyMs:  int(totalDuration.Milliseconds()),
-		})
-
-		spanRecord := store.SpanRecord{
-			ID:          uuid.New().String(),
-			TraceID:     traceID,
-			SpanID:      spanID,
-			Operation:   fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method),
-			ServiceName: "intercept.prism",
-			StartTime:   requestStart.UnixMicro(),
-			Duration:    totalDuration.Microseconds(),
-			Status:      grpcStatus,
-			Tags:        tags,
-		}
-
-		store.AddSpan(spanRecord);
-		tracing.Hub.Publish(spanRecord);
-
-		rootSpan := model.SpanInfo{
-			SpanID:      spanID,
-			TraceID:     traceID,
-			Operation:   fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method),
-			ServiceName: "intercept.prism",
-			StartTime:   requestStart.UnixMicro(),
-			Duration:    totalDuration.Microseconds(),
-			Status:      grpcStatus,
-			Tags:        tags,
-		}
+	if target.protocol == grpcProtocolNative {
+		callOpts := append(target.options.callOptions(),
+			grpc.Header(&respHeaders),
+			grpc.Trailer(&respTrailers),
+			grpc.Peer(&respPeer),
+		)
+		err = target.conn.Invoke(ctx, target.fullMethod(), reqMsg, respMsg, callOpts...)
+		// Negotiated TLS details, nil for plaintext targets
+		tlsInfo = grpcTLSInfo(&respPeer, reqBody.TLS)
+	} else {
+		respHeaders, respTrailers, tlsInfo, err = invokeGRPCOverHTTP(ctx, target, reqBody, md, reqMsg, respMsg)
+	}
+	totalDuration := time.Since(requestStart)
+	overhead := target.overhead
 
-		c.JSON(http.StatusOK, model.GRPCResponse{
+	call := &unaryCall{
+		duration: totalDuration,
+		response: model.GRPCResponse{
 			Duration:         fmt.Sprintf("%vms", totalDuration.Milliseconds()),
-			StatusCode:       int(st.Code()),
-			StatusName:       st.Code().String(),
-			Body:             "",
-			ResponseHeaders:  flatHeaders,
-			ResponseTrailers: flatTrailers,
-			Error:            st.Message(),
+			StatusName:       "OK",
+			ResponseHeaders:  flattenMetadata(respHeaders),
+			ResponseTrailers: flattenMetadata(respTrailers),
 			RequestSize:      int64(len(reqBody.Body)),
-			RequestID:        requestID,
-			ExecutionID:      executionID,
+			TLS:              tlsInfo,
+			Timings:          overhead.timings(),
 			TraceID:          traceID,
 			SpanID:           spanID,
-			Spans:            []model.SpanInfo{rootSpan},
-		})
-		return
-	}
-
-	// Marshal response to JSON using protojson
-	respJSON, err := protojson.Marshal(respMsg)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.GRPCResponse{
-			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Sprintf("Failed to marshal response to JSON: %v", err),
-			TraceID:    traceID,
-			SpanID:     spanID,
-		})
-		return
+		},
 	}
 
-	// Determine status
 	grpcStatus := "OK"
 	tags := map[string]string{
 		"grpc.service":     reqBody.Service,
 		"grpc.method":      reqBody.Method,
 		"grpc.status_code": "0",
 		"grpc.status_name": "OK",
+		"grpc.protocol":    target.protocol,
 	}
+	addTLSTags(tags, reqBody.UseTLS, tlsInfo)
+	auth.Tags(tags, reqBody.Auth)
 
-	// Queue records for async DB write
-	store.AddExecution(store.ExecutionRecord{
-		ID:         executionID,
-		RequestID:  requestID,
-		TraceID:    traceID,
-		StatusCode: 0, // gRPC OK
-		LatencyMs:  int(totalDuration.Milliseconds()),
+	if err != nil {
+		// Handle RPC error
+		st, _ := status.FromError(err)
+		errorDetails, detailMsgs := decodeErrorDetails(st, target.files)
+
+		grpcStatus = "ERROR"
+		tags["grpc.status_code"] = fmt.Sprintf("%d", int(st.Code()))
+		tags["grpc.status_name"] = st.Code().String()
+		addErrorDetailTags(tags, errorDetails, detailMsgs)
+
+		call.response.StatusCode = int(st.Code())
+		call.response.StatusName = st.Code().String()
+		call.response.Error = st.Message()
+		call.response.ErrorDetails = errorDetails
+	} else {
+		// Marshal response to JSON using protojson
+		respJSON, err := protojson.Marshal(respMsg)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal response to JSON: %v", err)
+		}
+		call.respMsg = respMsg
+		call.response.Body = string(respJSON)
+		call.response.ResponseSize = int64(len(respJSON))
+	}
+	target.options.addTags(tags, timeout)
+	overhead.addTags(tags)
+
+	// Headers and trailers are checked together, paths apply to the protojson body
+	assertionHeaders := flattenMetadata(metadata.Join(respHeaders, respTrailers))
+	call.response.Assertions = assertions.Evaluate(reqBody.Assertions, assertions.Response{
+		StatusCode: call.response.StatusCode,
+		StatusName: call.response.StatusName,
+		Headers:    assertionHeaders,
+		Body:       []byte(call.response.Body),
+		Latency:    totalDuration,
 	})
+	if addAssertionTags(tags, call.response.Assertions) {
+		grpcStatus = "ERROR"
+	}
+	if len(reqBody.Extract) > 0 {
+		resp := extract.Response{Headers: assertionHeaders, Body: []byte(call.response.Body)}
+		if call.respMsg != nil { // Not a typed nil, field paths report a failed RPC instead
+			resp.Message = call.respMsg
+		}
+		call.response.Extracted = extract.Run(reqBody.Extract, resp)
+		addExtractTags(tags, call.response.Extracted)
+	}
 
+	operation := fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method)
 	spanRecord := store.SpanRecord{
-		ID:          uuid.New().String(),
-		TraceID:     traceID,
-		SpanID:      spanID,
-		Operation:   fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method),
-		ServiceName: "intercept.prism",
-		StartTime:   requestStart.UnixMicro(),
-		Duration:    totalDuration.Microseconds(),
-		Status:      grpcStatus,
-		Tags:        tags,
+		ID:           uuid.New().String(),
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentSpanID,
+		Operation:    operation,
+		ServiceName:  "intercept.prism",
+		StartTime:    requestStart.UnixMicro(),
+		Duration:     totalDuration.Microseconds(),
+		Status:       grpcStatus,
+		Tags:         tags,
 	}
 
-	store.AddSpan(spanRecord);
-	tracing.Hub.Publish(spanRecord);
+	store.AddSpan(spanRecord)
+	tracing.Hub.Publish(spanRecord)
+
+	call.response.Spans = []model.SpanInfo{{
+		SpanID:       spanID,
+		TraceID:      traceID,
+		ParentSpanID: parentSpanID,
+		Operation:    operation,
+		ServiceName:  "intercept.prism",
+		StartTime:    requestStart.UnixMicro(),
+		Duration:     totalDuration.Microseconds(),
+		Status:       grpcStatus,
+		Tags:         tags,
+	}}
+	return call, nil
+}
+
+// grpcTarget is a resolved method on a pooled connection, ready to be called
+type grpcTarget struct {
+	conn        *grpc.ClientConn // Nil for gRPC-Web and Connect calls without reflection
+	release     func()
+	transport   *http.Transport // Shared transport for gRPC-Web and Connect, nil for native gRPC
+	serviceDesc protoreflect.ServiceDescriptor
+	methodDesc  protoreflect.MethodDescriptor
+	files       []protoreflect.FileDescriptor // Descriptors the method came from, used to decode error details
+	md          metadata.MD                   // User metadata, without the traceparent
+	protocol    string                        // Wire protocol, see grpcProtocol
+	options     grpcCallOptions
+	overhead    grpcOverhead
+}
 
-	log.Println("Queued Execution, and Span for async DB write (gRPC)")
+// fullMethod returns the "/package.Service/Method" path used on the wire
+func (t *grpcTarget) fullMethod() string {
+	return fmt.Sprintf("/%s/%s", t.serviceDesc.FullName(), t.methodDesc.Name())
+}
+
+// connect waits for the connection to become READY and records the dial time
+func (t *grpcTarget) connect(ctx context.Context) {
+	dialStart := time.Now()
+	waitForReady(ctx, t.conn)
+	t.overhead.DialDuration = time.Since(dialStart)
+}
+
+// resolveGRPCTarget validates the request, acquires a pooled connection and resolves
+// the method descriptor. On failure it returns the HTTP status and message to report
+func resolveGRPCTarget(reqBody model.GRPCRequest) (*grpcTarget, int, error) {
+	// Validate required fields
+	if !hasProtoSources(reqBody) && !reqBody.UseReflection {
+		return nil, http.StatusBadRequest, fmt.Errorf("proto_file, proto_files, proto_zip or protoset content is required unless use_reflection is set")
+	}
+	target, code, err := dialGRPCTarget(reqBody)
+	if err != nil {
+		return nil, code, err
+	}
+
+	// Resolve the service descriptor, either from the target's reflection API or the uploaded proto sources
+	compileStart := time.Now()
+	if reqBody.UseReflection {
+		target.serviceDesc, code, err = reflectGRPCService(target, reqBody.Service)
+		if err != nil {
+			target.release()
+			return nil, code, err
+		}
+		target.files = []protoreflect.FileDescriptor{target.serviceDesc.ParentFile()}
+	} else {
+		target.files, target.overhead.DescriptorCacheHit, err = grpcDescriptors.Get(reqBody)
+		if err == nil {
+			target.serviceDesc, err = findServiceDescriptor(target.files, reqBody.Service)
+		}
+		if err != nil {
+			target.release()
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	target.overhead.CompileDuration = time.Since(compileStart)
+
+	// Find the method descriptor
+	target.methodDesc = target.serviceDesc.Methods().ByName(protoreflect.Name(reqBody.Method))
+	if target.methodDesc == nil {
+		target.release()
+		return nil, http.StatusBadRequest, fmt.Errorf("Method '%s' not found in service '%s'", reqBody.Method, reqBody.Service)
+	}
+
+	return target, 0, nil
+}
+
+// dialGRPCTarget acquires a pooled connection, or the shared HTTP transport for gRPC-Web and
+// Connect, and builds the outgoing metadata, auth included. The descriptors are left for the
+// caller to resolve
+func dialGRPCTarget(reqBody model.GRPCRequest) (*grpcTarget, int, error) {
+	protocol, err := grpcProtocol(reqBody)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	options, err := parseGRPCCallOptions(reqBody.Options)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid call options: %v", err)
+	}
+
+	target := &grpcTarget{
+		release:  func() {},
+		md:       metadata.New(nil),
+		protocol: protocol,
+		options:  options,
+		overhead: grpcOverhead{Reflection: reqBody.UseReflection},
+	}
 
-	rootSpan := model.SpanInfo{
-		SpanID:      spanID,
-		TraceID:     traceID,
-		Operation:   fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method),
-		ServiceName: "intercept.prism",
-		StartTime:   requestStart.UnixMicro(),
-		Duration:    totalDuration.Microseconds(),
-		Status:      grpcStatus,
-		Tags:        tags,
+	// gRPC-Web and Connect calls go over a shared HTTP transport
+	if protocol != grpcProtocolNative {
+		target.transport, err = grpcHTTPTransport(reqBody)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid TLS configuration: %v", err)
+		}
+	}
+
+	// Get a pooled connection to the target gRPC server, which reflection needs whatever the
+	// call's protocol. NewClient connects lazily, so nothing goes over the wire if the
+	// descriptors turn out to be invalid
+	if protocol == grpcProtocolNative || reqBody.UseReflection {
+		dialOpts, err := grpcDialOptions(reqBody)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Invalid TLS configuration: %v", err)
+		}
+		target.conn, target.release, target.overhead.ConnectionReused, err = grpcConns.Acquire(reqBody, dialOpts)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to connect to gRPC server: %v", err)
+		}
+	}
+
+	// Build outgoing metadata
+	for key, value := range reqBody.Metadata {
+		target.md.Set(key, value)
+	}
+	credentials := map[string]string{}
+	if err := auth.ApplyMetadata(credentials, reqBody.Auth); err != nil {
+		target.release()
+		return nil, http.StatusBadRequest, err
 	}
+	for key, value := range credentials {
+		target.md.Set(key, value)
+	}
+
+	return target, 0, nil
+}
 
-	finalResponse := model.GRPCResponse{
-		Duration:         fmt.Sprintf("%vms", totalDuration.Milliseconds()),
-		StatusCode:       0,
-		StatusName:       "OK",
-		Body:             string(respJSON),
-		ResponseHeaders:  flatHeaders,
-		ResponseTrailers: flatTrailers,
-		Error:            "",
-		ResponseSize:     int64(len(respJSON)),
-		RequestSize:      int64(len(reqBody.Body)),
-		RequestID:        requestID,
-		ExecutionID:      executionID,
-		TraceID:          traceID,
-		SpanID:           spanID,
-		Spans:            []model.SpanInfo{rootSpan},
+// reflectGRPCService resolves a service through the target's reflection API. Reflection
+// calls carry the user's metadata (auth) but not the traceparent
+func reflectGRPCService(target *grpcTarget, service string) (protoreflect.ServiceDescriptor, int, error) {
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), target.md.Copy()), 30*time.Second)
+	defer cancel()
+	serviceDesc, err := reflectServiceDescriptor(ctx, target.conn, service)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errDescriptorNotFound) || errors.Is(err, errDescriptorAmbiguous) {
+			code = http.StatusBadRequest
+		}
+		return nil, code, fmt.Errorf("Failed to resolve service via reflection: %v", err)
 	}
-	c.JSON(http.StatusOK, finalResponse)
+	return serviceDesc, 0, nil
 }
 
 // flattenMetadata converts gRPC metadata to a flat map
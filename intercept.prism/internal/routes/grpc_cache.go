@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// descriptorCache keeps compiled proto sources keyed by a hash of their content,
+// so repeated calls with the same definitions skip protocompile entirely
+type descriptorCache struct {
+	mu         sync.Mutex
+	entries    map[string]*descriptorCacheEntry
+	maxEntries int
+}
+
+type descriptorCacheEntry struct {
+	files    []protoreflect.FileDescriptor
+	lastUsed time.Time
+}
+
+func newDescriptorCache(maxEntries int) *descriptorCache {
+	return &descriptorCache{
+		entries:    make(map[string]*descriptorCacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// Global descriptor cache
+var grpcDescriptors = newDescriptorCache(256)
+
+// protoSourcesKey hashes every descriptor input of a request into a stable cache key
+func protoSourcesKey(reqBody model.GRPCRequest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "protoset:%d:%s\n", len(reqBody.Protoset), reqBody.Protoset)
+	fmt.Fprintf(h, "proto_file:%d:%s\n", len(reqBody.ProtoFile), reqBody.ProtoFile)
+	fmt.Fprintf(h, "proto_zip:%d:%s\n", len(reqBody.ProtoZip), reqBody.ProtoZip)
+
+	names := make([]string, 0, len(reqBody.ProtoFiles))
+	for name := range reqBody.ProtoFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := reqBody.ProtoFiles[name]
+		fmt.Fprintf(h, "proto_files:%d:%s:%d:%s\n", len(name), name, len(content), content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the compiled descriptors for the request's proto sources, compiling on a miss.
+// Failed compilations are not cached
+func (d *descriptorCache) Get(reqBody model.GRPCRequest) ([]protoreflect.FileDescriptor, bool, error) {
+	key := protoSourcesKey(reqBody)
+
+	d.mu.Lock()
+	if entry, ok := d.entries[key]; ok {
+		entry.lastUsed = time.Now()
+		d.mu.Unlock()
+		return entry.files, true, nil
+	}
+	d.mu.Unlock()
+
+	files, err := compileProtoDescriptors(reqBody)
+	if err != nil {
+		return nil, false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) >= d.maxEntries {
+		d.evictOldest()
+	}
+	d.entries[key] = &descriptorCacheEntry{files: files, lastUsed: time.Now()}
+	return files, false, nil
+}
+
+// evictOldest drops the least recently used entry. Caller must hold d.mu
+func (d *descriptorCache) evictOldest() {
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range d.entries {
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, entry.lastUsed
+		}
+	}
+	delete(d.entries, oldestKey)
+}
+
+// grpcConnPool shares one ClientConn per (address, TLS config) across requests.
+// Connections nobody has used for idleTimeout are closed by a background janitor
+type grpcConnPool struct {
+	mu          sync.Mutex
+	conns       map[string]*pooledConn
+	idleTimeout time.Duration
+	janitorOnce sync.Once
+}
+
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	refs     int
+	lastUsed time.Time
+}
+
+func newGRPCConnPool(idleTimeout time.Duration) *grpcConnPool {
+	return &grpcConnPool{
+		conns:       make(map[string]*pooledConn),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Global connection pool
+var grpcConns = newGRPCConnPool(5 * time.Minute)
+
+// grpcConnKey identifies a connection by target and every setting that affects the transport
+func grpcConnKey(reqBody model.GRPCRequest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%t\n", reqBody.ServerAddress, reqBody.Authority, reqBody.UseTLS)
+	if reqBody.Options != nil {
+		fmt.Fprintf(h, "%d:%s\n", len(reqBody.Options.UserAgent), reqBody.Options.UserAgent)
+	}
+	if reqBody.UseTLS && reqBody.TLS != nil {
+		cfg := reqBody.TLS
+		fmt.Fprintf(h, "%s\n%t\n%d:%s\n%d:%s\n%d:%s\n",
+			cfg.ServerName, cfg.InsecureSkipVerify,
+			len(cfg.CACert), cfg.CACert,
+			len(cfg.ClientCert), cfg.ClientCert,
+			len(cfg.ClientKey), cfg.ClientKey,
+		)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Acquire returns a pooled connection for the request's target, creating one if needed.
+// The returned release func must be called once the caller is done with the connection
+func (p *grpcConnPool) Acquire(reqBody model.GRPCRequest, dialOpts []grpc.DialOption) (*grpc.ClientConn, func(), bool, error) {
+	p.janitorOnce.Do(func() { go p.janitor() })
+
+	key := grpcConnKey(reqBody)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, reused := p.conns[key]
+	if reused {
+		switch entry.conn.GetState() {
+		case connectivity.Shutdown:
+			delete(p.conns, key)
+			reused = false
+		case connectivity.TransientFailure:
+			// The target was down last time. Start over instead of failing fast until the backoff expires
+			if entry.refs == 0 {
+				entry.conn.Close()
+				delete(p.conns, key)
+				reused = false
+			} else {
+				entry.conn.ResetConnectBackoff()
+			}
+		}
+	}
+	if !reused {
+		conn, err := grpc.NewClient(reqBody.ServerAddress, dialOpts...)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		entry = &pooledConn{conn: conn}
+		p.conns[key] = entry
+	}
+
+	entry.refs++
+	entry.lastUsed = time.Now()
+
+	release := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		entry.refs--
+		entry.lastUsed = time.Now()
+	}
+	return entry.conn, release, reused, nil
+}
+
+// EvictIdle closes connections that are unused and have been idle since before the cutoff
+func (p *grpcConnPool) EvictIdle(now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	evicted := 0
+	for key, entry := range p.conns {
+		if entry.refs == 0 && now.Sub(entry.lastUsed) >= p.idleTimeout {
+			entry.conn.Close()
+			delete(p.conns, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+func (p *grpcConnPool) janitor() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if n := p.EvictIdle(now); n > 0 {
+			log.Printf("Closed %d idle gRPC connections", n)
+		}
+	}
+}
+
+// waitForReady connects a (possibly fresh) ClientConn and blocks until it is READY
+// or fails, so dial time can be reported separately from RPC latency.
+// A failed connection is left for the RPC itself to report
+func waitForReady(ctx context.Context, conn *grpc.ClientConn) {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready || state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			return
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
+
+// grpcOverhead is the setup work done before an RPC, kept out of the measured latency
+type grpcOverhead struct {
+	CompileDuration    time.Duration
+	DialDuration       time.Duration
+	DescriptorCacheHit bool
+	ConnectionReused   bool
+	Reflection         bool
+}
+
+func (o grpcOverhead) timings() *model.GRPCTimings {
+	return &model.GRPCTimings{
+		CompileDuration:    fmt.Sprintf("%vms", o.CompileDuration.Milliseconds()),
+		DialDuration:       fmt.Sprintf("%vms", o.DialDuration.Milliseconds()),
+		CompileMicros:      o.CompileDuration.Microseconds(),
+		DialMicros:         o.DialDuration.Microseconds(),
+		DescriptorCacheHit: o.DescriptorCacheHit,
+		ConnectionReused:   o.ConnectionReused,
+	}
+}
+
+func (o grpcOverhead) addTags(tags map[string]string) {
+	tags["grpc.compile_us"] = fmt.Sprintf("%d", o.CompileDuration.Microseconds())
+	tags["grpc.dial_us"] = fmt.Sprintf("%d", o.DialDuration.Microseconds())
+	tags["grpc.connection_reused"] = fmt.Sprintf("%t", o.ConnectionReused)
+	if o.Reflection {
+		tags["grpc.descriptor_source"] = "reflection"
+	} else if o.DescriptorCacheHit {
+		tags["grpc.descriptor_source"] = "cache"
+	} else {
+		tags["grpc.descriptor_source"] = "compiled"
+	}
+}
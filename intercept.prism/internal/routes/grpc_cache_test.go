@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestGRPCRoute_ReusesDescriptorsAndConnection(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	// A unique comment keeps the cache key away from other tests and repeated runs
+	reqBody := model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Cache"}`,
+		ProtoFile:     fmt.Sprintf("%s\n// %d\n", testProto, time.Now().UnixNano()),
+	}
+
+	code, first := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", reqBody)
+	if code != http.StatusOK || first.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, first.StatusCode, first.Error)
+	}
+	if first.Timings == nil {
+		t.Fatal("Expected timings in response")
+	}
+	if first.Timings.DescriptorCacheHit || first.Timings.ConnectionReused {
+		t.Errorf("Expected a cold first call, got %+v", first.Timings)
+	}
+
+	_, second := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", reqBody)
+	if second.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d: %s", second.StatusCode, second.Error)
+	}
+	if !second.Timings.DescriptorCacheHit {
+		t.Error("Expected descriptor cache hit on second call")
+	}
+	if !second.Timings.ConnectionReused {
+		t.Error("Expected pooled connection on second call")
+	}
+	if second.Spans[0].Tags["grpc.descriptor_source"] != "cache" {
+		t.Errorf("Expected descriptor_source=cache tag, got %v", second.Spans[0].Tags)
+	}
+	if _, ok := second.Spans[0].Tags["grpc.dial_us"]; !ok {
+		t.Errorf("Expected grpc.dial_us tag, got %v", second.Spans[0].Tags)
+	}
+}
+
+func TestProtoSourcesKey(t *testing.T) {
+	a := model.GRPCRequest{ProtoFiles: map[string]string{"a.proto": "A", "b.proto": "B"}}
+	b := model.GRPCRequest{ProtoFiles: map[string]string{"b.proto": "B", "a.proto": "A"}}
+	if protoSourcesKey(a) != protoSourcesKey(b) {
+		t.Error("Expected key to be independent of map order")
+	}
+
+	c := model.GRPCRequest{ProtoFiles: map[string]string{"a.proto": "A", "b.proto": "B2"}}
+	if protoSourcesKey(a) == protoSourcesKey(c) {
+		t.Error("Expected key to change with file content")
+	}
+
+	// Content moved between fields must not collide
+	d := model.GRPCRequest{ProtoFile: "A"}
+	e := model.GRPCRequest{ProtoZip: "A"}
+	if protoSourcesKey(d) == protoSourcesKey(e) {
+		t.Error("Expected key to distinguish proto_file from proto_zip")
+	}
+}
+
+func TestDescriptorCache_EvictsOldest(t *testing.T) {
+	cache := newDescriptorCache(2)
+	reqs := []model.GRPCRequest{
+		{ProtoFile: testProto + "\n// one\n"},
+		{ProtoFile: testProto + "\n// two\n"},
+		{ProtoFile: testProto + "\n// three\n"},
+	}
+	for _, r := range reqs {
+		if _, _, err := cache.Get(r); err != nil {
+			t.Fatalf("Failed to compile: %v", err)
+		}
+	}
+
+	if len(cache.entries) != 2 {
+		t.Fatalf("Expected 2 cached entries, got %d", len(cache.entries))
+	}
+	if _, hit, _ := cache.Get(reqs[0]); hit {
+		t.Error("Expected the oldest entry to have been evicted")
+	}
+}
+
+func TestGRPCConnPool_EvictIdle(t *testing.T) {
+	pool := newGRPCConnPool(time.Minute)
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+
+	idle, releaseIdle, _, err := pool.Acquire(model.GRPCRequest{ServerAddress: "127.0.0.1:1"}, dialOpts)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	releaseIdle()
+
+	busy, releaseBusy, _, err := pool.Acquire(model.GRPCRequest{ServerAddress: "127.0.0.1:2"}, dialOpts)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	defer releaseBusy()
+
+	if n := pool.EvictIdle(time.Now()); n != 0 {
+		t.Errorf("Expected nothing evicted before the idle timeout, got %d", n)
+	}
+	if n := pool.EvictIdle(time.Now().Add(2 * time.Minute)); n != 1 {
+		t.Errorf("Expected only the idle connection evicted, got %d", n)
+	}
+	if idle.GetState() != connectivity.Shutdown {
+		t.Errorf("Expected evicted connection to be closed, got %s", idle.GetState())
+	}
+	if busy.GetState() == connectivity.Shutdown {
+		t.Error("Expected in-use connection to stay open")
+	}
+
+	// Different TLS settings for the same address get their own connection
+	_, release, reused, _ := pool.Acquire(model.GRPCRequest{ServerAddress: "127.0.0.1:2", Authority: "other"}, dialOpts)
+	release()
+	if reused {
+		t.Error("Expected a separate connection for a different authority")
+	}
+}
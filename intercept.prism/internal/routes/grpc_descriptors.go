@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// Register the common Google API protos so uploaded files can import them
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/genproto/googleapis/api/httpbody"
+	_ "google.golang.org/genproto/googleapis/rpc/code"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	_ "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// uploadedProtoName is the import path given to the single proto_file field
+const uploadedProtoName = "uploaded.proto"
+
+// Limits on a proto_zip archive, so a small upload cannot expand into unbounded memory
+const (
+	maxProtoZipEntries = 1000
+	maxProtoZipBytes   = 32 << 20 // Uncompressed size of all .proto entries
+)
+
+// hasProtoSources reports whether the request carries any descriptor input besides reflection
+func hasProtoSources(reqBody model.GRPCRequest) bool {
+	return reqBody.ProtoFile != "" || len(reqBody.ProtoFiles) > 0 || reqBody.ProtoZip != "" || reqBody.Protoset != ""
+}
+
+// compileProtoDescriptors turns the request's proto sources into linked file descriptors.
+// A protoset takes precedence, otherwise proto_file, proto_files and proto_zip are compiled together
+func compileProtoDescriptors(reqBody model.GRPCRequest) ([]protoreflect.FileDescriptor, error) {
+	if reqBody.Protoset != "" {
+		return loadProtoset(reqBody.Protoset)
+	}
+
+	sources, err := collectProtoSources(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("No .proto files found in request")
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Uploaded files win, then the well-known types, then anything registered in the Go runtime (google/api, google/rpc)
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{
+				Accessor: protocompile.SourceAccessorFromMap(sources),
+			},
+			protocompile.ResolverFunc(func(importPath string) (protocompile.SearchResult, error) {
+				fd, err := protoregistry.GlobalFiles.FindFileByPath(importPath)
+				if err != nil {
+					return protocompile.SearchResult{}, err
+				}
+				return protocompile.SearchResult{Desc: fd}, nil
+			}),
+		}),
+	}
+
+	compiled, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse .proto file: %v", err)
+	}
+
+	files := make([]protoreflect.FileDescriptor, 0, len(compiled))
+	for _, fd := range compiled {
+		files = append(files, fd)
+	}
+	return files, nil
+}
+
+// collectProtoSources merges proto_file, proto_files and the .proto entries of proto_zip into one path -> content map
+func collectProtoSources(reqBody model.GRPCRequest) (map[string]string, error) {
+	sources := map[string]string{}
+	if reqBody.ProtoFile != "" {
+		sources[uploadedProtoName] = reqBody.ProtoFile
+	}
+	for name, content := range reqBody.ProtoFiles {
+		sources[cleanProtoPath(name)] = content
+	}
+
+	if reqBody.ProtoZip != "" {
+		raw, err := base64.StdEncoding.DecodeString(reqBody.ProtoZip)
+		if err != nil {
+			return nil, fmt.Errorf("proto_zip is not valid base64: %v", err)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("proto_zip is not a valid zip archive: %v", err)
+		}
+		if len(archive.File) > maxProtoZipEntries {
+			return nil, fmt.Errorf("proto_zip has %d entries, at most %d are allowed", len(archive.File), maxProtoZipEntries)
+		}
+		remaining := int64(maxProtoZipBytes)
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() || !strings.HasSuffix(f.Name, ".proto") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open %s in proto_zip: %v", f.Name, err)
+			}
+			// The sizes in the archive's headers can lie, so the limit applies to what is read
+			content, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s in proto_zip: %v", f.Name, err)
+			}
+			remaining -= int64(len(content))
+			if remaining < 0 {
+				return nil, fmt.Errorf("proto_zip expands to more than %d MiB of .proto files", maxProtoZipBytes>>20)
+			}
+			sources[cleanProtoPath(f.Name)] = string(content)
+		}
+	}
+	return sources, nil
+}
+
+// cleanProtoPath normalises a file name into the form used by import statements
+func cleanProtoPath(name string) string {
+	return strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+}
+
+// loadProtoset decodes a base64 FileDescriptorSet (protoc --descriptor_set_out).
+// Imports missing from the set are filled in from the Go runtime registry
+func loadProtoset(encoded string) ([]protoreflect.FileDescriptor, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("protoset is not valid base64: %v", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(raw, set); err != nil {
+		return nil, fmt.Errorf("protoset is not a valid FileDescriptorSet: %v", err)
+	}
+	if len(set.GetFile()) == 0 {
+		return nil, fmt.Errorf("protoset contains no files")
+	}
+
+	included := map[string]bool{}
+	for _, fd := range set.GetFile() {
+		included[fd.GetName()] = true
+	}
+	// Sets built without --include_imports usually only lack the well-known types
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if included[dep] {
+				continue
+			}
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				return nil, fmt.Errorf("protoset is missing imported file %q", dep)
+			}
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+			included[dep] = true
+		}
+	}
+
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to link protoset: %v", err)
+	}
+
+	files := []protoreflect.FileDescriptor{}
+	registry.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		files = append(files, fd)
+		return true
+	})
+	return files, nil
+}
+
+// findServiceDescriptor looks up a service across the compiled files.
+// The name may be fully-qualified or the bare service name
+func findServiceDescriptor(files []protoreflect.FileDescriptor, serviceName string) (protoreflect.ServiceDescriptor, error) {
+	for _, fileDesc := range files {
+		services := fileDesc.Services()
+		for i := 0; i < services.Len(); i++ {
+			svc := services.Get(i)
+			if string(svc.FullName()) == serviceName || string(svc.Name()) == serviceName {
+				return svc, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Service '%s' not found in .proto files", serviceName)
+}
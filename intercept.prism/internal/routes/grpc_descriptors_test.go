@@ -0,0 +1,232 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Greeter split across two files, wire-compatible with testProto
+var multiFileProtos = map[string]string{
+	"greeter/messages.proto": `
+syntax = "proto3";
+
+package testpkg;
+
+import "google/protobuf/timestamp.proto";
+
+message HelloRequest {
+  string name = 1;
+  google.protobuf.Timestamp sent_at = 2;
+}
+
+message HelloReply {
+  string message = 1;
+}
+`,
+	"greeter/service.proto": `
+syntax = "proto3";
+
+package testpkg;
+
+import "greeter/messages.proto";
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+}
+`,
+}
+
+// zipProtos packs the given files into a base64 encoded zip archive
+func zipProtos(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s to zip: %v", name, err)
+		}
+		w.Write([]byte(content))
+	}
+	// Non-proto files are ignored
+	readme, _ := zw.Create("README.md")
+	readme.Write([]byte("not a proto"))
+	zw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestGRPCRoute_MultiFileProtos(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Imports", "sent_at": "2026-01-01T00:00:00Z"}`,
+		ProtoFiles:    multiFileProtos,
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+
+	var bodyMap map[string]any
+	json.Unmarshal([]byte(resp.Body), &bodyMap)
+	if bodyMap["message"] != "Hello, Imports!" {
+		t.Errorf("Expected 'Hello, Imports!', got %v", bodyMap)
+	}
+}
+
+func TestGRPCRoute_ProtoZip(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Zip"}`,
+		ProtoZip:      zipProtos(t, multiFileProtos),
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+}
+
+func TestCollectProtoSources_ZipLimits(t *testing.T) {
+	many := map[string]string{}
+	for i := 0; i <= maxProtoZipEntries; i++ {
+		many[fmt.Sprintf("p%d.proto", i)] = `syntax = "proto3";`
+	}
+	_, err := collectProtoSources(model.GRPCRequest{ProtoZip: zipProtos(t, many)})
+	if err == nil || !strings.Contains(err.Error(), "at most 1000 are allowed") {
+		t.Errorf("Expected entry limit error, got: %v", err)
+	}
+
+	// Spaces compress to almost nothing, so the archive stays small
+	bomb := map[string]string{"bomb.proto": strings.Repeat(" ", maxProtoZipBytes+1)}
+	_, err = collectProtoSources(model.GRPCRequest{ProtoZip: zipProtos(t, bomb)})
+	if err == nil || !strings.Contains(err.Error(), "expands to more than 32 MiB") {
+		t.Errorf("Expected size limit error, got: %v", err)
+	}
+}
+
+func TestGRPCRoute_Protoset(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	// Compile the multi-file protos and export only the user files,
+	// leaving timestamp.proto to be filled in from the runtime registry
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(multiFileProtos),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), "greeter/messages.proto", "greeter/service.proto")
+	if err != nil {
+		t.Fatalf("Failed to compile test protos: %v", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range compiled {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	raw, _ := proto.Marshal(set)
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Protoset"}`,
+		Protoset:      base64.StdEncoding.EncodeToString(raw),
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+}
+
+func TestCompileProtoDescriptors_GoogleAPIImports(t *testing.T) {
+	files, err := compileProtoDescriptors(model.GRPCRequest{
+		ProtoFile: `
+syntax = "proto3";
+
+package shop;
+
+import "google/api/annotations.proto";
+import "google/rpc/status.proto";
+import "google/protobuf/empty.proto";
+
+service Orders {
+  rpc Cancel (CancelRequest) returns (google.protobuf.Empty) {
+    option (google.api.http) = { post: "/v1/orders/{id}:cancel" };
+  }
+}
+
+message CancelRequest {
+  string id = 1;
+  google.rpc.Status reason = 2;
+}
+`,
+	})
+	if err != nil {
+		t.Fatalf("Expected Google API imports to resolve, got: %v", err)
+	}
+
+	svc, err := findServiceDescriptor(files, "Orders")
+	if err != nil {
+		t.Fatalf("Expected Orders service: %v", err)
+	}
+	if svc.FullName() != "shop.Orders" {
+		t.Errorf("Expected shop.Orders, got %s", svc.FullName())
+	}
+}
+
+func TestGRPCRoute_MissingImport(t *testing.T) {
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: "localhost:50051",
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		ProtoFiles: map[string]string{
+			"greeter/service.proto": multiFileProtos["greeter/service.proto"],
+		},
+	})
+
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", code)
+	}
+	if !strings.Contains(resp.Error, "greeter/messages.proto") {
+		t.Errorf("Expected error naming the missing import, got: %s", resp.Error)
+	}
+}
+
+func TestGRPCRoute_InvalidProtoset(t *testing.T) {
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: "localhost:50051",
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Protoset:      "!!not base64!!",
+	})
+
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", code)
+	}
+	if resp.Error == "" {
+		t.Error("Expected protoset error")
+	}
+}
@@ -0,0 +1,397 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grpcHealthTimeout      = 10 * time.Second
+	grpcHealthWatch        = 5 * time.Second
+	grpcHealthMaxWatch     = 60 * time.Second
+	grpcHealthServerTarget = "(server)" // Span label for the empty service name
+)
+
+// checkGRPCHealth godoc
+// @Summary      Probe a gRPC target with the standard health service
+// @Description  Calls grpc.health.v1.Health/Check (and optionally Watch) for each service on a fresh connection.
+// @Description  Reports per-service serving status, connectivity state transitions and handshake timing, and records the probe as an Execution and span.
+// @Description  status_code is 0 when every service is SERVING, the failing RPC's code when a check errored, and UNAVAILABLE (14) otherwise
+// @Tags         gRPC
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GRPCHealthRequest true "Health probe configuration"
+// @Success      200 {object} model.GRPCHealthResponse "Probe result with tracing info"
+// @Failure      400 {object} model.GRPCHealthResponse "Invalid request body or TLS configuration"
+// @Failure      500 {object} model.GRPCHealthResponse "Failed to create the connection"
+// @Router       /grpc/health [post]
+func checkGRPCHealth(c *gin.Context) {
+	// Bind the incoming request
+	reqBody := model.GRPCHealthRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCHealthResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+	log.Println("gRPC Health Probe Received")
+
+	// Generate IDs upfront
+	requestID := reqBody.RequestID
+	executionID := uuid.New().String()
+	spanID := tracing.GenerateSpanID()
+	traceID := tracing.GenerateTraceID()
+
+	badRequest := func(msg string) {
+		c.JSON(http.StatusBadRequest, model.GRPCHealthResponse{
+			ServerAddress: reqBody.ServerAddress,
+			StatusCode:    http.StatusBadRequest,
+			Error:         msg,
+			TraceID:       traceID,
+			SpanID:        spanID,
+		})
+	}
+	if reqBody.ServerAddress == "" {
+		badRequest("server_address is required")
+		return
+	}
+	if reqBody.TimeoutMs < 0 || reqBody.WatchDurationMs < 0 {
+		badRequest("timeout_ms and watch_duration_ms must not be negative")
+		return
+	}
+	timeout := grpcHealthTimeout
+	if reqBody.TimeoutMs > 0 {
+		timeout = time.Duration(reqBody.TimeoutMs) * time.Millisecond
+	}
+	watchDuration := grpcHealthWatch
+	if reqBody.WatchDurationMs > 0 {
+		watchDuration = time.Duration(reqBody.WatchDurationMs) * time.Millisecond
+	}
+	if watchDuration > grpcHealthMaxWatch {
+		badRequest(fmt.Sprintf("watch_duration_ms must be at most %d", grpcHealthMaxWatch.Milliseconds()))
+		return
+	}
+
+	target := model.GRPCRequest{
+		ServerAddress: reqBody.ServerAddress,
+		UseTLS:        reqBody.UseTLS,
+		TLS:           reqBody.TLS,
+		Authority:     reqBody.Authority,
+	}
+	dialOpts, err := grpcDialOptions(target)
+	if err != nil {
+		badRequest(fmt.Sprintf("Invalid TLS configuration: %v", err))
+		return
+	}
+
+	// A dedicated connection, so the probe sees the whole handshake instead of a pooled READY conn
+	conn, err := grpc.NewClient(reqBody.ServerAddress, dialOpts...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.GRPCHealthResponse{
+			ServerAddress: reqBody.ServerAddress,
+			StatusCode:    http.StatusInternalServerError,
+			Error:         fmt.Sprintf("Failed to connect to gRPC server: %v", err),
+			TraceID:       traceID,
+			SpanID:        spanID,
+		})
+		return
+	}
+	defer conn.Close()
+
+	// Build outgoing metadata with the W3C traceparent
+	md := metadata.New(nil)
+	for key, value := range reqBody.Metadata {
+		md.Set(key, value)
+	}
+	md.Set("traceparent", fmt.Sprintf("00-%s-%s-01", traceID, spanID))
+	baseCtx := metadata.NewOutgoingContext(context.Background(), md)
+
+	services := reqBody.Services
+	if len(services) == 0 {
+		services = []string{""}
+	}
+
+	probe := &healthProbe{start: time.Now()}
+
+	connectCtx, cancelConnect := context.WithTimeout(baseCtx, timeout)
+	handshake := probe.trackConnectivity(connectCtx, conn)
+	cancelConnect()
+
+	// Check every service concurrently so watches share one window
+	client := healthpb.NewHealthClient(conn)
+	results := make([]model.GRPCServiceHealth, len(services))
+	var respPeer peer.Peer
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var p *peer.Peer
+			if i == 0 {
+				p = &respPeer
+			}
+			results[i] = probe.checkService(baseCtx, client, service, timeout, p)
+			if reqBody.Watch && results[i].StatusCode != int(codes.Unimplemented) {
+				probe.watchService(baseCtx, client, service, watchDuration, &results[i])
+			}
+		}()
+	}
+	wg.Wait()
+	totalDuration := time.Since(probe.start)
+
+	// Negotiated TLS details, nil for plaintext targets
+	tlsInfo := grpcTLSInfo(&respPeer, reqBody.TLS)
+
+	// Overall result: the first failed RPC, otherwise UNAVAILABLE for anything not SERVING
+	overall := codes.OK
+	errMsg := ""
+	for _, result := range results {
+		if result.StatusCode != int(codes.OK) {
+			overall, errMsg = codes.Code(result.StatusCode), result.Error
+			break
+		}
+	}
+	if overall == codes.OK {
+		for _, result := range results {
+			if result.Status != healthpb.HealthCheckResponse_SERVING.String() {
+				overall = codes.Unavailable
+				errMsg = fmt.Sprintf("service %s is %s", healthServiceLabel(result.Service), result.Status)
+				break
+			}
+		}
+	}
+
+	grpcStatus := "OK"
+	if overall != codes.OK {
+		grpcStatus = "ERROR"
+	}
+	method := "Check"
+	if reqBody.Watch {
+		method = "Check,Watch"
+	}
+	labels := make([]string, len(services))
+	for i, service := range services {
+		labels[i] = healthServiceLabel(service)
+	}
+	tags := map[string]string{
+		"grpc.service":          healthpb.Health_ServiceDesc.ServiceName,
+		"grpc.method":           method,
+		"grpc.status_code":      fmt.Sprintf("%d", int(overall)),
+		"grpc.status_name":      overall.String(),
+		"grpc.health.healthy":   fmt.Sprintf("%t", overall == codes.OK),
+		"grpc.health.services":  strings.Join(labels, ","),
+		"grpc.handshake_us":     fmt.Sprintf("%d", handshake.Microseconds()),
+		"grpc.connection_state": conn.GetState().String(),
+	}
+	addTLSTags(tags, reqBody.UseTLS, tlsInfo)
+
+	// Queue records for async DB write
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: int(overall),
+		LatencyMs:  int(totalDuration.Milliseconds()),
+	})
+
+	events := probe.sortedEvents()
+	spanRecord := store.SpanRecord{
+		ID:          uuid.New().String(),
+		TraceID:     traceID,
+		SpanID:      spanID,
+		Operation:   fmt.Sprintf("gRPC health %s", reqBody.ServerAddress),
+		ServiceName: "intercept.prism",
+		StartTime:   probe.start.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      grpcStatus,
+		Tags:        tags,
+		Events:      events,
+	}
+
+	store.AddSpan(spanRecord)
+	tracing.Hub.Publish(spanRecord)
+
+	log.Println("Queued Execution, and Span for async DB write (gRPC health)")
+
+	rootSpan := model.SpanInfo{
+		SpanID:      spanID,
+		TraceID:     traceID,
+		Operation:   spanRecord.Operation,
+		ServiceName: "intercept.prism",
+		StartTime:   probe.start.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      grpcStatus,
+		Tags:        tags,
+		Events:      events,
+	}
+
+	c.JSON(http.StatusOK, model.GRPCHealthResponse{
+		ServerAddress:     reqBody.ServerAddress,
+		Healthy:           overall == codes.OK,
+		StatusCode:        int(overall),
+		Services:          results,
+		ConnectionStates:  probe.states,
+		HandshakeDuration: fmt.Sprintf("%vms", handshake.Milliseconds()),
+		HandshakeMicros:   handshake.Microseconds(),
+		Duration:          fmt.Sprintf("%vms", totalDuration.Milliseconds()),
+		TLS:               tlsInfo,
+		Error:             errMsg,
+		RequestID:         requestID,
+		ExecutionID:       executionID,
+		TraceID:           traceID,
+		SpanID:            spanID,
+		Spans:             []model.SpanInfo{rootSpan},
+	})
+}
+
+// healthProbe collects connectivity states and span events from concurrent checks
+type healthProbe struct {
+	start  time.Time
+	mu     sync.Mutex
+	states []model.GRPCConnectionState
+	events []model.SpanEvent
+}
+
+func (p *healthProbe) event(name string, at time.Time, attrs map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, model.SpanEvent{Name: name, Timestamp: at.UnixMicro(), Attributes: attrs})
+}
+
+// sortedEvents returns the span events in time order
+func (p *healthProbe) sortedEvents() []model.SpanEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sort.SliceStable(p.events, func(i, j int) bool { return p.events[i].Timestamp < p.events[j].Timestamp })
+	return p.events
+}
+
+// trackConnectivity connects and records every state until the connection is READY or fails.
+// Returns the time until READY, zero if it never got there
+func (p *healthProbe) trackConnectivity(ctx context.Context, conn *grpc.ClientConn) time.Duration {
+	record := func(state connectivity.State) {
+		now := time.Now()
+		p.states = append(p.states, model.GRPCConnectionState{
+			State:   strings.ToUpper(state.String()),
+			Elapsed: now.Sub(p.start).Microseconds(),
+		})
+		p.event("connectivity", now, map[string]string{"state": strings.ToUpper(state.String())})
+	}
+
+	state := conn.GetState()
+	record(state)
+	conn.Connect()
+	for {
+		switch state {
+		case connectivity.Ready:
+			return time.Since(p.start)
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return 0
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return 0
+		}
+		state = conn.GetState()
+		record(state)
+	}
+}
+
+// checkService calls Health/Check for one service
+func (p *healthProbe) checkService(ctx context.Context, client healthpb.HealthClient, service string, timeout time.Duration, respPeer *peer.Peer) model.GRPCServiceHealth {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := []grpc.CallOption{}
+	if respPeer != nil {
+		opts = append(opts, grpc.Peer(respPeer))
+	}
+
+	start := time.Now()
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service}, opts...)
+	end := time.Now()
+
+	result := model.GRPCServiceHealth{
+		Service:  service,
+		Status:   healthpb.HealthCheckResponse_UNKNOWN.String(),
+		Duration: fmt.Sprintf("%vms", end.Sub(start).Milliseconds()),
+	}
+	if err != nil {
+		st, _ := status.FromError(err)
+		result.StatusCode = int(st.Code())
+		result.Error = st.Message()
+		// NOT_FOUND is how the standard server reports an unregistered service
+		if st.Code() == codes.NotFound {
+			result.Status = healthpb.HealthCheckResponse_SERVICE_UNKNOWN.String()
+		}
+	} else {
+		result.Status = resp.GetStatus().String()
+	}
+
+	p.event("health.check", end, map[string]string{
+		"service":          healthServiceLabel(service),
+		"status":           result.Status,
+		"grpc.status_code": fmt.Sprintf("%d", result.StatusCode),
+	})
+	return result
+}
+
+// watchService streams Health/Watch for the given window and records each update.
+// The watch ending because the window elapsed is the normal outcome, not an error
+func (p *healthProbe) watchService(ctx context.Context, client healthpb.HealthClient, service string, window time.Duration, result *model.GRPCServiceHealth) {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: service})
+	for err == nil {
+		var resp *healthpb.HealthCheckResponse
+		resp, err = stream.Recv()
+		if err != nil {
+			break
+		}
+		now := time.Now()
+		result.Updates = append(result.Updates, model.GRPCHealthUpdate{
+			Status:  resp.GetStatus().String(),
+			Elapsed: now.Sub(p.start).Microseconds(),
+		})
+		p.event("health.update", now, map[string]string{
+			"service": healthServiceLabel(service),
+			"status":  resp.GetStatus().String(),
+		})
+	}
+
+	if ctx.Err() == nil || status.Code(err) != codes.DeadlineExceeded {
+		result.WatchError = status.Convert(err).Message()
+	}
+	// The latest watched status is the current one
+	if len(result.Updates) > 0 {
+		result.Status = result.Updates[len(result.Updates)-1].Status
+	}
+}
+
+// healthServiceLabel names the empty service, which stands for the whole server
+func healthServiceLabel(service string) string {
+	if service == "" {
+		return grpcHealthServerTarget
+	}
+	return service
+}
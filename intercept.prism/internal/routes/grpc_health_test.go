@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startHealthGRPCServer serves the standard health service with "billing" SERVING and "search" NOT_SERVING
+func startHealthGRPCServer(t *testing.T) (string, *health.Server, func()) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("billing", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("search", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("Test gRPC health server stopped: %v", err)
+		}
+	}()
+
+	return lis.Addr().String(), healthServer, func() {
+		s.Stop()
+		lis.Close()
+	}
+}
+
+func TestGRPCHealth_ServerServing(t *testing.T) {
+	addr, _, cleanup := startHealthGRPCServer(t)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", model.GRPCHealthRequest{ServerAddress: addr})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, resp.Error)
+	}
+	if !resp.Healthy || resp.StatusCode != 0 {
+		t.Errorf("Expected healthy server, got %+v", resp)
+	}
+	if len(resp.Services) != 1 || resp.Services[0].Status != "SERVING" {
+		t.Errorf("Expected overall server SERVING, got %+v", resp.Services)
+	}
+
+	last := resp.ConnectionStates[len(resp.ConnectionStates)-1]
+	if last.State != "READY" || resp.HandshakeMicros <= 0 {
+		t.Errorf("Expected READY with handshake timing, got %+v / %d", resp.ConnectionStates, resp.HandshakeMicros)
+	}
+
+	span := resp.Spans[0]
+	if span.Tags["grpc.health.healthy"] != "true" || span.Tags["grpc.service"] != "grpc.health.v1.Health" {
+		t.Errorf("Unexpected span tags: %v", span.Tags)
+	}
+	if len(span.Events) == 0 || span.Events[0].Name != "connectivity" {
+		t.Errorf("Expected connectivity events on the span, got %+v", span.Events)
+	}
+}
+
+func TestGRPCHealth_PerServiceStatus(t *testing.T) {
+	addr, _, cleanup := startHealthGRPCServer(t)
+	defer cleanup()
+
+	_, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", model.GRPCHealthRequest{
+		ServerAddress: addr,
+		Services:      []string{"billing", "search", "unknown"},
+	})
+
+	statuses := map[string]model.GRPCServiceHealth{}
+	for _, s := range resp.Services {
+		statuses[s.Service] = s
+	}
+	if statuses["billing"].Status != "SERVING" || statuses["search"].Status != "NOT_SERVING" {
+		t.Errorf("Unexpected statuses: %+v", resp.Services)
+	}
+	if statuses["unknown"].Status != "SERVICE_UNKNOWN" || statuses["unknown"].StatusCode != int(codes.NotFound) {
+		t.Errorf("Expected unknown service reported as SERVICE_UNKNOWN, got %+v", statuses["unknown"])
+	}
+	if resp.Healthy || resp.StatusCode != int(codes.NotFound) {
+		t.Errorf("Expected failed check to decide the status, got %t / %d", resp.Healthy, resp.StatusCode)
+	}
+	if resp.Spans[0].Status != "ERROR" {
+		t.Errorf("Expected ERROR span, got %s", resp.Spans[0].Status)
+	}
+}
+
+func TestGRPCHealth_NotServingIsUnavailable(t *testing.T) {
+	addr, _, cleanup := startHealthGRPCServer(t)
+	defer cleanup()
+
+	_, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", model.GRPCHealthRequest{
+		ServerAddress: addr,
+		Services:      []string{"billing", "search"},
+	})
+	if resp.Healthy || resp.StatusCode != int(codes.Unavailable) {
+		t.Errorf("Expected UNAVAILABLE for a NOT_SERVING service, got %t / %d", resp.Healthy, resp.StatusCode)
+	}
+}
+
+func TestGRPCHealth_Watch(t *testing.T) {
+	addr, healthServer, cleanup := startHealthGRPCServer(t)
+	defer cleanup()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		healthServer.SetServingStatus("billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	}()
+
+	_, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", model.GRPCHealthRequest{
+		ServerAddress:   addr,
+		Services:        []string{"billing"},
+		Watch:           true,
+		WatchDurationMs: 400,
+	})
+
+	billing := resp.Services[0]
+	if len(billing.Updates) != 2 || billing.Updates[1].Status != "NOT_SERVING" {
+		t.Fatalf("Expected SERVING then NOT_SERVING updates, got %+v", billing.Updates)
+	}
+	if billing.WatchError != "" {
+		t.Errorf("Expected the watch window to end cleanly, got %q", billing.WatchError)
+	}
+	if billing.Status != "NOT_SERVING" || resp.Healthy {
+		t.Errorf("Expected the latest watched status to count, got %s / %t", billing.Status, resp.Healthy)
+	}
+}
+
+func TestGRPCHealth_Unreachable(t *testing.T) {
+	// Reserve a port and close it so nothing is listening
+	lis, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := lis.Addr().String()
+	lis.Close()
+
+	_, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", model.GRPCHealthRequest{ServerAddress: addr, TimeoutMs: 2000})
+	if resp.Healthy || resp.StatusCode != int(codes.Unavailable) {
+		t.Errorf("Expected UNAVAILABLE, got %t / %d: %s", resp.Healthy, resp.StatusCode, resp.Error)
+	}
+	if resp.HandshakeMicros != 0 {
+		t.Errorf("Expected no handshake time for a failed connection, got %d", resp.HandshakeMicros)
+	}
+	last := resp.ConnectionStates[len(resp.ConnectionStates)-1]
+	if last.State != "TRANSIENT_FAILURE" {
+		t.Errorf("Expected TRANSIENT_FAILURE, got %+v", resp.ConnectionStates)
+	}
+}
+
+func TestGRPCHealth_InvalidRequest(t *testing.T) {
+	for name, reqBody := range map[string]model.GRPCHealthRequest{
+		"address": {},
+		"watch":   {ServerAddress: "localhost:50051", WatchDurationMs: 120000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCHealthResponse](t, setupGRPCRouter(), "/grpc/health", reqBody)
+			if code != http.StatusBadRequest || resp.Error == "" {
+				t.Errorf("Expected 400 with error, got %d: %+v", code, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// httpBinding is one google.api.http rule of a method with its parsed path template
+type httpBinding struct {
+	method       string
+	template     *pathTemplate
+	body         string // "", "*" or a top-level field name
+	responseBody string
+	index        int // 0 for the main rule, n for additional_bindings[n-1]
+}
+
+// rule describes the binding for the response
+func (b *httpBinding) rule() *model.GRPCHTTPRule {
+	return &model.GRPCHTTPRule{
+		Method:       b.method,
+		Path:         b.template.raw,
+		Body:         b.body,
+		ResponseBody: b.responseBody,
+		Binding:      b.index,
+	}
+}
+
+// methodHTTPBindings returns the google.api.http rule of a method followed by its additional bindings.
+// Options compiled from source or received via reflection keep the extension as unknown fields,
+// so they are re-parsed against the registered annotations
+func methodHTTPBindings(md protoreflect.MethodDescriptor) ([]*httpBinding, error) {
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil {
+		return nil, nil
+	}
+	raw, err := proto.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &descriptorpb.MethodOptions{}
+	if err := (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(raw, parsed); err != nil {
+		return nil, err
+	}
+	rule, ok := proto.GetExtension(parsed, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil || rule.GetPattern() == nil {
+		return nil, nil
+	}
+
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	bindings := make([]*httpBinding, 0, len(rules))
+	for i, r := range rules {
+		method, path := httpRulePattern(r)
+		template, err := parsePathTemplate(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path template '%s' on %s: %v", path, md.FullName(), err)
+		}
+		bindings = append(bindings, &httpBinding{
+			method:       method,
+			template:     template,
+			body:         r.GetBody(),
+			responseBody: r.GetResponseBody(),
+			index:        i,
+		})
+	}
+	return bindings, nil
+}
+
+// httpRulePattern returns the HTTP method and path template of a rule
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", pattern.Get
+	case *annotations.HttpRule_Put:
+		return "PUT", pattern.Put
+	case *annotations.HttpRule_Post:
+		return "POST", pattern.Post
+	case *annotations.HttpRule_Delete:
+		return "DELETE", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// pathTemplate is a parsed google.api.http path template such as /v1/{name=shelves/*/books/*}:publish
+type pathTemplate struct {
+	raw      string
+	segments []templateSegment
+	verb     string
+	regexp   *regexp.Regexp // Matches an escaped request path, one group per variable
+}
+
+// templateSegment is a literal, a bare wildcard or a variable bound to a field path
+type templateSegment struct {
+	literal string
+	field   string         // Dotted proto field path, set for variables
+	pattern *regexp.Regexp // Values the variable accepts, set for variables
+	multi   bool           // The variable spans several path segments, so '/' is kept unescaped
+	expr    string         // Regular expression for the segment
+}
+
+// parsePathTemplate parses the path syntax of google/api/http.proto
+func parsePathTemplate(raw string) (*pathTemplate, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("template must start with '/'")
+	}
+	t := &pathTemplate{raw: raw}
+
+	rest := raw[1:]
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") && i > strings.LastIndex(rest, "}") {
+		t.verb = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	parts, err := splitTemplate(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		segment := templateSegment{literal: part, expr: regexp.QuoteMeta(part)}
+		switch {
+		case strings.HasPrefix(part, "{"):
+			inner := part[1 : len(part)-1]
+			field, pattern, found := strings.Cut(inner, "=")
+			if !found {
+				pattern = "*"
+			}
+			if field == "" {
+				return nil, fmt.Errorf("variable without a field in '%s'", part)
+			}
+			patternExpr := wildcardExpr(pattern)
+			segment = templateSegment{
+				field:   field,
+				pattern: regexp.MustCompile("^" + patternExpr + "$"),
+				multi:   strings.Contains(pattern, "/") || pattern == "**",
+				expr:    "(" + patternExpr + ")",
+			}
+		case part == "*" || part == "**":
+			segment = templateSegment{literal: part, expr: wildcardExpr(part)}
+		case part == "":
+			return nil, fmt.Errorf("empty path segment")
+		}
+		t.segments = append(t.segments, segment)
+		exprs = append(exprs, segment.expr)
+	}
+
+	expr := "^/" + strings.Join(exprs, "/")
+	if t.verb != "" {
+		expr += ":" + regexp.QuoteMeta(t.verb)
+	}
+	t.regexp, err = regexp.Compile(expr + "$")
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitTemplate splits a template on '/' outside of variables
+func splitTemplate(s string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced '}'")
+			}
+		case '/':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced '{'")
+	}
+	return append(parts, s[start:]), nil
+}
+
+// wildcardExpr converts a segment pattern like shelves/*/books/* into a regular expression
+func wildcardExpr(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		switch part {
+		case "*":
+			parts[i] = `[^/]+`
+		case "**":
+			parts[i] = `.+`
+		default:
+			parts[i] = regexp.QuoteMeta(part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// literals counts the literal segments, so the most specific template wins when several match
+func (t *pathTemplate) literals() int {
+	count := 0
+	for _, segment := range t.segments {
+		if segment.field == "" && segment.literal != "*" && segment.literal != "**" {
+			count++
+		}
+	}
+	return count
+}
+
+// fields returns the field paths bound by the template
+func (t *pathTemplate) fields() []string {
+	var fields []string
+	for _, segment := range t.segments {
+		if segment.field != "" {
+			fields = append(fields, segment.field)
+		}
+	}
+	return fields
+}
+
+// match returns the unescaped variable values of an escaped request path
+func (t *pathTemplate) match(escapedPath string) (map[string]string, bool) {
+	groups := t.regexp.FindStringSubmatch(escapedPath)
+	if groups == nil {
+		return nil, false
+	}
+	values := map[string]string{}
+	group := 1
+	for _, segment := range t.segments {
+		if segment.field == "" {
+			continue
+		}
+		value, err := url.PathUnescape(groups[group])
+		if err != nil {
+			return nil, false
+		}
+		values[segment.field] = value
+		group++
+	}
+	return values, true
+}
+
+// expand fills the template's variables from the message
+func (t *pathTemplate) expand(msg protoreflect.Message) (string, error) {
+	var b strings.Builder
+	for _, segment := range t.segments {
+		b.WriteByte('/')
+		if segment.field == "" {
+			if segment.literal == "*" || segment.literal == "**" {
+				return "", fmt.Errorf("wildcard '%s' outside a variable cannot be filled from the message", segment.literal)
+			}
+			b.WriteString(segment.literal)
+			continue
+		}
+
+		value, err := fieldPathValue(msg, segment.field)
+		if err != nil {
+			return "", err
+		}
+		if value == "" {
+			return "", fmt.Errorf("path variable %s is empty", segment.field)
+		}
+		if !segment.multi {
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+		// Multi-segment values keep their slashes, so they have to fit the pattern as is
+		if !segment.pattern.MatchString(value) {
+			return "", fmt.Errorf("value '%s' of %s does not match the template pattern", value, segment.field)
+		}
+		parts := strings.Split(value, "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		b.WriteString(strings.Join(parts, "/"))
+	}
+	if t.verb != "" {
+		b.WriteString(":" + t.verb)
+	}
+	return b.String(), nil
+}
+
+// buildHTTPRequest maps a request message onto the binding: template variables go in the path,
+// the body field (or everything else for "*") in the JSON body and the remaining fields in the query
+func buildHTTPRequest(binding *httpBinding, msg protoreflect.Message) (*model.GRPCTranscodeHTTPRequest, error) {
+	path, err := binding.template.expand(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{}
+	for _, field := range binding.template.fields() {
+		skip[field] = true
+	}
+
+	req := &model.GRPCTranscodeHTTPRequest{Method: binding.method, Path: path}
+	switch binding.body {
+	case "":
+	case "*":
+		body := msg.Interface()
+		body = proto.Clone(body)
+		for field := range skip {
+			clearFieldPath(body.ProtoReflect(), field)
+		}
+		raw, err := protojson.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = string(raw)
+		// Every field not bound by the path is in the body
+		return req, nil
+	default:
+		raw, err := marshalBodyField(msg, binding.body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = raw
+		skip[binding.body] = true
+	}
+
+	query := url.Values{}
+	if err := appendQuery(query, msg, "", skip); err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		req.Path += "?" + query.Encode()
+	}
+	return req, nil
+}
+
+// marshalBodyField returns the JSON of a single top-level field
+func marshalBodyField(msg protoreflect.Message, name string) (string, error) {
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return "", fmt.Errorf("body field '%s' not found in %s", name, msg.Descriptor().FullName())
+	}
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+		raw, err := protojson.Marshal(msg.Get(fd).Message().Interface())
+		return string(raw), err
+	}
+
+	only := msg.Type().New()
+	only.Set(fd, msg.Get(fd))
+	raw, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(only.Interface())
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return "", err
+	}
+	return string(fields[fd.JSONName()]), nil
+}
+
+// appendQuery adds every populated field that is not skipped as a query parameter, nesting with dots
+func appendQuery(query url.Values, msg protoreflect.Message, prefix string, skip map[string]bool) error {
+	var err error
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := prefix + string(fd.Name())
+		if skip[path] {
+			return true
+		}
+		switch {
+		case fd.IsMap():
+			err = fmt.Errorf("map field %s cannot be sent as a query parameter", path)
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				var value string
+				if value, err = formatScalar(fd, list.Get(i)); err == nil {
+					query.Add(path, value)
+				}
+			}
+		case fd.Message() != nil && !isScalarWellKnown(fd.Message()):
+			err = appendQuery(query, v.Message(), path+".", skip)
+		default:
+			var value string
+			if value, err = formatScalar(fd, v); err == nil {
+				query.Add(path, value)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// parseHTTPRequest builds the request message of a binding from the body, path variables and query string
+func parseHTTPRequest(binding *httpBinding, md protoreflect.MessageDescriptor, vars map[string]string, query url.Values, body string) (protoreflect.Message, error) {
+	msg := dynamicpb.NewMessage(md)
+
+	if strings.TrimSpace(body) != "" {
+		switch binding.body {
+		case "":
+		case "*":
+			if err := protojson.Unmarshal([]byte(body), msg.Interface()); err != nil {
+				return nil, fmt.Errorf("invalid request body: %v", err)
+			}
+		default:
+			fd := md.Fields().ByName(protoreflect.Name(binding.body))
+			if fd == nil {
+				return nil, fmt.Errorf("body field '%s' not found in %s", binding.body, md.FullName())
+			}
+			key, _ := json.Marshal(fd.JSONName())
+			wrapped := fmt.Sprintf("{%s:%s}", key, body)
+			if err := protojson.Unmarshal([]byte(wrapped), msg.Interface()); err != nil {
+				return nil, fmt.Errorf("invalid request body: %v", err)
+			}
+		}
+	}
+
+	for field, value := range vars {
+		if err := setFieldPath(msg, field, value); err != nil {
+			return nil, err
+		}
+	}
+	if binding.body != "*" {
+		for key, values := range query {
+			for _, value := range values {
+				if err := setFieldPath(msg, key, value); err != nil {
+					return nil, fmt.Errorf("query parameter %s: %v", key, err)
+				}
+			}
+		}
+	}
+	return msg, nil
+}
+
+// lookupField finds a field by proto or JSON name, as grpc-gateway does for query parameters
+func lookupField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByJSONName(name)
+}
+
+// fieldPathValue returns the string form of the singular field at a dotted path
+func fieldPathValue(msg protoreflect.Message, path string) (string, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := lookupField(msg.Descriptor(), name)
+		if fd == nil {
+			return "", fmt.Errorf("field '%s' not found in %s", path, msg.Descriptor().FullName())
+		}
+		if fd.IsList() || fd.IsMap() {
+			return "", fmt.Errorf("repeated field %s cannot be bound to the path", path)
+		}
+		if i == len(names)-1 {
+			return formatScalar(fd, msg.Get(fd))
+		}
+		if fd.Message() == nil {
+			return "", fmt.Errorf("field %s in '%s' is not a message", name, path)
+		}
+		msg = msg.Get(fd).Message()
+	}
+	return "", fmt.Errorf("empty field path")
+}
+
+// setFieldPath parses a path or query value into the field at a dotted path, appending to repeated fields
+func setFieldPath(msg protoreflect.Message, path, value string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := lookupField(msg.Descriptor(), name)
+		if fd == nil {
+			return fmt.Errorf("field '%s' not found in %s", path, msg.Descriptor().FullName())
+		}
+		if fd.IsMap() {
+			return fmt.Errorf("map field %s cannot be set from a string", path)
+		}
+		if i < len(names)-1 {
+			if fd.Message() == nil || fd.IsList() {
+				return fmt.Errorf("field %s in '%s' is not a message", name, path)
+			}
+			msg = msg.Mutable(fd).Message()
+			continue
+		}
+
+		v, err := parseScalar(msg, fd, value)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for %s: %v", value, path, err)
+		}
+		if fd.IsList() {
+			msg.Mutable(fd).List().Append(v)
+		} else {
+			msg.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+// clearFieldPath clears the field at a dotted path if its parents are set
+func clearFieldPath(msg protoreflect.Message, path string) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := lookupField(msg.Descriptor(), name)
+		if fd == nil {
+			return
+		}
+		if i == len(names)-1 {
+			msg.Clear(fd)
+			return
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() || !msg.Has(fd) {
+			return
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+}
+
+// formatScalar returns the string form of a singular value the way grpc-gateway parses it
+func formatScalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) (string, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool()), nil
+	case protoreflect.StringKind:
+		return v.String(), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name()), nil
+		}
+		return strconv.Itoa(int(v.Enum())), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if !isScalarWellKnown(fd.Message()) {
+			return "", fmt.Errorf("message field %s cannot be used as a path or query parameter", fd.FullName())
+		}
+		raw, err := protojson.Marshal(v.Message().Interface())
+		if err != nil {
+			return "", err
+		}
+		// Timestamps, durations and field masks are JSON strings, wrappers may be bare numbers or bools
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s, nil
+		}
+		return string(raw), nil
+	default:
+		return fmt.Sprint(v.Interface()), nil
+	}
+}
+
+// parseScalar parses a path or query value for a field of msg
+func parseScalar(msg protoreflect.Message, fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(s); err == nil {
+				return protoreflect.ValueOfBytes(b), nil
+			}
+		}
+		return protoreflect.Value{}, fmt.Errorf("not valid base64")
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByName(protoreflect.Name(s)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+			return protoreflect.Value{}, fmt.Errorf("unknown value of %s", fd.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if !isScalarWellKnown(fd.Message()) {
+			return protoreflect.Value{}, fmt.Errorf("message fields cannot be set from a string")
+		}
+		var value protoreflect.Value
+		if fd.IsList() {
+			value = msg.Mutable(fd).List().NewElement()
+		} else {
+			value = msg.NewField(fd)
+		}
+		// Try the value as a JSON string first, then bare for numeric and bool wrappers
+		quoted, _ := json.Marshal(s)
+		if err := protojson.Unmarshal(quoted, value.Message().Interface()); err != nil {
+			if err := protojson.Unmarshal([]byte(s), value.Message().Interface()); err != nil {
+				return protoreflect.Value{}, err
+			}
+		}
+		return value, nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
+
+// isScalarWellKnown reports whether a message type has a string or scalar JSON form
+func isScalarWellKnown(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
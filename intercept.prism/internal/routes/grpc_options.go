@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	// Register the gzip compressor for grpc.UseCompressor
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+)
+
+// grpcCallOptions is the validated form of model.GRPCCallOptions
+type grpcCallOptions struct {
+	deadline     time.Duration // Zero means the handler default
+	compression  string        // Empty for identity
+	maxSend      int
+	maxRecv      int
+	waitForReady bool
+	userAgent    string
+}
+
+// parseGRPCCallOptions validates the per-call options of a request
+func parseGRPCCallOptions(opts *model.GRPCCallOptions) (grpcCallOptions, error) {
+	if opts == nil {
+		return grpcCallOptions{}, nil
+	}
+	if opts.DeadlineMs < 0 {
+		return grpcCallOptions{}, fmt.Errorf("deadline_ms must not be negative")
+	}
+	if opts.MaxSendMessageSize < 0 || opts.MaxRecvMessageSize < 0 {
+		return grpcCallOptions{}, fmt.Errorf("max message sizes must not be negative")
+	}
+
+	parsed := grpcCallOptions{
+		deadline:     time.Duration(opts.DeadlineMs) * time.Millisecond,
+		maxSend:      opts.MaxSendMessageSize,
+		maxRecv:      opts.MaxRecvMessageSize,
+		waitForReady: opts.WaitForReady,
+		userAgent:    opts.UserAgent,
+	}
+	switch opts.Compression {
+	case "", "identity":
+	case grpcgzip.Name:
+		parsed.compression = grpcgzip.Name
+	default:
+		return grpcCallOptions{}, fmt.Errorf("unsupported compression '%s', expected gzip or identity", opts.Compression)
+	}
+	return parsed, nil
+}
+
+// timeout returns the configured deadline, or def when none was set
+func (o grpcCallOptions) timeout(def time.Duration) time.Duration {
+	if o.deadline > 0 {
+		return o.deadline
+	}
+	return def
+}
+
+// callOptions converts the settings into grpc-go call options
+func (o grpcCallOptions) callOptions() []grpc.CallOption {
+	opts := []grpc.CallOption{grpc.WaitForReady(o.waitForReady)}
+	if o.compression != "" {
+		opts = append(opts, grpc.UseCompressor(o.compression))
+	}
+	if o.maxSend > 0 {
+		opts = append(opts, grpc.MaxCallSendMsgSize(o.maxSend))
+	}
+	if o.maxRecv > 0 {
+		opts = append(opts, grpc.MaxCallRecvMsgSize(o.maxRecv))
+	}
+	return opts
+}
+
+// addTags records the effective call settings on the span
+func (o grpcCallOptions) addTags(tags map[string]string, timeout time.Duration) {
+	tags["grpc.deadline_ms"] = fmt.Sprintf("%d", timeout.Milliseconds())
+	tags["grpc.wait_for_ready"] = fmt.Sprintf("%t", o.waitForReady)
+	tags["grpc.compression"] = "identity"
+	if o.compression != "" {
+		tags["grpc.compression"] = o.compression
+	}
+	if o.maxSend > 0 {
+		tags["grpc.max_send_message_size"] = fmt.Sprintf("%d", o.maxSend)
+	}
+	if o.maxRecv > 0 {
+		tags["grpc.max_recv_message_size"] = fmt.Sprintf("%d", o.maxRecv)
+	}
+	if o.userAgent != "" {
+		tags["grpc.user_agent"] = o.userAgent
+	}
+}
+
+// checkSendSize applies max_send_message_size for the HTTP based protocols, mirroring grpc-go's error
+func (o grpcCallOptions) checkSendSize(size int) error {
+	if o.maxSend > 0 && size > o.maxSend {
+		return status.Errorf(codes.ResourceExhausted, "trying to send message larger than max (%d vs. %d)", size, o.maxSend)
+	}
+	return nil
+}
+
+// checkRecvSize applies max_recv_message_size for the HTTP based protocols, mirroring grpc-go's error
+func (o grpcCallOptions) checkRecvSize(size int) error {
+	if o.maxRecv > 0 && size > o.maxRecv {
+		return status.Errorf(codes.ResourceExhausted, "grpc: received message larger than max (%d vs. %d)", size, o.maxRecv)
+	}
+	return nil
+}
+
+// gzipBytes compresses a message for the HTTP based protocols
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// gunzipBytes decompresses a gzip encoded message
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,226 @@
+package routes
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// callRecorder captures what the test server saw for the last call
+type callRecorder struct {
+	mu        sync.Mutex
+	deadline  time.Duration
+	userAgent string
+}
+
+// recordingInterceptor stores the remaining deadline and user agent, and sleeps when asked to via x-sleep-ms
+func (r *callRecorder) interceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.mu.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		r.deadline = time.Until(deadline)
+	}
+	if ua := md.Get("user-agent"); len(ua) > 0 {
+		r.userAgent = ua[0]
+	}
+	r.mu.Unlock()
+
+	if sleep := md.Get("x-sleep-ms"); len(sleep) > 0 {
+		d, _ := time.ParseDuration(sleep[0] + "ms")
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return handler(ctx, req)
+}
+
+func TestGRPCRoute_CallOptions(t *testing.T) {
+	recorder := &callRecorder{}
+	addr, cleanup := startTestGRPCServerWithOptions(t, grpc.UnaryInterceptor(recorder.interceptor))
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Options"}`,
+		ProtoFile:     testProto,
+		Options: &model.GRPCCallOptions{
+			DeadlineMs:         2000,
+			Compression:        "gzip",
+			MaxSendMessageSize: 1024,
+			MaxRecvMessageSize: 1024,
+			WaitForReady:       true,
+			UserAgent:          "billing-service/2.3",
+		},
+	})
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+
+	recorder.mu.Lock()
+	if recorder.deadline <= 0 || recorder.deadline > 2*time.Second {
+		t.Errorf("Expected a deadline of at most 2s at the server, got %v", recorder.deadline)
+	}
+	if !strings.HasPrefix(recorder.userAgent, "billing-service/2.3 grpc-go/") {
+		t.Errorf("Expected custom user agent, got %q", recorder.userAgent)
+	}
+	recorder.mu.Unlock()
+
+	tags := resp.Spans[0].Tags
+	expected := map[string]string{
+		"grpc.deadline_ms":           "2000",
+		"grpc.compression":           "gzip",
+		"grpc.max_send_message_size": "1024",
+		"grpc.max_recv_message_size": "1024",
+		"grpc.wait_for_ready":        "true",
+		"grpc.user_agent":            "billing-service/2.3",
+	}
+	for key, value := range expected {
+		if tags[key] != value {
+			t.Errorf("Expected tag %s=%q, got %q", key, value, tags[key])
+		}
+	}
+}
+
+func TestGRPCRoute_DefaultCallOptionTags(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Defaults"}`,
+		ProtoFile:     testProto,
+	})
+	tags := resp.Spans[0].Tags
+	if tags["grpc.deadline_ms"] != "30000" || tags["grpc.compression"] != "identity" || tags["grpc.wait_for_ready"] != "false" {
+		t.Errorf("Unexpected default option tags: %v", tags)
+	}
+}
+
+func TestGRPCRoute_DeadlineExceeded(t *testing.T) {
+	recorder := &callRecorder{}
+	addr, cleanup := startTestGRPCServerWithOptions(t, grpc.UnaryInterceptor(recorder.interceptor))
+	defer cleanup()
+
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Slow"}`,
+		ProtoFile:     testProto,
+		Metadata:      map[string]string{"x-sleep-ms": "2000"},
+		Options:       &model.GRPCCallOptions{DeadlineMs: 100},
+	})
+	if resp.StatusCode != int(codes.DeadlineExceeded) {
+		t.Errorf("Expected DEADLINE_EXCEEDED, got %d: %s", resp.StatusCode, resp.Error)
+	}
+}
+
+func TestGRPCRoute_MessageSizeLimits(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	for name, opts := range map[string]*model.GRPCCallOptions{
+		"send": {MaxSendMessageSize: 4},
+		"recv": {MaxRecvMessageSize: 4},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: addr,
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				Body:          `{"name": "A name longer than four bytes"}`,
+				ProtoFile:     testProto,
+				Options:       opts,
+			})
+			if resp.StatusCode != int(codes.ResourceExhausted) {
+				t.Errorf("Expected RESOURCE_EXHAUSTED, got %d: %s", resp.StatusCode, resp.Error)
+			}
+		})
+	}
+}
+
+func TestGRPCRoute_InvalidCallOptions(t *testing.T) {
+	for name, opts := range map[string]*model.GRPCCallOptions{
+		"compression": {Compression: "brotli"},
+		"deadline":    {DeadlineMs: -1},
+		"size":        {MaxRecvMessageSize: -5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: "localhost:50051",
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				ProtoFile:     testProto,
+				Options:       opts,
+			})
+			if code != http.StatusBadRequest || !strings.Contains(resp.Error, "Invalid call options") {
+				t.Errorf("Expected 400 for invalid options, got %d: %s", code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestGRPCRoute_ConnectGzipAndUserAgent(t *testing.T) {
+	methodDesc, err := parseTestProto()
+	if err != nil {
+		t.Fatalf("Failed to parse test proto: %v", err)
+	}
+
+	var gotUserAgent, gotEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.Header.Get("User-Agent")
+		gotEncoding = r.Header.Get("Content-Encoding")
+
+		raw, _ := io.ReadAll(r.Body)
+		if gotEncoding == "gzip" {
+			raw, _ = gunzipBytes(raw)
+		}
+		reqMsg := dynamicpb.NewMessage(methodDesc.Input())
+		proto.Unmarshal(raw, reqMsg)
+
+		respMsg := dynamicpb.NewMessage(methodDesc.Output())
+		respMsg.Set(methodDesc.Output().Fields().ByName("message"),
+			protoreflect.ValueOfString("Hello, "+reqMsg.Get(methodDesc.Input().Fields().ByName("name")).String()+"!"))
+		payload, _ := proto.Marshal(respMsg)
+
+		w.Header().Set("Content-Type", "application/proto")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipBytes(payload))
+	}))
+	defer server.Close()
+
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: server.URL,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Zipped"}`,
+		ProtoFile:     testProto,
+		Protocol:      grpcProtocolConnect,
+		Options:       &model.GRPCCallOptions{Compression: "gzip", UserAgent: "web-checkout/1.0"},
+	})
+	if resp.StatusCode != 0 || !strings.Contains(resp.Body, "Hello, Zipped!") {
+		t.Fatalf("Expected decompressed success, got %d: %s %s", resp.StatusCode, resp.Error, resp.Body)
+	}
+	if gotEncoding != "gzip" || gotUserAgent != "web-checkout/1.0" {
+		t.Errorf("Expected gzip request with custom user agent, got %q / %q", gotEncoding, gotUserAgent)
+	}
+}
@@ -0,0 +1,422 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// errDescriptorNotFound marks lookups that failed because the target does not expose
+// the requested symbol, as opposed to transport or protocol failures
+var errDescriptorNotFound = errors.New("descriptor not found")
+
+// errDescriptorAmbiguous marks a bare service name that more than one package exports
+var errDescriptorAmbiguous = errors.New("ambiguous service name")
+
+// reflectionClient talks to a target's gRPC server reflection service.
+// It uses the v1 API and falls back to v1alpha for servers that predate it
+type reflectionClient struct {
+	conn   *grpc.ClientConn
+	ctx    context.Context
+	v1     grpc.BidiStreamingClient[reflectionv1.ServerReflectionRequest, reflectionv1.ServerReflectionResponse]
+	alpha  grpc.BidiStreamingClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse]
+	cancel context.CancelFunc
+}
+
+func newReflectionClient(ctx context.Context, conn *grpc.ClientConn) *reflectionClient {
+	ctx, cancel := context.WithCancel(ctx)
+	return &reflectionClient{conn: conn, ctx: ctx, cancel: cancel}
+}
+
+// Close ends the reflection stream
+func (r *reflectionClient) Close() {
+	r.cancel()
+}
+
+// roundTrip sends a single reflection request and waits for its response
+func (r *reflectionClient) roundTrip(req *reflectionv1.ServerReflectionRequest) (*reflectionv1.ServerReflectionResponse, error) {
+	if r.alpha == nil {
+		resp, err := r.roundTripV1(req)
+		if status.Code(err) != codes.Unimplemented {
+			return resp, err
+		}
+		// Server only knows the older API, switch over for the rest of the session
+		r.alpha, err = reflectionv1alpha.NewServerReflectionClient(r.conn).ServerReflectionInfo(r.ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.roundTripV1Alpha(req)
+}
+
+func (r *reflectionClient) roundTripV1(req *reflectionv1.ServerReflectionRequest) (*reflectionv1.ServerReflectionResponse, error) {
+	if r.v1 == nil {
+		stream, err := reflectionv1.NewServerReflectionClient(r.conn).ServerReflectionInfo(r.ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.v1 = stream
+	}
+	if err := r.v1.Send(req); err != nil {
+		// The real error surfaces on Recv
+		if _, recvErr := r.v1.Recv(); recvErr != nil {
+			return nil, recvErr
+		}
+		return nil, err
+	}
+	return r.v1.Recv()
+}
+
+// roundTripV1Alpha converts through the wire format, the v1alpha messages are identical to v1
+func (r *reflectionClient) roundTripV1Alpha(req *reflectionv1.ServerReflectionRequest) (*reflectionv1.ServerReflectionResponse, error) {
+	alphaReq := &reflectionv1alpha.ServerReflectionRequest{}
+	if err := convertMessage(req, alphaReq); err != nil {
+		return nil, err
+	}
+	if err := r.alpha.Send(alphaReq); err != nil {
+		if _, recvErr := r.alpha.Recv(); recvErr != nil {
+			return nil, recvErr
+		}
+		return nil, err
+	}
+	alphaResp, err := r.alpha.Recv()
+	if err != nil {
+		return nil, err
+	}
+	resp := &reflectionv1.ServerReflectionResponse{}
+	if err := convertMessage(alphaResp, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func convertMessage(from, to proto.Message) error {
+	b, err := proto.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, to)
+}
+
+// ListServices returns the fully-qualified names of every service the target exposes
+func (r *reflectionClient) ListServices() ([]string, error) {
+	resp, err := r.roundTrip(&reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("reflection error: %s", errResp.GetErrorMessage())
+	}
+
+	names := []string{}
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	return names, nil
+}
+
+// FilesForSymbol fetches the file defining symbol plus all of its transitive
+// imports and links them into a registry
+func (r *reflectionClient) FilesForSymbol(symbol string) (*protoregistry.Files, error) {
+	resp, err := r.roundTrip(&reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fileProtos := map[string]*descriptorpb.FileDescriptorProto{}
+	if err := collectFileDescriptors(resp, fileProtos); err != nil {
+		return nil, err
+	}
+
+	// Servers may send only the requested file, so fetch any imports still missing
+	for {
+		missing := ""
+		for _, fd := range fileProtos {
+			for _, dep := range fd.GetDependency() {
+				if _, ok := fileProtos[dep]; !ok {
+					missing = dep
+					break
+				}
+			}
+			if missing != "" {
+				break
+			}
+		}
+		if missing == "" {
+			break
+		}
+
+		resp, err := r.roundTrip(&reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: missing},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := collectFileDescriptors(resp, fileProtos); err != nil {
+			return nil, err
+		}
+		if _, ok := fileProtos[missing]; !ok {
+			return nil, fmt.Errorf("reflection did not return imported file %q", missing)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range fileProtos {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// collectFileDescriptors decodes the serialized FileDescriptorProtos of a reflection response
+func collectFileDescriptors(resp *reflectionv1.ServerReflectionResponse, into map[string]*descriptorpb.FileDescriptorProto) error {
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return fmt.Errorf("reflection error: %s", errResp.GetErrorMessage())
+	}
+	for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(raw, fd); err != nil {
+			return fmt.Errorf("invalid file descriptor from reflection: %v", err)
+		}
+		into[fd.GetName()] = fd
+	}
+	return nil
+}
+
+// matchServiceName picks the listed service a request names. A fully-qualified name wins,
+// a bare name has to match the last segment of exactly one service
+func matchServiceName(names []string, serviceName string) (string, error) {
+	var candidates []string
+	for _, name := range names {
+		if name == serviceName {
+			return name, nil
+		}
+		if strings.HasSuffix(name, "."+serviceName) {
+			candidates = append(candidates, name)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("service '%s' not found via server reflection: %w", serviceName, errDescriptorNotFound)
+	case 1:
+		return candidates[0], nil
+	default:
+		sort.Strings(candidates)
+		return "", fmt.Errorf("service '%s' is ambiguous, use one of %s: %w", serviceName, strings.Join(candidates, ", "), errDescriptorAmbiguous)
+	}
+}
+
+// reflectServiceDescriptor resolves a service through server reflection.
+// The name may be fully-qualified or the bare service name
+func reflectServiceDescriptor(ctx context.Context, conn *grpc.ClientConn, serviceName string) (protoreflect.ServiceDescriptor, error) {
+	client := newReflectionClient(ctx, conn)
+	defer client.Close()
+
+	names, err := client.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services via reflection: %v", err)
+	}
+
+	fullName, err := matchServiceName(names, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := client.FilesForSymbol(fullName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve descriptors for '%s' via reflection: %v", fullName, err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(fullName))
+	if err != nil {
+		return nil, fmt.Errorf("service '%s' not found in reflected descriptors: %w", fullName, errDescriptorNotFound)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a service: %w", fullName, errDescriptorNotFound)
+	}
+	return serviceDesc, nil
+}
+
+// listGRPCServices godoc
+// @Summary      List gRPC services via reflection
+// @Description  Lists the services and methods a gRPC target exposes through server reflection (v1 or v1alpha).
+// @Description  Use POST /grpc/services for targets that need metadata, auth or environment variables
+// @Tags         gRPC
+// @Produce      json
+// @Param        address              query string true  "Target server address (host:port)"
+// @Param        use_tls              query bool   false "Connect using TLS with the system root CAs"
+// @Param        insecure_skip_verify query bool   false "Skip TLS certificate verification"
+// @Param        authority            query string false "Override the :authority pseudo-header"
+// @Success      200 {object} model.GRPCServiceList "Services and methods"
+// @Failure      400 {object} model.GRPCServiceList "Missing address or invalid TLS configuration"
+// @Failure      502 {object} model.GRPCServiceList "Connecting to the target or reflection failed"
+// @Router       /grpc/services [get]
+func listGRPCServices(c *gin.Context) {
+	address := c.Query("address")
+	if address == "" {
+		c.JSON(http.StatusBadRequest, model.GRPCServiceList{Error: "address query parameter is required"})
+		return
+	}
+
+	target := model.GRPCRequest{
+		ServerAddress: address,
+		UseTLS:        c.Query("use_tls") == "true",
+		Authority:     c.Query("authority"),
+	}
+	if c.Query("insecure_skip_verify") == "true" {
+		target.TLS = &model.GRPCTLSConfig{InsecureSkipVerify: true}
+	}
+	respondGRPCServices(c, target)
+}
+
+// describeGRPCServices godoc
+// @Summary      List gRPC services via reflection, with metadata and auth
+// @Description  Same as GET /grpc/services, for targets whose reflection API needs credentials. The reflection calls
+// @Description  carry `metadata` and the `auth` block, and both can reference `environment` variables.
+// @Description  Proto sources and the message body are ignored
+// @Tags         gRPC
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GRPCRequest true "Target address, TLS, metadata, auth and environment"
+// @Success      200 {object} model.GRPCServiceList "Services and methods"
+// @Failure      400 {object} model.GRPCServiceList "Missing address, unresolved variable or invalid TLS or auth configuration"
+// @Failure      401 {object} model.GRPCServiceList "OAuth2 needs an interactive authorization first"
+// @Failure      502 {object} model.GRPCServiceList "Connecting to the target, fetching an OAuth2 token or reflection failed"
+// @Router       /grpc/services [post]
+func describeGRPCServices(c *gin.Context) {
+	reqBody := model.GRPCRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCServiceList{Error: err.Error()})
+		return
+	}
+	if err := expandGRPCRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCServiceList{ServerAddress: reqBody.ServerAddress, Error: err.Error()})
+		return
+	}
+	if reqBody.ServerAddress == "" {
+		c.JSON(http.StatusBadRequest, model.GRPCServiceList{Error: "server_address is required"})
+		return
+	}
+
+	// The listing has no span of its own, so a token fetch is traced on its own
+	if _, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, tracing.GenerateTraceID(), ""); err != nil {
+		c.JSON(code, model.GRPCServiceList{ServerAddress: reqBody.ServerAddress, Error: err.Error()})
+		return
+	}
+	respondGRPCServices(c, reqBody)
+}
+
+// respondGRPCServices reflects the services of the target, sending its metadata and auth
+// with every reflection call
+func respondGRPCServices(c *gin.Context, reqBody model.GRPCRequest) {
+	// Listing is reflection, which needs a native connection whatever the protocol
+	reqBody.UseReflection = true
+	target, code, err := dialGRPCTarget(reqBody)
+	if err != nil {
+		// Failing to reach the target is the target's problem, not the request's
+		if code == http.StatusInternalServerError {
+			code = http.StatusBadGateway
+		}
+		c.JSON(code, model.GRPCServiceList{ServerAddress: reqBody.ServerAddress, Error: err.Error()})
+		return
+	}
+	defer target.release()
+
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(c.Request.Context(), target.md.Copy()), 30*time.Second)
+	defer cancel()
+
+	services, err := reflectServiceList(ctx, target.conn)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, model.GRPCServiceList{
+			ServerAddress: reqBody.ServerAddress,
+			Error:         err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.GRPCServiceList{
+		ServerAddress: reqBody.ServerAddress,
+		Services:      services,
+	})
+}
+
+// reflectServiceList resolves every service on the target and describes its methods
+func reflectServiceList(ctx context.Context, conn *grpc.ClientConn) ([]model.GRPCServiceInfo, error) {
+	client := newReflectionClient(ctx, conn)
+	defer client.Close()
+
+	names, err := client.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services via reflection: %v", err)
+	}
+	sort.Strings(names)
+
+	services := []model.GRPCServiceInfo{}
+	for _, name := range names {
+		// A service whose descriptors can't be resolved is still listed, just without methods
+		unresolved := model.GRPCServiceInfo{Name: name, Methods: []model.GRPCMethodInfo{}}
+
+		files, err := client.FilesForSymbol(name)
+		if err != nil {
+			log.Printf("Failed to resolve descriptors for '%s' via reflection: %v", name, err)
+			services = append(services, unresolved)
+			continue
+		}
+		desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			services = append(services, unresolved)
+			continue
+		}
+		serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		services = append(services, describeService(serviceDesc))
+	}
+	return services, nil
+}
+
+// describeService lists the methods of a service descriptor for the UI's method picker
+func describeService(serviceDesc protoreflect.ServiceDescriptor) model.GRPCServiceInfo {
+	info := model.GRPCServiceInfo{
+		Name:    string(serviceDesc.FullName()),
+		Methods: []model.GRPCMethodInfo{},
+	}
+	methods := serviceDesc.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		m := methods.Get(i)
+		info.Methods = append(info.Methods, model.GRPCMethodInfo{
+			Name:            string(m.Name()),
+			FullName:        fmt.Sprintf("/%s/%s", serviceDesc.FullName(), m.Name()),
+			InputType:       string(m.Input().FullName()),
+			OutputType:      string(m.Output().FullName()),
+			ClientStreaming: m.IsStreamingClient(),
+			ServerStreaming: m.IsStreamingServer(),
+		})
+	}
+	return info
+}
@@ -0,0 +1,274 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// registerFileWithDeps adds a file and its transitive imports to a registry
+func registerFileWithDeps(files *protoregistry.Files, fd protoreflect.FileDescriptor) {
+	if _, err := files.FindFileByPath(fd.Path()); err == nil {
+		return
+	}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		registerFileWithDeps(files, imports.Get(i).FileDescriptor)
+	}
+	files.RegisterFile(fd)
+}
+
+// startReflectionGRPCServer starts the SayHello server with server reflection enabled.
+// v1 controls whether the v1 API is served in addition to v1alpha
+func startReflectionGRPCServer(t *testing.T, v1 bool) (string, func()) {
+	t.Helper()
+
+	methodDesc, err := parseTestProto()
+	if err != nil {
+		t.Fatalf("Failed to parse test proto: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := grpc.NewServer()
+	serviceDesc := greeterServiceDesc(methodDesc)
+	s.RegisterService(&serviceDesc, nil)
+
+	// The test proto is not in the global registry, so hand the reflection server its own
+	files := &protoregistry.Files{}
+	registerFileWithDeps(files, methodDesc.ParentFile())
+	opts := reflection.ServerOptions{Services: s, DescriptorResolver: files}
+	reflectionv1alpha.RegisterServerReflectionServer(s, reflection.NewServer(opts))
+	if v1 {
+		reflectionv1.RegisterServerReflectionServer(s, reflection.NewServerV1(opts))
+	}
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("Test gRPC server stopped: %v", err)
+		}
+	}()
+
+	return lis.Addr().String(), func() {
+		s.Stop()
+		lis.Close()
+	}
+}
+
+func TestGRPCRoute_ReflectionV1(t *testing.T) {
+	addr, cleanup := startReflectionGRPCServer(t, true)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "Greeter", // Bare name, resolved against the listed services
+		Method:        "SayHello",
+		Body:          `{"name": "Reflection"}`,
+		UseReflection: true,
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+
+	var bodyMap map[string]any
+	json.Unmarshal([]byte(resp.Body), &bodyMap)
+	if bodyMap["message"] != "Hello, Reflection!" {
+		t.Errorf("Expected 'Hello, Reflection!', got %v", bodyMap)
+	}
+}
+
+func TestGRPCRoute_ReflectionV1AlphaFallback(t *testing.T) {
+	addr, cleanup := startReflectionGRPCServer(t, false)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Alpha"}`,
+		UseReflection: true,
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected success through v1alpha, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+}
+
+func TestGRPCRoute_ReflectionUnknownService(t *testing.T) {
+	addr, cleanup := startReflectionGRPCServer(t, true)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Missing",
+		Method:        "SayHello",
+		UseReflection: true,
+	})
+
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", code)
+	}
+	if resp.Error == "" {
+		t.Error("Expected error about service not found")
+	}
+}
+
+func TestMatchServiceName(t *testing.T) {
+	names := []string{"billing.v1.Ledger", "billing.v2.Ledger", "shop.Orders", "Orders"}
+	tests := []struct {
+		service string
+		match   string
+		problem string
+	}{
+		{"billing.v2.Ledger", "billing.v2.Ledger", ""},
+		{"Orders", "Orders", ""}, // Exact match beats the suffix of shop.Orders
+		{"Ledger", "", "use one of billing.v1.Ledger, billing.v2.Ledger"},
+		{"v1.Ledger", "billing.v1.Ledger", ""},
+		{"Payments", "", "not found"},
+	}
+	for _, tt := range tests {
+		match, err := matchServiceName(names, tt.service)
+		if tt.problem != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("%s: expected %q, got %q %v", tt.service, tt.problem, match, err)
+			}
+			continue
+		}
+		if err != nil || match != tt.match {
+			t.Errorf("%s: expected %s, got %q %v", tt.service, tt.match, match, err)
+		}
+	}
+}
+
+func TestGRPCServices_ListViaReflection(t *testing.T) {
+	addr, cleanup := startReflectionGRPCServer(t, true)
+	defer cleanup()
+
+	router := setupGRPCRouter()
+	req, _ := http.NewRequest("GET", "/grpc/services?address="+addr, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp model.GRPCServiceList
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	var greeter *model.GRPCServiceInfo
+	for i := range resp.Services {
+		if resp.Services[i].Name == "testpkg.Greeter" {
+			greeter = &resp.Services[i]
+		}
+	}
+	if greeter == nil {
+		t.Fatalf("Expected testpkg.Greeter in %+v", resp.Services)
+	}
+	if len(greeter.Methods) != 1 {
+		t.Fatalf("Expected 1 method, got %+v", greeter.Methods)
+	}
+
+	m := greeter.Methods[0]
+	if m.Name != "SayHello" || m.FullName != "/testpkg.Greeter/SayHello" {
+		t.Errorf("Unexpected method names: %+v", m)
+	}
+	if m.InputType != "testpkg.HelloRequest" || m.OutputType != "testpkg.HelloReply" {
+		t.Errorf("Unexpected message types: %+v", m)
+	}
+	if m.ClientStreaming || m.ServerStreaming {
+		t.Errorf("Expected unary method, got %+v", m)
+	}
+}
+
+func TestGRPCServices_NoReflection(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	router := setupGRPCRouter()
+	req, _ := http.NewRequest("GET", "/grpc/services?address="+addr, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 without reflection, got %d", w.Code)
+	}
+}
+
+func TestGRPCServices_MissingAddress(t *testing.T) {
+	router := setupGRPCRouter()
+	req, _ := http.NewRequest("GET", "/grpc/services", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGRPCServices_DialFailure(t *testing.T) {
+	router := setupGRPCRouter()
+	req, _ := http.NewRequest("GET", "/grpc/services?address=dns:///%25zz", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGRPCServices_PostWithAuth(t *testing.T) {
+	// The reflection stream is rejected without the API key
+	addr, _, cleanup := startLibraryGRPCServer(t, grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		if values := md.Get("x-api-key"); len(values) == 0 || values[0] != "k-42" {
+			return status.Error(codes.Unauthenticated, "missing API key")
+		}
+		return handler(srv, ss)
+	}))
+	defer cleanup()
+
+	list := func(reqBody model.GRPCRequest) (int, model.GRPCServiceList) {
+		return postJSON[model.GRPCServiceList](t, setupGRPCRouter(), "/grpc/services", reqBody)
+	}
+
+	code, resp := list(model.GRPCRequest{
+		ServerAddress: "{{host}}",
+		Auth:          &model.AuthConfig{Type: "apikey", Key: "X-Api-Key", Value: "{{apiKey}}"},
+		Environment:   map[string]string{"host": addr, "apiKey": "k-42"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", code, resp.Error)
+	}
+	if resp.ServerAddress != addr || len(resp.Services) == 0 {
+		t.Errorf("Expected the library services at %s, got %+v", addr, resp)
+	}
+
+	if code, _ := list(model.GRPCRequest{ServerAddress: addr}); code != http.StatusBadGateway {
+		t.Errorf("Expected 502 without the API key, got %d", code)
+	}
+	if code, _ := list(model.GRPCRequest{ServerAddress: addr, Environment: map[string]string{"host": addr}, Metadata: map[string]string{"x-api-key": "{{apiKey}}"}}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unresolved variable, got %d", code)
+	}
+}
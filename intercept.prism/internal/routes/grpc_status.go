@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// detailResolver finds status detail types among the standard Google types first,
+// then in the descriptors used for the call, so services can attach their own detail messages
+type detailResolver struct {
+	local *dynamicpb.Types
+}
+
+// newDetailResolver indexes the given files and everything they import
+func newDetailResolver(files []protoreflect.FileDescriptor) *detailResolver {
+	registry := &protoregistry.Files{}
+	seen := map[string]bool{}
+	var register func(fd protoreflect.FileDescriptor)
+	register = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		// Conflicts only mean the symbol is already known, which is fine for lookups
+		registry.RegisterFile(fd)
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			register(imports.Get(i).FileDescriptor)
+		}
+	}
+	for _, fd := range files {
+		register(fd)
+	}
+	return &detailResolver{local: dynamicpb.NewTypes(registry)}
+}
+
+func (r *detailResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return r.local.FindMessageByName(name)
+}
+
+func (r *detailResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	name := url
+	if i := strings.LastIndex(url, "/"); i >= 0 {
+		name = url[i+1:]
+	}
+	return r.FindMessageByName(protoreflect.FullName(name))
+}
+
+func (r *detailResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByName(field); err == nil {
+		return xt, nil
+	}
+	return r.local.FindExtensionByName(field)
+}
+
+func (r *detailResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByNumber(message, field); err == nil {
+		return xt, nil
+	}
+	return r.local.FindExtensionByNumber(message, field)
+}
+
+// decodeErrorDetails converts the Any details of a status into JSON.
+// Details of unknown types are returned with their raw bytes instead of being dropped
+func decodeErrorDetails(st *status.Status, files []protoreflect.FileDescriptor) ([]model.GRPCErrorDetail, []proto.Message) {
+	anyDetails := st.Proto().GetDetails()
+	if len(anyDetails) == 0 {
+		return nil, nil
+	}
+
+	resolver := newDetailResolver(files)
+	details := make([]model.GRPCErrorDetail, 0, len(anyDetails))
+	messages := make([]proto.Message, 0, len(anyDetails))
+	for _, detail := range anyDetails {
+		msg, err := anypb.UnmarshalNew(detail, proto.UnmarshalOptions{Resolver: resolver})
+		if err != nil {
+			details = append(details, model.GRPCErrorDetail{
+				Type: string(detail.MessageName()),
+				Raw:  base64.StdEncoding.EncodeToString(detail.GetValue()),
+			})
+			continue
+		}
+		value, _ := protojson.MarshalOptions{Resolver: resolver}.Marshal(msg)
+		details = append(details, model.GRPCErrorDetail{
+			Type:  string(detail.MessageName()),
+			Value: string(value),
+		})
+		messages = append(messages, msg)
+	}
+	return details, messages
+}
+
+// addErrorDetailTags records the detail types on the span, plus the fields of the
+// standard details that are most useful when searching traces
+func addErrorDetailTags(tags map[string]string, details []model.GRPCErrorDetail, messages []proto.Message) {
+	if len(details) == 0 {
+		return
+	}
+	types := make([]string, len(details))
+	for i, detail := range details {
+		types[i] = detail.Type
+	}
+	tags["grpc.error_details"] = strings.Join(types, ",")
+
+	for _, msg := range messages {
+		switch d := msg.(type) {
+		case *errdetails.ErrorInfo:
+			tags["grpc.error_info.reason"] = d.GetReason()
+			tags["grpc.error_info.domain"] = d.GetDomain()
+		case *errdetails.RetryInfo:
+			tags["grpc.retry_info.delay_ms"] = fmt.Sprintf("%d", d.GetRetryDelay().AsDuration().Milliseconds())
+		case *errdetails.BadRequest:
+			fields := make([]string, 0, len(d.GetFieldViolations()))
+			for _, v := range d.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+			tags["grpc.bad_request.fields"] = strings.Join(fields, ",")
+		case *errdetails.QuotaFailure:
+			subjects := make([]string, 0, len(d.GetViolations()))
+			for _, v := range d.GetViolations() {
+				subjects = append(subjects, v.GetSubject())
+			}
+			tags["grpc.quota_failure.subjects"] = strings.Join(subjects, ",")
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package routes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Greeter with a service specific error detail message
+const detailsProto = testProto + `
+message GreetError {
+  string hint = 1;
+}
+`
+
+// failingStatus is the status returned by the details test server
+func failingStatus(t *testing.T) *spb.Status {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"details.proto": detailsProto}),
+		},
+	}
+	compiled, err := compiler.Compile(context.Background(), "details.proto")
+	if err != nil {
+		t.Fatalf("Failed to compile details proto: %v", err)
+	}
+	greetErrorDesc := compiled[0].Messages().ByName("GreetError")
+	greetError := dynamicpb.NewMessage(greetErrorDesc)
+	greetError.Set(greetErrorDesc.Fields().ByName("hint"), protoreflect.ValueOfString("try a shorter name"))
+
+	details := []proto.Message{
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "too long"},
+		}},
+		&errdetails.ErrorInfo{Reason: "NAME_TOO_LONG", Domain: "greeter.example.com"},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "project:demo"}}},
+		greetError,
+	}
+
+	st := &spb.Status{Code: int32(codes.InvalidArgument), Message: "bad name"}
+	for _, detail := range details {
+		packed, err := anypb.New(detail)
+		if err != nil {
+			t.Fatalf("Failed to pack detail: %v", err)
+		}
+		st.Details = append(st.Details, packed)
+	}
+	// A detail nobody has a descriptor for
+	st.Details = append(st.Details, &anypb.Any{TypeUrl: "type.googleapis.com/other.Secret", Value: []byte{0x0a, 0x01, 0x78}})
+	return st
+}
+
+// startDetailsGRPCServer serves a SayHello that always fails with failingStatus
+func startDetailsGRPCServer(t *testing.T) (string, func()) {
+	t.Helper()
+
+	failure := status.FromProto(failingStatus(t)).Err()
+	serviceDesc := grpc.ServiceDesc{
+		ServiceName: "testpkg.Greeter",
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "SayHello",
+				Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+					return nil, failure
+				},
+			},
+		},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&serviceDesc, nil)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("Test gRPC details server stopped: %v", err)
+		}
+	}()
+
+	return lis.Addr().String(), func() {
+		s.Stop()
+		lis.Close()
+	}
+}
+
+func TestGRPCRoute_ErrorDetails(t *testing.T) {
+	addr, cleanup := startDetailsGRPCServer(t)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Bartholomew"}`,
+		ProtoFile:     detailsProto,
+	})
+	if code != http.StatusOK || resp.StatusCode != int(codes.InvalidArgument) {
+		t.Fatalf("Expected INVALID_ARGUMENT, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+	if len(resp.ErrorDetails) != 6 {
+		t.Fatalf("Expected 6 error details, got %+v", resp.ErrorDetails)
+	}
+
+	byType := map[string]model.GRPCErrorDetail{}
+	for _, detail := range resp.ErrorDetails {
+		byType[detail.Type] = detail
+	}
+
+	var errorInfo map[string]any
+	json.Unmarshal([]byte(byType["google.rpc.ErrorInfo"].Value), &errorInfo)
+	if errorInfo["reason"] != "NAME_TOO_LONG" {
+		t.Errorf("Expected decoded ErrorInfo, got %v", byType["google.rpc.ErrorInfo"])
+	}
+	if !strings.Contains(byType["testpkg.GreetError"].Value, "try a shorter name") {
+		t.Errorf("Expected service detail decoded from the proto file, got %+v", byType["testpkg.GreetError"])
+	}
+	if unknown := byType["other.Secret"]; unknown.Value != "" || unknown.Raw != "CgF4" {
+		t.Errorf("Expected unknown detail as raw bytes, got %+v", unknown)
+	}
+
+	tags := resp.Spans[0].Tags
+	expected := map[string]string{
+		"grpc.error_info.reason":      "NAME_TOO_LONG",
+		"grpc.error_info.domain":      "greeter.example.com",
+		"grpc.retry_info.delay_ms":    "1500",
+		"grpc.bad_request.fields":     "name",
+		"grpc.quota_failure.subjects": "project:demo",
+	}
+	for key, value := range expected {
+		if tags[key] != value {
+			t.Errorf("Expected tag %s=%q, got %q", key, value, tags[key])
+		}
+	}
+	if !strings.Contains(tags["grpc.error_details"], "google.rpc.BadRequest") {
+		t.Errorf("Expected detail types tag, got %q", tags["grpc.error_details"])
+	}
+}
+
+func TestGRPCRoute_ErrorDetailsOverWebProtocols(t *testing.T) {
+	st := failingStatus(t)
+	raw, _ := proto.Marshal(st)
+
+	errorInfo, _ := proto.Marshal(&errdetails.ErrorInfo{Reason: "NAME_TOO_LONG"})
+	connectBody := fmt.Sprintf(`{"code": "invalid_argument", "message": "bad name", "details": [{"type": "google.rpc.ErrorInfo", "value": %q}]}`,
+		base64.RawStdEncoding.EncodeToString(errorInfo))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") == "application/proto" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(connectBody))
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Header().Set("Grpc-Status", "3")
+		w.Header().Set("Grpc-Message", "bad%20name")
+		w.Header().Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(raw))
+	}))
+	defer server.Close()
+
+	for _, protocol := range []string{grpcProtocolWeb, grpcProtocolConnect} {
+		t.Run(protocol, func(t *testing.T) {
+			_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: server.URL,
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				ProtoFile:     detailsProto,
+				Protocol:      protocol,
+			})
+			if resp.StatusCode != int(codes.InvalidArgument) || resp.Error != "bad name" {
+				t.Fatalf("Expected INVALID_ARGUMENT 'bad name', got %d: %s", resp.StatusCode, resp.Error)
+			}
+			if resp.Spans[0].Tags["grpc.error_info.reason"] != "NAME_TOO_LONG" {
+				t.Errorf("Expected ErrorInfo decoded, got %+v", resp.ErrorDetails)
+			}
+			if _, ok := resp.ResponseHeaders["grpc-status-details-bin"]; ok {
+				t.Error("Expected grpc-status-details-bin to be stripped from headers")
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Default upper bound for a single streaming call. Closing the SSE connection cancels it earlier
+const grpcStreamTimeout = 5 * time.Minute
+
+// maxGRPCStreamSpanEvents bounds the message events on a stream span, since a stream can
+// run for minutes. Messages past it are only counted, in a tag
+const maxGRPCStreamSpanEvents = 500
+
+// executeGRPCStream godoc
+// @Summary      Execute a streaming gRPC request
+// @Description  Proxies a server-streaming, client-streaming or bidirectional gRPC call and streams the result as Server-Sent Events.
+// @Description  Request messages are taken from `messages` (or `body` for server-streaming). Events are emitted as they happen:
+// @Description  `headers` (response headers), `message` (model.GRPCStreamMessage, for every message sent and received) and a final `end` (model.GRPCResponse with status, trailers and the stream span)
+// @Tags         gRPC
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        request body model.GRPCRequest true "gRPC request configuration with proto sources and messages"
+// @Success      200 {object} model.GRPCStreamMessage "SSE stream of headers, message and end events"
+// @Failure      400 {object} model.GRPCResponse "Invalid request body, proto file or messages"
+// @Failure      500 {object} model.GRPCResponse "Request execution failed"
+// @Router       /grpc/stream [post]
+func executeGRPCStream(c *gin.Context) {
+	// Bind the incoming request
+	reqBody := model.GRPCRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+	log.Println("gRPC Stream Request Received")
+
+	// Resolve {{variables}} from the request's environment
+	if err := expandGRPCRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	// Generate IDs upfront
+	requestID := reqBody.RequestID
+	executionID := uuid.New().String()
+	spanID := tracing.GenerateSpanID()
+	traceID := tracing.GenerateTraceID()
+
+	// Fetch or reuse the OAuth2 access token, with token endpoint calls under the stream's span
+	tokenSpans, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, spanID)
+	if err != nil {
+		c.JSON(code, model.GRPCResponse{
+			StatusCode: code,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+			Spans:      tokenSpans,
+		})
+		return
+	}
+
+	// Resolve the method on a pooled connection
+	target, code, err := resolveGRPCTarget(reqBody)
+	if err != nil {
+		c.JSON(code, model.GRPCResponse{
+			StatusCode: code,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		})
+		return
+	}
+	defer target.release()
+
+	if target.protocol != grpcProtocolNative {
+		c.JSON(http.StatusBadRequest, model.GRPCResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Sprintf("Streaming is only supported over native gRPC, got protocol '%s'", target.protocol),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		})
+		return
+	}
+
+	methodDesc := target.methodDesc
+	if !methodDesc.IsStreamingClient() && !methodDesc.IsStreamingServer() {
+		c.JSON(http.StatusBadRequest, model.GRPCResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Sprintf("Method '%s' is a unary method, use /grpc/ instead", reqBody.Method),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		})
+		return
+	}
+
+	// Parse every outgoing message before opening the stream, so bad JSON never reaches the server
+	rawMessages, err := streamRequestMessages(reqBody, methodDesc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+		})
+		return
+	}
+	reqMsgs := make([]*dynamicpb.Message, len(rawMessages))
+	requestSize := 0
+	for i, raw := range rawMessages {
+		reqMsgs[i] = dynamicpb.NewMessage(methodDesc.Input())
+		if err := protojson.Unmarshal([]byte(raw), reqMsgs[i]); err != nil {
+			c.JSON(http.StatusBadRequest, model.GRPCResponse{
+				StatusCode: http.StatusBadRequest,
+				Error:      fmt.Sprintf("Failed to unmarshal message %d JSON: %v", i, err),
+				TraceID:    traceID,
+				SpanID:     spanID,
+			})
+			return
+		}
+		requestSize += len(raw)
+	}
+
+	// Inject W3C traceparent
+	md := target.md.Copy()
+	traceparent := fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+	md.Set("traceparent", traceparent)
+
+	// The stream lives as long as the SSE client stays connected
+	timeout := target.options.timeout(grpcStreamTimeout)
+	ctx := metadata.NewOutgoingContext(c.Request.Context(), md)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Connect before starting the clock so a fresh dial doesn't count as stream latency
+	target.connect(ctx)
+	overhead := target.overhead
+
+	// From here on everything, including errors, is reported as SSE events
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	events := newGRPCStreamWriter(c.Writer)
+
+	var respPeer peer.Peer
+	streamStart := time.Now()
+	stream, streamErr := target.conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(methodDesc.Name()),
+		ServerStreams: methodDesc.IsStreamingServer(),
+		ClientStreams: methodDesc.IsStreamingClient(),
+	}, target.fullMethod(), append(target.options.callOptions(), grpc.Peer(&respPeer))...)
+
+	var respHeaders, respTrailers metadata.MD
+	received := 0
+	responseSize := 0
+	if streamErr == nil {
+		// Send in the background so bidirectional servers can reply while we are still sending
+		var sendWG sync.WaitGroup
+		sendWG.Add(1)
+		go func() {
+			defer sendWG.Done()
+			for i, msg := range reqMsgs {
+				// A failed send means the stream is over; RecvMsg reports the real status
+				if err := stream.SendMsg(msg); err != nil {
+					return
+				}
+				events.message(streamStart, i, "sent", msg)
+			}
+			stream.CloseSend()
+		}()
+
+		if headers, err := stream.Header(); err == nil {
+			respHeaders = headers
+			events.send("headers", gin.H{"headers": flattenMetadata(headers)})
+		}
+
+		for {
+			respMsg := dynamicpb.NewMessage(methodDesc.Output())
+			if err := stream.RecvMsg(respMsg); err != nil {
+				if !errors.Is(err, io.EOF) {
+					streamErr = err
+				}
+				break
+			}
+			responseSize += events.message(streamStart, received, "received", respMsg)
+			received++
+		}
+
+		// Stop a sender still blocked on flow control once the server has finished
+		cancel()
+		sendWG.Wait()
+		respTrailers = stream.Trailer()
+	}
+	streamEnd := time.Now()
+	totalDuration := streamEnd.Sub(streamStart)
+
+	// Negotiated TLS details, nil for plaintext targets
+	tlsInfo := grpcTLSInfo(&respPeer, reqBody.TLS)
+
+	st, _ := status.FromError(streamErr)
+	errorDetails, detailMsgs := decodeErrorDetails(st, target.files)
+
+	grpcStatus := "OK"
+	if streamErr != nil {
+		grpcStatus = "ERROR"
+	}
+	tags := map[string]string{
+		"grpc.service":           reqBody.Service,
+		"grpc.method":            reqBody.Method,
+		"grpc.status_code":       fmt.Sprintf("%d", int(st.Code())),
+		"grpc.status_name":       st.Code().String(),
+		"grpc.protocol":          grpcProtocolNative,
+		"grpc.stream_type":       grpcStreamType(methodDesc),
+		"grpc.messages_sent":     fmt.Sprintf("%d", events.sent),
+		"grpc.messages_received": fmt.Sprintf("%d", received),
+	}
+	if events.droppedEvents > 0 {
+		tags["grpc.stream.dropped_events"] = fmt.Sprintf("%d", events.droppedEvents)
+	}
+	addTLSTags(tags, reqBody.UseTLS, tlsInfo)
+	addErrorDetailTags(tags, errorDetails, detailMsgs)
+	auth.Tags(tags, reqBody.Auth)
+	target.options.addTags(tags, timeout)
+	overhead.addTags(tags)
+
+	// Queue records for async DB write
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: int(st.Code()),
+		LatencyMs:  int(totalDuration.Milliseconds()),
+	})
+
+	spanRecord := store.SpanRecord{
+		ID:          uuid.New().String(),
+		TraceID:     traceID,
+		SpanID:      spanID,
+		Operation:   fmt.Sprintf("gRPC %s/%s", reqBody.Service, reqBody.Method),
+		ServiceName: "intercept.prism",
+		StartTime:   streamStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      grpcStatus,
+		Tags:        tags,
+		Events:      events.spanEvents,
+	}
+
+	store.AddSpan(spanRecord)
+	tracing.Hub.Publish(spanRecord)
+
+	log.Println("Queued Execution, and Span for async DB write (gRPC stream)")
+
+	rootSpan := model.SpanInfo{
+		SpanID:      spanID,
+		TraceID:     traceID,
+		Operation:   spanRecord.Operation,
+		ServiceName: "intercept.prism",
+		StartTime:   streamStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      grpcStatus,
+		Tags:        tags,
+		Events:      events.spanEvents,
+	}
+
+	events.send("end", model.GRPCResponse{
+		Duration:         fmt.Sprintf("%vms", totalDuration.Milliseconds()),
+		StatusCode:       int(st.Code()),
+		StatusName:       st.Code().String(),
+		ResponseHeaders:  flattenMetadata(respHeaders),
+		ResponseTrailers: flattenMetadata(respTrailers),
+		Error:            st.Message(),
+		ErrorDetails:     errorDetails,
+		ResponseSize:     int64(responseSize),
+		RequestSize:      int64(requestSize),
+		TLS:              tlsInfo,
+		Timings:          overhead.timings(),
+		MessagesSent:     events.sent,
+		MessagesReceived: received,
+		RequestID:        requestID,
+		ExecutionID:      executionID,
+		TraceID:          traceID,
+		SpanID:           spanID,
+		Spans:            append([]model.SpanInfo{rootSpan}, tokenSpans...),
+	})
+}
+
+// streamRequestMessages picks the JSON messages to send for a streaming method.
+// Server-streaming calls take exactly one request message, empty if none is given
+func streamRequestMessages(reqBody model.GRPCRequest, methodDesc protoreflect.MethodDescriptor) ([]string, error) {
+	messages := reqBody.Messages
+	if len(messages) == 0 && reqBody.Body != "" {
+		messages = []string{reqBody.Body}
+	}
+	if methodDesc.IsStreamingClient() {
+		return messages, nil
+	}
+
+	switch len(messages) {
+	case 0:
+		return []string{"{}"}, nil
+	case 1:
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("Method '%s' is server-streaming and takes a single request message, got %d", reqBody.Method, len(messages))
+	}
+}
+
+// grpcStreamType names the streaming shape of a method for span tags
+func grpcStreamType(methodDesc protoreflect.MethodDescriptor) string {
+	switch {
+	case methodDesc.IsStreamingClient() && methodDesc.IsStreamingServer():
+		return "bidi_streaming"
+	case methodDesc.IsStreamingClient():
+		return "client_streaming"
+	default:
+		return "server_streaming"
+	}
+}
+
+// grpcStreamWriter serialises SSE writes from the send and receive sides of a stream
+// and records a span event for every message, up to maxGRPCStreamSpanEvents
+type grpcStreamWriter struct {
+	mu            sync.Mutex
+	w             gin.ResponseWriter
+	sent          int
+	spanEvents    []model.SpanEvent
+	droppedEvents int // Messages past maxGRPCStreamSpanEvents
+}
+
+func newGRPCStreamWriter(w gin.ResponseWriter) *grpcStreamWriter {
+	return &grpcStreamWriter{w: w}
+}
+
+// send writes a single SSE event and flushes it to the client
+func (s *grpcStreamWriter) send(event string, payload any) {
+	data, _ := json.Marshal(payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	s.w.Flush()
+}
+
+// message emits a "message" event and records the matching span event.
+// It returns the size of the JSON body
+func (s *grpcStreamWriter) message(streamStart time.Time, index int, direction string, msg proto.Message) int {
+	now := time.Now()
+	body, _ := protojson.Marshal(msg)
+	size := proto.Size(msg)
+
+	s.mu.Lock()
+	if direction == "sent" {
+		s.sent++
+	}
+	if len(s.spanEvents) < maxGRPCStreamSpanEvents {
+		s.spanEvents = append(s.spanEvents, model.SpanEvent{
+			Name:      "message",
+			Timestamp: now.UnixMicro(),
+			Attributes: map[string]string{
+				"message.type":              direction,
+				"message.id":                fmt.Sprintf("%d", index),
+				"message.uncompressed_size": fmt.Sprintf("%d", size),
+			},
+		})
+	} else {
+		s.droppedEvents++
+	}
+	s.mu.Unlock()
+
+	s.send("message", model.GRPCStreamMessage{
+		Index:     index,
+		Direction: direction,
+		Body:      string(body),
+		Size:      size,
+		Elapsed:   now.Sub(streamStart).Microseconds(),
+	})
+	return len(body)
+}
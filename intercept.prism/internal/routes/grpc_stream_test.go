@@ -0,0 +1,430 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Streaming test proto definition
+const streamProto = `
+syntax = "proto3";
+
+package testpkg;
+
+service Counter {
+  rpc Count (Number) returns (stream Number);
+  rpc Sum (stream Number) returns (Number);
+  rpc Double (stream Number) returns (stream Number);
+  rpc Get (Number) returns (Number);
+}
+
+message Number {
+  int64 value = 1;
+}
+`
+
+// sseEvent is a single parsed Server-Sent Event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// parseSSE splits a recorded SSE body into its events
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		ev := sseEvent{}
+		for _, line := range strings.Split(block, "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				ev.Event = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				ev.Data = v
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// startStreamGRPCServer serves testpkg.Counter:
+// Count sends 1..value (failing with RESOURCE_EXHAUSTED past 3), Sum adds all inputs, Double echoes value*2
+func startStreamGRPCServer(t *testing.T) (string, func()) {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"stream.proto": streamProto}),
+		},
+	}
+	compiled, err := compiler.Compile(context.Background(), "stream.proto")
+	if err != nil {
+		t.Fatalf("Failed to compile stream proto: %v", err)
+	}
+	numberDesc := compiled[0].Messages().ByName("Number")
+	valueField := numberDesc.Fields().ByName("value")
+
+	number := func(v int64) *dynamicpb.Message {
+		msg := dynamicpb.NewMessage(numberDesc)
+		msg.Set(valueField, protoreflect.ValueOfInt64(v))
+		return msg
+	}
+
+	serviceDesc := grpc.ServiceDesc{
+		ServiceName: "testpkg.Counter",
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Get",
+				Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+					req := dynamicpb.NewMessage(numberDesc)
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					return req, nil
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Count",
+				ServerStreams: true,
+				Handler: func(srv any, stream grpc.ServerStream) error {
+					req := dynamicpb.NewMessage(numberDesc)
+					if err := stream.RecvMsg(req); err != nil {
+						return err
+					}
+					stream.SetTrailer(metadata.Pairs("x-count", "done"))
+					n := req.Get(valueField).Int()
+					for i := int64(1); i <= n; i++ {
+						if i > 3 {
+							return status.Error(codes.ResourceExhausted, "too many")
+						}
+						if err := stream.SendMsg(number(i)); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				StreamName:    "Sum",
+				ClientStreams: true,
+				Handler: func(srv any, stream grpc.ServerStream) error {
+					var sum int64
+					for {
+						req := dynamicpb.NewMessage(numberDesc)
+						err := stream.RecvMsg(req)
+						if errors.Is(err, io.EOF) {
+							return stream.SendMsg(number(sum))
+						}
+						if err != nil {
+							return err
+						}
+						sum += req.Get(valueField).Int()
+					}
+				},
+			},
+			{
+				StreamName:    "Double",
+				ServerStreams: true,
+				ClientStreams: true,
+				Handler: func(srv any, stream grpc.ServerStream) error {
+					for {
+						req := dynamicpb.NewMessage(numberDesc)
+						err := stream.RecvMsg(req)
+						if errors.Is(err, io.EOF) {
+							return nil
+						}
+						if err != nil {
+							return err
+						}
+						if err := stream.SendMsg(number(req.Get(valueField).Int() * 2)); err != nil {
+							return err
+						}
+					}
+				},
+			},
+		},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&serviceDesc, nil)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("Test gRPC stream server stopped: %v", err)
+		}
+	}()
+
+	return lis.Addr().String(), func() {
+		s.Stop()
+		lis.Close()
+	}
+}
+
+// doGRPCStream posts to /grpc/stream and returns the status code and raw body
+func doGRPCStream(t *testing.T, reqBody model.GRPCRequest) (int, string) {
+	t.Helper()
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest("POST", "/grpc/stream", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	setupGRPCRouter().ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// streamResult splits the SSE output into message events and the final response
+func streamResult(t *testing.T, body string) ([]model.GRPCStreamMessage, model.GRPCResponse) {
+	t.Helper()
+
+	var messages []model.GRPCStreamMessage
+	var end *model.GRPCResponse
+	for _, ev := range parseSSE(body) {
+		switch ev.Event {
+		case "message":
+			var msg model.GRPCStreamMessage
+			if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+				t.Fatalf("Failed to parse message event: %v", err)
+			}
+			messages = append(messages, msg)
+		case "end":
+			end = &model.GRPCResponse{}
+			if err := json.Unmarshal([]byte(ev.Data), end); err != nil {
+				t.Fatalf("Failed to parse end event: %v", err)
+			}
+		}
+	}
+	if end == nil {
+		t.Fatalf("Expected an end event, got: %s", body)
+	}
+	return messages, *end
+}
+
+// receivedBodies returns the bodies of received messages in order
+func receivedBodies(messages []model.GRPCStreamMessage) []string {
+	var bodies []string
+	for _, msg := range messages {
+		if msg.Direction == "received" {
+			bodies = append(bodies, msg.Body)
+		}
+	}
+	return bodies
+}
+
+func TestGRPCStream_ServerStreaming(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	code, body := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Count",
+		Body:          `{"value": 3}`,
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, body)
+	}
+
+	messages, end := streamResult(t, body)
+	got := receivedBodies(messages)
+	if strings.Join(got, ",") != `{"value":"1"},{"value":"2"},{"value":"3"}` {
+		t.Errorf("Unexpected received messages: %v", got)
+	}
+	if end.StatusCode != 0 || end.MessagesSent != 1 || end.MessagesReceived != 3 {
+		t.Errorf("Unexpected end summary: status=%d sent=%d received=%d", end.StatusCode, end.MessagesSent, end.MessagesReceived)
+	}
+	if end.ResponseTrailers["x-count"] != "done" {
+		t.Errorf("Expected trailers in end event, got %v", end.ResponseTrailers)
+	}
+
+	span := end.Spans[0]
+	if span.Tags["grpc.stream_type"] != "server_streaming" {
+		t.Errorf("Expected server_streaming tag, got %v", span.Tags)
+	}
+	if len(span.Events) != 4 {
+		t.Errorf("Expected one span event per message, got %d", len(span.Events))
+	}
+}
+
+func TestGRPCStream_ClientStreaming(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	code, body := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Sum",
+		Messages:      []string{`{"value": 1}`, `{"value": 2}`, `{"value": 4}`},
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, body)
+	}
+
+	messages, end := streamResult(t, body)
+	if got := receivedBodies(messages); len(got) != 1 || got[0] != `{"value":"7"}` {
+		t.Errorf("Expected sum of 7, got %v", got)
+	}
+	if end.MessagesSent != 3 || end.Spans[0].Tags["grpc.messages_sent"] != "3" {
+		t.Errorf("Expected 3 messages sent, got %d / %v", end.MessagesSent, end.Spans[0].Tags)
+	}
+}
+
+func TestGRPCStream_SpanEventLimit(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	messages := make([]string, maxGRPCStreamSpanEvents)
+	for i := range messages {
+		messages[i] = `{"value": 1}`
+	}
+	code, body := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Sum",
+		Messages:      messages,
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, body)
+	}
+
+	// Every message is still streamed, only the span stops recording them
+	received, end := streamResult(t, body)
+	if got := receivedBodies(received); len(got) != 1 || got[0] != fmt.Sprintf(`{"value":"%d"}`, maxGRPCStreamSpanEvents) {
+		t.Errorf("Expected sum of %d, got %v", maxGRPCStreamSpanEvents, got)
+	}
+	span := end.Spans[0]
+	if len(span.Events) != maxGRPCStreamSpanEvents || span.Tags["grpc.stream.dropped_events"] != "1" {
+		t.Errorf("Expected %d span events and 1 dropped, got %d %v", maxGRPCStreamSpanEvents, len(span.Events), span.Tags)
+	}
+}
+
+func TestGRPCStream_Bidirectional(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	code, body := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Double",
+		Messages:      []string{`{"value": 1}`, `{"value": 5}`},
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, body)
+	}
+
+	events := parseSSE(body)
+	if events[0].Event != "headers" && events[0].Event != "message" {
+		t.Errorf("Expected the stream to open with headers or a message, got %q", events[0].Event)
+	}
+
+	messages, end := streamResult(t, body)
+	got := receivedBodies(messages)
+	if strings.Join(got, ",") != `{"value":"2"},{"value":"10"}` {
+		t.Errorf("Unexpected received messages: %v", got)
+	}
+	if end.StatusName != "OK" || end.Spans[0].Tags["grpc.stream_type"] != "bidi_streaming" {
+		t.Errorf("Unexpected end summary: %s %v", end.StatusName, end.Spans[0].Tags)
+	}
+}
+
+func TestGRPCStream_ErrorStatus(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	_, body := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Count",
+		Body:          `{"value": 5}`,
+		ProtoFile:     streamProto,
+	})
+
+	messages, end := streamResult(t, body)
+	if len(receivedBodies(messages)) != 3 {
+		t.Errorf("Expected messages before the error to be delivered, got %v", messages)
+	}
+	if end.StatusCode != int(codes.ResourceExhausted) || end.Error != "too many" {
+		t.Errorf("Expected RESOURCE_EXHAUSTED, got %d: %s", end.StatusCode, end.Error)
+	}
+	if end.Spans[0].Status != "ERROR" {
+		t.Errorf("Expected ERROR span, got %s", end.Spans[0].Status)
+	}
+}
+
+func TestGRPCStream_RejectsUnaryAndBadMessages(t *testing.T) {
+	addr, cleanup := startStreamGRPCServer(t)
+	defer cleanup()
+
+	code, _ := doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Get",
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unary method, got %d", code)
+	}
+
+	code, _ = doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Sum",
+		Messages:      []string{`{"value": 1}`, `{"nope": true}`},
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid message JSON, got %d", code)
+	}
+
+	code, _ = doGRPCStream(t, model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Count",
+		Messages:      []string{`{"value": 1}`, `{"value": 2}`},
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for several messages on a server stream, got %d", code)
+	}
+
+	// Streaming methods are rejected by the unary endpoint
+	code, _ = postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Counter",
+		Method:        "Count",
+		ProtoFile:     streamProto,
+	})
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for streaming method on /grpc/, got %d", code)
+	}
+}
@@ -0,0 +1,258 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// generateGRPCTemplate godoc
+// @Summary      Generate a request template for a gRPC method
+// @Description  Builds a protojson skeleton of a method's input message from uploaded proto sources or server reflection.
+// @Description  Every field is set to a placeholder (enums to their first value, repeated fields to one element). Only the first field of each oneof is included; the others are listed in `fields` with `in_body` false
+// @Tags         gRPC
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GRPCRequest true "Proto sources (or use_reflection), service and method"
+// @Success      200 {object} model.GRPCMessageTemplate "Request template"
+// @Failure      400 {object} model.GRPCMessageTemplate "Invalid request, proto file, service or method"
+// @Failure      500 {object} model.GRPCMessageTemplate "Reflection failed on the target"
+// @Router       /grpc/template [post]
+func generateGRPCTemplate(c *gin.Context) {
+	reqBody := model.GRPCRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCMessageTemplate{Error: err.Error()})
+		return
+	}
+	if err := expandGRPCRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCMessageTemplate{Error: err.Error()})
+		return
+	}
+
+	// Reflection may need the OAuth2 token; a token fetch gets a trace of its own
+	if _, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, tracing.GenerateTraceID(), ""); err != nil {
+		c.JSON(code, model.GRPCMessageTemplate{Error: err.Error()})
+		return
+	}
+
+	target, code, err := resolveGRPCTarget(reqBody)
+	if err != nil {
+		c.JSON(code, model.GRPCMessageTemplate{
+			Service: reqBody.Service,
+			Method:  reqBody.Method,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer target.release()
+
+	input := target.methodDesc.Input()
+	body, fields := buildMessageTemplate(input)
+
+	c.JSON(http.StatusOK, model.GRPCMessageTemplate{
+		Service:         string(target.serviceDesc.FullName()),
+		Method:          string(target.methodDesc.Name()),
+		InputType:       string(input.FullName()),
+		ClientStreaming: target.methodDesc.IsStreamingClient(),
+		Body:            body,
+		Fields:          fields,
+	})
+}
+
+// templateBuilder writes a message skeleton as ordered JSON and collects field annotations
+type templateBuilder struct {
+	buf    bytes.Buffer
+	fields []model.GRPCTemplateField
+	stack  map[protoreflect.FullName]bool // Messages being expanded, to stop on recursive types
+}
+
+// buildMessageTemplate returns an indented protojson skeleton for the message and its field annotations
+func buildMessageTemplate(md protoreflect.MessageDescriptor) (string, []model.GRPCTemplateField) {
+	b := &templateBuilder{stack: map[protoreflect.FullName]bool{}}
+	b.writeMessage(md, "")
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, b.buf.Bytes(), "", "  "); err != nil {
+		return b.buf.String(), b.fields
+	}
+	return out.String(), b.fields
+}
+
+func (b *templateBuilder) writeMessage(md protoreflect.MessageDescriptor, path string) {
+	if b.writeWellKnown(md) {
+		return
+	}
+	// Recursive types are cut off with an empty object
+	if b.stack[md.FullName()] {
+		b.buf.WriteString("{}")
+		return
+	}
+	b.stack[md.FullName()] = true
+	defer delete(b.stack, md.FullName())
+
+	b.buf.WriteByte('{')
+	written := 0
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		fieldPath := fd.JSONName()
+		if path != "" {
+			fieldPath = path + "." + fd.JSONName()
+		}
+
+		// protojson rejects more than one member of a oneof, so only the first one goes in the body
+		oneof := fd.ContainingOneof()
+		inBody := oneof == nil || oneof.IsSynthetic() || oneof.Fields().Get(0) == fd
+		b.annotate(fd, fieldPath, inBody)
+		if !inBody {
+			continue
+		}
+
+		if written > 0 {
+			b.buf.WriteByte(',')
+		}
+		written++
+		b.writeString(fd.JSONName())
+		b.buf.WriteByte(':')
+		b.writeField(fd, fieldPath)
+	}
+	b.buf.WriteByte('}')
+}
+
+func (b *templateBuilder) writeField(fd protoreflect.FieldDescriptor, path string) {
+	switch {
+	case fd.IsMap():
+		b.buf.WriteByte('{')
+		b.writeString(mapKeyPlaceholder(fd.MapKey()))
+		b.buf.WriteByte(':')
+		b.writeSingular(fd.MapValue(), path+"{}")
+		b.buf.WriteByte('}')
+	case fd.IsList():
+		b.buf.WriteByte('[')
+		b.writeSingular(fd, path+"[]")
+		b.buf.WriteByte(']')
+	default:
+		b.writeSingular(fd, path)
+	}
+}
+
+// writeSingular writes the placeholder for one value of the field's type
+func (b *templateBuilder) writeSingular(fd protoreflect.FieldDescriptor, path string) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b.buf.WriteString("false")
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		b.buf.WriteString(`""`)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		b.buf.WriteString("0")
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		b.buf.WriteString(`"0"`)
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			b.buf.WriteString("null")
+			return
+		}
+		b.writeString(string(fd.Enum().Values().Get(0).Name()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		b.writeMessage(fd.Message(), path)
+	}
+}
+
+// writeWellKnown writes the JSON form of well-known types that protojson does not encode as objects
+func (b *templateBuilder) writeWellKnown(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		b.buf.WriteString(`"1970-01-01T00:00:00Z"`)
+	case "google.protobuf.Duration":
+		b.buf.WriteString(`"0s"`)
+	case "google.protobuf.FieldMask":
+		b.buf.WriteString(`""`)
+	case "google.protobuf.Struct", "google.protobuf.Any", "google.protobuf.Empty":
+		b.buf.WriteString("{}")
+	case "google.protobuf.Value":
+		b.buf.WriteString("null")
+	case "google.protobuf.ListValue":
+		b.buf.WriteString("[]")
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		// Wrappers are written as their bare value
+		b.writeSingular(md.Fields().ByName("value"), "")
+	default:
+		return false
+	}
+	return true
+}
+
+// annotate records the type, label and oneof of a field
+func (b *templateBuilder) annotate(fd protoreflect.FieldDescriptor, path string, inBody bool) {
+	field := model.GRPCTemplateField{
+		Path:   path,
+		Type:   fieldTypeName(fd),
+		InBody: inBody,
+	}
+	switch {
+	case fd.IsMap():
+		field.Label = "map"
+		field.Type = fmt.Sprintf("map<%s, %s>", fieldTypeName(fd.MapKey()), fieldTypeName(fd.MapValue()))
+	case fd.IsList():
+		field.Label = "repeated"
+	case fd.HasOptionalKeyword():
+		field.Label = "optional"
+	}
+	if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+		field.Oneof = string(oneof.Name())
+	}
+
+	enumField := fd
+	if fd.IsMap() {
+		enumField = fd.MapValue()
+	}
+	if enum := enumField.Enum(); enum != nil {
+		values := enum.Values()
+		for i := 0; i < values.Len(); i++ {
+			field.EnumValues = append(field.EnumValues, string(values.Get(i).Name()))
+		}
+	}
+	b.fields = append(b.fields, field)
+}
+
+// fieldTypeName is the scalar kind, or the full name for messages and enums
+func fieldTypeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// mapKeyPlaceholder returns a key that protojson accepts for the map's key type
+func mapKeyPlaceholder(key protoreflect.FieldDescriptor) string {
+	switch key.Kind() {
+	case protoreflect.StringKind:
+		return "key"
+	case protoreflect.BoolKind:
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+func (b *templateBuilder) writeString(s string) {
+	b.buf.WriteString(strconv.Quote(s))
+}
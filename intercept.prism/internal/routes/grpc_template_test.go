@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Input message exercising every kind of field the template has to cover
+const templateProto = `
+syntax = "proto3";
+
+package shop;
+
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/wrappers.proto";
+import "google/protobuf/struct.proto";
+
+service Orders {
+  rpc Create (CreateOrderRequest) returns (Order);
+}
+
+enum Priority {
+  PRIORITY_UNSPECIFIED = 0;
+  PRIORITY_HIGH = 1;
+}
+
+message Item {
+  string sku = 1;
+  int64 quantity = 2;
+}
+
+message Category {
+  string name = 1;
+  Category parent = 2;
+}
+
+message CreateOrderRequest {
+  string customer_id = 1;
+  repeated Item items = 2;
+  map<string, int32> labels = 3;
+  Priority priority = 4;
+  oneof payment {
+    string card_token = 5;
+    string voucher_code = 6;
+  }
+  optional string note = 7;
+  google.protobuf.Timestamp deliver_at = 8;
+  google.protobuf.Int32Value max_parcels = 9;
+  google.protobuf.Struct extra = 10;
+  Category category = 11;
+  bytes signature = 12;
+}
+
+message Order {
+  string id = 1;
+}
+`
+
+func TestGRPCTemplate_AllFieldKinds(t *testing.T) {
+	code, resp := postJSON[model.GRPCMessageTemplate](t, setupGRPCRouter(), "/grpc/template", model.GRPCRequest{
+		ServerAddress: "localhost:50051",
+		Service:       "Orders",
+		Method:        "Create",
+		ProtoFile:     templateProto,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, resp.Error)
+	}
+	if resp.Service != "shop.Orders" || resp.InputType != "shop.CreateOrderRequest" {
+		t.Errorf("Unexpected method info: %+v", resp)
+	}
+
+	// The skeleton must be accepted as a request body as-is
+	files, _, err := grpcDescriptors.Get(model.GRPCRequest{ProtoFile: templateProto})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	svc, _ := findServiceDescriptor(files, "shop.Orders")
+	msg := dynamicpb.NewMessage(svc.Methods().ByName("Create").Input())
+	if err := protojson.Unmarshal([]byte(resp.Body), msg); err != nil {
+		t.Fatalf("Template is not valid protojson: %v\n%s", err, resp.Body)
+	}
+
+	var body map[string]any
+	json.Unmarshal([]byte(resp.Body), &body)
+	expected := map[string]any{
+		"priority":   "PRIORITY_UNSPECIFIED",
+		"deliverAt":  "1970-01-01T00:00:00Z",
+		"maxParcels": float64(0),
+		"cardToken":  "",
+	}
+	for key, value := range expected {
+		if body[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, body[key])
+		}
+	}
+	if _, ok := body["voucherCode"]; ok {
+		t.Error("Expected only the first oneof member in the body")
+	}
+	if items, ok := body["items"].([]any); !ok || len(items) != 1 {
+		t.Errorf("Expected one placeholder item, got %v", body["items"])
+	}
+	if parent := body["category"].(map[string]any)["parent"]; len(parent.(map[string]any)) != 0 {
+		t.Errorf("Expected recursive message to be cut off, got %v", parent)
+	}
+	if strings.Index(resp.Body, "customerId") > strings.Index(resp.Body, "signature") {
+		t.Error("Expected fields in declaration order")
+	}
+
+	fields := map[string]model.GRPCTemplateField{}
+	for _, f := range resp.Fields {
+		fields[f.Path] = f
+	}
+	if f := fields["voucherCode"]; f.Oneof != "payment" || f.InBody {
+		t.Errorf("Expected voucherCode annotated as an omitted oneof member, got %+v", f)
+	}
+	if f := fields["items"]; f.Label != "repeated" || f.Type != "shop.Item" {
+		t.Errorf("Unexpected items annotation: %+v", f)
+	}
+	if f := fields["items[].quantity"]; f.Type != "int64" {
+		t.Errorf("Expected nested field annotation, got %+v", f)
+	}
+	if f := fields["labels"]; f.Label != "map" || f.Type != "map<string, int32>" {
+		t.Errorf("Unexpected labels annotation: %+v", f)
+	}
+	if f := fields["note"]; f.Label != "optional" {
+		t.Errorf("Expected optional label on note, got %+v", f)
+	}
+	if f := fields["priority"]; len(f.EnumValues) != 2 {
+		t.Errorf("Expected enum values on priority, got %+v", f)
+	}
+}
+
+func TestGRPCTemplate_UnknownMethod(t *testing.T) {
+	code, resp := postJSON[model.GRPCMessageTemplate](t, setupGRPCRouter(), "/grpc/template", model.GRPCRequest{
+		ServerAddress: "localhost:50051",
+		Service:       "shop.Orders",
+		Method:        "Delete",
+		ProtoFile:     templateProto,
+	})
+	if code != http.StatusBadRequest || resp.Error == "" {
+		t.Errorf("Expected 400 with error, got %d: %+v", code, resp)
+	}
+}
+
+func TestBuildMessageTemplate_Indented(t *testing.T) {
+	files, _, err := grpcDescriptors.Get(model.GRPCRequest{ProtoFile: templateProto})
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	var item protoreflect.MessageDescriptor
+	for _, fd := range files {
+		if m := fd.Messages().ByName("Item"); m != nil {
+			item = m
+		}
+	}
+	body, fields := buildMessageTemplate(item)
+	if body != "{\n  \"sku\": \"\",\n  \"quantity\": \"0\"\n}" {
+		t.Errorf("Unexpected template: %s", body)
+	}
+	if len(fields) != 2 {
+		t.Errorf("Expected 2 field annotations, got %d", len(fields))
+	}
+}
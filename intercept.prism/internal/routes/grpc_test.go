@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/bufbuild/protocompile"
@@ -79,24 +80,9 @@ func parseTestProto() (protoreflect.MethodDescriptor, error) {
 	return method, nil
 }
 
-// startTestGRPCServer starts a gRPC server that handles the SayHello method
-func startTestGRPCServer(t *testing.T) (string, func()) {
-	t.Helper()
-
-	methodDesc, err := parseTestProto()
-	if err != nil {
-		t.Fatalf("Failed to parse test proto: %v", err)
-	}
-
-	lis, err := net.Listen("tcp", "127.0.0.1:0")
-	if err != nil {
-		t.Fatalf("Failed to listen: %v", err)
-	}
-
-	s := grpc.NewServer()
-
-	// Register a generic service handler
-	serviceDesc := grpc.ServiceDesc{
+// greeterServiceDesc builds a generic handler for testpkg.Greeter/SayHello backed by dynamicpb
+func greeterServiceDesc(methodDesc protoreflect.MethodDescriptor) grpc.ServiceDesc {
+	return grpc.ServiceDesc{
 		ServiceName: "testpkg.Greeter",
 		HandlerType: nil,
 		Methods: []grpc.MethodDesc{
@@ -108,18 +94,51 @@ func startTestGRPCServer(t *testing.T) (string, func()) {
 						return nil, err
 					}
 
-					nameField := methodDesc.Input().Fields().ByName("name")
-					name := reqMsg.Get(nameField).String()
+					sayHello := func(ctx context.Context, req any) (any, error) {
+						nameField := methodDesc.Input().Fields().ByName("name")
+						name := req.(*dynamicpb.Message).Get(nameField).String()
 
-					respMsg := dynamicpb.NewMessage(methodDesc.Output())
-					messageField := methodDesc.Output().Fields().ByName("message")
-					respMsg.Set(messageField, protoreflect.ValueOfString(fmt.Sprintf("Hello, %s!", name)))
-					return respMsg, nil
+						respMsg := dynamicpb.NewMessage(methodDesc.Output())
+						messageField := methodDesc.Output().Fields().ByName("message")
+						respMsg.Set(messageField, protoreflect.ValueOfString(fmt.Sprintf("Hello, %s!", name)))
+						return respMsg, nil
+					}
+					if interceptor == nil {
+						return sayHello(ctx, reqMsg)
+					}
+					info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/testpkg.Greeter/SayHello"}
+					return interceptor(ctx, reqMsg, info, sayHello)
 				},
 			},
 		},
 		Streams: []grpc.StreamDesc{},
 	}
+}
+
+// startTestGRPCServer starts a gRPC server that handles the SayHello method
+func startTestGRPCServer(t *testing.T) (string, func()) {
+	t.Helper()
+	return startTestGRPCServerWithOptions(t)
+}
+
+// startTestGRPCServerWithOptions starts the SayHello server with extra server options (e.g. TLS credentials)
+func startTestGRPCServerWithOptions(t *testing.T, opts ...grpc.ServerOption) (string, func()) {
+	t.Helper()
+
+	methodDesc, err := parseTestProto()
+	if err != nil {
+		t.Fatalf("Failed to parse test proto: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := grpc.NewServer(opts...)
+
+	// Register a generic service handler
+	serviceDesc := greeterServiceDesc(methodDesc)
 	s.RegisterService(&serviceDesc, nil)
 
 	go func() {
@@ -238,8 +257,8 @@ func TestGRPCRoute_MissingProtoFile(t *testing.T) {
 
 	var resp model.GRPCResponse
 	json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp.Error != "proto_file content is required" {
-		t.Errorf("Expected proto_file required error, got: %s", resp.Error)
+	if resp.Error != "proto_file, proto_files, proto_zip or protoset content is required unless use_reflection is set" {
+		t.Errorf("Expected proto sources required error, got: %s", resp.Error)
 	}
 }
 
@@ -473,3 +492,116 @@ func TestGRPCResponse_JSONSerialization(t *testing.T) {
 		t.Errorf("TraceID mismatch: expected %s, got %s", resp.TraceID, parsed.TraceID)
 	}
 }
+
+func TestGRPCRoute_AuthMetadata(t *testing.T) {
+	router := setupGRPCRouter()
+	var received metadata.MD
+	capture := grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		received, _ = metadata.FromIncomingContext(ctx)
+		return handler(ctx, req)
+	})
+	addr, cleanup := startTestGRPCServerWithOptions(t, capture)
+	defer cleanup()
+
+	send := func(cfg *model.AuthConfig) (int, model.GRPCResponse) {
+		jsonBody, _ := json.Marshal(model.GRPCRequest{
+			ServerAddress: addr,
+			Service:       "testpkg.Greeter",
+			Method:        "SayHello",
+			Body:          `{"name": "Prism"}`,
+			ProtoFile:     testProto,
+			Auth:          cfg,
+		})
+		req, _ := http.NewRequest("POST", "/grpc/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.GRPCResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := send(&model.AuthConfig{Type: "bearer", Token: "abc"})
+	if code != http.StatusOK || resp.Error != "" {
+		t.Fatalf("Expected a successful call, got %d %s", code, resp.Error)
+	}
+	if got := received.Get("authorization"); len(got) != 1 || got[0] != "Bearer abc" {
+		t.Errorf("Expected the bearer token in metadata, got %v", got)
+	}
+	if len(received.Get("traceparent")) != 1 {
+		t.Error("Expected traceparent alongside the credentials")
+	}
+
+	code, resp = send(&model.AuthConfig{Type: "awsv4", AccessKeyID: "a", SecretAccessKey: "b", Region: "r", Service: "s"})
+	if code != http.StatusBadRequest || resp.Error != "auth: awsv4 is not supported for gRPC" {
+		t.Errorf("Expected 400 for a signing scheme, got %d %q", code, resp.Error)
+	}
+}
+
+func TestGRPCRoute_Assertions(t *testing.T) {
+	router := setupGRPCRouter()
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	jsonBody, _ := json.Marshal(model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "World"}`,
+		ProtoFile:     testProto,
+		Assertions: []model.Assertion{
+			{Type: "status", Expected: "OK"},
+			{Type: "jsonpath", Path: "$.message", Operator: "matches", Expected: "^Hello"},
+			{Type: "size", Expected: "5"},
+		},
+	})
+	req, _ := http.NewRequest("POST", "/grpc/", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp model.GRPCResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Assertions) != 3 || !resp.Assertions[0].Passed || !resp.Assertions[1].Passed {
+		t.Fatalf("Expected the status and message assertions to pass, got %+v", resp.Assertions)
+	}
+	if resp.StatusName != "OK" || resp.Spans[0].Status != "ERROR" || resp.Spans[0].Tags["assertions.failed"] != "1" {
+		t.Errorf("Expected the size assertion to fail the span of a successful RPC, got %s %v", resp.Spans[0].Status, resp.Spans[0].Tags)
+	}
+}
+
+func TestGRPCRoute_Extract(t *testing.T) {
+	router := setupGRPCRouter()
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	jsonBody, _ := json.Marshal(model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "World"}`,
+		ProtoFile:     testProto,
+		Extract: []model.Extraction{
+			{Variable: "greeting", From: "field", Path: "message"},
+			{Variable: "word", From: "regex", Path: `Hello, (\w+)`},
+			{Variable: "missing", From: "field", Path: "reply.text"},
+		},
+	})
+	req, _ := http.NewRequest("POST", "/grpc/", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp model.GRPCResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Extracted == nil || resp.Extracted.Variables["greeting"] != "Hello, World!" || resp.Extracted.Variables["word"] != "World" {
+		t.Fatalf("Expected extracted variables, got %d %+v", w.Code, resp.Extracted)
+	}
+	if len(resp.Extracted.Failures) != 1 || !strings.Contains(resp.Extracted.Failures[0], "has no field reply") {
+		t.Errorf("Expected reply.text to fail, got %q", resp.Extracted.Failures)
+	}
+	if resp.Spans[0].Tags["extract.variables"] != "greeting, word" {
+		t.Errorf("Unexpected span tags %v", resp.Spans[0].Tags)
+	}
+}
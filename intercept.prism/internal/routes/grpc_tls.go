@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+)
+
+// grpcDialOptions builds the transport credentials, authority override and user agent for a gRPC target
+func grpcDialOptions(reqBody model.GRPCRequest) ([]grpc.DialOption, error) {
+	dialOpts := []grpc.DialOption{}
+	if reqBody.Authority != "" {
+		dialOpts = append(dialOpts, grpc.WithAuthority(reqBody.Authority))
+	}
+	// user-agent is a reserved header, grpc-go only takes it per connection
+	if reqBody.Options != nil && reqBody.Options.UserAgent != "" {
+		dialOpts = append(dialOpts, grpc.WithUserAgent(reqBody.Options.UserAgent))
+	}
+
+	if !reqBody.UseTLS {
+		return append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials())), nil
+	}
+
+	tlsConfig, err := buildGRPCTLSConfig(reqBody.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))), nil
+}
+
+// buildGRPCTLSConfig converts the request TLS settings into a tls.Config.
+// A nil config means plain TLS against the system root CAs
+func buildGRPCTLSConfig(cfg *model.GRPCTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg == nil {
+		return tlsConfig, nil
+	}
+
+	tlsConfig.ServerName = cfg.ServerName
+	tlsConfig.InsecureSkipVerify = cfg.InsecureSkipVerify
+
+	// Custom CA replaces the system roots, otherwise nil RootCAs falls back to them
+	if cfg.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, fmt.Errorf("no valid PEM certificates found in ca_cert")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Client certificate for mTLS, both halves have to be present
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be provided together")
+		}
+		cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(cfg.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// grpcTLSInfo extracts the negotiated TLS details from the peer of a finished RPC.
+// Returns nil for plaintext connections or when the handshake never completed
+func grpcTLSInfo(p *peer.Peer, cfg *model.GRPCTLSConfig) *model.GRPCTLSInfo {
+	if p == nil || p.AuthInfo == nil {
+		return nil
+	}
+	tlsAuth, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return tlsStateInfo(tlsAuth.State, cfg)
+}
+
+// tlsStateInfo summarises a completed TLS handshake for the response
+func tlsStateInfo(state tls.ConnectionState, cfg *model.GRPCTLSConfig) *model.GRPCTLSInfo {
+	info := &model.GRPCTLSInfo{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		MutualTLS:          cfg != nil && cfg.ClientCert != "",
+	}
+	for _, cert := range state.PeerCertificates {
+		info.PeerCertificates = append(info.PeerCertificates, model.CertificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore.UTC().Format(time.RFC3339),
+			NotAfter:  cert.NotAfter.UTC().Format(time.RFC3339),
+			DNSNames:  cert.DNSNames,
+		})
+	}
+	return info
+}
+
+// addTLSTags records whether TLS was requested and the negotiated version and cipher on the span tags
+func addTLSTags(tags map[string]string, useTLS bool, info *model.GRPCTLSInfo) {
+	tags["grpc.tls"] = fmt.Sprintf("%t", useTLS)
+	if info == nil {
+		return
+	}
+	tags["tls.version"] = info.Version
+	tags["tls.cipher_suite"] = info.CipherSuite
+	if info.MutualTLS {
+		tags["tls.mutual"] = "true"
+	}
+}
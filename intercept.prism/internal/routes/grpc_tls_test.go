@@ -0,0 +1,249 @@
+package routes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// testCert is a PEM encoded certificate/key pair plus its parsed form
+type testCert struct {
+	certPEM string
+	keyPEM  string
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate signed by parent, or a self-signed CA when parent is nil
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.DNSNames = []string{cn}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &testCert{
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		cert:    cert,
+		key:     key,
+	}
+}
+
+// serverTLSOption builds TLS server credentials, optionally requiring client certs signed by clientCA
+func serverTLSOption(t *testing.T, server *testCert, clientCA *testCert) grpc.ServerOption {
+	t.Helper()
+
+	pair, err := tls.X509KeyPair([]byte(server.certPEM), []byte(server.keyPEM))
+	if err != nil {
+		t.Fatalf("Failed to load server key pair: %v", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{pair}}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA.cert)
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return grpc.Creds(credentials.NewTLS(cfg))
+}
+
+func TestGRPCRoute_TLSWithCustomCA(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil, 0)
+	server := newTestCert(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+
+	addr, cleanup := startTestGRPCServerWithOptions(t, serverTLSOption(t, server, nil))
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "TLS"}`,
+		ProtoFile:     testProto,
+		UseTLS:        true,
+		TLS:           &model.GRPCTLSConfig{CACert: ca.certPEM, ServerName: "localhost"},
+	})
+
+	if code != http.StatusOK || resp.StatusCode != 0 {
+		t.Fatalf("Expected successful TLS call, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+	}
+	if resp.TLS == nil {
+		t.Fatal("Expected TLS details in response")
+	}
+	if resp.TLS.Version == "" || resp.TLS.CipherSuite == "" {
+		t.Errorf("Expected negotiated version and cipher, got %+v", resp.TLS)
+	}
+	if resp.TLS.NegotiatedProtocol != "h2" {
+		t.Errorf("Expected ALPN h2, got %q", resp.TLS.NegotiatedProtocol)
+	}
+	if len(resp.TLS.PeerCertificates) == 0 || resp.TLS.PeerCertificates[0].Subject != "CN=localhost" {
+		t.Errorf("Expected server certificate CN=localhost, got %+v", resp.TLS.PeerCertificates)
+	}
+	if resp.Spans[0].Tags["grpc.tls"] != "true" || resp.Spans[0].Tags["tls.version"] == "" {
+		t.Errorf("Expected TLS span tags, got %v", resp.Spans[0].Tags)
+	}
+}
+
+func TestGRPCRoute_TLSUntrustedServer(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil, 0)
+	server := newTestCert(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+
+	addr, cleanup := startTestGRPCServerWithOptions(t, serverTLSOption(t, server, nil))
+	defer cleanup()
+
+	// System roots do not trust the test CA
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "TLS"}`,
+		ProtoFile:     testProto,
+		UseTLS:        true,
+	})
+	if resp.StatusCode == 0 {
+		t.Fatal("Expected untrusted certificate to fail the call")
+	}
+
+	// Skipping verification lets the same call through
+	_, resp = postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "TLS"}`,
+		ProtoFile:     testProto,
+		UseTLS:        true,
+		TLS:           &model.GRPCTLSConfig{InsecureSkipVerify: true},
+	})
+	if resp.StatusCode != 0 {
+		t.Errorf("Expected insecure_skip_verify to succeed, got %d: %s", resp.StatusCode, resp.Error)
+	}
+}
+
+func TestGRPCRoute_MutualTLS(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil, 0)
+	server := newTestCert(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "prism-client", ca, x509.ExtKeyUsageClientAuth)
+
+	addr, cleanup := startTestGRPCServerWithOptions(t, serverTLSOption(t, server, ca))
+	defer cleanup()
+
+	reqBody := model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "mTLS"}`,
+		ProtoFile:     testProto,
+		UseTLS:        true,
+		TLS:           &model.GRPCTLSConfig{CACert: ca.certPEM, ServerName: "localhost"},
+	}
+
+	// Without a client certificate the server rejects the handshake
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", reqBody)
+	if resp.StatusCode == 0 {
+		t.Fatal("Expected call without client certificate to fail")
+	}
+
+	reqBody.TLS.ClientCert = client.certPEM
+	reqBody.TLS.ClientKey = client.keyPEM
+	_, resp = postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", reqBody)
+	if resp.StatusCode != 0 {
+		t.Fatalf("Expected mTLS call to succeed, got %d: %s", resp.StatusCode, resp.Error)
+	}
+	if resp.TLS == nil || !resp.TLS.MutualTLS {
+		t.Errorf("Expected mutual_tls in response, got %+v", resp.TLS)
+	}
+}
+
+func TestGRPCRoute_InvalidTLSConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *model.GRPCTLSConfig
+	}{
+		{"garbage CA", &model.GRPCTLSConfig{CACert: "not a certificate"}},
+		{"cert without key", &model.GRPCTLSConfig{ClientCert: "-----BEGIN CERTIFICATE-----"}},
+		{"mismatched key pair", &model.GRPCTLSConfig{ClientCert: "bad", ClientKey: "bad"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: "localhost:50051",
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				ProtoFile:     testProto,
+				UseTLS:        true,
+				TLS:           tt.cfg,
+			})
+			if code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", code)
+			}
+			if resp.Error == "" {
+				t.Error("Expected TLS configuration error")
+			}
+		})
+	}
+}
+
+func TestGRPCRoute_PlaintextHasNoTLSInfo(t *testing.T) {
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	_, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "World"}`,
+		ProtoFile:     testProto,
+		Authority:     "greeter.internal",
+	})
+	if resp.StatusCode != 0 {
+		t.Fatalf("Expected success, got %d: %s", resp.StatusCode, resp.Error)
+	}
+	if resp.TLS != nil {
+		t.Errorf("Expected no TLS details for plaintext call, got %+v", resp.TLS)
+	}
+	if resp.Spans[0].Tags["grpc.tls"] != "false" {
+		t.Errorf("Expected grpc.tls=false tag, got %v", resp.Spans[0].Tags)
+	}
+}
@@ -0,0 +1,511 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Transcoding modes, the empty mode only translates the request
+const (
+	transcodeModeREST    = "rest"
+	transcodeModeGRPC    = "grpc"
+	transcodeModeCompare = "compare"
+)
+
+// transcodeGRPCRequest godoc
+// @Summary      Transcode between a gRPC method and its google.api.http mapping
+// @Description  Maps a gRPC request (service, method, body) onto the REST path, query and body of the method's google.api.http binding,
+// @Description  or routes an HTTP request (`http`) to the gRPC method whose binding matches it, the way grpc-gateway does.
+// @Description  `mode` rest or grpc calls that side, compare calls both and checks that the responses are equivalent; without a mode only the translation is returned
+// @Tags         gRPC
+// @Accept       json
+// @Produce      json
+// @Param        request body model.GRPCTranscodeRequest true "gRPC or HTTP request with proto sources and the sides to call"
+// @Success      200 {object} model.GRPCTranscodeResponse "Translated request and the responses of the called sides"
+// @Failure      400 {object} model.GRPCTranscodeResponse "Invalid request, missing binding or no matching route"
+// @Failure      500 {object} model.GRPCTranscodeResponse "Reflection or a call failed"
+// @Router       /grpc/transcode [post]
+func transcodeGRPCRequest(c *gin.Context) {
+	reqBody := model.GRPCTranscodeRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCTranscodeResponse{Error: err.Error()})
+		return
+	}
+	log.Println("gRPC Transcode Request Received")
+	if err := expandGRPCTranscodeRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.GRPCTranscodeResponse{Mode: reqBody.Mode, Error: err.Error()})
+		return
+	}
+
+	response := model.GRPCTranscodeResponse{Mode: reqBody.Mode}
+	fail := func(code int, err error) {
+		response.Error = err.Error()
+		c.JSON(code, response)
+	}
+
+	switch reqBody.Mode {
+	case "", transcodeModeREST, transcodeModeGRPC, transcodeModeCompare:
+	default:
+		fail(http.StatusBadRequest, fmt.Errorf("Unsupported mode '%s', expected rest, grpc or compare", reqBody.Mode))
+		return
+	}
+	callREST := reqBody.Mode == transcodeModeREST || reqBody.Mode == transcodeModeCompare
+	callGRPC := reqBody.Mode == transcodeModeGRPC || reqBody.Mode == transcodeModeCompare
+	if callREST && reqBody.GatewayURL == "" {
+		fail(http.StatusBadRequest, fmt.Errorf("gateway_url is required for mode %s", reqBody.Mode))
+		return
+	}
+	if callGRPC && reqBody.ServerAddress == "" {
+		fail(http.StatusBadRequest, fmt.Errorf("server_address is required for mode %s", reqBody.Mode))
+		return
+	}
+
+	// The calls are children of a transcode span, and so is fetching an OAuth2 token for them
+	// or for the reflection lookup
+	traceID := tracing.GenerateTraceID()
+	rootSpanID := tracing.GenerateSpanID()
+	reflection := reqBody.UseReflection && !hasProtoSources(reqBody.GRPCRequest)
+	var tokenSpans []model.SpanInfo
+	var code int
+	var err error
+	if callREST || callGRPC || reflection {
+		tokenSpans, code, err = fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, rootSpanID)
+		if err != nil {
+			response.TraceID = traceID
+			response.Spans = tokenSpans
+			fail(code, err)
+			return
+		}
+	}
+
+	// One connection serves both the reflection lookup and the gRPC call, carrying the
+	// same metadata and auth
+	var target *grpcTarget
+	if callGRPC || reflection {
+		target, code, err = dialGRPCTarget(reqBody.GRPCRequest)
+		if err != nil {
+			fail(code, err)
+			return
+		}
+		defer target.release()
+	}
+
+	// Find the method and binding, from the HTTP request when one is given
+	services, code, err := transcodeServices(reqBody, target)
+	if err != nil {
+		fail(code, err)
+		return
+	}
+	methodDesc, binding, vars, query, err := selectTranscodeMethod(reqBody, services)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		fail(http.StatusBadRequest, fmt.Errorf("Method '%s' is a streaming method, only unary methods can be transcoded", methodDesc.FullName()))
+		return
+	}
+	grpcReq := reqBody.GRPCRequest
+	grpcReq.Service = string(methodDesc.Parent().FullName())
+	grpcReq.Method = string(methodDesc.Name())
+	response.Service = grpcReq.Service
+	response.Method = grpcReq.Method
+	if callGRPC {
+		target.serviceDesc = methodDesc.Parent().(protoreflect.ServiceDescriptor)
+		target.methodDesc = methodDesc
+	}
+	response.HTTPRule = binding.rule()
+
+	// Translate whichever side was given into the other
+	var reqMsg protoreflect.Message
+	if reqBody.HTTP != nil {
+		reqMsg, err = parseHTTPRequest(binding, methodDesc.Input(), vars, query, reqBody.HTTP.Body)
+		if err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		response.HTTPRequest = &model.GRPCTranscodeHTTPRequest{
+			Method: strings.ToUpper(reqBody.HTTP.Method),
+			Path:   reqBody.HTTP.Path,
+			Body:   reqBody.HTTP.Body,
+		}
+	} else {
+		reqMsg = dynamicpb.NewMessage(methodDesc.Input())
+		if reqBody.Body != "" {
+			if err := protojson.Unmarshal([]byte(reqBody.Body), reqMsg.Interface()); err != nil {
+				fail(http.StatusBadRequest, fmt.Errorf("Failed to unmarshal request body JSON: %v", err))
+				return
+			}
+		}
+		response.HTTPRequest, err = buildHTTPRequest(binding, reqMsg)
+		if err != nil {
+			fail(http.StatusBadRequest, fmt.Errorf("Failed to map request onto %s %s: %v", binding.method, binding.template.raw, err))
+			return
+		}
+	}
+	grpcBody, err := protojson.Marshal(reqMsg.Interface())
+	if err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	response.GRPCBody = string(grpcBody)
+	grpcReq.Body = response.GRPCBody
+
+	if !callREST && !callGRPC {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	response.TraceID = traceID
+	response.SpanID = rootSpanID
+	transcodeStart := time.Now()
+
+	var grpcCall *unaryCall
+	if callGRPC {
+		grpcCall, err = invokeUnary(target, grpcReq, reqMsg.Interface(), traceID, tracing.GenerateSpanID(), rootSpanID)
+		if err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		executionID := recordTranscodeExecution(reqBody.RequestID, traceID, grpcCall.response.StatusCode, grpcCall.duration, grpcCall.response.Assertions)
+		saveExtracted(grpcCall.response.Extracted, reqBody.Extract, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+		grpcCall.response.RequestID = reqBody.RequestID
+		grpcCall.response.ExecutionID = executionID
+		response.GRPC = &grpcCall.response
+		response.Spans = append(response.Spans, grpcCall.response.Spans...)
+	}
+
+	if callREST {
+		restReq := model.RestRequest{
+			Method:    response.HTTPRequest.Method,
+			URL:       strings.TrimRight(reqBody.GatewayURL, "/") + response.HTTPRequest.Path,
+			Body:      response.HTTPRequest.Body,
+			Headers:   map[string]string{},
+			RequestID: reqBody.RequestID,
+			Auth:      reqBody.Auth,
+		}
+		if restReq.Body != "" {
+			restReq.Headers["Content-Type"] = "application/json"
+		}
+		for key, value := range reqBody.Headers {
+			restReq.Headers[key] = value
+		}
+
+		// A failed REST call is reported next to the gRPC result instead of failing the request
+		restSpanID := tracing.GenerateSpanID()
+		restCall, err := sendRestRequest(restReq, traceID, restSpanID, rootSpanID)
+		if err != nil {
+			response.REST = &model.RestResponse{
+				Error:   fmt.Sprintf("REST call failed: %v", err),
+				TraceID: traceID,
+				SpanID:  restSpanID,
+			}
+		} else {
+			executionID := recordTranscodeExecution(reqBody.RequestID, traceID, restCall.response.StatusCode, restCall.duration, nil)
+			restCall.response.RequestID = reqBody.RequestID
+			restCall.response.ExecutionID = executionID
+			response.REST = &restCall.response
+			response.Spans = append(response.Spans, restCall.response.Spans...)
+		}
+	}
+
+	if callREST && callGRPC {
+		differences := compareTranscoded(binding, methodDesc.Output(), grpcCall, response.REST)
+		equivalent := len(differences) == 0
+		response.Equivalent = &equivalent
+		response.Differences = differences
+	}
+
+	// Root span covering the calls
+	spanStatus := "OK"
+	if (response.GRPC != nil && response.GRPC.StatusCode != int(codes.OK)) ||
+		(response.REST != nil && (response.REST.Error != "" || response.REST.StatusCode >= 400)) ||
+		(response.Equivalent != nil && !*response.Equivalent) {
+		spanStatus = "ERROR"
+	}
+	tags := map[string]string{
+		"grpc.service":        response.Service,
+		"grpc.method":         response.Method,
+		"transcode.mode":      reqBody.Mode,
+		"transcode.http_rule": fmt.Sprintf("%s %s", binding.method, binding.template.raw),
+		"transcode.binding":   fmt.Sprintf("%d", binding.index),
+		"transcode.http_path": response.HTTPRequest.Path,
+		"transcode.from_http": fmt.Sprintf("%t", reqBody.HTTP != nil),
+	}
+	if response.Equivalent != nil {
+		tags["transcode.equivalent"] = fmt.Sprintf("%t", *response.Equivalent)
+		if len(response.Differences) > 0 {
+			tags["transcode.differences"] = strings.Join(response.Differences, "; ")
+		}
+	}
+
+	totalDuration := time.Since(transcodeStart)
+	operation := fmt.Sprintf("gRPC transcode %s/%s", response.Service, response.Method)
+	spanRecord := store.SpanRecord{
+		ID:          uuid.New().String(),
+		TraceID:     traceID,
+		SpanID:      rootSpanID,
+		Operation:   operation,
+		ServiceName: "intercept.prism",
+		StartTime:   transcodeStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      spanStatus,
+		Tags:        tags,
+	}
+	store.AddSpan(spanRecord)
+	tracing.Hub.Publish(spanRecord)
+	log.Println("Queued Executions, and Spans for async DB write (gRPC transcode)")
+
+	rootSpan := model.SpanInfo{
+		SpanID:      rootSpanID,
+		TraceID:     traceID,
+		Operation:   operation,
+		ServiceName: "intercept.prism",
+		StartTime:   transcodeStart.UnixMicro(),
+		Duration:    totalDuration.Microseconds(),
+		Status:      spanStatus,
+		Tags:        tags,
+	}
+	response.Spans = append([]model.SpanInfo{rootSpan}, append(response.Spans, tokenSpans...)...)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// recordTranscodeExecution queues an Execution for one side of a transcoded call. Assertions
+// apply to the gRPC side only
+func recordTranscodeExecution(requestID, traceID string, statusCode int, duration time.Duration, results []model.AssertionResult) string {
+	executionID := uuid.New().String()
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: statusCode,
+		LatencyMs:  int(duration.Milliseconds()),
+		Assertions: results,
+	})
+	return executionID
+}
+
+// transcodeServices returns the services to look for the method in: the named one, or every
+// service of the proto sources when routing an HTTP request without a service. Reflection goes
+// through target, which also records the descriptors it resolved and their overhead
+func transcodeServices(reqBody model.GRPCTranscodeRequest, target *grpcTarget) ([]protoreflect.ServiceDescriptor, int, error) {
+	if reqBody.HTTP == nil && (reqBody.Service == "" || reqBody.Method == "") {
+		return nil, http.StatusBadRequest, fmt.Errorf("service and method are required unless an http request is given")
+	}
+
+	compileStart := time.Now()
+	if reqBody.UseReflection && !hasProtoSources(reqBody.GRPCRequest) {
+		if reqBody.Service == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("service is required when using reflection")
+		}
+		serviceDesc, code, err := reflectGRPCService(target, reqBody.Service)
+		if err != nil {
+			return nil, code, err
+		}
+		target.files = []protoreflect.FileDescriptor{serviceDesc.ParentFile()}
+		target.overhead.CompileDuration = time.Since(compileStart)
+		return []protoreflect.ServiceDescriptor{serviceDesc}, 0, nil
+	}
+
+	if !hasProtoSources(reqBody.GRPCRequest) {
+		return nil, http.StatusBadRequest, fmt.Errorf("proto_file, proto_files, proto_zip or protoset content is required unless use_reflection is set")
+	}
+	files, cacheHit, err := grpcDescriptors.Get(reqBody.GRPCRequest)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if target != nil {
+		target.files = files
+		target.overhead.DescriptorCacheHit = cacheHit
+		target.overhead.CompileDuration = time.Since(compileStart)
+		target.overhead.Reflection = false
+	}
+	if reqBody.Service != "" {
+		serviceDesc, err := findServiceDescriptor(files, reqBody.Service)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return []protoreflect.ServiceDescriptor{serviceDesc}, 0, nil
+	}
+
+	var services []protoreflect.ServiceDescriptor
+	for _, fileDesc := range files {
+		for i := 0; i < fileDesc.Services().Len(); i++ {
+			services = append(services, fileDesc.Services().Get(i))
+		}
+	}
+	return services, 0, nil
+}
+
+// selectTranscodeMethod picks the method and binding. An HTTP request is matched against every
+// binding of the services, preferring the template with the most literal segments, and its
+// path variables and query parameters are returned with it
+func selectTranscodeMethod(reqBody model.GRPCTranscodeRequest, services []protoreflect.ServiceDescriptor) (protoreflect.MethodDescriptor, *httpBinding, map[string]string, url.Values, error) {
+	if reqBody.HTTP == nil {
+		methodDesc := services[0].Methods().ByName(protoreflect.Name(reqBody.Method))
+		if methodDesc == nil {
+			return nil, nil, nil, nil, fmt.Errorf("Method '%s' not found in service '%s'", reqBody.Method, reqBody.Service)
+		}
+		bindings, err := methodHTTPBindings(methodDesc)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if len(bindings) == 0 {
+			return nil, nil, nil, nil, fmt.Errorf("Method '%s' has no google.api.http annotation", methodDesc.FullName())
+		}
+		if reqBody.Binding < 0 || reqBody.Binding >= len(bindings) {
+			return nil, nil, nil, nil, fmt.Errorf("Binding %d out of range, '%s' has %d", reqBody.Binding, methodDesc.FullName(), len(bindings))
+		}
+		return methodDesc, bindings[reqBody.Binding], nil, nil, nil
+	}
+
+	parsed, err := url.Parse(reqBody.HTTP.Path)
+	if err != nil || !strings.HasPrefix(parsed.Path, "/") {
+		return nil, nil, nil, nil, fmt.Errorf("http.path must be an absolute path, got '%s'", reqBody.HTTP.Path)
+	}
+	httpMethod := strings.ToUpper(reqBody.HTTP.Method)
+
+	var bestMethod protoreflect.MethodDescriptor
+	var bestBinding *httpBinding
+	var bestVars map[string]string
+	for _, serviceDesc := range services {
+		methods := serviceDesc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			bindings, err := methodHTTPBindings(methods.Get(i))
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			for _, binding := range bindings {
+				if binding.method != httpMethod {
+					continue
+				}
+				vars, ok := binding.template.match(parsed.EscapedPath())
+				if !ok {
+					continue
+				}
+				if bestBinding == nil || binding.template.literals() > bestBinding.template.literals() {
+					bestMethod, bestBinding, bestVars = methods.Get(i), binding, vars
+				}
+			}
+		}
+	}
+	if bestBinding == nil {
+		return nil, nil, nil, nil, fmt.Errorf("No google.api.http binding matches %s %s", httpMethod, parsed.Path)
+	}
+	return bestMethod, bestBinding, bestVars, parsed.Query(), nil
+}
+
+// compareTranscoded checks that the REST response carries the same result as the gRPC call.
+// Failures are compared by the HTTP status grpc-gateway maps the gRPC code to, and their message
+func compareTranscoded(binding *httpBinding, output protoreflect.MessageDescriptor, grpcCall *unaryCall, rest *model.RestResponse) []string {
+	grpcResp := grpcCall.response
+	if rest.Error != "" {
+		return []string{rest.Error}
+	}
+	if grpcResp.StatusCode != int(codes.OK) || rest.StatusCode >= 400 {
+		code := codes.Code(grpcResp.StatusCode)
+		expected := gatewayHTTPStatus(code)
+		if rest.StatusCode != expected {
+			return []string{fmt.Sprintf("status: gRPC %s maps to HTTP %d, REST returned %d", code, expected, rest.StatusCode)}
+		}
+		var restErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal([]byte(rest.Body), &restErr) == nil && restErr.Message != grpcResp.Error {
+			return []string{fmt.Sprintf("error message: gRPC %q, REST %q", grpcResp.Error, restErr.Message)}
+		}
+		return nil
+	}
+
+	// Decode the REST body into the output type, wrapped in response_body when set
+	restMsg := dynamicpb.NewMessage(output)
+	restBody := rest.Body
+	grpcMsg := proto.Message(grpcCall.respMsg)
+	if binding.responseBody != "" {
+		fd := output.Fields().ByName(protoreflect.Name(binding.responseBody))
+		if fd == nil {
+			return []string{fmt.Sprintf("response_body field '%s' not found in %s", binding.responseBody, output.FullName())}
+		}
+		key, _ := json.Marshal(fd.JSONName())
+		restBody = fmt.Sprintf("{%s:%s}", key, rest.Body)
+
+		only := dynamicpb.NewMessage(output)
+		if grpcCall.respMsg.Has(fd) {
+			only.Set(fd, grpcCall.respMsg.Get(fd))
+		}
+		grpcMsg = only
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal([]byte(restBody), restMsg); err != nil {
+		return []string{fmt.Sprintf("body: REST response is not a valid %s: %v", output.FullName(), err)}
+	}
+	if proto.Equal(grpcMsg, restMsg) {
+		return nil
+	}
+
+	// List the top-level fields that differ
+	var differences []string
+	fields := output.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		a, b := dynamicpb.NewMessage(output), dynamicpb.NewMessage(output)
+		if grpcMsg.ProtoReflect().Has(fd) {
+			a.Set(fd, grpcMsg.ProtoReflect().Get(fd))
+		}
+		if restMsg.Has(fd) {
+			b.Set(fd, restMsg.Get(fd))
+		}
+		if !proto.Equal(a, b) {
+			differences = append(differences, fmt.Sprintf("%s: gRPC and REST values differ", fd.JSONName()))
+		}
+	}
+	return differences
+}
+
+// gatewayHTTPStatus is the HTTP status grpc-gateway responds with for a gRPC code
+func gatewayHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,610 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Library service exposed through google.api.http bindings
+const libraryProto = `
+syntax = "proto3";
+
+package library;
+
+import "google/api/annotations.proto";
+
+service Library {
+  rpc GetBook (GetBookRequest) returns (Book) {
+    option (google.api.http) = {
+      get: "/v1/{name=shelves/*/books/*}"
+      additional_bindings { get: "/v1/books/{book_id}" }
+    };
+  }
+  rpc CreateBook (CreateBookRequest) returns (Book) {
+    option (google.api.http) = {
+      post: "/v1/{parent=shelves/*}/books"
+      body: "book"
+    };
+  }
+  rpc SearchBooks (SearchBooksRequest) returns (SearchBooksResponse) {
+    option (google.api.http) = {
+      post: "/v1/books:search"
+      body: "*"
+      response_body: "books"
+    };
+  }
+  rpc Ping (Book) returns (Book);
+}
+
+enum View {
+  VIEW_UNSPECIFIED = 0;
+  BASIC = 1;
+  FULL = 2;
+}
+
+message Filter {
+  int64 min_pages = 1;
+}
+
+message GetBookRequest {
+  string name = 1;
+  string book_id = 2;
+  View view = 3;
+  Filter filter = 4;
+  repeated string tags = 5;
+}
+
+message Book {
+  string name = 1;
+  string title = 2;
+  int32 pages = 3;
+}
+
+message CreateBookRequest {
+  string parent = 1;
+  Book book = 2;
+  string request_id = 3;
+}
+
+message SearchBooksRequest {
+  string query = 1;
+  int32 page_size = 2;
+}
+
+message SearchBooksResponse {
+  repeated Book books = 1;
+  string next_page_token = 2;
+}
+`
+
+// libraryRespond is the business logic shared by the gRPC server and the gateway emulator,
+// working on the protojson form of the messages
+func libraryRespond(method string, req map[string]any) (map[string]any, *status.Status) {
+	str := func(v any) string { s, _ := v.(string); return s }
+	switch method {
+	case "GetBook":
+		name := str(req["name"])
+		if name == "" {
+			name = "shelves/0/books/" + str(req["bookId"])
+		}
+		if strings.Contains(name, "missing") {
+			return nil, status.New(codes.NotFound, "book not found")
+		}
+		return map[string]any{"name": name, "title": "Title of " + name + " " + str(req["view"]), "pages": 100}, nil
+	case "CreateBook":
+		book, _ := req["book"].(map[string]any)
+		return map[string]any{"name": str(req["parent"]) + "/books/" + str(req["requestId"]), "title": book["title"]}, nil
+	case "SearchBooks":
+		return map[string]any{
+			"books":         []any{map[string]any{"name": "books/" + str(req["query"])}},
+			"nextPageToken": "next",
+		}, nil
+	}
+	return nil, status.New(codes.Unimplemented, method)
+}
+
+// libraryServer serves the Library service with dynamicpb and records the last request
+type libraryServer struct {
+	mu   sync.Mutex
+	last map[string]any
+}
+
+func (l *libraryServer) lastRequest() map[string]any {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// startLibraryGRPCServer serves every Library method through libraryRespond, with server
+// reflection and extra server options (e.g. interceptors)
+func startLibraryGRPCServer(t *testing.T, opts ...grpc.ServerOption) (string, *libraryServer, func()) {
+	t.Helper()
+
+	files, err := compileProtoDescriptors(model.GRPCRequest{ProtoFile: libraryProto})
+	if err != nil {
+		t.Fatalf("Failed to compile library proto: %v", err)
+	}
+	serviceDesc, err := findServiceDescriptor(files, "library.Library")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &libraryServer{}
+	desc := grpc.ServiceDesc{ServiceName: "library.Library"}
+	for i := 0; i < serviceDesc.Methods().Len(); i++ {
+		methodDesc := serviceDesc.Methods().Get(i)
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(methodDesc.Name()),
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				reqMsg := dynamicpb.NewMessage(methodDesc.Input())
+				if err := dec(reqMsg); err != nil {
+					return nil, err
+				}
+				raw, _ := protojson.Marshal(reqMsg)
+				req := map[string]any{}
+				json.Unmarshal(raw, &req)
+
+				server.mu.Lock()
+				server.last = req
+				server.mu.Unlock()
+
+				resp, st := libraryRespond(string(methodDesc.Name()), req)
+				if st != nil {
+					return nil, st.Err()
+				}
+				respMsg := dynamicpb.NewMessage(methodDesc.Output())
+				raw, _ = json.Marshal(resp)
+				if err := protojson.Unmarshal(raw, respMsg); err != nil {
+					return nil, err
+				}
+				return respMsg, nil
+			},
+		})
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&desc, nil)
+	registry := &protoregistry.Files{}
+	registerFileWithDeps(registry, serviceDesc.ParentFile())
+	reflectionv1.RegisterServerReflectionServer(s, reflection.NewServerV1(reflection.ServerOptions{Services: s, DescriptorResolver: registry}))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("Test gRPC server stopped: %v", err)
+		}
+	}()
+	return lis.Addr().String(), server, func() {
+		s.Stop()
+		lis.Close()
+	}
+}
+
+// libraryGateway emulates grpc-gateway for the Library bindings. skew changes every title
+type libraryGateway struct {
+	mu       sync.Mutex
+	skew     bool
+	lastURL  string
+	lastBody string
+}
+
+var (
+	gatewayBookPath   = regexp.MustCompile(`^/v1/(shelves/[^/]+/books/[^/]+)$`)
+	gatewayBookIDPath = regexp.MustCompile(`^/v1/books/([^/:]+)$`)
+	gatewayShelfPath  = regexp.MustCompile(`^/v1/(shelves/[^/]+)/books$`)
+)
+
+func (g *libraryGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	g.lastURL = r.URL.RequestURI()
+	g.lastBody = string(body)
+	skew := g.skew
+	g.mu.Unlock()
+
+	var method string
+	req := map[string]any{}
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && gatewayBookPath.MatchString(r.URL.Path):
+		method = "GetBook"
+		req["name"] = gatewayBookPath.FindStringSubmatch(r.URL.Path)[1]
+		req["view"] = query.Get("view")
+	case r.Method == http.MethodGet && gatewayBookIDPath.MatchString(r.URL.Path):
+		method = "GetBook"
+		req["bookId"] = gatewayBookIDPath.FindStringSubmatch(r.URL.Path)[1]
+	case r.Method == http.MethodPost && gatewayShelfPath.MatchString(r.URL.Path):
+		method = "CreateBook"
+		book := map[string]any{}
+		json.Unmarshal(body, &book)
+		req["parent"] = gatewayShelfPath.FindStringSubmatch(r.URL.Path)[1]
+		req["book"] = book
+		req["requestId"] = query.Get("request_id")
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/books:search":
+		method = "SearchBooks"
+		json.Unmarshal(body, &req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	resp, st := libraryRespond(method, req)
+	w.Header().Set("Content-Type", "application/json")
+	if st != nil {
+		w.WriteHeader(gatewayHTTPStatus(st.Code()))
+		json.NewEncoder(w).Encode(map[string]any{"code": st.Code(), "message": st.Message()})
+		return
+	}
+	if skew {
+		resp["title"] = "Something else"
+	}
+	if method == "SearchBooks" {
+		json.NewEncoder(w).Encode(resp["books"])
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestGRPCTranscode_BuildHTTPRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		binding int
+		body    string
+		want    model.GRPCTranscodeHTTPRequest
+	}{
+		{
+			name:   "path and query",
+			method: "GetBook",
+			body:   `{"name": "shelves/1/books/2", "view": "FULL", "filter": {"minPages": "10"}, "tags": ["a", "b"]}`,
+			want:   model.GRPCTranscodeHTTPRequest{Method: "GET", Path: "/v1/shelves/1/books/2?filter.min_pages=10&tags=a&tags=b&view=FULL"},
+		},
+		{
+			name:    "additional binding escapes the variable",
+			method:  "GetBook",
+			binding: 1,
+			body:    `{"bookId": "a/b c"}`,
+			want:    model.GRPCTranscodeHTTPRequest{Method: "GET", Path: "/v1/books/a%2Fb%20c"},
+		},
+		{
+			name:   "body field",
+			method: "CreateBook",
+			body:   `{"parent": "shelves/7", "book": {"title": "Go"}, "requestId": "r1"}`,
+			want:   model.GRPCTranscodeHTTPRequest{Method: "POST", Path: "/v1/shelves/7/books?request_id=r1", Body: `{"title":"Go"}`},
+		},
+		{
+			name:   "whole message body with verb",
+			method: "SearchBooks",
+			body:   `{"query": "go", "pageSize": 5}`,
+			want:   model.GRPCTranscodeHTTPRequest{Method: "POST", Path: "/v1/books:search", Body: `{"query":"go","pageSize":5}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCTranscodeResponse](t, setupGRPCRouter(), "/grpc/transcode", model.GRPCTranscodeRequest{
+				GRPCRequest: model.GRPCRequest{
+					Service:   "library.Library",
+					Method:    tt.method,
+					Body:      tt.body,
+					ProtoFile: libraryProto,
+				},
+				Binding: tt.binding,
+			})
+			if code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", code, resp.Error)
+			}
+			got := *resp.HTTPRequest
+			// protojson output spacing is not stable, compare the body as JSON
+			if got.Method != tt.want.Method || got.Path != tt.want.Path || !jsonEqual(got.Body, tt.want.Body) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+			if resp.HTTPRule == nil || resp.HTTPRule.Binding != tt.binding {
+				t.Errorf("Expected binding %d in the rule, got %+v", tt.binding, resp.HTTPRule)
+			}
+			if len(resp.Spans) != 0 {
+				t.Errorf("Expected no spans without calls, got %d", len(resp.Spans))
+			}
+		})
+	}
+}
+
+func TestGRPCTranscode_RouteHTTPToGRPC(t *testing.T) {
+	addr, server, cleanup := startLibraryGRPCServer(t)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCTranscodeResponse](t, setupGRPCRouter(), "/grpc/transcode", model.GRPCTranscodeRequest{
+		GRPCRequest: model.GRPCRequest{ServerAddress: addr, ProtoFile: libraryProto},
+		Mode:        transcodeModeGRPC,
+		HTTP:        &model.GRPCTranscodeHTTPRequest{Method: "post", Path: "/v1/shelves/3/books?request_id=abc", Body: `{"title": "Dune", "pages": 412}`},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", code, resp.Error)
+	}
+	if resp.Service != "library.Library" || resp.Method != "CreateBook" {
+		t.Errorf("Expected library.Library/CreateBook, got %s/%s", resp.Service, resp.Method)
+	}
+	if resp.GRPC == nil || resp.GRPC.StatusCode != 0 || !strings.Contains(resp.GRPC.Body, "shelves/3/books/abc") {
+		t.Fatalf("Expected gRPC success, got %+v", resp.GRPC)
+	}
+	if resp.REST != nil {
+		t.Errorf("Expected no REST call in grpc mode")
+	}
+
+	last := server.lastRequest()
+	book, _ := last["book"].(map[string]any)
+	if last["parent"] != "shelves/3" || last["requestId"] != "abc" || book["title"] != "Dune" || book["pages"] != float64(412) {
+		t.Errorf("Unexpected request at the server: %v", last)
+	}
+}
+
+func TestGRPCTranscode_ReflectionWithAuth(t *testing.T) {
+	// Every call, reflection included, must carry the bearer token
+	authorized := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); len(values) == 0 || values[0] != "Bearer s3cret" {
+			return status.Error(codes.Unauthenticated, "missing token")
+		}
+		return nil
+	}
+	var reflections atomic.Int32
+	addr, _, cleanup := startLibraryGRPCServer(t,
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := authorized(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authorized(ss.Context()); err != nil {
+				return err
+			}
+			reflections.Add(1)
+			return handler(srv, ss)
+		}),
+	)
+	defer cleanup()
+
+	code, resp := postJSON[model.GRPCTranscodeResponse](t, setupGRPCRouter(), "/grpc/transcode", model.GRPCTranscodeRequest{
+		GRPCRequest: model.GRPCRequest{
+			ServerAddress: addr,
+			Service:       "library.Library",
+			UseReflection: true,
+			Auth:          &model.AuthConfig{Type: "bearer", Token: "s3cret"},
+		},
+		Mode: transcodeModeGRPC,
+		HTTP: &model.GRPCTranscodeHTTPRequest{Method: "GET", Path: "/v1/shelves/1/books/b1"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", code, resp.Error)
+	}
+	if resp.GRPC == nil || resp.GRPC.StatusCode != 0 || resp.Method != "GetBook" {
+		t.Fatalf("Expected GetBook to succeed, got %s %+v", resp.Method, resp.GRPC)
+	}
+	if n := reflections.Load(); n != 1 {
+		t.Errorf("Expected one reflection lookup, got %d", n)
+	}
+}
+
+func TestGRPCTranscode_SelectMethod(t *testing.T) {
+	services, _, err := transcodeServices(model.GRPCTranscodeRequest{
+		GRPCRequest: model.GRPCRequest{ProtoFile: libraryProto},
+		HTTP:        &model.GRPCTranscodeHTTPRequest{},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An escaped slash stays inside the single-segment variable
+	methodDesc, binding, vars, query, err := selectTranscodeMethod(model.GRPCTranscodeRequest{
+		HTTP: &model.GRPCTranscodeHTTPRequest{Method: "GET", Path: "/v1/books/b%2F1?view=BASIC"},
+	}, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if methodDesc.Name() != "GetBook" || binding.index != 1 || vars["book_id"] != "b/1" {
+		t.Errorf("Expected GetBook binding 1 with book_id b/1, got %s %d %v", methodDesc.Name(), binding.index, vars)
+	}
+	if query.Get("view") != "BASIC" {
+		t.Errorf("Expected the query parameters back, got %v", query)
+	}
+
+	methodDesc, _, _, _, err = selectTranscodeMethod(model.GRPCTranscodeRequest{
+		HTTP: &model.GRPCTranscodeHTTPRequest{Method: "POST", Path: "/v1/books:search"},
+	}, services)
+	if err != nil || methodDesc.Name() != "SearchBooks" {
+		t.Errorf("Expected SearchBooks, got %v %v", methodDesc, err)
+	}
+}
+
+func TestGRPCTranscode_Compare(t *testing.T) {
+	addr, _, cleanup := startLibraryGRPCServer(t)
+	defer cleanup()
+	gateway := &libraryGateway{}
+	gatewayServer := httptest.NewServer(gateway)
+	defer gatewayServer.Close()
+
+	compare := func(method, body string) model.GRPCTranscodeResponse {
+		t.Helper()
+		code, resp := postJSON[model.GRPCTranscodeResponse](t, setupGRPCRouter(), "/grpc/transcode", model.GRPCTranscodeRequest{
+			GRPCRequest: model.GRPCRequest{
+				ServerAddress: addr,
+				Service:       "library.Library",
+				Method:        method,
+				Body:          body,
+				ProtoFile:     libraryProto,
+				RequestID:     "req-1",
+			},
+			Mode:       transcodeModeCompare,
+			GatewayURL: gatewayServer.URL + "/",
+		})
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", code, resp.Error)
+		}
+		if resp.Equivalent == nil || resp.GRPC == nil || resp.REST == nil {
+			t.Fatalf("Expected both sides to be called, got %+v", resp)
+		}
+		return resp
+	}
+
+	resp := compare("GetBook", `{"name": "shelves/1/books/2", "view": "FULL"}`)
+	if !*resp.Equivalent {
+		t.Errorf("Expected equivalent responses, got differences %v", resp.Differences)
+	}
+	if gateway.lastURL != "/v1/shelves/1/books/2?view=FULL" {
+		t.Errorf("Unexpected gateway request %s", gateway.lastURL)
+	}
+
+	// Root span with the two calls as children, each with its own execution
+	if len(resp.Spans) != 3 || resp.Spans[0].ParentSpanID != "" {
+		t.Fatalf("Expected a root span and two children, got %+v", resp.Spans)
+	}
+	for _, span := range resp.Spans[1:] {
+		if span.ParentSpanID != resp.SpanID || span.TraceID != resp.TraceID {
+			t.Errorf("Expected child of %s in trace %s, got %+v", resp.SpanID, resp.TraceID, span)
+		}
+	}
+	if resp.Spans[0].Tags["transcode.equivalent"] != "true" || resp.Spans[0].Tags["transcode.http_rule"] != "GET /v1/{name=shelves/*/books/*}" {
+		t.Errorf("Unexpected root span tags %v", resp.Spans[0].Tags)
+	}
+	if resp.GRPC.ExecutionID == "" || resp.REST.ExecutionID == "" || resp.GRPC.ExecutionID == resp.REST.ExecutionID {
+		t.Errorf("Expected one execution per call, got %q and %q", resp.GRPC.ExecutionID, resp.REST.ExecutionID)
+	}
+
+	// response_body selects the repeated field on the REST side
+	resp = compare("SearchBooks", `{"query": "go"}`)
+	if !*resp.Equivalent {
+		t.Errorf("Expected equivalent search responses, got differences %v", resp.Differences)
+	}
+
+	// Errors compare by the mapped HTTP status and message
+	resp = compare("GetBook", `{"name": "shelves/1/books/missing"}`)
+	if !*resp.Equivalent || resp.GRPC.StatusCode != int(codes.NotFound) || resp.REST.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected equivalent NOT_FOUND, got %d / %d %v", resp.GRPC.StatusCode, resp.REST.StatusCode, resp.Differences)
+	}
+
+	gateway.mu.Lock()
+	gateway.skew = true
+	gateway.mu.Unlock()
+	resp = compare("GetBook", `{"name": "shelves/1/books/2"}`)
+	if *resp.Equivalent || len(resp.Differences) != 1 || !strings.HasPrefix(resp.Differences[0], "title") {
+		t.Errorf("Expected a title difference, got %v", resp.Differences)
+	}
+	if resp.Spans[0].Status != "ERROR" {
+		t.Errorf("Expected the root span to fail on differences, got %s", resp.Spans[0].Status)
+	}
+}
+
+func TestGRPCTranscode_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     model.GRPCTranscodeRequest
+		wantErr string
+	}{
+		{
+			name:    "unknown mode",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "GetBook", ProtoFile: libraryProto}, Mode: "both"},
+			wantErr: "Unsupported mode",
+		},
+		{
+			name:    "missing gateway",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "GetBook", ProtoFile: libraryProto}, Mode: transcodeModeREST},
+			wantErr: "gateway_url is required",
+		},
+		{
+			name:    "no annotation",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "Ping", ProtoFile: libraryProto}},
+			wantErr: "no google.api.http annotation",
+		},
+		{
+			name:    "binding out of range",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "CreateBook", ProtoFile: libraryProto}, Binding: 1},
+			wantErr: "out of range",
+		},
+		{
+			name:    "empty path variable",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "GetBook", Body: `{}`, ProtoFile: libraryProto}},
+			wantErr: "name is empty",
+		},
+		{
+			name:    "multi-segment variable outside its pattern",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{Service: "library.Library", Method: "GetBook", Body: `{"name": "books/1"}`, ProtoFile: libraryProto}},
+			wantErr: "does not match the template pattern",
+		},
+		{
+			name:    "no matching route",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{ProtoFile: libraryProto}, HTTP: &model.GRPCTranscodeHTTPRequest{Method: "DELETE", Path: "/v1/shelves/1"}},
+			wantErr: "No google.api.http binding matches DELETE /v1/shelves/1",
+		},
+		{
+			name:    "unknown query parameter",
+			req:     model.GRPCTranscodeRequest{GRPCRequest: model.GRPCRequest{ProtoFile: libraryProto}, HTTP: &model.GRPCTranscodeHTTPRequest{Method: "GET", Path: "/v1/shelves/1/books/2?colour=red"}},
+			wantErr: "query parameter colour",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCTranscodeResponse](t, setupGRPCRouter(), "/grpc/transcode", tt.req)
+			if code != http.StatusBadRequest || !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("Expected 400 containing %q, got %d: %s", tt.wantErr, code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestPathTemplate_Match(t *testing.T) {
+	template, err := parsePathTemplate("/v1/{name=projects/*/docs/**}:export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, ok := template.match("/v1/projects/p1/docs/a/b%20c:export")
+	if !ok || vars["name"] != "projects/p1/docs/a/b c" {
+		t.Errorf("Expected a multi-segment match, got %v %v", vars, ok)
+	}
+	if _, ok := template.match("/v1/projects/p1/docs/a"); ok {
+		t.Error("Expected the verb to be required")
+	}
+
+	for _, invalid := range []string{"v1/books", "/v1/{name", "/v1//books", "/v1/{=*}"} {
+		if _, err := parsePathTemplate(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// jsonEqual compares two JSON documents, treating empty strings as equal
+func jsonEqual(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return fmt.Sprint(va) == fmt.Sprint(vb)
+}
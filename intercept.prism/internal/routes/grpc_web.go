@@ -0,0 +1,472 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yendelevium/intercept.prism/model"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Wire protocols selectable through GRPCRequest.Protocol
+const (
+	grpcProtocolNative  = "grpc"
+	grpcProtocolWeb     = "grpc-web"
+	grpcProtocolWebText = "grpc-web-text"
+	grpcProtocolConnect = "connect"
+)
+
+// grpcProtocol validates the requested wire protocol, defaulting to native gRPC
+func grpcProtocol(reqBody model.GRPCRequest) (string, error) {
+	switch reqBody.Protocol {
+	case "", grpcProtocolNative:
+		return grpcProtocolNative, nil
+	case grpcProtocolWeb, grpcProtocolWebText, grpcProtocolConnect:
+		return reqBody.Protocol, nil
+	default:
+		return "", fmt.Errorf("Unsupported protocol '%s', expected grpc, grpc-web, grpc-web-text or connect", reqBody.Protocol)
+	}
+}
+
+// grpcHTTPTransports shares one http.Transport per TLS config between gRPC-Web and Connect
+// calls, so keep-alive connections survive from one request to the next
+var grpcHTTPTransports = struct {
+	sync.Mutex
+	byKey map[string]*http.Transport
+}{byKey: make(map[string]*http.Transport)}
+
+// grpcHTTPTransport returns the shared transport for the request's TLS settings, creating it if needed
+func grpcHTTPTransport(reqBody model.GRPCRequest) (*http.Transport, error) {
+	key := grpcConnKey(model.GRPCRequest{UseTLS: reqBody.UseTLS, TLS: reqBody.TLS})
+
+	grpcHTTPTransports.Lock()
+	defer grpcHTTPTransports.Unlock()
+	if transport, ok := grpcHTTPTransports.byKey[key]; ok {
+		return transport, nil
+	}
+
+	// Idle connections are dropped on the same schedule as the native pool's
+	transport := &http.Transport{ForceAttemptHTTP2: true, IdleConnTimeout: grpcConns.idleTimeout}
+	if reqBody.UseTLS {
+		tlsConfig, err := buildGRPCTLSConfig(reqBody.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	grpcHTTPTransports.byKey[key] = transport
+	return transport, nil
+}
+
+// grpcHTTPURL builds the POST URL for a method. The server address may carry its own
+// scheme and path prefix (e.g. "https://api.example.com/rpc"), otherwise use_tls picks the scheme
+func grpcHTTPURL(reqBody model.GRPCRequest, fullMethod string) string {
+	base := reqBody.ServerAddress
+	if !strings.Contains(base, "://") {
+		scheme := "http"
+		if reqBody.UseTLS {
+			scheme = "https"
+		}
+		base = scheme + "://" + base
+	}
+	return strings.TrimSuffix(base, "/") + fullMethod
+}
+
+// invokeGRPCOverHTTP performs a unary call using gRPC-Web, gRPC-Web-text or Connect.
+// TLS targets negotiate HTTP/2 through ALPN and fall back to HTTP/1.1, plaintext targets use HTTP/1.1.
+// RPC failures are returned as gRPC status errors, like conn.Invoke does
+func invokeGRPCOverHTTP(ctx context.Context, target *grpcTarget, reqBody model.GRPCRequest, md metadata.MD, reqMsg, respMsg proto.Message) (metadata.MD, metadata.MD, *model.GRPCTLSInfo, error) {
+	protocol, options := target.protocol, target.options
+
+	payload, err := proto.Marshal(reqMsg)
+	if err != nil {
+		return nil, nil, nil, status.Errorf(codes.Internal, "failed to encode request: %v", err)
+	}
+	if err := options.checkSendSize(len(payload)); err != nil {
+		return nil, nil, nil, err
+	}
+	compressed := options.compression != ""
+	if compressed {
+		payload = gzipBytes(payload)
+	}
+
+	var body []byte
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, grpcHTTPURL(reqBody, target.fullMethod()), nil)
+	if err != nil {
+		return nil, nil, nil, status.Errorf(codes.InvalidArgument, "invalid server address: %v", err)
+	}
+	for key, values := range md {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	if options.userAgent != "" {
+		httpReq.Header.Set("User-Agent", options.userAgent)
+	}
+
+	timeoutMs := int64(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = max(time.Until(deadline).Milliseconds(), 1)
+	}
+
+	switch protocol {
+	case grpcProtocolConnect:
+		body = payload
+		httpReq.Header.Set("Content-Type", "application/proto")
+		httpReq.Header.Set("Connect-Protocol-Version", "1")
+		if timeoutMs > 0 {
+			httpReq.Header.Set("Connect-Timeout-Ms", strconv.FormatInt(timeoutMs, 10))
+		}
+		if compressed {
+			httpReq.Header.Set("Content-Encoding", "gzip")
+		}
+		// Set explicitly so the transport hands back the body untouched, including gzip encoded errors
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+	case grpcProtocolWeb, grpcProtocolWebText:
+		flag := byte(0x00)
+		if compressed {
+			flag = 0x01
+			httpReq.Header.Set("Grpc-Encoding", "gzip")
+		}
+		httpReq.Header.Set("Grpc-Accept-Encoding", "gzip")
+		body = grpcWebFrame(flag, payload)
+		httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+		if protocol == grpcProtocolWebText {
+			body = []byte(base64.StdEncoding.EncodeToString(body))
+			httpReq.Header.Set("Content-Type", "application/grpc-web-text")
+			httpReq.Header.Set("Accept", "application/grpc-web-text")
+		}
+		httpReq.Header.Set("X-Grpc-Web", "1")
+		if timeoutMs > 0 {
+			httpReq.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", timeoutMs))
+		}
+	}
+	httpReq.Body = io.NopCloser(bytes.NewReader(body))
+	httpReq.ContentLength = int64(len(body))
+	if reqBody.Authority != "" {
+		httpReq.Host = reqBody.Authority
+	}
+
+	// Record whether the shared transport had a keep-alive connection ready
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			target.overhead.ConnectionReused = info.Reused
+		},
+	}))
+
+	resp, err := (&http.Client{Transport: target.transport}).Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, nil, nil, status.Errorf(codes.Unavailable, "HTTP request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tlsInfo *model.GRPCTLSInfo
+	if resp.TLS != nil {
+		tlsInfo = tlsStateInfo(*resp.TLS, reqBody.TLS)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, tlsInfo, status.Errorf(codes.Unavailable, "failed to read response: %v", err)
+	}
+
+	var headers, trailers metadata.MD
+	if protocol == grpcProtocolConnect {
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			raw, err = gunzipBytes(raw)
+			if err != nil {
+				return headerMetadata(resp.Header), nil, tlsInfo, status.Errorf(codes.Internal, "invalid gzip response: %v", err)
+			}
+		}
+		headers, trailers, err = decodeConnectResponse(resp, raw, respMsg, options)
+	} else {
+		if protocol == grpcProtocolWebText {
+			raw, err = decodeGRPCWebText(raw)
+			if err != nil {
+				return headerMetadata(resp.Header), nil, tlsInfo, status.Errorf(codes.Internal, "invalid grpc-web-text response: %v", err)
+			}
+		}
+		headers, trailers, err = decodeGRPCWebResponse(resp, raw, respMsg, options)
+	}
+	return headers, trailers, tlsInfo, err
+}
+
+// grpcWebFrame prefixes a payload with the 1 byte flag and 4 byte big-endian length of a gRPC frame
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	return frame
+}
+
+// decodeGRPCWebText decodes a grpc-web-text body. Servers may base64 encode every frame
+// separately, so the body can be several padded chunks back to back
+func decodeGRPCWebText(raw []byte) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(raw)), "")
+	var out []byte
+	for len(text) > 0 {
+		end := len(text)
+		for i := 0; i+4 <= len(text); i += 4 {
+			if strings.Contains(text[i:i+4], "=") {
+				end = i + 4
+				break
+			}
+		}
+		chunk, err := base64.StdEncoding.DecodeString(text[:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+		text = text[end:]
+	}
+	return out, nil
+}
+
+// decodeGRPCWebResponse reads the data frame into respMsg and the status from the trailer frame.
+// Trailers-only responses carry the status in the HTTP headers instead
+func decodeGRPCWebResponse(resp *http.Response, raw []byte, respMsg proto.Message, options grpcCallOptions) (metadata.MD, metadata.MD, error) {
+	headers := headerMetadata(resp.Header)
+	trailers := metadata.MD{}
+	gotMessage := false
+
+	for len(raw) > 0 {
+		if len(raw) < 5 {
+			return headers, trailers, status.Error(codes.Internal, "truncated gRPC-Web frame header")
+		}
+		flag := raw[0]
+		length := binary.BigEndian.Uint32(raw[1:5])
+		if uint64(len(raw)-5) < uint64(length) {
+			return headers, trailers, status.Error(codes.Internal, "truncated gRPC-Web frame")
+		}
+		payload := raw[5 : 5+length]
+		raw = raw[5+length:]
+
+		switch {
+		case flag&0x80 != 0:
+			trailers = parseGRPCWebTrailers(payload)
+		case !gotMessage:
+			if flag&0x01 != 0 {
+				encoding := resp.Header.Get("Grpc-Encoding")
+				if encoding != "gzip" {
+					return headers, trailers, status.Errorf(codes.Unimplemented, "unsupported grpc-encoding %q", encoding)
+				}
+				var err error
+				if payload, err = gunzipBytes(payload); err != nil {
+					return headers, trailers, status.Errorf(codes.Internal, "invalid gzip message: %v", err)
+				}
+			}
+			if err := options.checkRecvSize(len(payload)); err != nil {
+				return headers, trailers, err
+			}
+			if err := proto.Unmarshal(payload, respMsg); err != nil {
+				return headers, trailers, status.Errorf(codes.Internal, "failed to decode response: %v", err)
+			}
+			gotMessage = true
+		}
+	}
+
+	// Prefer the trailer frame, fall back to a trailers-only response
+	statusMD := trailers
+	if len(statusMD.Get("grpc-status")) == 0 {
+		statusMD = headers
+	}
+	st := grpcStatusFromMetadata(statusMD, resp.StatusCode)
+	for _, md := range []metadata.MD{headers, trailers} {
+		delete(md, "grpc-status")
+		delete(md, "grpc-message")
+		delete(md, "grpc-status-details-bin")
+	}
+
+	if st.Code() != codes.OK {
+		return headers, trailers, st.Err()
+	}
+	if !gotMessage {
+		return headers, trailers, status.Error(codes.Internal, "gRPC-Web response contained no message")
+	}
+	return headers, trailers, nil
+}
+
+// parseGRPCWebTrailers parses the "key: value\r\n" block of a gRPC-Web trailer frame
+func parseGRPCWebTrailers(payload []byte) metadata.MD {
+	trailers := metadata.MD{}
+	for _, line := range strings.Split(string(payload), "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		trailers.Append(strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value))
+	}
+	return trailers
+}
+
+// grpcStatusFromMetadata reads grpc-status, the percent-encoded grpc-message and any
+// google.rpc.Status in grpc-status-details-bin. Without a grpc-status the HTTP status is mapped the way gRPC clients do
+func grpcStatusFromMetadata(md metadata.MD, httpStatus int) *status.Status {
+	values := md.Get("grpc-status")
+	if len(values) == 0 {
+		if httpStatus != http.StatusOK {
+			return status.New(httpStatusToGRPCCode(httpStatus), http.StatusText(httpStatus))
+		}
+		return status.New(codes.Internal, "response is missing grpc-status")
+	}
+
+	code, err := strconv.Atoi(values[0])
+	if err != nil {
+		return status.Newf(codes.Internal, "invalid grpc-status %q", values[0])
+	}
+	message := ""
+	if msgs := md.Get("grpc-message"); len(msgs) > 0 {
+		message, err = url.PathUnescape(msgs[0])
+		if err != nil {
+			message = msgs[0]
+		}
+	}
+	st := status.New(codes.Code(code), message)
+
+	// The full status carries error details; trust it only when it agrees with grpc-status
+	if bins := md.Get("grpc-status-details-bin"); len(bins) > 0 {
+		raw, err := decodeBinaryHeader(bins[0])
+		if err == nil {
+			detailed := &spb.Status{}
+			if proto.Unmarshal(raw, detailed) == nil && detailed.GetCode() == int32(code) {
+				st = status.FromProto(detailed)
+			}
+		}
+	}
+	return st
+}
+
+// decodeBinaryHeader decodes a "-bin" metadata value, which may or may not be padded
+func decodeBinaryHeader(value string) ([]byte, error) {
+	if len(value)%4 == 0 {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+// connectError is the JSON body of a failed Connect unary call
+type connectError struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message"`
+	Details []connectErrorDetail `json:"details"`
+}
+
+// connectErrorDetail is a google.protobuf.Any in Connect's JSON error form
+type connectErrorDetail struct {
+	Type  string `json:"type"`  // Fully-qualified message name
+	Value string `json:"value"` // Base64 encoded message, usually unpadded
+}
+
+// Connect error code names and their gRPC equivalents
+var connectCodes = map[string]codes.Code{
+	"canceled":            codes.Canceled,
+	"unknown":             codes.Unknown,
+	"invalid_argument":    codes.InvalidArgument,
+	"deadline_exceeded":   codes.DeadlineExceeded,
+	"not_found":           codes.NotFound,
+	"already_exists":      codes.AlreadyExists,
+	"permission_denied":   codes.PermissionDenied,
+	"resource_exhausted":  codes.ResourceExhausted,
+	"failed_precondition": codes.FailedPrecondition,
+	"aborted":             codes.Aborted,
+	"out_of_range":        codes.OutOfRange,
+	"unimplemented":       codes.Unimplemented,
+	"internal":            codes.Internal,
+	"unavailable":         codes.Unavailable,
+	"data_loss":           codes.DataLoss,
+	"unauthenticated":     codes.Unauthenticated,
+}
+
+// decodeConnectResponse reads a Connect unary response. Trailers arrive as "Trailer-" prefixed headers
+// and errors as a JSON body on a non-200 status
+func decodeConnectResponse(resp *http.Response, raw []byte, respMsg proto.Message, options grpcCallOptions) (metadata.MD, metadata.MD, error) {
+	headers := metadata.MD{}
+	trailers := metadata.MD{}
+	for key, values := range resp.Header {
+		lower := strings.ToLower(key)
+		if name, ok := strings.CutPrefix(lower, "trailer-"); ok {
+			trailers.Append(name, values...)
+		} else {
+			headers.Append(lower, values...)
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var connectErr connectError
+		if err := json.Unmarshal(raw, &connectErr); err != nil || connectErr.Code == "" {
+			return headers, trailers, status.Error(httpStatusToGRPCCode(resp.StatusCode), http.StatusText(resp.StatusCode))
+		}
+		code, ok := connectCodes[connectErr.Code]
+		if !ok {
+			code = codes.Unknown
+		}
+		detailed := &spb.Status{Code: int32(code), Message: connectErr.Message}
+		for _, detail := range connectErr.Details {
+			value, err := decodeBinaryHeader(detail.Value)
+			if err != nil {
+				continue
+			}
+			detailed.Details = append(detailed.Details, &anypb.Any{
+				TypeUrl: "type.googleapis.com/" + detail.Type,
+				Value:   value,
+			})
+		}
+		return headers, trailers, status.FromProto(detailed).Err()
+	}
+
+	if err := options.checkRecvSize(len(raw)); err != nil {
+		return headers, trailers, err
+	}
+	if err := proto.Unmarshal(raw, respMsg); err != nil {
+		return headers, trailers, status.Errorf(codes.Internal, "failed to decode response: %v", err)
+	}
+	return headers, trailers, nil
+}
+
+// httpStatusToGRPCCode maps an HTTP status without gRPC status information to a gRPC code
+func httpStatusToGRPCCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// headerMetadata converts HTTP response headers to lower-cased gRPC metadata
+func headerMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range header {
+		md.Append(key, values...)
+	}
+	return md
+}
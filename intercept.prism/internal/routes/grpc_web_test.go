@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// startGRPCWebServer serves testpkg.Greeter/SayHello over gRPC-Web, gRPC-Web-text and Connect.
+// The name "missing" fails with NOT_FOUND. Request headers are stored in lastHeaders
+func startGRPCWebServer(t *testing.T) (*httptest.Server, *http.Header) {
+	t.Helper()
+
+	methodDesc, err := parseTestProto()
+	if err != nil {
+		t.Fatalf("Failed to parse test proto: %v", err)
+	}
+
+	lastHeaders := &http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lastHeaders = r.Header.Clone()
+		if r.URL.Path != "/testpkg.Greeter/SayHello" {
+			http.NotFound(w, r)
+			return
+		}
+
+		raw, _ := io.ReadAll(r.Body)
+		contentType := r.Header.Get("Content-Type")
+		isText := contentType == "application/grpc-web-text"
+		if strings.HasPrefix(contentType, "application/grpc-web") {
+			if isText {
+				raw, _ = base64.StdEncoding.DecodeString(string(raw))
+			}
+			raw = raw[5:]
+		}
+
+		reqMsg := dynamicpb.NewMessage(methodDesc.Input())
+		if err := proto.Unmarshal(raw, reqMsg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := reqMsg.Get(methodDesc.Input().Fields().ByName("name")).String()
+
+		respMsg := dynamicpb.NewMessage(methodDesc.Output())
+		respMsg.Set(methodDesc.Output().Fields().ByName("message"), protoreflect.ValueOfString(fmt.Sprintf("Hello, %s!", name)))
+		payload, _ := proto.Marshal(respMsg)
+
+		if contentType == "application/proto" {
+			if name == "missing" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code": "not_found", "message": "no such user"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/proto")
+			w.Header().Set("Trailer-X-Served-By", "connect")
+			w.Write(payload)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if name == "missing" {
+			// Trailers-only response
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "no%20such%20user")
+			return
+		}
+
+		frames := [][]byte{
+			grpcWebFrame(0x00, payload),
+			grpcWebFrame(0x80, []byte("grpc-status: 0\r\ngrpc-message: \r\nx-served-by: grpc-web\r\n")),
+		}
+		for _, frame := range frames {
+			if isText {
+				// Encode frames separately, as streaming servers do
+				frame = []byte(base64.StdEncoding.EncodeToString(frame))
+			}
+			w.Write(frame)
+		}
+	}))
+	return server, lastHeaders
+}
+
+func TestGRPCRoute_WebProtocols(t *testing.T) {
+	server, lastHeaders := startGRPCWebServer(t)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		protocol string
+		trailer  string
+	}{
+		{grpcProtocolWeb, "grpc-web"},
+		{grpcProtocolWebText, "grpc-web"},
+		{grpcProtocolConnect, "connect"},
+	} {
+		t.Run(tc.protocol, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: server.URL,
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				Body:          `{"name": "Web"}`,
+				ProtoFile:     testProto,
+				Protocol:      tc.protocol,
+				Metadata:      map[string]string{"x-api-key": "secret"},
+			})
+			if code != http.StatusOK || resp.StatusCode != 0 {
+				t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+			}
+
+			var bodyMap map[string]any
+			json.Unmarshal([]byte(resp.Body), &bodyMap)
+			if bodyMap["message"] != "Hello, Web!" {
+				t.Errorf("Expected 'Hello, Web!', got %v", bodyMap)
+			}
+			if resp.ResponseTrailers["x-served-by"] != tc.trailer {
+				t.Errorf("Expected x-served-by trailer %q, got %v", tc.trailer, resp.ResponseTrailers)
+			}
+			if _, ok := resp.ResponseTrailers["grpc-status"]; ok {
+				t.Error("Expected grpc-status to be stripped from trailers")
+			}
+			if resp.Spans[0].Tags["grpc.protocol"] != tc.protocol {
+				t.Errorf("Expected grpc.protocol tag %q, got %v", tc.protocol, resp.Spans[0].Tags)
+			}
+			if lastHeaders.Get("X-Api-Key") != "secret" || lastHeaders.Get("Traceparent") == "" {
+				t.Errorf("Expected metadata and traceparent as HTTP headers, got %v", *lastHeaders)
+			}
+		})
+	}
+}
+
+func TestGRPCRoute_WebProtocolErrors(t *testing.T) {
+	server, _ := startGRPCWebServer(t)
+	defer server.Close()
+
+	for _, protocol := range []string{grpcProtocolWeb, grpcProtocolWebText, grpcProtocolConnect} {
+		t.Run(protocol, func(t *testing.T) {
+			code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+				ServerAddress: server.URL,
+				Service:       "testpkg.Greeter",
+				Method:        "SayHello",
+				Body:          `{"name": "missing"}`,
+				ProtoFile:     testProto,
+				Protocol:      protocol,
+			})
+			if code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", code)
+			}
+			if resp.StatusCode != int(codes.NotFound) || resp.Error != "no such user" {
+				t.Errorf("Expected NOT_FOUND 'no such user', got %d: %s", resp.StatusCode, resp.Error)
+			}
+		})
+	}
+}
+
+func TestGRPCRoute_WebProtocolsShareTransport(t *testing.T) {
+	server, _ := startGRPCWebServer(t)
+	defer server.Close()
+
+	reqBody := model.GRPCRequest{
+		ServerAddress: server.URL,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "Reuse"}`,
+		ProtoFile:     testProto,
+		Protocol:      grpcProtocolConnect,
+	}
+	for i := range 2 {
+		code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", reqBody)
+		if code != http.StatusOK || resp.StatusCode != 0 {
+			t.Fatalf("Expected success, got %d / %d: %s", code, resp.StatusCode, resp.Error)
+		}
+		if i == 1 && !resp.Timings.ConnectionReused {
+			t.Error("Expected the second call to reuse the HTTP connection")
+		}
+	}
+
+	// No native connection is dialled for an HTTP protocol
+	grpcConns.mu.Lock()
+	_, pooled := grpcConns.conns[grpcConnKey(reqBody)]
+	grpcConns.mu.Unlock()
+	if pooled {
+		t.Error("Expected no pooled gRPC connection for a Connect call")
+	}
+}
+
+func TestGRPCRoute_UnsupportedProtocol(t *testing.T) {
+	code, resp := postJSON[model.GRPCResponse](t, setupGRPCRouter(), "/grpc/", model.GRPCRequest{
+		ServerAddress: "localhost:50051",
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		ProtoFile:     testProto,
+		Protocol:      "soap",
+	})
+	if code != http.StatusBadRequest || !strings.Contains(resp.Error, "soap") {
+		t.Errorf("Expected 400 naming the protocol, got %d: %s", code, resp.Error)
+	}
+}
+
+func TestDecodeGRPCWebText_Chunks(t *testing.T) {
+	first := grpcWebFrame(0x00, []byte("a"))
+	second := grpcWebFrame(0x80, []byte("grpc-status: 0\r\n"))
+	encoded := base64.StdEncoding.EncodeToString(first) + base64.StdEncoding.EncodeToString(second)
+
+	decoded, err := decodeGRPCWebText([]byte(encoded))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded) != len(first)+len(second) || binary.BigEndian.Uint32(decoded[1:5]) != 1 {
+		t.Errorf("Unexpected decoded frames: %q", decoded)
+	}
+}
@@ -9,5 +9,7 @@ func AddRoutes(superRouter *gin.RouterGroup) {
 	restRoutes(superRouter)
 	graphqlRoutes(superRouter)
 	grpcRoutes(superRouter)
+	oauth2Routes(superRouter)
+	cookieRoutes(superRouter)
 	tracing.RegisterOTLPReceiver(superRouter)
 }
@@ -0,0 +1,248 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/store"
+	"github.com/yendelevium/intercept.prism/internal/tracing"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// oauth2Client calls token endpoints
+var oauth2Client = &http.Client{Timeout: 30 * time.Second}
+
+func oauth2Routes(superRouter *gin.RouterGroup) {
+	oauth2Router := superRouter.Group("/oauth2")
+	{
+		oauth2Router.POST("/token", fetchOAuth2TokenHandler)
+		oauth2Router.POST("/authorize", authorizeOAuth2)
+		oauth2Router.GET("/callback", oauth2Callback)
+		oauth2Router.DELETE("/tokens", clearOAuth2Tokens)
+	}
+}
+
+// fetchOAuth2Token resolves an oauth2 auth block into its access token before the request
+// is built. Calls to the token endpoint become child spans of the request's span and are
+// returned for the response; a cached token adds none. The status is for the caller's reply
+func fetchOAuth2Token(cfg *model.AuthConfig, workspaceID, traceID, parentSpanID string) ([]model.SpanInfo, int, error) {
+	if cfg == nil || !strings.EqualFold(cfg.Type, "oauth2") || cfg.Token != "" {
+		return nil, http.StatusOK, nil
+	}
+	token, fetches, _, err := auth.OAuth2Tokens.Token(oauth2Client, workspaceID, cfg.OAuth2, false)
+
+	var spans []model.SpanInfo
+	for _, fetch := range fetches {
+		spans = append(spans, recordOAuth2Fetch(fetch, traceID, parentSpanID))
+	}
+	switch {
+	case errors.Is(err, auth.ErrAuthorizationRequired):
+		return spans, http.StatusUnauthorized, err
+	case err != nil && len(fetches) > 0:
+		return spans, http.StatusBadGateway, err
+	case err != nil:
+		return spans, http.StatusBadRequest, err
+	}
+	cfg.Token = token.AccessToken
+	return spans, http.StatusOK, nil
+}
+
+// recordOAuth2Fetch queues the span of one token endpoint call
+func recordOAuth2Fetch(fetch *auth.TokenFetch, traceID, parentSpanID string) model.SpanInfo {
+	status := "OK"
+	tags := map[string]string{
+		"oauth2.grant_type": fetch.GrantType,
+		"oauth2.token_url":  fetch.TokenURL,
+		"http.status_code":  fmt.Sprintf("%d", fetch.StatusCode),
+	}
+	if fetch.Err != nil {
+		status = "ERROR"
+		tags["error.message"] = fetch.Err.Error()
+	}
+
+	span := model.SpanInfo{
+		SpanID:       tracing.GenerateSpanID(),
+		TraceID:      traceID,
+		ParentSpanID: parentSpanID,
+		Operation:    fmt.Sprintf("OAuth2 %s", fetch.GrantType),
+		ServiceName:  "intercept.prism",
+		StartTime:    fetch.Start.UnixMicro(),
+		Duration:     fetch.Duration.Microseconds(),
+		Status:       status,
+		Tags:         tags,
+	}
+	record := store.SpanRecord{
+		ID:           uuid.New().String(),
+		TraceID:      span.TraceID,
+		SpanID:       span.SpanID,
+		ParentSpanID: span.ParentSpanID,
+		Operation:    span.Operation,
+		ServiceName:  span.ServiceName,
+		StartTime:    span.StartTime,
+		Duration:     span.Duration,
+		Status:       span.Status,
+		Tags:         span.Tags,
+	}
+	store.AddSpan(record)
+	tracing.Hub.Publish(record)
+	return span
+}
+
+// fetchOAuth2TokenHandler godoc
+// @Summary      Fetch an OAuth2 access token
+// @Description  Returns the cached token for the workspace and configuration, refreshing it when it has expired, or runs the client_credentials, password or refresh_token grant.
+// @Description  Executors do the same for an `auth` block of type `oauth2`, so calling this first is only needed to inspect the token or to warm the cache. Token endpoint calls are returned as spans
+// @Tags         OAuth2
+// @Accept       json
+// @Produce      json
+// @Param        request body model.OAuth2TokenRequest true "Token configuration"
+// @Success      200 {object} model.OAuth2TokenResponse "Access token"
+// @Failure      400 {object} model.OAuth2TokenResponse "Invalid configuration"
+// @Failure      401 {object} model.OAuth2TokenResponse "An authorization_code configuration has not been authorized yet"
+// @Failure      502 {object} model.OAuth2TokenResponse "The token endpoint failed or refused the grant"
+// @Router       /oauth2/token [post]
+func fetchOAuth2TokenHandler(c *gin.Context) {
+	reqBody := model.OAuth2TokenRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.OAuth2TokenResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+
+	traceID := tracing.GenerateTraceID()
+	token, fetches, source, err := auth.OAuth2Tokens.Token(oauth2Client, reqBody.WorkspaceID, &reqBody.OAuth2, reqBody.ForceRefresh)
+	response := model.OAuth2TokenResponse{Source: source}
+	if len(fetches) > 0 {
+		response.TraceID = traceID
+		for _, fetch := range fetches {
+			response.Spans = append(response.Spans, recordOAuth2Fetch(fetch, traceID, ""))
+		}
+	}
+
+	if err != nil {
+		response.StatusCode = http.StatusBadRequest
+		if errors.Is(err, auth.ErrAuthorizationRequired) {
+			response.StatusCode = http.StatusUnauthorized
+		} else if len(fetches) > 0 {
+			response.StatusCode = http.StatusBadGateway
+		}
+		response.Error = err.Error()
+		c.JSON(response.StatusCode, response)
+		return
+	}
+
+	response.StatusCode = http.StatusOK
+	response.AccessToken = token.AccessToken
+	response.TokenType = token.TokenType
+	response.Scope = token.Scope
+	response.Refreshable = token.RefreshToken != ""
+	if !token.Expiry.IsZero() {
+		response.ExpiresAt = token.Expiry.UTC().Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// authorizeOAuth2 godoc
+// @Summary      Start an OAuth2 authorization code flow
+// @Description  Returns the provider's authorization URL with a PKCE S256 challenge. Open it in a browser; the provider redirects to `redirect_uri`, by default this server's /oauth2/callback, which exchanges the code and caches the token for the workspace.
+// @Description  Requests using the same configuration then send that token, refreshing it when it expires
+// @Tags         OAuth2
+// @Accept       json
+// @Produce      json
+// @Param        request body model.OAuth2AuthorizeRequest true "authorization_code configuration"
+// @Success      200 {object} model.OAuth2AuthorizeResponse "URL to open"
+// @Failure      400 {object} model.OAuth2AuthorizeResponse "Invalid configuration"
+// @Router       /oauth2/authorize [post]
+func authorizeOAuth2(c *gin.Context) {
+	reqBody := model.OAuth2AuthorizeRequest{}
+	if err := c.BindJSON(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.OAuth2AuthorizeResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+	if reqBody.OAuth2.RedirectURI == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		reqBody.OAuth2.RedirectURI = fmt.Sprintf("%s://%s/oauth2/callback", scheme, c.Request.Host)
+	}
+
+	authURL, state, err := auth.OAuth2Tokens.Authorize(reqBody.WorkspaceID, reqBody.OAuth2)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.OAuth2AuthorizeResponse{StatusCode: http.StatusBadRequest, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.OAuth2AuthorizeResponse{
+		StatusCode:       http.StatusOK,
+		AuthorizationURL: authURL,
+		State:            state,
+		RedirectURI:      reqBody.OAuth2.RedirectURI,
+	})
+}
+
+// oauth2Callback godoc
+// @Summary      OAuth2 redirect target
+// @Description  Receives the authorization code from the provider, exchanges it with the PKCE verifier and caches the token. Answers with a page the user can close
+// @Tags         OAuth2
+// @Produce      html
+// @Param        state query string true "State returned by /oauth2/authorize"
+// @Param        code query string false "Authorization code"
+// @Param        error query string false "Error reported by the provider"
+// @Success      200 {string} string "Authorization complete"
+// @Failure      400 {string} string "Unknown state or the provider refused"
+// @Failure      502 {string} string "The code exchange failed"
+// @Router       /oauth2/callback [get]
+func oauth2Callback(c *gin.Context) {
+	page := func(code int, message string) {
+		c.Data(code, "text/html; charset=utf-8", []byte(fmt.Sprintf(
+			"<!doctype html><title>intercept.prism</title><p>%s</p>", html.EscapeString(message))))
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		auth.OAuth2Tokens.Cancel(c.Query("state"))
+		page(http.StatusBadRequest, fmt.Sprintf("Authorization failed: %s %s", providerErr, c.Query("error_description")))
+		return
+	}
+	if c.Query("code") == "" {
+		page(http.StatusBadRequest, "Authorization failed: no code in the redirect")
+		return
+	}
+
+	_, fetch, err := auth.OAuth2Tokens.Callback(oauth2Client, c.Query("state"), c.Query("code"))
+	if fetch != nil {
+		recordOAuth2Fetch(fetch, tracing.GenerateTraceID(), "")
+	}
+	if err != nil {
+		code := http.StatusBadRequest
+		if fetch != nil {
+			code = http.StatusBadGateway
+		}
+		page(code, fmt.Sprintf("Authorization failed: %v", err))
+		return
+	}
+	page(http.StatusOK, "Authorization complete, you can close this window.")
+}
+
+// clearOAuth2Tokens godoc
+// @Summary      Forget cached OAuth2 tokens
+// @Description  Drops every cached access and refresh token of a workspace, so the next request runs its grant again
+// @Tags         OAuth2
+// @Produce      json
+// @Param        workspace_id query string true "Workspace ID"
+// @Success      200 {object} model.OAuth2ClearResponse "Tokens dropped"
+// @Failure      400 {object} model.OAuth2ClearResponse "Missing workspace_id"
+// @Router       /oauth2/tokens [delete]
+func clearOAuth2Tokens(c *gin.Context) {
+	workspaceID := c.Query("workspace_id")
+	if workspaceID == "" {
+		c.JSON(http.StatusBadRequest, model.OAuth2ClearResponse{StatusCode: http.StatusBadRequest, Error: "workspace_id is required"})
+		return
+	}
+	c.JSON(http.StatusOK, model.OAuth2ClearResponse{StatusCode: http.StatusOK, Cleared: auth.OAuth2Tokens.Clear(workspaceID)})
+}
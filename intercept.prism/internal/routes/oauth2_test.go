@@ -0,0 +1,182 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func setupOAuth2Router() *gin.Engine {
+	r := gin.New()
+	restRoutes(r.Group("/"))
+	oauth2Routes(r.Group("/"))
+	return r
+}
+
+// newTokenEndpoint issues numbered tokens. With a PKCE challenge set it only accepts the
+// matching verifier
+func newTokenEndpoint() (*httptest.Server, *int, *string) {
+	calls := 0
+	challenge := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r.ParseForm()
+		if challenge != "" {
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, calls)
+	}))
+	return server, &calls, &challenge
+}
+
+func TestRestRoute_OAuth2(t *testing.T) {
+	router := setupOAuth2Router()
+	tokenServer, tokenCalls, _ := newTokenEndpoint()
+	defer tokenServer.Close()
+
+	var authorization string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	send := func() (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(model.RestRequest{
+			Method:      "GET",
+			URL:         mockServer.URL,
+			WorkspaceID: "ws-rest-oauth2",
+			Auth: &model.AuthConfig{Type: "oauth2", OAuth2: &model.OAuth2Config{
+				GrantType:    "client_credentials",
+				TokenURL:     tokenServer.URL,
+				ClientID:     "app",
+				ClientSecret: "{{clientSecret}}",
+			}},
+			Environment: map[string]string{"clientSecret": "s3cret"},
+		})
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := send()
+	if code != http.StatusOK || authorization != "Bearer token-1" {
+		t.Fatalf("Expected the fetched token to be sent, got %d %q %s", code, authorization, resp.Error)
+	}
+	if len(resp.Spans) != 2 {
+		t.Fatalf("Expected the request span and a token span, got %d", len(resp.Spans))
+	}
+	tokenSpan := resp.Spans[1]
+	if tokenSpan.ParentSpanID != resp.SpanID || tokenSpan.Operation != "OAuth2 client_credentials" || tokenSpan.Tags["http.status_code"] != "200" {
+		t.Errorf("Unexpected token span %+v", tokenSpan)
+	}
+	if resp.Spans[0].Tags["auth.type"] != "oauth2" || resp.Spans[0].Tags["auth.oauth2.client_id"] != "app" {
+		t.Errorf("Expected oauth2 tags, got %v", resp.Spans[0].Tags)
+	}
+
+	// The second request uses the cached token and makes no token span
+	code, resp = send()
+	if code != http.StatusOK || authorization != "Bearer token-1" || *tokenCalls != 1 || len(resp.Spans) != 1 {
+		t.Errorf("Expected the cached token, got %d %q after %d token calls, %d spans", code, authorization, *tokenCalls, len(resp.Spans))
+	}
+
+	// Clearing the workspace forces a new fetch
+	req, _ := http.NewRequest("DELETE", "/oauth2/tokens?workspace_id=ws-rest-oauth2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var cleared model.OAuth2ClearResponse
+	json.Unmarshal(w.Body.Bytes(), &cleared)
+	if cleared.Cleared != 1 {
+		t.Errorf("Expected one token cleared, got %+v", cleared)
+	}
+	send()
+	if authorization != "Bearer token-2" {
+		t.Errorf("Expected a new token after clearing, got %q", authorization)
+	}
+}
+
+func TestOAuth2Route_AuthorizationCode(t *testing.T) {
+	router := setupOAuth2Router()
+	tokenServer, _, challenge := newTokenEndpoint()
+	defer tokenServer.Close()
+
+	var authorization string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	cfg := model.OAuth2Config{
+		GrantType:        "authorization_code",
+		TokenURL:         tokenServer.URL,
+		ClientID:         "app",
+		AuthorizationURL: "https://idp.example.com/authorize",
+	}
+	execute := func() (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(model.RestRequest{
+			Method:      "GET",
+			URL:         mockServer.URL,
+			WorkspaceID: "ws-code",
+			Auth:        &model.AuthConfig{Type: "oauth2", OAuth2: &cfg},
+		})
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	if code, _ := execute(); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 before the flow is completed, got %d", code)
+	}
+
+	jsonBody, _ := json.Marshal(model.OAuth2AuthorizeRequest{WorkspaceID: "ws-code", OAuth2: cfg})
+	req, _ := http.NewRequest("POST", "/oauth2/authorize", bytes.NewBuffer(jsonBody))
+	req.Host = "localhost:7000"
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var started model.OAuth2AuthorizeResponse
+	json.Unmarshal(w.Body.Bytes(), &started)
+	if started.RedirectURI != "http://localhost:7000/oauth2/callback" {
+		t.Fatalf("Expected the default redirect URI, got %+v", started)
+	}
+	authURL, _ := url.Parse(started.AuthorizationURL)
+	*challenge = authURL.Query().Get("code_challenge")
+
+	// The provider redirects the browser back with the code
+	req, _ = http.NewRequest("GET", "/oauth2/callback?code=abc&state="+url.QueryEscape(started.State), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the code exchange to succeed, got %d %s", w.Code, w.Body.String())
+	}
+
+	if code, resp := execute(); code != http.StatusOK || authorization != "Bearer token-1" {
+		t.Errorf("Expected the authorized token to be sent, got %d %q %s", code, authorization, resp.Error)
+	}
+}
@@ -10,6 +10,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/extract"
 	"github.com/yendelevium/intercept.prism/internal/store"
 	"github.com/yendelevium/intercept.prism/internal/tracing"
 	"github.com/yendelevium/intercept.prism/model"
@@ -25,14 +28,23 @@ func restRoutes(superRouter *gin.RouterGroup) {
 
 // executeRequest godoc
 // @Summary      Execute an HTTP request
-// @Description  Proxies an HTTP request to a target URL with tracing enabled
+// @Description  Proxies an HTTP request to a target URL with tracing enabled.
+// @Description  `{{name}}` in the URL, headers and body is replaced with the value from `environment`, and helpers such as `{{$uuid}}`, `{{$timestamp}}`, `{{$isoTimestamp}}`, `{{$randomInt 1 10}}`, `{{$base64 text}}` and `{{$hmac sha256 key message}}` are evaluated. When an `environment` is sent, unresolved variables are rejected with 400; without one they are sent as written
+// @Description  `auth` adds Basic, Bearer, API key (header or query), Digest, AWS Signature V4 or HMAC credentials to the resolved request. Digest answers the server's 401 challenge with a second request. Secrets never appear in span tags
+// @Description  With a `session_id`, which requires a `workspace_id`, cookies set by responses are kept in a jar for the workspace and session and sent with later requests that use it, following domain, path, secure and expiry rules. See /cookies
+// @Description  `assertions` check the status, headers, JSONPath or XPath values, body regex, JSON Schema, size or latency of the response. Results are returned and stored with the execution, and any failure marks the span as failed
+// @Description  Paths are a subset, and unsupported syntax is rejected with 400. JSONPath supports `$`, `.name`, `['name']`, `[n]`, `[-n]`, `[start:end]`, `*`, `..` and unions like `[0,2]`, but not filter expressions `[?(...)]` or script expressions. XPath supports `/`, `//`, names, `*`, `@attr`, `text()`, `node()`, `.`, `..` and `count(path)`, with the predicates `[n]`, `[last()]`, `[@a]`, `[@a='v']`, `[name='v']`, `contains()` and `starts-with()`; other axes, functions and operators are not supported. JSON Schema checks type, enum, const, the numeric, string, array and object constraints, allOf, anyOf, oneOf, not and local `$ref` (`#/...`); `format`, remote `$ref`, `if`/`then`/`else`, `dependentSchemas` and `unevaluatedProperties` are ignored
+// @Description  `extract` pulls values out of the response by JSONPath or XPath (the subsets above), regex (first capture group) or header name into the `variables` of `extracted`, to be sent in the `environment` of the next request. With `save_to_environment`, they are also written to that environment of `workspace_id`; values are never put in span tags
+// @Description  An `oauth2` auth block fetches an access token with its grant and caches it per `workspace_id`, which it requires, until it expires, refreshing it when possible; token endpoint calls are returned as child spans
 // @Tags         REST
 // @Accept       json
 // @Produce      json
 // @Param        request body model.RestRequest true "Request configuration"
 // @Success      200 {object} model.RestResponse "Successful response with tracing info"
 // @Failure      400 {object} model.RestResponse "Invalid request body"
+// @Failure      401 {object} model.RestResponse "An oauth2 authorization_code configuration has not been authorized yet"
 // @Failure      500 {object} model.RestResponse "Request execution failed"
+// @Failure      502 {object} model.RestResponse "The OAuth2 token endpoint failed"
 // @Router       /rest/ [post]
 func executeRequest(c *gin.Context) {
 	// Get the request details
@@ -47,6 +59,15 @@ func executeRequest(c *gin.Context) {
 	}
 	log.Println("Request Received")
 
+	// Resolve {{variables}} from the request's environment
+	if err := expandRestRequest(&reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, model.RestResponse{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
 	// Get the request ID from the body
 	requestID := reqBody.RequestID
 
@@ -55,42 +76,97 @@ func executeRequest(c *gin.Context) {
 	spanID := tracing.GenerateSpanID()
 	traceID := tracing.GenerateTraceID()
 
-	// Construct the request
-	remoteBody := strings.NewReader(reqBody.Body)
-	remoteReq, err := http.NewRequest(reqBody.Method, reqBody.URL, remoteBody)
+	// Fetch or reuse the OAuth2 access token, with token endpoint calls under the request's span
+	tokenSpans, code, err := fetchOAuth2Token(reqBody.Auth, reqBody.WorkspaceID, traceID, spanID)
+	if err != nil {
+		c.JSON(code, model.RestResponse{
+			StatusCode: code,
+			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
+			Spans:      tokenSpans,
+		})
+		return
+	}
+
+	// Make the request and queue its span
+	call, err := sendRestRequest(reqBody, traceID, spanID, "")
 	if err != nil {
 		response := model.RestResponse{
 			StatusCode: http.StatusInternalServerError,
 			Error:      err.Error(),
+			TraceID:    traceID,
+			SpanID:     spanID,
 		}
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	// Add the headers
-	for key, value := range reqBody.Headers {
-		remoteReq.Header.Set(key, value)
-	}
+	// Queue records for async DB write
+	store.AddExecution(store.ExecutionRecord{
+		ID:         executionID,
+		RequestID:  requestID,
+		TraceID:    traceID,
+		StatusCode: call.response.StatusCode,
+		LatencyMs:  int(call.duration.Milliseconds()),
+		Assertions: call.response.Assertions,
+	})
+
+	log.Println("Queued Execution, and Span for async DB write")
+
+	// Save extracted variables so the next request of a chain can use them
+	saveExtracted(call.response.Extracted, reqBody.Extract, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+
+	// Construct and Send Final Response
+	finalResponse := call.response
+	finalResponse.RequestID = requestID
+	finalResponse.ExecutionID = executionID
+	finalResponse.Spans = append(finalResponse.Spans, tokenSpans...)
+	c.JSON(http.StatusOK, finalResponse)
+}
+
+// restCall is the outcome of sendRestRequest
+type restCall struct {
+	response model.RestResponse
+	duration time.Duration
+}
+
+// sendRestRequest makes the HTTP request with a traceparent header and queues its span.
+// The error is set when no response was received. parentSpanID is empty for root spans
+func sendRestRequest(reqBody model.RestRequest, traceID, spanID, parentSpanID string) (*restCall, error) {
+	// Construct the request. Digest auth builds it a second time to answer the challenge
+	newRequest := func() (*http.Request, error) {
+		remoteBody := strings.NewReader(reqBody.Body)
+		remoteReq, err := http.NewRequest(reqBody.Method, reqBody.URL, remoteBody)
+		if err != nil {
+			return nil, err
+		}
+
+		// Add the headers
+		for key, value := range reqBody.Headers {
+			remoteReq.Header.Set(key, value)
+		}
 
-	// Inject W3C Trace Context headers for distributed tracing
-	traceparent := fmt.Sprintf("00-%s-%s-01", traceID, spanID)
-	remoteReq.Header.Set("traceparent", traceparent)
+		// Add credentials, signing the request as it will be sent
+		if err := auth.Apply(remoteReq, reqBody.Auth); err != nil {
+			return nil, err
+		}
+
+		// Inject W3C Trace Context headers for distributed tracing
+		traceparent := fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+		remoteReq.Header.Set("traceparent", traceparent)
+		return remoteReq, nil
+	}
 
 	// Make the request
-	reqClient := http.Client{
+	reqClient := &http.Client{
 		Timeout: 30 * time.Second,
+		Jar:     sessionJar(reqBody.WorkspaceID, reqBody.SessionID),
 	}
 	requestStart := time.Now()
-	remoteResponse, err := reqClient.Do(remoteReq)
+	remoteResponse, err := auth.Send(reqClient, reqBody.Auth, newRequest)
 	if err != nil {
-		response := model.RestResponse{
-			StatusCode: http.StatusInternalServerError,
-			Error:      err.Error(),
-			TraceID:    traceID,
-			SpanID:     spanID,
-		}
-		c.JSON(http.StatusInternalServerError, response)
-		return
+		return nil, err
 	}
 	defer remoteResponse.Body.Close()
 
@@ -98,13 +174,7 @@ func executeRequest(c *gin.Context) {
 	responseBodyBytes, err := io.ReadAll(remoteResponse.Body)
 	responseEnd := time.Now()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.RestResponse{
-			StatusCode: http.StatusInternalServerError,
-			Error:      "Failed to read response body",
-			TraceID:    traceID,
-			SpanID:     spanID,
-		})
-		return
+		return nil, fmt.Errorf("Failed to read response body")
 	}
 
 	totalDuration := responseEnd.Sub(requestStart)
@@ -127,59 +197,66 @@ func executeRequest(c *gin.Context) {
 		"http.url":         reqBody.URL,
 		"http.status_code": fmt.Sprintf("%d", remoteResponse.StatusCode),
 	}
+	auth.Tags(tags, reqBody.Auth)
+	addCookieTags(tags, reqBody.SessionID, len(remoteResponse.Request.Cookies()), len(remoteResponse.Cookies()))
 
-	// Queue records for async DB write
-	store.AddExecution(store.ExecutionRecord{
-		ID:         executionID,
-		RequestID:  requestID,
-		TraceID:    traceID,
+	// Check the response before the span is recorded, a failed assertion fails the span
+	results := assertions.Evaluate(reqBody.Assertions, assertions.Response{
 		StatusCode: remoteResponse.StatusCode,
-		LatencyMs:  int(totalDuration.Milliseconds()),
+		Headers:    respHeaders,
+		Body:       responseBodyBytes,
+		Latency:    totalDuration,
 	})
+	if addAssertionTags(tags, results) {
+		status = "ERROR"
+	}
+	extracted := extract.Run(reqBody.Extract, extract.Response{Headers: respHeaders, Body: responseBodyBytes})
+	addExtractTags(tags, extracted)
 
 	spanRecord := store.SpanRecord{
-		ID:          uuid.New().String(),
-		TraceID:     traceID,
-		SpanID:      spanID,
-		Operation:   fmt.Sprintf("%s %s", reqBody.Method, reqBody.URL),
-		ServiceName: "intercept.prism",
-		StartTime:   requestStart.UnixMicro(),
-		Duration:    totalDuration.Microseconds(),
-		Status:      status,
-		Tags:        tags,
+		ID:           uuid.New().String(),
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentSpanID,
+		Operation:    fmt.Sprintf("%s %s", reqBody.Method, reqBody.URL),
+		ServiceName:  "intercept.prism",
+		StartTime:    requestStart.UnixMicro(),
+		Duration:     totalDuration.Microseconds(),
+		Status:       status,
+		Tags:         tags,
 	}
 
 	store.AddSpan(spanRecord)
 	tracing.Hub.Publish(spanRecord)
 
-	log.Println("Queued Execution, and Span for async DB write")
-
 	// Build span info for response (for client-side display)
 	rootSpan := model.SpanInfo{
-		SpanID:      spanID,
-		TraceID:     traceID,
-		Operation:   fmt.Sprintf("%s %s", reqBody.Method, reqBody.URL),
-		ServiceName: "intercept.prism",
-		StartTime:   requestStart.UnixMicro(),
-		Duration:    totalDuration.Microseconds(),
-		Status:      status,
-		Tags:        tags,
-	}
-
-	// Construct and Send Final Response
-	finalResponse := model.RestResponse{
-		Duration:     fmt.Sprintf("%vms", totalDuration.Milliseconds()),
-		StatusCode:   remoteResponse.StatusCode,
-		Body:         string(responseBodyBytes),
-		Headers:      respHeaders,
-		Error:        "",
-		ResponseSize: int64(len(responseBodyBytes)),
-		RequestSize:  int64(len(reqBody.Body)),
-		RequestID:    requestID,
-		ExecutionID:  executionID,
-		TraceID:      traceID,
 		SpanID:       spanID,
-		Spans:        []model.SpanInfo{rootSpan},
+		TraceID:      traceID,
+		ParentSpanID: parentSpanID,
+		Operation:    fmt.Sprintf("%s %s", reqBody.Method, reqBody.URL),
+		ServiceName:  "intercept.prism",
+		StartTime:    requestStart.UnixMicro(),
+		Duration:     totalDuration.Microseconds(),
+		Status:       status,
+		Tags:         tags,
 	}
-	c.JSON(http.StatusOK, finalResponse)
+
+	return &restCall{
+		duration: totalDuration,
+		response: model.RestResponse{
+			Duration:     fmt.Sprintf("%vms", totalDuration.Milliseconds()),
+			StatusCode:   remoteResponse.StatusCode,
+			Body:         string(responseBodyBytes),
+			Headers:      respHeaders,
+			Error:        "",
+			ResponseSize: int64(len(responseBodyBytes)),
+			RequestSize:  int64(len(reqBody.Body)),
+			Assertions:   results,
+			Extracted:    extracted,
+			TraceID:      traceID,
+			SpanID:       spanID,
+			Spans:        []model.SpanInfo{rootSpan},
+		},
+	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,23 @@ func setupRouter() *gin.Engine {
 	return r
 }
 
+// postJSON posts body to path on router and decodes the JSON response into T
+func postJSON[T any](t *testing.T, router http.Handler, path string, body any) (int, T) {
+	t.Helper()
+
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp T
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
 func TestRestRoute_ValidRequest(t *testing.T) {
 	router := setupRouter()
 
@@ -284,3 +302,253 @@ func TestRestResponse_JSONSerialization(t *testing.T) {
 		t.Errorf("TraceID mismatch: expected %s, got %s", resp.TraceID, parsed.TraceID)
 	}
 }
+
+func TestRestRoute_Auth(t *testing.T) {
+	router := setupRouter()
+
+	var received *http.Request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	send := func(reqBody model.RestRequest) (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// Credentials come from the environment and stay out of the span tags
+	code, resp := send(model.RestRequest{
+		Method:      "GET",
+		URL:         mockServer.URL + "/books",
+		Auth:        &model.AuthConfig{Type: "apikey", Key: "api_key", Value: "{{apiKey}}", In: "query"},
+		Environment: map[string]string{"apiKey": "top-secret"},
+	})
+	if code != http.StatusOK || received.URL.Query().Get("api_key") != "top-secret" {
+		t.Fatalf("Expected the key in the query string, got %d %s", code, received.URL.RawQuery)
+	}
+	if received.Header.Get("traceparent") == "" {
+		t.Error("Expected traceparent alongside the credentials")
+	}
+	tags := resp.Spans[0].Tags
+	if tags["auth.type"] != "apikey" || tags["auth.key"] != "api_key" {
+		t.Errorf("Expected auth tags, got %v", tags)
+	}
+	for name, value := range tags {
+		if strings.Contains(value, "top-secret") {
+			t.Errorf("Tag %s leaks the API key: %s", name, value)
+		}
+	}
+
+	code, resp = send(model.RestRequest{
+		Method: "GET",
+		URL:    mockServer.URL,
+		Auth:   &model.AuthConfig{Type: "awsv4", AccessKeyID: "AKID"},
+	})
+	if code != http.StatusBadRequest || resp.Error != "auth: awsv4 requires secret_access_key, region, service" {
+		t.Errorf("Expected 400 for incomplete credentials, got %d %q", code, resp.Error)
+	}
+}
+
+func TestRestRoute_DigestAuth(t *testing.T) {
+	router := setupRouter()
+
+	calls := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Digest ") || !strings.Contains(authorization, `username="alice"`) {
+			w.Header().Set("WWW-Authenticate", `Digest realm="books", qop="auth", nonce="abc123"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	reqBody := model.RestRequest{
+		Method: "GET",
+		URL:    mockServer.URL + "/books",
+		Auth:   &model.AuthConfig{Type: "digest", Username: "alice", Password: "s3cret"},
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp model.RestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("Expected the challenge to be answered, got %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+func TestRestRoute_Assertions(t *testing.T) {
+	router := setupRouter()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 42, "name": "Ada"}`))
+	}))
+	defer mockServer.Close()
+
+	send := func(list []model.Assertion) (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(model.RestRequest{
+			Method:      "GET",
+			URL:         mockServer.URL,
+			Assertions:  list,
+			Environment: map[string]string{"userId": "42"},
+		})
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := send([]model.Assertion{
+		{Type: "status", Expected: "200"},
+		{Type: "jsonpath", Path: "$.id", Expected: "{{userId}}"},
+		{Type: "header", Path: "Content-Type", Operator: "contains", Expected: "json"},
+	})
+	if code != http.StatusOK || len(resp.Assertions) != 3 {
+		t.Fatalf("Expected three results, got %d %+v", code, resp.Assertions)
+	}
+	for _, result := range resp.Assertions {
+		if !result.Passed {
+			t.Errorf("Expected %s to pass, got %+v", result.Name, result)
+		}
+	}
+	if span := resp.Spans[0]; span.Status != "OK" || span.Tags["assertions.failed"] != "0" {
+		t.Errorf("Expected a passing span, got %s %v", span.Status, span.Tags)
+	}
+
+	// A failed assertion fails the span even though the target answered 200
+	code, resp = send([]model.Assertion{{Name: "has email", Type: "jsonpath", Path: "$.email"}})
+	if code != http.StatusOK || resp.Assertions[0].Passed {
+		t.Fatalf("Expected the assertion to fail, got %d %+v", code, resp.Assertions)
+	}
+	if span := resp.Spans[0]; span.Status != "ERROR" || span.Tags["assertions.failures"] != "has email" {
+		t.Errorf("Expected a failed span, got %s %v", span.Status, span.Tags)
+	}
+
+	code, resp = send([]model.Assertion{{Type: "regex", Expected: "("}})
+	if code != http.StatusBadRequest || !strings.HasPrefix(resp.Error, "assertion 1: invalid pattern") {
+		t.Errorf("Expected 400 for an invalid pattern, got %d %q", code, resp.Error)
+	}
+}
+
+func TestRestRoute_ExtractChain(t *testing.T) {
+	router := setupRouter()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Session", "s-17")
+			w.Write([]byte(`{"access_token": "tok-123", "user": {"id": 7}}`))
+		case "/me":
+			if r.Header.Get("Authorization") != "Bearer tok-123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id": 7}`))
+		}
+	}))
+	defer mockServer.Close()
+
+	send := func(reqBody model.RestRequest) (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// The login call's token feeds the next request's environment
+	code, login := send(model.RestRequest{
+		Method: "POST",
+		URL:    mockServer.URL + "/login",
+		Extract: []model.Extraction{
+			{Variable: "token", From: "jsonpath", Path: "$.access_token", Secret: true},
+			{Variable: "userId", From: "jsonpath", Path: "$.user.id"},
+			{Variable: "session", From: "header", Path: "x-session"},
+			{Variable: "refresh", From: "jsonpath", Path: "$.refresh_token"},
+		},
+	})
+	if code != http.StatusOK || login.Extracted == nil {
+		t.Fatalf("Expected extracted variables, got %d %+v", code, login)
+	}
+	vars := login.Extracted.Variables
+	if vars["token"] != "tok-123" || vars["userId"] != "7" || vars["session"] != "s-17" || len(vars) != 3 {
+		t.Errorf("Unexpected variables %v", vars)
+	}
+	if len(login.Extracted.Failures) != 1 || !strings.HasPrefix(login.Extracted.Failures[0], "refresh:") {
+		t.Errorf("Expected refresh to fail, got %q", login.Extracted.Failures)
+	}
+	tags := login.Spans[0].Tags
+	if tags["extract.variables"] != "session, token, userId" || tags["extract.failures"] != "1" || login.Spans[0].Status != "OK" {
+		t.Errorf("Unexpected span %s %v", login.Spans[0].Status, tags)
+	}
+	for _, value := range tags {
+		if strings.Contains(value, "tok-123") {
+			t.Errorf("Extracted value leaked into span tags: %v", tags)
+		}
+	}
+
+	code, me := send(model.RestRequest{
+		Method:      "GET",
+		URL:         mockServer.URL + "/me",
+		Headers:     map[string]string{"Authorization": "Bearer {{token}}"},
+		Environment: vars,
+	})
+	if code != http.StatusOK || me.StatusCode != http.StatusOK {
+		t.Errorf("Expected the chained call to be authorized, got %d %d", code, me.StatusCode)
+	}
+
+	// Saving needs the workspace, and without a database the request still succeeds
+	code, resp := send(model.RestRequest{
+		Method:            "POST",
+		URL:               mockServer.URL + "/login",
+		Extract:           []model.Extraction{{Variable: "token", From: "jsonpath", Path: "$.access_token"}},
+		SaveToEnvironment: "env-1",
+	})
+	if code != http.StatusBadRequest || resp.Error != "save_to_environment requires a workspace_id" {
+		t.Errorf("Expected 400 without a workspace, got %d %q", code, resp.Error)
+	}
+	code, resp = send(model.RestRequest{
+		Method:            "POST",
+		URL:               mockServer.URL + "/login",
+		Extract:           []model.Extraction{{Variable: "token", From: "jsonpath", Path: "$.access_token"}},
+		SaveToEnvironment: "env-1",
+		WorkspaceID:       "ws-1",
+	})
+	if code != http.StatusOK || resp.Extracted.Saved || resp.Extracted.EnvironmentID != "env-1" || resp.Extracted.SaveError != "no database connection" {
+		t.Errorf("Expected an unsaved result, got %d %+v", code, resp.Extracted)
+	}
+
+	code, resp = send(model.RestRequest{
+		Method:  "GET",
+		URL:     mockServer.URL + "/me",
+		Extract: []model.Extraction{{Variable: "id", From: "field", Path: "id"}},
+	})
+	if code != http.StatusBadRequest || resp.Error != "extract 1: field paths only apply to gRPC responses" {
+		t.Errorf("Expected 400 for a field path, got %d %q", code, resp.Error)
+	}
+}
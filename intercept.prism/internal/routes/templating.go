@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"fmt"
+
+	"github.com/yendelevium/intercept.prism/internal/assertions"
+	"github.com/yendelevium/intercept.prism/internal/auth"
+	"github.com/yendelevium/intercept.prism/internal/templating"
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+// expandRestRequest resolves {{variables}} and {{$helpers}} in the parts of a REST request
+// that are sent to the target
+func expandRestRequest(reqBody *model.RestRequest) error {
+	r := templating.New(reqBody.Environment)
+	reqBody.URL = r.Expand(reqBody.URL)
+	reqBody.Headers = r.ExpandMap(reqBody.Headers)
+	reqBody.Body = r.Expand(reqBody.Body)
+	expandAuth(r, reqBody.Auth)
+	expandAssertions(r, reqBody.Assertions)
+	expandExtractions(r, reqBody.Extract)
+	if err := expandErr(r, reqBody.Auth, reqBody.Assertions); err != nil {
+		return err
+	}
+	if err := validateSession(reqBody.WorkspaceID, reqBody.SessionID); err != nil {
+		return err
+	}
+	return validateExtract(reqBody.Extract, false, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+}
+
+// expandGraphQLRequest resolves templates in the URL, headers, query and the string values
+// of variables and connection params, including every operation of a batch
+func expandGraphQLRequest(reqBody *model.GraphQLRequest) error {
+	r := templating.New(reqBody.Environment)
+	reqBody.URL = r.Expand(reqBody.URL)
+	reqBody.Headers = r.ExpandMap(reqBody.Headers)
+	reqBody.Query = r.Expand(reqBody.Query)
+	reqBody.OperationName = r.Expand(reqBody.OperationName)
+	reqBody.Variables = expandJSONObject(r, reqBody.Variables)
+	reqBody.ConnectionParams = expandJSONObject(r, reqBody.ConnectionParams)
+	for i := range reqBody.Batch {
+		op := &reqBody.Batch[i]
+		op.Query = r.Expand(op.Query)
+		op.OperationName = r.Expand(op.OperationName)
+		op.Variables = expandJSONObject(r, op.Variables)
+	}
+	expandAuth(r, reqBody.Auth)
+	expandAssertions(r, reqBody.Assertions)
+	expandExtractions(r, reqBody.Extract)
+	if err := expandErr(r, reqBody.Auth, reqBody.Assertions); err != nil {
+		return err
+	}
+	if err := validateSession(reqBody.WorkspaceID, reqBody.SessionID); err != nil {
+		return err
+	}
+	return validateExtract(reqBody.Extract, false, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+}
+
+// expandGraphQLIntrospectRequest resolves templates in the URL, headers and auth
+func expandGraphQLIntrospectRequest(reqBody *model.GraphQLIntrospectRequest) error {
+	r := templating.New(reqBody.Environment)
+	reqBody.URL = r.Expand(reqBody.URL)
+	reqBody.Headers = r.ExpandMap(reqBody.Headers)
+	expandAuth(r, reqBody.Auth)
+	return expandErr(r, reqBody.Auth, nil)
+}
+
+// expandGraphQLSchemaDiffRequest resolves the endpoints of both sides of a comparison
+func expandGraphQLSchemaDiffRequest(reqBody *model.GraphQLSchemaDiffRequest) error {
+	r := templating.New(reqBody.Environment)
+	for _, source := range []*model.GraphQLSchemaSource{&reqBody.Base, &reqBody.Target} {
+		source.URL = r.Expand(source.URL)
+		source.Headers = r.ExpandMap(source.Headers)
+		expandAuth(r, source.Auth)
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if err := auth.Validate(reqBody.Base.Auth); err != nil {
+		return fmt.Errorf("base: %v", err)
+	}
+	if err := auth.Validate(reqBody.Target.Auth); err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	return nil
+}
+
+// expandGRPCRequest resolves templates in the target, metadata and the protojson messages
+func expandGRPCRequest(reqBody *model.GRPCRequest) error {
+	r := templating.New(reqBody.Environment)
+	expandGRPCFields(r, reqBody)
+	if err := expandErr(r, reqBody.Auth, reqBody.Assertions); err != nil {
+		return err
+	}
+	return validateExtract(reqBody.Extract, true, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+}
+
+// expandGRPCTranscodeRequest also covers the REST side of a transcoded call
+func expandGRPCTranscodeRequest(reqBody *model.GRPCTranscodeRequest) error {
+	r := templating.New(reqBody.Environment)
+	expandGRPCFields(r, &reqBody.GRPCRequest)
+	reqBody.GatewayURL = r.Expand(reqBody.GatewayURL)
+	reqBody.Headers = r.ExpandMap(reqBody.Headers)
+	if reqBody.HTTP != nil {
+		reqBody.HTTP.Path = r.Expand(reqBody.HTTP.Path)
+		reqBody.HTTP.Body = r.Expand(reqBody.HTTP.Body)
+	}
+	if err := expandErr(r, reqBody.Auth, reqBody.Assertions); err != nil {
+		return err
+	}
+	return validateExtract(reqBody.Extract, true, reqBody.SaveToEnvironment, reqBody.WorkspaceID)
+}
+
+func expandGRPCFields(r *templating.Resolver, reqBody *model.GRPCRequest) {
+	reqBody.ServerAddress = r.Expand(reqBody.ServerAddress)
+	reqBody.Authority = r.Expand(reqBody.Authority)
+	reqBody.Metadata = r.ExpandMap(reqBody.Metadata)
+	reqBody.Body = r.Expand(reqBody.Body)
+	for i, message := range reqBody.Messages {
+		reqBody.Messages[i] = r.Expand(message)
+	}
+	expandAuth(r, reqBody.Auth)
+	expandAssertions(r, reqBody.Assertions)
+	expandExtractions(r, reqBody.Extract)
+}
+
+// expandAuth resolves every credential field, so secrets can live in the environment
+func expandAuth(r *templating.Resolver, cfg *model.AuthConfig) {
+	if cfg == nil {
+		return
+	}
+	for _, field := range []*string{
+		&cfg.Type, &cfg.Username, &cfg.Password, &cfg.Token, &cfg.Scheme, &cfg.Key, &cfg.Value, &cfg.In,
+		&cfg.AccessKeyID, &cfg.SecretAccessKey, &cfg.SessionToken, &cfg.Region, &cfg.Service,
+		&cfg.Secret, &cfg.Algorithm, &cfg.Encoding, &cfg.SignatureHeader, &cfg.TimestampHeader,
+	} {
+		*field = r.Expand(*field)
+	}
+	if o := cfg.OAuth2; o != nil {
+		for _, field := range []*string{
+			&o.GrantType, &o.TokenURL, &o.ClientID, &o.ClientSecret, &o.ClientAuth, &o.Scope, &o.Audience,
+			&o.Username, &o.Password, &o.RefreshToken, &o.AuthorizationURL, &o.RedirectURI,
+		} {
+			*field = r.Expand(*field)
+		}
+		o.ExtraParams = r.ExpandMap(o.ExtraParams)
+	}
+}
+
+// expandAssertions resolves the paths and expected values, so a check can compare against
+// an environment value such as {{userId}}
+func expandAssertions(r *templating.Resolver, list []model.Assertion) {
+	for i := range list {
+		list[i].Path = r.Expand(list[i].Path)
+		list[i].Expected = r.Expand(list[i].Expected)
+	}
+}
+
+// expandErr reports unresolved references first, then an incomplete auth block or an
+// assertion that cannot be evaluated, all before anything is sent
+func expandErr(r *templating.Resolver, cfg *model.AuthConfig, list []model.Assertion) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if err := auth.Validate(cfg); err != nil {
+		return err
+	}
+	return assertions.Validate(list)
+}
+
+func expandJSONObject(r *templating.Resolver, object map[string]any) map[string]any {
+	if object == nil {
+		return nil
+	}
+	return r.ExpandValue(object).(map[string]any)
+}
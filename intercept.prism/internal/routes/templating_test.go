@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yendelevium/intercept.prism/model"
+)
+
+func TestRestRoute_Environment(t *testing.T) {
+	var path, auth, body string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		bodyBytes, _ := io.ReadAll(r.Body)
+		body = string(bodyBytes)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer mockServer.Close()
+
+	router := setupRouter()
+	send := func(reqBody model.RestRequest) (int, model.RestResponse) {
+		jsonBody, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/rest/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.RestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := send(model.RestRequest{
+		Method:      "POST",
+		URL:         "{{baseUrl}}/books/{{id}}",
+		Headers:     map[string]string{"Authorization": "Bearer {{token}}"},
+		Body:        `{"title": "{{title}}"}`,
+		Environment: map[string]string{"baseUrl": mockServer.URL, "id": "7", "token": "abc", "title": "Dune"},
+	})
+	if code != http.StatusOK || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the request to be sent, got %d %s", code, resp.Error)
+	}
+	if path != "/books/7" || auth != "Bearer abc" || body != `{"title": "Dune"}` {
+		t.Errorf("Expected resolved values, got path %q, auth %q, body %q", path, auth, body)
+	}
+	if resp.Spans[0].Tags["http.url"] != mockServer.URL+"/books/7" {
+		t.Errorf("Expected the span to show the resolved URL, got %s", resp.Spans[0].Tags["http.url"])
+	}
+
+	path = ""
+	code, resp = send(model.RestRequest{
+		Method:      "GET",
+		URL:         "{{baseUrl}}/books/{{id}}",
+		Headers:     map[string]string{"Authorization": "Bearer {{token}}"},
+		Environment: map[string]string{"baseUrl": mockServer.URL},
+	})
+	if code != http.StatusBadRequest || resp.Error != "Unresolved variables: id, token" {
+		t.Errorf("Expected 400 listing the unresolved variables, got %d %q", code, resp.Error)
+	}
+	if path != "" {
+		t.Error("Expected the target not to be called")
+	}
+}
+
+func TestGraphQLRoute_Environment(t *testing.T) {
+	var received graphqlRequestBody
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"book":null}}`))
+	}))
+	defer mockServer.Close()
+
+	code, resp := postJSON[model.GraphQLResponse](t, setupGraphQLRouter(), "/graphql/", model.GraphQLRequest{
+		URL:         "{{endpoint}}",
+		Query:       `query Book($id: ID!) { book(id: $id) { title } }`,
+		Variables:   map[string]interface{}{"id": "{{bookId}}", "first": 3},
+		Environment: map[string]string{"endpoint": mockServer.URL, "bookId": "b-1"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", code, resp.Error)
+	}
+	if received.Variables["id"] != "b-1" || received.Variables["first"] != float64(3) {
+		t.Errorf("Expected resolved variables, got %+v", received.Variables)
+	}
+}
+
+func TestGRPCRoute_Environment(t *testing.T) {
+	router := setupGRPCRouter()
+	addr, cleanup := startTestGRPCServer(t)
+	defer cleanup()
+
+	send := func(reqBody model.GRPCRequest) (int, model.GRPCResponse) {
+		jsonBody, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/grpc/", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.GRPCResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := send(model.GRPCRequest{
+		ServerAddress: "{{grpcHost}}",
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "{{name}}"}`,
+		ProtoFile:     testProto,
+		Environment:   map[string]string{"grpcHost": addr, "name": "Prism"},
+	})
+	if code != http.StatusOK || !strings.Contains(resp.Body, "Hello, Prism!") {
+		t.Errorf("Expected a resolved call, got %d %s %s", code, resp.Body, resp.Error)
+	}
+
+	code, resp = send(model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "{{name}}"}`,
+		ProtoFile:     testProto,
+		Metadata:      map[string]string{"x-api-key": "{{apiKey}}"},
+		Environment:   map[string]string{"grpcHost": addr},
+	})
+	if code != http.StatusBadRequest || resp.Error != "Unresolved variables: apiKey, name" {
+		t.Errorf("Expected 400 listing the unresolved variables, got %d %q", code, resp.Error)
+	}
+
+	// Without an environment, braces in the payload are sent as they are
+	code, resp = send(model.GRPCRequest{
+		ServerAddress: addr,
+		Service:       "testpkg.Greeter",
+		Method:        "SayHello",
+		Body:          `{"name": "{{#each users}}"}`,
+		ProtoFile:     testProto,
+	})
+	if code != http.StatusOK || !strings.Contains(resp.Body, "Hello, {{#each users}}!") {
+		t.Errorf("Expected the literal braces to be sent, got %d %s %s", code, resp.Body, resp.Error)
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/yendelevium/intercept.prism/internal/database"
+)
+
+// ErrEnvironmentNotFound is returned when the environment does not exist in the workspace
+var ErrEnvironmentNotFound = errors.New("environment not found in the workspace")
+
+// SaveEnvironmentVariables writes values into an environment's variables, updating rows
+// with the same key and appending the rest. Unlike executions and spans it is written
+// synchronously, so the next request of a chain sees the values. Read-only rows are left
+// as they are and their keys returned
+func SaveEnvironmentVariables(environmentID, workspaceID string, values map[string]string, secrets map[string]bool) ([]string, error) {
+	pool := database.GetPool()
+	if pool == nil {
+		return nil, fmt.Errorf("no database connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	queries := database.New(pool).WithTx(tx)
+
+	// The row stays locked until the update commits, so concurrent chains don't lose values
+	raw, err := queries.GetEnvironmentVariables(ctx, database.GetEnvironmentVariablesParams{
+		ID:          environmentID,
+		WorkspaceId: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEnvironmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, readonly, err := mergeVariables(raw, values, secrets)
+	if err != nil {
+		return nil, err
+	}
+	if err := queries.UpdateEnvironmentVariables(ctx, database.UpdateEnvironmentVariablesParams{
+		Variables: rows,
+		ID:        environmentID,
+	}); err != nil {
+		return nil, err
+	}
+	return readonly, tx.Commit(ctx)
+}
+
+// mergeVariables applies values to the environment's rows, which are stored as the
+// frontend's key/value editor rows. Fields the backend doesn't know are kept
+func mergeVariables(raw []byte, values map[string]string, secrets map[string]bool) ([]byte, []string, error) {
+	var rows []map[string]any
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, nil, fmt.Errorf("environment variables are not a list of rows: %v", err)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var readonly []string
+	for _, name := range names {
+		found := false
+		for _, row := range rows {
+			if key, _ := row["key"].(string); key != name {
+				continue
+			}
+			found = true
+			if locked, _ := row["readonly"].(bool); locked {
+				readonly = append(readonly, name)
+				continue
+			}
+			row["value"] = values[name]
+			if secrets[name] {
+				row["secret"] = true
+			}
+		}
+		if !found {
+			rows = append(rows, map[string]any{
+				"id":      uuid.New().String(),
+				"key":     name,
+				"value":   values[name],
+				"enabled": true,
+				"secret":  secrets[name],
+			})
+		}
+	}
+
+	encoded, err := json.Marshal(rows)
+	return encoded, readonly, err
+}
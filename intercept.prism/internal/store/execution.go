@@ -2,11 +2,13 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/yendelevium/intercept.prism/internal/database"
+	"github.com/yendelevium/intercept.prism/model"
 )
 
 // ExecutionRecord represents an execution to be persisted
@@ -16,6 +18,8 @@ type ExecutionRecord struct {
 	TraceID    string
 	StatusCode int
 	LatencyMs  int
+	ErrorCount int // Errors reported in a successful HTTP response, e.g. a GraphQL errors array
+	Assertions []model.AssertionResult
 }
 
 // Type implements Record interface
@@ -35,12 +39,19 @@ func (r *ExecutionRecord) Write() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var assertionsJSON []byte
+	if len(r.Assertions) > 0 {
+		assertionsJSON, _ = json.Marshal(r.Assertions)
+	}
+
 	_, err := queries.InsertExecution(ctx, database.InsertExecutionParams{
 		ID:         r.ID,
 		RequestId:  r.RequestID,
 		TraceId:    r.TraceID,
 		StatusCode: pgtype.Int4{Int32: int32(r.StatusCode), Valid: true},
 		LatencyMs:  pgtype.Int4{Int32: int32(r.LatencyMs), Valid: true},
+		ErrorCount: pgtype.Int4{Int32: int32(r.ErrorCount), Valid: true},
+		Assertions: assertionsJSON,
 	})
 	return err
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/yendelevium/intercept.prism/internal/database"
+	"github.com/yendelevium/intercept.prism/model"
 )
 
 // SpanRecord represents a span to be persisted
@@ -22,6 +23,7 @@ type SpanRecord struct {
     Duration     int64             `json:"duration"`
     Status       string            `json:"status,omitempty"`
     Tags         map[string]string `json:"tags,omitempty"`
+    Events       []model.SpanEvent `json:"events,omitempty"`
 }
 
 // Type implements Record interface
@@ -46,6 +48,11 @@ func (r *SpanRecord) Write() error {
 		tagsJSON, _ = json.Marshal(r.Tags)
 	}
 
+	var eventsJSON []byte
+	if len(r.Events) > 0 {
+		eventsJSON, _ = json.Marshal(r.Events)
+	}
+
 	params := database.InsertSpanParams{
 		ID:          r.ID,
 		TraceId:     r.TraceID,
@@ -65,6 +72,9 @@ func (r *SpanRecord) Write() error {
 	if tagsJSON != nil {
 		params.Tags = tagsJSON
 	}
+	if eventsJSON != nil {
+		params.Events = eventsJSON
+	}
 
 	return queries.InsertSpan(ctx, params)
 }
@@ -118,6 +128,13 @@ func GetSpansByTraceID(traceID string) ([]SpanRecord, error) {
 			}
 		}
 
+		if row.Events != nil {
+			var events []model.SpanEvent
+			if err := json.Unmarshal(row.Events, &events); err == nil {
+				record.Events = events
+			}
+		}
+
 		result = append(result, record)
 	}
 
@@ -0,0 +1,228 @@
+package templating
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Resolver expands {{name}} references to environment variables and {{$helper args}} calls in
+// request fields. References may be nested, e.g. {{$base64 {{user}}:{{password}}}}, and \{{
+// is a literal {{. Problems are collected across calls and reported together by Err
+type Resolver struct {
+	env        map[string]string
+	strict     bool      // Report unresolved variables, only when an environment was given
+	now        time.Time // Shared by the timestamp helpers so one request sees one time
+	unresolved map[string]bool
+	problems   []string
+}
+
+// Error lists every variable that had no value and every helper that could not be evaluated
+type Error struct {
+	Unresolved []string
+	Problems   []string
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, 2)
+	if len(e.Unresolved) > 0 {
+		parts = append(parts, "Unresolved variables: "+strings.Join(e.Unresolved, ", "))
+	}
+	parts = append(parts, e.Problems...)
+	return strings.Join(parts, "; ")
+}
+
+// New creates a resolver for one request. Without an environment, unknown references are
+// left as they are without an error, so payloads such as Handlebars templates that were
+// sent before templating existed keep working. Helpers are evaluated either way
+func New(env map[string]string) *Resolver {
+	return &Resolver{env: env, strict: env != nil, now: time.Now(), unresolved: map[string]bool{}}
+}
+
+// Err returns an *Error if any reference could not be resolved
+func (r *Resolver) Err() error {
+	if len(r.unresolved) == 0 && len(r.problems) == 0 {
+		return nil
+	}
+	unresolved := make([]string, 0, len(r.unresolved))
+	for name := range r.unresolved {
+		unresolved = append(unresolved, name)
+	}
+	sort.Strings(unresolved)
+	return &Error{Unresolved: unresolved, Problems: r.problems}
+}
+
+// Expand resolves the references in s. Unresolved references are left in place
+func (r *Resolver) Expand(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], `\{{`):
+			out.WriteString("{{")
+			i += 3
+		case strings.HasPrefix(s[i:], "{{"):
+			end := closingBraces(s, i+2)
+			if end < 0 {
+				out.WriteString(s[i:])
+				return out.String()
+			}
+			out.WriteString(r.evaluate(s[i+2 : end]))
+			i = end + 2
+		default:
+			out.WriteByte(s[i])
+			i++
+		}
+	}
+	return out.String()
+}
+
+// ExpandMap resolves the keys and values of a header or metadata map
+func (r *Resolver) ExpandMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	expanded := make(map[string]string, len(m))
+	for key, value := range m {
+		expanded[r.Expand(key)] = r.Expand(value)
+	}
+	return expanded
+}
+
+// ExpandValue resolves every string inside a decoded JSON value, such as GraphQL variables
+func (r *Resolver) ExpandValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.Expand(v)
+	case map[string]any:
+		expanded := make(map[string]any, len(v))
+		for key, item := range v {
+			expanded[r.Expand(key)] = r.ExpandValue(item)
+		}
+		return expanded
+	case []any:
+		expanded := make([]any, len(v))
+		for i, item := range v {
+			expanded[i] = r.ExpandValue(item)
+		}
+		return expanded
+	}
+	return value
+}
+
+// closingBraces finds the }} that closes the {{ before start, skipping nested references
+func closingBraces(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s)-1; {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			depth++
+			i += 2
+		case strings.HasPrefix(s[i:], "}}"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+			i += 2
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// evaluate resolves the inside of one {{...}}, after expanding any references nested in it
+func (r *Resolver) evaluate(raw string) string {
+	expr := strings.TrimSpace(r.Expand(raw))
+	if strings.HasPrefix(expr, "$") {
+		return r.helper(expr)
+	}
+	if expr == "" {
+		r.problems = append(r.problems, "Empty reference {{}}")
+		return "{{" + raw + "}}"
+	}
+	value, ok := r.env[expr]
+	if !ok {
+		if r.strict {
+			r.unresolved[expr] = true
+		}
+		return "{{" + raw + "}}"
+	}
+	return value
+}
+
+// helper evaluates a dynamic value such as {{$uuid}} or {{$hmac sha256 key message}}
+func (r *Resolver) helper(expr string) string {
+	name, rest, _ := strings.Cut(expr, " ")
+	rest = strings.TrimSpace(rest)
+	args := strings.Fields(rest)
+
+	switch name {
+	case "$uuid", "$guid":
+		return uuid.NewString()
+	case "$timestamp":
+		return strconv.FormatInt(r.now.Unix(), 10)
+	case "$timestampMs":
+		return strconv.FormatInt(r.now.UnixMilli(), 10)
+	case "$isoTimestamp":
+		return r.now.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	case "$randomInt":
+		low, high := 0, 1000
+		if len(args) > 0 {
+			var errLow, errHigh error
+			if len(args) == 2 {
+				low, errLow = strconv.Atoi(args[0])
+				high, errHigh = strconv.Atoi(args[1])
+			}
+			if len(args) != 2 || errLow != nil || errHigh != nil || high < low {
+				r.problems = append(r.problems, fmt.Sprintf("%s expects no arguments or an integer min and max, got %q", name, rest))
+				return ""
+			}
+		}
+		return strconv.Itoa(low + rand.IntN(high-low+1))
+	case "$base64":
+		return base64.StdEncoding.EncodeToString([]byte(rest))
+	case "$hmac", "$hmacBase64":
+		// The message is everything after the key, so it may contain spaces
+		if len(args) < 2 {
+			r.problems = append(r.problems, fmt.Sprintf("%s expects an algorithm, a key and a message", name))
+			return ""
+		}
+		newHash, ok := hmacAlgorithms[strings.ToLower(args[0])]
+		if !ok {
+			r.problems = append(r.problems, fmt.Sprintf("%s: unknown algorithm %s, expected sha1, sha256 or sha512", name, args[0]))
+			return ""
+		}
+		_, afterAlgorithm, _ := strings.Cut(rest, args[0])
+		_, message, _ := strings.Cut(strings.TrimSpace(afterAlgorithm), args[1])
+		mac := hmac.New(newHash, []byte(args[1]))
+		mac.Write([]byte(strings.TrimPrefix(message, " ")))
+		if name == "$hmacBase64" {
+			return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	r.problems = append(r.problems, fmt.Sprintf("Unknown helper %s", name))
+	return ""
+}
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
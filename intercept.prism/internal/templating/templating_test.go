@@ -0,0 +1,153 @@
+package templating
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestExpand_Variables(t *testing.T) {
+	r := New(map[string]string{"baseUrl": "https://api.example.com", "id": "42", "user": "alice", "password": "s3cret"})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{{baseUrl}}/books/{{ id }}", "https://api.example.com/books/42"},
+		{"no references", "no references"},
+		{`{"query": "{ book(id: {{id}}) { title } }"}`, `{"query": "{ book(id: 42) { title } }"}`},
+		{"Basic {{$base64 {{user}}:{{password}}}}", "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))},
+		{`\{{id}} stays`, "{{id}} stays"},
+		{"unterminated {{id", "unterminated {{id"},
+	}
+	for _, tt := range tests {
+		if got := r.Expand(tt.input); got != tt.expected {
+			t.Errorf("Expand(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestExpand_Unresolved(t *testing.T) {
+	r := New(map[string]string{"host": "example.com"})
+	got := r.Expand("https://{{host}}/{{version}}/{{path}}?token={{token}}&v={{version}}")
+	if got != "https://example.com/{{version}}/{{path}}?token={{token}}&v={{version}}" {
+		t.Errorf("Expected unresolved references to be kept, got %q", got)
+	}
+	r.Expand("{{$nope}}")
+
+	err := r.Err()
+	var templateErr *Error
+	if !errors.As(err, &templateErr) {
+		t.Fatalf("Expected an *Error, got %v", err)
+	}
+	if strings.Join(templateErr.Unresolved, ",") != "path,token,version" {
+		t.Errorf("Expected sorted unique names, got %v", templateErr.Unresolved)
+	}
+	if err.Error() != "Unresolved variables: path, token, version; Unknown helper $nope" {
+		t.Errorf("Unexpected message: %s", err.Error())
+	}
+}
+
+func TestExpand_NoEnvironment(t *testing.T) {
+	r := New(nil)
+	got := r.Expand("<p>{{#if user}}{{user.name}}{{/if}}</p> {{$base64 a}}")
+	if got != "<p>{{#if user}}{{user.name}}{{/if}}</p> YQ==" || r.Err() != nil {
+		t.Errorf("Expected unknown references to be kept without an error, got %q %v", got, r.Err())
+	}
+
+	// An empty environment is still an environment
+	r = New(map[string]string{})
+	r.Expand("{{user}}")
+	if err := r.Err(); err == nil || err.Error() != "Unresolved variables: user" {
+		t.Errorf("Expected user to be unresolved, got %v", err)
+	}
+}
+
+func TestExpand_Helpers(t *testing.T) {
+	r := New(nil)
+
+	if _, err := uuid.Parse(r.Expand("{{$uuid}}")); err != nil {
+		t.Errorf("Expected a UUID: %v", err)
+	}
+	if r.Expand("{{$uuid}}") == r.Expand("{{$uuid}}") {
+		t.Error("Expected a new UUID for every reference")
+	}
+
+	// Timestamps are taken once per resolver
+	seconds, _ := strconv.ParseInt(r.Expand("{{$timestamp}}"), 10, 64)
+	millis, _ := strconv.ParseInt(r.Expand("{{$timestampMs}}"), 10, 64)
+	if seconds != millis/1000 || time.Since(time.Unix(seconds, 0)) > time.Minute {
+		t.Errorf("Unexpected timestamps %d and %d", seconds, millis)
+	}
+	iso, err := time.Parse(time.RFC3339, r.Expand("{{$isoTimestamp}}"))
+	if err != nil || iso.UnixMilli() != millis {
+		t.Errorf("Expected an ISO timestamp matching %d, got %v (%v)", millis, iso, err)
+	}
+
+	for i := 0; i < 20; i++ {
+		n, err := strconv.Atoi(r.Expand("{{$randomInt 5 7}}"))
+		if err != nil || n < 5 || n > 7 {
+			t.Fatalf("Expected an integer in [5, 7], got %d (%v)", n, err)
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("GET /books 123"))
+	if got := r.Expand("{{$hmac sha256 key GET /books 123}}"); got != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected hex HMAC %s", got)
+	}
+	if got := r.Expand("{{$hmacBase64 SHA256 key GET /books 123}}"); got != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected base64 HMAC %s", got)
+	}
+
+	if err := r.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestExpand_HelperErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		problem string
+	}{
+		{"{{$randomInt 10}}", "$randomInt expects no arguments or an integer min and max"},
+		{"{{$randomInt 9 1}}", "$randomInt expects no arguments or an integer min and max"},
+		{"{{$hmac md5 key msg}}", "$hmac: unknown algorithm md5"},
+		{"{{$hmac sha256}}", "$hmac expects an algorithm, a key and a message"},
+		{"{{ }}", "Empty reference {{}}"},
+	}
+	for _, tt := range tests {
+		r := New(nil)
+		r.Expand(tt.input)
+		if err := r.Err(); err == nil || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("Expand(%q): expected %q, got %v", tt.input, tt.problem, err)
+		}
+	}
+}
+
+func TestExpandValue(t *testing.T) {
+	r := New(map[string]string{"genre": "FICTION", "key": "filter"})
+	value := map[string]any{
+		"{{key}}": map[string]any{"genre": "{{genre}}", "first": float64(10)},
+		"tags":    []any{"{{genre}}", true},
+	}
+	got := r.ExpandValue(value).(map[string]any)
+	filter := got["filter"].(map[string]any)
+	if filter["genre"] != "FICTION" || filter["first"] != float64(10) {
+		t.Errorf("Unexpected object: %+v", filter)
+	}
+	if tags := got["tags"].([]any); tags[0] != "FICTION" || tags[1] != true {
+		t.Errorf("Unexpected list: %+v", tags)
+	}
+}
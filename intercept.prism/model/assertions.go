@@ -0,0 +1,26 @@
+package model
+
+import "encoding/json"
+
+// A check evaluated against the response after a request completes. A failed assertion
+// marks the span and execution as failed
+type Assertion struct {
+	Name     string          `json:"name,omitempty"`                        // Label for the result, generated from the other fields when empty
+	Type     string          `json:"type"`                                  // status, header, jsonpath, xpath, regex, schema, size or latency
+	Path     string          `json:"path,omitempty"`                        // Header name, JSONPath or XPath expression
+	Operator string          `json:"operator,omitempty"`                    // eq, neq, lt, lte, gt, gte, contains, not_contains, matches, not_matches, exists or not_exists
+	Expected string          `json:"expected,omitempty"`                    // Compared as a number when both sides are numeric. Bytes for size, milliseconds for latency
+	Schema   json.RawMessage `json:"schema,omitempty" swaggertype:"object"` // JSON Schema the body must satisfy, for the schema type
+}
+
+// Outcome of an assertion, with the value it was compared against
+type AssertionResult struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message,omitempty"` // Why it failed, e.g. the schema violations or a body that is not JSON
+}
@@ -0,0 +1,102 @@
+package model
+
+// Credentials added to an outgoing request once its {{variables}} are resolved.
+// Only the fields of the chosen type are used
+type AuthConfig struct {
+	Type string `json:"type"` // basic, bearer, apikey, digest, awsv4, hmac or oauth2
+
+	// basic and digest
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// bearer
+	Token  string `json:"token,omitempty"`
+	Scheme string `json:"scheme,omitempty"` // Authorization scheme, defaults to Bearer
+
+	// apikey
+	Key   string `json:"key,omitempty"` // Header or query parameter name
+	Value string `json:"value,omitempty"`
+	In    string `json:"in,omitempty"` // "header" (default) or "query"
+
+	// awsv4
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Service         string `json:"service,omitempty"` // Signing name, e.g. execute-api, s3 or es
+
+	// hmac: signs "METHOD\nPATH?QUERY\nTIMESTAMP\nBODY" with the secret
+	Secret          string `json:"secret,omitempty"`
+	Algorithm       string `json:"algorithm,omitempty"`        // sha1, sha256 (default) or sha512
+	Encoding        string `json:"encoding,omitempty"`         // hex (default) or base64
+	SignatureHeader string `json:"signature_header,omitempty"` // Defaults to X-Signature
+	TimestampHeader string `json:"timestamp_header,omitempty"` // Unix seconds, defaults to X-Timestamp
+
+	// oauth2: an access token is fetched, cached per workspace (workspace_id is required) and sent like a bearer token
+	OAuth2 *OAuth2Config `json:"oauth2,omitempty"`
+}
+
+// How to obtain an OAuth 2.0 access token
+type OAuth2Config struct {
+	GrantType    string            `json:"grant_type"` // client_credentials, password, refresh_token or authorization_code
+	TokenURL     string            `json:"token_url"`
+	ClientID     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret,omitempty"`
+	ClientAuth   string            `json:"client_auth,omitempty"` // "basic" (default) sends the client credentials in an Authorization header, "body" as form fields
+	Scope        string            `json:"scope,omitempty"`       // Space separated
+	Audience     string            `json:"audience,omitempty"`
+	ExtraParams  map[string]string `json:"extra_params,omitempty"` // Additional form fields for the token request
+
+	// password grant
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// refresh_token grant, also used once to seed the cache
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// authorization_code grant with PKCE, started through POST /oauth2/authorize
+	AuthorizationURL string `json:"authorization_url,omitempty"`
+	RedirectURI      string `json:"redirect_uri,omitempty"` // Defaults to this server's /oauth2/callback
+}
+
+// Fetch, or read from the cache, the token for an OAuth2 configuration
+type OAuth2TokenRequest struct {
+	WorkspaceID  string       `json:"workspace_id"`
+	OAuth2       OAuth2Config `json:"oauth2"`
+	ForceRefresh bool         `json:"force_refresh,omitempty"` // Skip the cache and ask the token endpoint
+}
+
+type OAuth2TokenResponse struct {
+	StatusCode  int    `json:"status"`
+	Error       string `json:"error_msg,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	TokenType   string `json:"token_type,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"` // RFC 3339, empty when the server gave no lifetime
+	Refreshable bool   `json:"refreshable"`          // A refresh token is cached alongside
+	Source      string `json:"source,omitempty"`     // cache, fetched or refreshed
+
+	TraceID string     `json:"trace_id,omitempty"`
+	Spans   []SpanInfo `json:"spans,omitempty"`
+}
+
+// Start an authorization code flow. The user opens AuthorizationURL in a browser and the
+// provider redirects back to the callback, which exchanges the code and caches the token
+type OAuth2AuthorizeRequest struct {
+	WorkspaceID string       `json:"workspace_id"`
+	OAuth2      OAuth2Config `json:"oauth2"`
+}
+
+type OAuth2AuthorizeResponse struct {
+	StatusCode       int    `json:"status"`
+	Error            string `json:"error_msg,omitempty"`
+	AuthorizationURL string `json:"authorization_url,omitempty"`
+	State            string `json:"state,omitempty"`
+	RedirectURI      string `json:"redirect_uri,omitempty"`
+}
+
+type OAuth2ClearResponse struct {
+	StatusCode int    `json:"status"`
+	Error      string `json:"error_msg,omitempty"`
+	Cleared    int    `json:"cleared"` // Number of cached tokens dropped
+}
@@ -0,0 +1,30 @@
+package model
+
+// A cookie held in a session's cookie jar
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`              // Without a leading dot
+	Path     string `json:"path,omitempty"`      // Defaults to /
+	Expires  string `json:"expires,omitempty"`   // RFC 3339, empty for a session cookie
+	HostOnly bool   `json:"host_only"`           // Sent to Domain only, not its subdomains
+	Secure   bool   `json:"secure"`              // Sent over https and wss only
+	HttpOnly bool   `json:"http_only"`           // Informational, the data plane has no scripts
+	SameSite string `json:"same_site,omitempty"` // Informational: Lax, Strict or None
+}
+
+type CookieJarResponse struct {
+	StatusCode  int      `json:"status"`
+	Error       string   `json:"error_msg,omitempty"`
+	WorkspaceID string   `json:"workspace_id"`
+	SessionID   string   `json:"session_id"`
+	Cookies     []Cookie `json:"cookies"`
+	Removed     int      `json:"removed,omitempty"` // Cookies dropped by a delete
+}
+
+// Add a cookie to a jar, or replace the one with the same name, domain and path
+type CookieJarUpdate struct {
+	WorkspaceID string `json:"workspace_id"`
+	SessionID   string `json:"session_id"`
+	Cookie      Cookie `json:"cookie"`
+}
@@ -0,0 +1,22 @@
+package model
+
+// Pulls a value out of the response into a variable, so a later request can reference it
+// as {{variable}}, e.g. the token returned by a login call
+type Extraction struct {
+	Variable string `json:"variable"`         // Name of the variable
+	From     string `json:"from"`             // jsonpath, xpath, regex, header or field (gRPC only)
+	Path     string `json:"path"`             // JSONPath, XPath, pattern, header name or message field path such as user.tokens[0]
+	Secret   bool   `json:"secret,omitempty"` // Masked in the environment when saved, the value is never put in span tags
+}
+
+// Variables extracted from a response, and where they were saved
+type ExtractResult struct {
+	Variables map[string]string `json:"variables"`
+	Failures  []string          `json:"failures,omitempty"` // "variable: reason" for extractions that found no value
+
+	// Set when the request named an environment to save into
+	EnvironmentID string   `json:"environment_id,omitempty"`
+	Saved         bool     `json:"saved,omitempty"`
+	Readonly      []string `json:"readonly,omitempty"`   // Variables not saved because their row is read-only
+	SaveError     string   `json:"save_error,omitempty"` // Why nothing was saved
+}
@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 // Incoming GraphQL request from the Prism frontend
 type GraphQLRequest struct {
 	URL           string                 `json:"url"`
@@ -10,6 +12,57 @@ type GraphQLRequest struct {
 	RequestID     string                 `json:"request_id"`
 	CollectionID  string                 `json:"collection_id"`
 	CreatedByID   string                 `json:"created_by_id"`
+	WorkspaceID   string                 `json:"workspace_id,omitempty"` // Scopes cached OAuth2 tokens and cookie jars
+	SessionID     string                 `json:"session_id,omitempty"`   // Cookie jar shared by requests with the same workspace and session, none when empty. Requires workspace_id
+
+	// Values for {{name}} references in the URL, headers, query and variables
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// Credentials applied after templating. Secrets are never stored in span tags
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// Checks run against the response. Not evaluated for subscriptions
+	Assertions []Assertion `json:"assertions,omitempty"`
+
+	// Values pulled out of the response into variables, returned in the response and saved
+	// to SaveToEnvironment, an environment of the workspace, when it is set. Not run for
+	// subscriptions
+	Extract           []Extraction `json:"extract,omitempty"`
+	SaveToEnvironment string       `json:"save_to_environment,omitempty"`
+
+	// Send the query as-is, even when an introspected schema is cached for the endpoint.
+	// Useful for servers with directives or extensions that introspection does not expose
+	SkipValidation bool `json:"skip_validation,omitempty"`
+
+	// Send apollo-federation-include-trace: ftv1 so Apollo subgraphs return resolver timings
+	IncludeTrace bool `json:"include_trace,omitempty"`
+
+	// Transport variants. A request is a JSON POST of query unless one of these is set
+	Method         string             `json:"method,omitempty"`          // "POST" (default) or "GET" with the operation in the query string
+	PersistedQuery bool               `json:"persisted_query,omitempty"` // Automatic Persisted Queries: send the sha256 hash first and the query only if the server asks for it
+	Batch          []GraphQLOperation `json:"batch,omitempty"`           // Operations sent together as a JSON array, instead of query
+	Uploads        []GraphQLUpload    `json:"uploads,omitempty"`         // Files sent with the GraphQL multipart request spec
+
+	// Subscriptions over WebSocket (/graphql/subscribe)
+	Protocol         string         `json:"protocol,omitempty"`          // "graphql-transport-ws" (default) or the legacy "subscriptions-transport-ws"
+	ConnectionParams map[string]any `json:"connection_params,omitempty"` // Payload of connection_init, e.g. an auth token
+	MaxEvents        int            `json:"max_events,omitempty"`        // Complete the subscription after this many events
+	TimeoutMs        int64          `json:"timeout_ms,omitempty"`        // Subscription lifetime, defaults to 5m
+}
+
+// One operation of a batched GraphQL request
+type GraphQLOperation struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operation_name,omitempty"`
+}
+
+// A file for a multipart GraphQL request, placed at a variable of the operation
+type GraphQLUpload struct {
+	Path        string `json:"path"` // Object path of the variable, e.g. variables.file, variables.files.0 or 1.variables.file in a batch
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"` // Defaults to application/octet-stream
+	Content     string `json:"content"`                // base64
 }
 
 // GraphQL response returned to the Prism frontend with metrics and tracing
@@ -22,6 +75,33 @@ type GraphQLResponse struct {
 	ResponseSize int64             `json:"response_size"` // in bytes
 	RequestSize  int64             `json:"request_size"`  // in bytes
 
+	// Errors returned by the server in the response body, usually with HTTP 200
+	Errors      []GraphQLError `json:"errors,omitempty"`
+	PartialData bool           `json:"partial_data"` // data was returned alongside errors
+
+	// Transport details
+	Transport      string `json:"transport,omitempty"`       // post, get, batch or multipart
+	PersistedQuery string `json:"persisted_query,omitempty"` // hit, registered (sent again with the query) or unsupported
+	Attempts       int    `json:"attempts,omitempty"`        // HTTP requests made, 2 after a persisted query miss
+
+	// Subscription summary, sent in the final "end" event of /graphql/subscribe
+	Protocol  string `json:"protocol,omitempty"`
+	Events    int    `json:"events,omitempty"`     // next payloads received
+	EndReason string `json:"end_reason,omitempty"` // complete, max_events, timeout, client_closed, error or connection_closed
+
+	// Client-side validation against the introspected schema
+	Validated        bool                     `json:"validated"` // The query was checked before sending
+	ValidationErrors []GraphQLValidationError `json:"validation_errors,omitempty"`
+
+	// Cost of the query document, measured before sending
+	Analysis *GraphQLQueryAnalysis `json:"analysis,omitempty"`
+
+	// Results of the request's assertions, in order
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+
+	// Variables pulled out of the response
+	Extracted *ExtractResult `json:"extracted,omitempty"`
+
 	// Database record IDs
 	RequestID   string `json:"request_id,omitempty"`
 	ExecutionID string `json:"execution_id,omitempty"`
@@ -31,3 +111,125 @@ type GraphQLResponse struct {
 	SpanID  string     `json:"span_id"`
 	Spans   []SpanInfo `json:"spans"` // Local spans captured for this request
 }
+
+// An entry of the errors array of a GraphQL response
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       string            `json:"path,omitempty"` // Dotted response path, e.g. books.0.author
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Code       string            `json:"code,omitempty"`      // extensions.code, e.g. UNAUTHENTICATED
+	Operation  *int              `json:"operation,omitempty"` // Index of the operation in a batch
+	Extensions map[string]any    `json:"extensions,omitempty"`
+}
+
+// A single payload of a GraphQL subscription, emitted as an SSE "next" event
+type GraphQLSubscriptionEvent struct {
+	Index    int            `json:"index"`   // Position in the subscription, starting at 0
+	Payload  string         `json:"payload"` // The execution result with data, errors and extensions
+	Errors   []GraphQLError `json:"errors,omitempty"`
+	Size     int            `json:"size"`        // Payload size in bytes
+	Elapsed  int64          `json:"elapsed_us"`  // Since the subscription was started
+	Interval int64          `json:"interval_us"` // Since the previous event
+}
+
+// A query or variables error found before the request was sent
+type GraphQLValidationError struct {
+	Message   string            `json:"message"`
+	Rule      string            `json:"rule,omitempty"` // Name of the failed validation rule, e.g. FieldsOnCorrectType
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	Path      string            `json:"path,omitempty"`      // e.g. variable.filter.genre for variable errors
+	Operation *int              `json:"operation,omitempty"` // Index of the operation in a batch
+}
+
+// Shape and estimated cost of the operation that was sent. For a batch, depth is the deepest
+// operation and the other counts are summed
+type GraphQLQueryAnalysis struct {
+	Depth           int `json:"depth"`            // Deepest field nesting, 1 for top-level fields
+	Fields          int `json:"fields"`           // Fields selected, counting each fragment use
+	Aliases         int `json:"aliases"`          // Fields selected under a different name
+	Fragments       int `json:"fragments"`        // Distinct named fragments used
+	FragmentSpreads int `json:"fragment_spreads"` // ...Name uses
+	InlineFragments int `json:"inline_fragments"` // ... on Type uses
+	Complexity      int `json:"complexity"`       // Estimated cost, see SchemaWeighted
+
+	// The complexity uses the introspected schema: list fields multiply their selections by the
+	// first/last/limit argument, or @listSize, and @cost weights replace the default cost of 1.
+	// Without a schema the complexity is the field count
+	SchemaWeighted bool `json:"schema_weighted"`
+}
+
+// Position in the query document, 1-based
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Schema introspection of a GraphQL endpoint, sent with the same headers and auth as a
+// GraphQLRequest so the cached schema is found when the request is validated
+type GraphQLIntrospectRequest struct {
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Refresh     bool              `json:"refresh,omitempty"`      // Fetch again even when the schema is cached
+	Environment map[string]string `json:"environment,omitempty"`  // Values for {{name}} references in the URL, headers and auth
+	Auth        *AuthConfig       `json:"auth,omitempty"`         // Credentials applied after templating
+	WorkspaceID string            `json:"workspace_id,omitempty"` // Scopes cached OAuth2 tokens
+}
+
+// Introspected schema as JSON and SDL, with change detection against the previous fetch
+type GraphQLIntrospectResponse struct {
+	URL          string          `json:"url"`
+	StatusCode   int             `json:"status"`
+	Schema       json.RawMessage `json:"schema,omitempty" swaggertype:"object"` // The __schema object of the introspection result
+	SDL          string          `json:"sdl,omitempty"`
+	Hash         string          `json:"hash,omitempty"` // SHA-256 of the SDL
+	Types        int             `json:"types"`          // Named types, excluding introspection and built-in scalars
+	Cached       bool            `json:"cached"`         // Served from the cache without contacting the target
+	Changed      bool            `json:"changed"`        // The schema differs from the previous fetch
+	PreviousHash string          `json:"previous_hash,omitempty"`
+	FetchedAt    string          `json:"fetched_at,omitempty"` // RFC 3339
+	Duration     string          `json:"request_duration,omitempty"`
+	Error        string          `json:"error_msg,omitempty"`
+}
+
+// One side of a schema comparison: an endpoint, or a schema supplied as SDL or as an
+// introspection result. An endpoint's cached snapshot is used unless refresh is set
+type GraphQLSchemaSource struct {
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    *AuthConfig       `json:"auth,omitempty"`    // Credentials for the endpoint, applied after templating
+	Refresh bool              `json:"refresh,omitempty"` // Introspect the endpoint even when a snapshot is cached
+	SDL     string            `json:"sdl,omitempty"`
+	Schema  json.RawMessage   `json:"schema,omitempty" swaggertype:"object"` // An introspection __schema object
+}
+
+// Compare two schemas, e.g. the cached snapshot of an endpoint against it live
+type GraphQLSchemaDiffRequest struct {
+	Base   GraphQLSchemaSource `json:"base"`
+	Target GraphQLSchemaSource `json:"target"`
+	FailOn string              `json:"fail_on,omitempty"` // "breaking" or "dangerous": respond 409 when changes at or above this level are found
+
+	Environment map[string]string `json:"environment,omitempty"`  // Values for {{name}} references in the URLs, headers and auth of both sides
+	WorkspaceID string            `json:"workspace_id,omitempty"` // Scopes cached OAuth2 tokens
+}
+
+// A difference between two schemas
+type GraphQLSchemaChange struct {
+	Type        string `json:"type"`        // e.g. FIELD_REMOVED, ARG_TYPE_CHANGED, ENUM_VALUE_ADDED
+	Criticality string `json:"criticality"` // breaking, dangerous or safe
+	Path        string `json:"path"`        // e.g. Query.books, Query.books.first, Genre.HISTORY or @cached.ttl
+	Message     string `json:"message"`
+}
+
+// Schema comparison report. Changes are ordered breaking first, then by path
+type GraphQLSchemaDiffResponse struct {
+	BaseHash   string                `json:"base_hash,omitempty"` // SHA-256 of the SDL, as printed from introspection or as given
+	TargetHash string                `json:"target_hash,omitempty"`
+	Identical  bool                  `json:"identical"`
+	Breaking   int                   `json:"breaking"`
+	Dangerous  int                   `json:"dangerous"`
+	Safe       int                   `json:"safe"`
+	Failed     bool                  `json:"failed"` // fail_on was reached
+	Changes    []GraphQLSchemaChange `json:"changes"`
+	Duration   string                `json:"request_duration,omitempty"`
+	Error      string                `json:"error_msg,omitempty"`
+}
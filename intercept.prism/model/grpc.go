@@ -6,12 +6,58 @@ type GRPCRequest struct {
 	Service       string            `json:"service"`
 	Method        string            `json:"method"`
 	Body          string            `json:"body"`
+	Messages      []string          `json:"messages,omitempty"` // JSON messages sent in order on client and bidi streams
 	ProtoFile     string            `json:"proto_file"`
+	ProtoFiles    map[string]string `json:"proto_files,omitempty"`    // Import path -> .proto content
+	ProtoZip      string            `json:"proto_zip,omitempty"`      // Base64 zip archive of .proto files
+	Protoset      string            `json:"protoset,omitempty"`       // Base64 FileDescriptorSet, takes precedence over sources
+	UseReflection bool              `json:"use_reflection,omitempty"` // Resolve descriptors via server reflection instead of ProtoFile
 	Metadata      map[string]string `json:"metadata"`
 	UseTLS        bool              `json:"use_tls"`
+	TLS           *GRPCTLSConfig    `json:"tls,omitempty"`       // Only used when UseTLS is set
+	Authority     string            `json:"authority,omitempty"` // Overrides the :authority pseudo-header
+	Protocol      string            `json:"protocol,omitempty"`  // grpc (default), grpc-web, grpc-web-text or connect
+	Options       *GRPCCallOptions  `json:"options,omitempty"`   // Per-call settings, defaults match a plain grpc-go client
 	RequestID     string            `json:"request_id"`
 	CollectionID  string            `json:"collection_id"`
 	CreatedByID   string            `json:"created_by_id"`
+	WorkspaceID   string            `json:"workspace_id,omitempty"` // Scopes cached OAuth2 tokens
+
+	// Values for {{name}} references in the server address, metadata, body and messages
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// Credentials applied after templating. gRPC calls send basic, bearer or a header apikey
+	// as metadata; the REST side of a transcoded call takes any type
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// Checks run against the response of a unary call. Status compares the gRPC code or its
+	// name, headers include trailers and paths apply to the protojson body
+	Assertions []Assertion `json:"assertions,omitempty"`
+
+	// Values pulled out of the response of a unary call into variables, saved to
+	// SaveToEnvironment, an environment of the workspace, when it is set. field paths walk
+	// the response message by proto or JSON field names
+	Extract           []Extraction `json:"extract,omitempty"`
+	SaveToEnvironment string       `json:"save_to_environment,omitempty"`
+}
+
+// TLS settings for a gRPC target. System roots are used when no CA is given
+type GRPCTLSConfig struct {
+	CACert             string `json:"ca_cert,omitempty"`     // PEM encoded CA bundle
+	ClientCert         string `json:"client_cert,omitempty"` // PEM encoded, enables mTLS together with ClientKey
+	ClientKey          string `json:"client_key,omitempty"`  // PEM encoded
+	ServerName         string `json:"server_name,omitempty"` // SNI and certificate verification name
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// Per-call client settings, to reproduce how a production client calls the target
+type GRPCCallOptions struct {
+	DeadlineMs         int64  `json:"deadline_ms,omitempty"`           // Defaults to 30s for unary calls and 5m for streams
+	Compression        string `json:"compression,omitempty"`           // "gzip" or "identity" (default)
+	MaxSendMessageSize int    `json:"max_send_message_size,omitempty"` // in bytes, unlimited by default
+	MaxRecvMessageSize int    `json:"max_recv_message_size,omitempty"` // in bytes, 4MB by default for native gRPC
+	WaitForReady       bool   `json:"wait_for_ready,omitempty"`        // Block until the connection is ready instead of failing fast (native gRPC only)
+	UserAgent          string `json:"user_agent,omitempty"`            // Prepended to the grpc-go user agent for native gRPC
 }
 
 // gRPC response returned to the Prism frontend with metrics and tracing
@@ -26,6 +72,25 @@ type GRPCResponse struct {
 	ResponseSize     int64             `json:"response_size"` // in bytes
 	RequestSize      int64             `json:"request_size"`  // in bytes
 
+	// google.rpc.Status details attached to a failed RPC
+	ErrorDetails []GRPCErrorDetail `json:"error_details,omitempty"`
+
+	// Negotiated TLS details, only set for TLS connections
+	TLS *GRPCTLSInfo `json:"tls,omitempty"`
+
+	// Setup time spent before the RPC, not included in Duration
+	Timings *GRPCTimings `json:"timings,omitempty"`
+
+	// Results of the request's assertions, in order
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+
+	// Variables pulled out of the response
+	Extracted *ExtractResult `json:"extracted,omitempty"`
+
+	// Message counts, only set for streaming calls
+	MessagesSent     int `json:"messages_sent,omitempty"`
+	MessagesReceived int `json:"messages_received,omitempty"`
+
 	// Database record IDs
 	RequestID   string `json:"request_id,omitempty"`
 	ExecutionID string `json:"execution_id,omitempty"`
@@ -35,3 +100,199 @@ type GRPCResponse struct {
 	SpanID  string     `json:"span_id"`
 	Spans   []SpanInfo `json:"spans"` // Local spans captured for this request
 }
+
+// A single google.rpc.Status detail, e.g. google.rpc.BadRequest or google.rpc.ErrorInfo
+type GRPCErrorDetail struct {
+	Type  string `json:"type"`            // Fully-qualified message name
+	Value string `json:"value,omitempty"` // Detail as JSON, empty when the type is unknown
+	Raw   string `json:"raw,omitempty"`   // Base64 encoded bytes, only set when the type is unknown
+}
+
+// A single message sent or received on a gRPC stream, emitted as an SSE "message" event
+type GRPCStreamMessage struct {
+	Index     int    `json:"index"`     // Position within its direction, starting at 0
+	Direction string `json:"direction"` // "sent" or "received"
+	Body      string `json:"body"`
+	Size      int    `json:"size"`       // Encoded protobuf size in bytes
+	Elapsed   int64  `json:"elapsed_us"` // Since the stream was opened
+}
+
+// Setup overhead of a gRPC call, reported separately from RPC latency
+type GRPCTimings struct {
+	CompileDuration    string `json:"compile_duration"` // Descriptor compile or reflection time
+	DialDuration       string `json:"dial_duration"`    // Time until the connection was READY
+	CompileMicros      int64  `json:"compile_us"`
+	DialMicros         int64  `json:"dial_us"`
+	DescriptorCacheHit bool   `json:"descriptor_cache_hit"`
+	ConnectionReused   bool   `json:"connection_reused"`
+}
+
+// TLS connection state negotiated with the gRPC target
+type GRPCTLSInfo struct {
+	Version            string            `json:"version"`
+	CipherSuite        string            `json:"cipher_suite"`
+	ServerName         string            `json:"server_name,omitempty"`
+	NegotiatedProtocol string            `json:"negotiated_protocol,omitempty"` // ALPN, "h2" for gRPC
+	MutualTLS          bool              `json:"mutual_tls"`
+	PeerCertificates   []CertificateInfo `json:"peer_certificates,omitempty"`
+}
+
+// Summary of an X.509 certificate presented by the peer
+type CertificateInfo struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	NotBefore string   `json:"not_before"` // RFC 3339
+	NotAfter  string   `json:"not_after"`  // RFC 3339
+	DNSNames  []string `json:"dns_names,omitempty"`
+}
+
+// Services and methods a gRPC target exposes through server reflection
+type GRPCServiceList struct {
+	ServerAddress string            `json:"server_address"`
+	Services      []GRPCServiceInfo `json:"services"`
+	Error         string            `json:"error_msg,omitempty"`
+}
+
+// A single gRPC service and its methods
+type GRPCServiceInfo struct {
+	Name    string           `json:"name"` // Fully-qualified, e.g. "helloworld.Greeter"
+	Methods []GRPCMethodInfo `json:"methods"`
+}
+
+// A single gRPC method with its message types and streaming shape
+type GRPCMethodInfo struct {
+	Name            string `json:"name"`
+	FullName        string `json:"full_name"` // "/package.Service/Method"
+	InputType       string `json:"input_type"`
+	OutputType      string `json:"output_type"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+}
+
+// Skeleton request for a gRPC method's input message
+type GRPCMessageTemplate struct {
+	Service         string              `json:"service"`
+	Method          string              `json:"method"`
+	InputType       string              `json:"input_type"`
+	ClientStreaming bool                `json:"client_streaming"`
+	Body            string              `json:"body"`             // protojson with every field set to a placeholder
+	Fields          []GRPCTemplateField `json:"fields,omitempty"` // Annotations for the fields in Body, in order
+	Error           string              `json:"error_msg,omitempty"`
+}
+
+// Annotation for a single field of a message template
+type GRPCTemplateField struct {
+	Path       string   `json:"path"`            // JSON path in Body, e.g. "address.lines[]"
+	Type       string   `json:"type"`            // Scalar kind, or the full name of the message or enum
+	Label      string   `json:"label,omitempty"` // "repeated", "map" or "optional"
+	Oneof      string   `json:"oneof,omitempty"` // Name of the oneof the field belongs to
+	InBody     bool     `json:"in_body"`         // False for oneof alternatives left out of Body
+	EnumValues []string `json:"enum_values,omitempty"`
+}
+
+// Health probe against the standard grpc.health.v1.Health service
+type GRPCHealthRequest struct {
+	ServerAddress   string            `json:"server_address"`
+	Services        []string          `json:"services,omitempty"`          // Service names to check, empty means the whole server ("")
+	Watch           bool              `json:"watch,omitempty"`             // Also stream status changes via Health/Watch
+	WatchDurationMs int64             `json:"watch_duration_ms,omitempty"` // How long to watch, defaults to 5s, at most 60s
+	TimeoutMs       int64             `json:"timeout_ms,omitempty"`        // Connect and Check deadline, defaults to 10s
+	Metadata        map[string]string `json:"metadata"`
+	UseTLS          bool              `json:"use_tls"`
+	TLS             *GRPCTLSConfig    `json:"tls,omitempty"`
+	Authority       string            `json:"authority,omitempty"`
+	RequestID       string            `json:"request_id"`
+}
+
+// Result of a health probe with per-service status and connection timing
+type GRPCHealthResponse struct {
+	ServerAddress     string                `json:"server_address"`
+	Healthy           bool                  `json:"healthy"` // Every checked service is SERVING
+	StatusCode        int                   `json:"status_code"`
+	Services          []GRPCServiceHealth   `json:"services"`
+	ConnectionStates  []GRPCConnectionState `json:"connection_states"` // Connectivity transitions of the probe connection
+	HandshakeDuration string                `json:"handshake_duration"`
+	HandshakeMicros   int64                 `json:"handshake_us"`
+	Duration          string                `json:"request_duration"`
+	TLS               *GRPCTLSInfo          `json:"tls,omitempty"`
+	Error             string                `json:"error_msg,omitempty"`
+
+	// Database record IDs
+	RequestID   string `json:"request_id,omitempty"`
+	ExecutionID string `json:"execution_id,omitempty"`
+
+	// Distributed tracing
+	TraceID string     `json:"trace_id"`
+	SpanID  string     `json:"span_id"`
+	Spans   []SpanInfo `json:"spans"`
+}
+
+// Serving status of one service
+type GRPCServiceHealth struct {
+	Service    string             `json:"service"`
+	Status     string             `json:"status"`      // SERVING, NOT_SERVING, SERVICE_UNKNOWN or UNKNOWN
+	StatusCode int                `json:"status_code"` // gRPC code of the Check call
+	Error      string             `json:"error_msg,omitempty"`
+	Duration   string             `json:"duration"`
+	Updates    []GRPCHealthUpdate `json:"updates,omitempty"` // Statuses received from Watch
+	WatchError string             `json:"watch_error,omitempty"`
+}
+
+// A status received on a Health/Watch stream
+type GRPCHealthUpdate struct {
+	Status  string `json:"status"`
+	Elapsed int64  `json:"elapsed_us"` // Since the probe started
+}
+
+// A connectivity state the probe connection passed through
+type GRPCConnectionState struct {
+	State   string `json:"state"`      // IDLE, CONNECTING, READY, TRANSIENT_FAILURE or SHUTDOWN
+	Elapsed int64  `json:"elapsed_us"` // Since the probe started
+}
+
+// Translates between a gRPC method and its google.api.http REST mapping, optionally calling either side.
+// The input is either the gRPC request (service, method, body) or an HTTP request to route to its method
+type GRPCTranscodeRequest struct {
+	GRPCRequest
+	Mode       string                    `json:"mode,omitempty"`        // "" translates only, "rest", "grpc" or "compare" calls those sides
+	Binding    int                       `json:"binding,omitempty"`     // 0 for the main rule, n for additional_bindings[n-1]
+	HTTP       *GRPCTranscodeHTTPRequest `json:"http,omitempty"`        // REST call to route to its gRPC method, replaces service/method/body
+	GatewayURL string                    `json:"gateway_url,omitempty"` // Base URL of the REST side, e.g. a grpc-gateway
+	Headers    map[string]string         `json:"headers,omitempty"`     // Sent with the REST call
+}
+
+// REST side of a transcoded call
+type GRPCTranscodeHTTPRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"` // Path and query string, relative to the gateway URL
+	Body   string `json:"body,omitempty"`
+}
+
+// A google.api.http binding of a method
+type GRPCHTTPRule struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"` // Path template
+	Body         string `json:"body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Binding      int    `json:"binding"`
+}
+
+// Result of a transcoding, with the responses of whichever sides were called
+type GRPCTranscodeResponse struct {
+	Mode        string                    `json:"mode"`
+	Service     string                    `json:"service"`
+	Method      string                    `json:"method"`
+	HTTPRule    *GRPCHTTPRule             `json:"http_rule,omitempty"`
+	HTTPRequest *GRPCTranscodeHTTPRequest `json:"http_request,omitempty"`
+	GRPCBody    string                    `json:"grpc_body,omitempty"` // protojson request message
+	REST        *RestResponse             `json:"rest,omitempty"`
+	GRPC        *GRPCResponse             `json:"grpc,omitempty"`
+	Equivalent  *bool                     `json:"equivalent,omitempty"` // Only set by the compare mode
+	Differences []string                  `json:"differences,omitempty"`
+	Error       string                    `json:"error_msg,omitempty"`
+
+	// Distributed tracing, the calls are child spans of SpanID
+	TraceID string     `json:"trace_id,omitempty"`
+	SpanID  string     `json:"span_id,omitempty"`
+	Spans   []SpanInfo `json:"spans,omitempty"`
+}
@@ -9,6 +9,22 @@ type RestRequest struct {
 	RequestID    string            `json:"request_id"`
 	CollectionID string            `json:"collection_id"`
 	CreatedByID  string            `json:"created_by_id"`
+	WorkspaceID  string            `json:"workspace_id,omitempty"` // Scopes cached OAuth2 tokens and cookie jars
+	SessionID    string            `json:"session_id,omitempty"`   // Cookie jar shared by requests with the same workspace and session, none when empty. Requires workspace_id
+
+	// Values for {{name}} references in the URL, headers and body
+	Environment map[string]string `json:"environment,omitempty"`
+
+	// Credentials applied after templating. Secrets are never stored in span tags
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// Checks run against the response
+	Assertions []Assertion `json:"assertions,omitempty"`
+
+	// Values pulled out of the response into variables, returned in the response and saved
+	// to SaveToEnvironment, an environment of the workspace, when it is set
+	Extract           []Extraction `json:"extract,omitempty"`
+	SaveToEnvironment string       `json:"save_to_environment,omitempty"`
 }
 
 // API test response with metrics and tracing
@@ -21,6 +37,12 @@ type RestResponse struct {
 	ResponseSize int64             `json:"response_size"` // in bytes
 	RequestSize  int64             `json:"request_size"`  // in bytes
 
+	// Results of the request's assertions, in order
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+
+	// Variables pulled out of the response
+	Extracted *ExtractResult `json:"extracted,omitempty"`
+
 	// Database record IDs
 	RequestID   string `json:"request_id,omitempty"`
 	ExecutionID string `json:"execution_id,omitempty"`
@@ -11,6 +11,14 @@ type SpanInfo struct {
 	Duration     int64             `json:"duration"`   // Microseconds
 	Status       string            `json:"status,omitempty"`
 	Tags         map[string]string `json:"tags,omitempty"`
+	Events       []SpanEvent       `json:"events,omitempty"`
+}
+
+// SpanEvent is a timestamped annotation within a span, e.g. one message on a stream
+type SpanEvent struct {
+	Name       string            `json:"name"`
+	Timestamp  int64             `json:"timestamp"` // Unix microseconds
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // TraceResponse is the full distributed trace query result
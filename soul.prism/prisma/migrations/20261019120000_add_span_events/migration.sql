@@ -0,0 +1,2 @@
+ALTER TABLE "Span"
+ADD COLUMN "events" JSONB;
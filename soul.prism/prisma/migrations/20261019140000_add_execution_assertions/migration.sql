@@ -0,0 +1,2 @@
+ALTER TABLE "Execution"
+ADD COLUMN "assertions" JSONB;
@@ -116,7 +116,7 @@ export async function getErrorRateAnalytics(
     prisma.execution.count({
       where: {
         ...where,
-        statusCode: { gte: 400 },
+        OR: [{ statusCode: { gte: 400 } }, { errorCount: { gt: 0 } }],
       },
     }),
   ]);